@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/docker/libnetwork"
+	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/types"
 	"github.com/gorilla/mux"
 )
@@ -26,12 +28,16 @@ const (
 	epName = "{" + urlEpName + ":" + regex + "}"
 	epID   = "{" + urlEpID + ":" + regex + "}"
 	cnID   = "{" + urlCnID + ":" + regex + "}"
+	sbID   = "{" + urlSbID + ":" + regex + "}"
+	label  = "{" + urlLabel + "}"
 	// Internal URL variable name, they can be anything
 	urlNwName = "network-name"
 	urlNwID   = "network-id"
 	urlEpName = "endpoint-name"
 	urlEpID   = "endpoint-id"
 	urlCnID   = "container-id"
+	urlSbID   = "sandbox-id"
+	urlLabel  = "label"
 )
 
 // NewHTTPHandler creates and initialize the HTTP handler to serve the requests for libnetwork
@@ -77,20 +83,26 @@ func (h *httpHandler) initRouter() {
 		"GET": {
 			// Order matters
 			{"/networks", []string{"name", nwName}, procGetNetworks},
+			{"/networks", []string{"label", label}, procGetNetworks},
 			{"/networks", nil, procGetNetworks},
 			{"/networks/" + nwID, nil, procGetNetwork},
 			{"/networks/" + nwID + "/endpoints", []string{"name", epName}, procGetEndpoints},
 			{"/networks/" + nwID + "/endpoints/" + epID, nil, procGetEndpoint},
+			{"/sandboxes", []string{"container-id", cnID}, procGetSandboxes},
+			{"/sandboxes", nil, procGetSandboxes},
+			{"/sandboxes/" + sbID, nil, procGetSandbox},
 		},
 		"POST": {
 			{"/networks", nil, procCreateNetwork},
 			{"/networks/" + nwID + "/endpoints", nil, procCreateEndpoint},
-			{"/networks/" + nwID + "/endpoints/" + epID + "/containers", nil, procJoinEndpoint},
+			{"/networks/" + nwID + "/endpoints/" + epID + "/sandboxes", nil, procJoinEndpoint},
+			{"/sandboxes", nil, procCreateSandbox},
 		},
 		"DELETE": {
 			{"/networks/" + nwID, nil, procDeleteNetwork},
 			{"/networks/" + nwID + "/endpoints/" + epID, nil, procDeleteEndpoint},
-			{"/networks/id/" + nwID + "/endpoints/" + epID + "/containers/" + cnID, nil, procLeaveEndpoint},
+			{"/networks/" + nwID + "/endpoints/" + epID + "/sandboxes/" + sbID, nil, procLeaveEndpoint},
+			{"/sandboxes/" + sbID, nil, procDeleteSandbox},
 		},
 	}
 
@@ -103,6 +115,56 @@ func (h *httpHandler) initRouter() {
 			}
 		}
 	}
+
+	// The event stream does not fit the request/response model of the processors
+	h.r.Path("/events").Methods("GET").HandlerFunc(h.handleEvents)
+}
+
+// handleEvents streams the controller events to the client, one JSON object
+// per event, until the client goes away. The "type" (repeatable), "network"
+// and "driver" query parameters restrict the events which are sent.
+func (h *httpHandler) handleEvents(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := libnetwork.EventFilter{
+		NetworkID:   query.Get("network"),
+		NetworkType: query.Get("driver"),
+	}
+	for _, t := range query["type"] {
+		filter.Types = append(filter.Types, libnetwork.EventType(t))
+	}
+
+	events, cancel := h.c.Subscribe(filter)
+	defer cancel()
+
+	var gone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		gone = cn.CloseNotify()
+	}
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(buildEventResource(e)); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-gone:
+			return
+		}
+	}
 }
 
 func makeHandler(ctrl libnetwork.NetworkController, fct processor) http.HandlerFunc {
@@ -140,6 +202,7 @@ func buildNetworkResource(nw libnetwork.Network) *networkResource {
 		r.Name = nw.Name()
 		r.ID = nw.ID()
 		r.Type = nw.Type()
+		r.Labels = nw.Labels()
 		epl := nw.Endpoints()
 		r.Endpoints = make([]*endpointResource, 0, len(epl))
 		for _, e := range epl {
@@ -156,44 +219,73 @@ func buildEndpointResource(ep libnetwork.Endpoint) *endpointResource {
 		r.Name = ep.Name()
 		r.ID = ep.ID()
 		r.Network = ep.Network()
+		r.Labels = ep.Labels()
+	}
+	return r
+}
+
+func buildSandboxResource(sb libnetwork.Sandbox) *sandboxResource {
+	r := &sandboxResource{}
+	if sb != nil {
+		r.ID = sb.ID()
+		r.ContainerID = sb.ContainerID()
+		r.Key = sb.Key()
+		epl := sb.Endpoints()
+		r.Endpoints = make([]*endpointResource, 0, len(epl))
+		for _, e := range epl {
+			r.Endpoints = append(r.Endpoints, buildEndpointResource(e))
+		}
 	}
 	return r
 }
 
+func buildEventResource(e libnetwork.Event) *eventResource {
+	return &eventResource{
+		Type:         string(e.Type),
+		Time:         e.Time.UnixNano(),
+		NetworkType:  e.NetworkType,
+		NetworkID:    e.NetworkID,
+		NetworkName:  e.NetworkName,
+		EndpointID:   e.EndpointID,
+		EndpointName: e.EndpointName,
+		ContainerID:  e.ContainerID,
+	}
+}
+
 /**************
  Options Parser
 ***************/
 
-func (ej *endpointJoin) parseOptions() []libnetwork.EndpointOption {
-	var setFctList []libnetwork.EndpointOption
-	if ej.HostName != "" {
-		setFctList = append(setFctList, libnetwork.JoinOptionHostname(ej.HostName))
+func (sc *sandboxCreate) parseOptions() []libnetwork.SandboxOption {
+	var setFctList []libnetwork.SandboxOption
+	if sc.HostName != "" {
+		setFctList = append(setFctList, libnetwork.SandboxOptionHostname(sc.HostName))
 	}
-	if ej.DomainName != "" {
-		setFctList = append(setFctList, libnetwork.JoinOptionDomainname(ej.DomainName))
+	if sc.DomainName != "" {
+		setFctList = append(setFctList, libnetwork.SandboxOptionDomainname(sc.DomainName))
 	}
-	if ej.HostsPath != "" {
-		setFctList = append(setFctList, libnetwork.JoinOptionHostsPath(ej.HostsPath))
+	if sc.HostsPath != "" {
+		setFctList = append(setFctList, libnetwork.SandboxOptionHostsPath(sc.HostsPath))
 	}
-	if ej.ResolvConfPath != "" {
-		setFctList = append(setFctList, libnetwork.JoinOptionResolvConfPath(ej.ResolvConfPath))
+	if sc.ResolvConfPath != "" {
+		setFctList = append(setFctList, libnetwork.SandboxOptionResolvConfPath(sc.ResolvConfPath))
 	}
-	if ej.UseDefaultSandbox {
-		setFctList = append(setFctList, libnetwork.JoinOptionUseDefaultSandbox())
+	if sc.UseDefaultSandbox {
+		setFctList = append(setFctList, libnetwork.SandboxOptionUseDefaultSandbox())
 	}
-	if ej.DNS != nil {
-		for _, d := range ej.DNS {
-			setFctList = append(setFctList, libnetwork.JoinOptionDNS(d))
+	if sc.DNS != nil {
+		for _, d := range sc.DNS {
+			setFctList = append(setFctList, libnetwork.SandboxOptionDNS(d))
 		}
 	}
-	if ej.ExtraHosts != nil {
-		for _, e := range ej.ExtraHosts {
-			setFctList = append(setFctList, libnetwork.JoinOptionExtraHost(e.Name, e.Address))
+	if sc.ExtraHosts != nil {
+		for _, e := range sc.ExtraHosts {
+			setFctList = append(setFctList, libnetwork.SandboxOptionExtraHost(e.Name, e.Address))
 		}
 	}
-	if ej.ParentUpdates != nil {
-		for _, p := range ej.ParentUpdates {
-			setFctList = append(setFctList, libnetwork.JoinOptionParentUpdate(p.EndpointID, p.Name, p.Address))
+	if sc.ParentUpdates != nil {
+		for _, p := range sc.ParentUpdates {
+			setFctList = append(setFctList, libnetwork.SandboxOptionParentUpdate(p.EndpointID, p.Name, p.Address))
 		}
 	}
 	return setFctList
@@ -214,7 +306,12 @@ func procCreateNetwork(c libnetwork.NetworkController, vars map[string]string, b
 		return "", &responseStatus{Status: "Invalid body: " + err.Error(), StatusCode: http.StatusBadRequest}
 	}
 
-	nw, err := c.NewNetwork(create.NetworkType, create.Name, nil)
+	var setFctList []libnetwork.NetworkOption
+	if create.Labels != nil {
+		setFctList = append(setFctList, libnetwork.NetworkOptionLabels(create.Labels))
+	}
+
+	nw, err := c.NewNetwork(create.NetworkType, create.Name, setFctList...)
 	if err != nil {
 		return "", convertNetworkError(err)
 	}
@@ -240,6 +337,16 @@ func procGetNetworks(c libnetwork.NetworkController, vars map[string]string, bod
 		if errRsp.isOK() {
 			list = append(list, buildNetworkResource(nw))
 		}
+	} else if filter, queryByLabel := vars[urlLabel]; queryByLabel {
+		filter, err := url.QueryUnescape(filter)
+		if err != nil {
+			return nil, &responseStatus{Status: "Invalid label filter: " + err.Error(), StatusCode: http.StatusBadRequest}
+		}
+		for _, nw := range c.Networks() {
+			if netlabel.Match(nw.Labels(), filter) {
+				list = append(list, buildNetworkResource(nw))
+			}
+		}
 	} else {
 		for _, nw := range c.Networks() {
 			list = append(list, buildNetworkResource(nw))
@@ -267,6 +374,9 @@ func procCreateEndpoint(c libnetwork.NetworkController, vars map[string]string,
 	}
 
 	var setFctList []libnetwork.EndpointOption
+	if ec.Labels != nil {
+		setFctList = append(setFctList, libnetwork.CreateOptionLabels(ec.Labels))
+	}
 	if ec.ExposedPorts != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionExposedPorts(ec.ExposedPorts))
 	}
@@ -353,11 +463,16 @@ func procJoinEndpoint(c libnetwork.NetworkController, vars map[string]string, bo
 		return nil, errRsp
 	}
 
-	cd, err := ep.Join(ej.ContainerID, ej.parseOptions()...)
+	sb, errRsp := findSandbox(c, ej.SandboxID)
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+
+	err = ep.Join(sb, libnetwork.JoinOptionPriority(ej.Priority), libnetwork.JoinOptionDNSOptions(ej.DNSOptions...))
 	if err != nil {
 		return nil, convertNetworkError(err)
 	}
-	return cd, &successResponse
+	return nil, &successResponse
 }
 
 func procLeaveEndpoint(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
@@ -369,7 +484,12 @@ func procLeaveEndpoint(c libnetwork.NetworkController, vars map[string]string, b
 		return nil, errRsp
 	}
 
-	err := ep.Leave(vars[urlCnID])
+	sb, errRsp := findSandbox(c, vars[urlSbID])
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+
+	err := ep.Leave(sb)
 	if err != nil {
 		return nil, convertNetworkError(err)
 	}
@@ -394,6 +514,61 @@ func procDeleteEndpoint(c libnetwork.NetworkController, vars map[string]string,
 	return nil, &successResponse
 }
 
+/*****************
+ Sandbox interface
+******************/
+func procCreateSandbox(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	var create sandboxCreate
+
+	err := json.Unmarshal(body, &create)
+	if err != nil {
+		return "", &responseStatus{Status: "Invalid body: " + err.Error(), StatusCode: http.StatusBadRequest}
+	}
+
+	sb, err := c.NewSandbox(create.ContainerID, create.parseOptions()...)
+	if err != nil {
+		return "", convertNetworkError(err)
+	}
+
+	return sb.ID(), &createdResponse
+}
+
+func procGetSandbox(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	sb, errRsp := findSandbox(c, vars[urlSbID])
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+	return buildSandboxResource(sb), &successResponse
+}
+
+func procGetSandboxes(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	var list []*sandboxResource
+
+	// If query parameter is specified, return a filtered collection
+	containerID, queryByContainer := vars[urlCnID]
+	for _, sb := range c.Sandboxes() {
+		if !queryByContainer || sb.ContainerID() == containerID {
+			list = append(list, buildSandboxResource(sb))
+		}
+	}
+
+	return list, &successResponse
+}
+
+func procDeleteSandbox(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	sb, errRsp := findSandbox(c, vars[urlSbID])
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+
+	err := sb.Delete()
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return nil, &successResponse
+}
+
 /***********
   Utilities
 ************/
@@ -472,6 +647,17 @@ func findEndpoint(c libnetwork.NetworkController, ns, es string, nwBy, epBy int)
 	return ep, &successResponse
 }
 
+func findSandbox(c libnetwork.NetworkController, id string) (libnetwork.Sandbox, *responseStatus) {
+	sb, err := c.SandboxByID(id)
+	if err != nil {
+		if _, ok := err.(libnetwork.ErrNoSuchSandbox); ok {
+			return nil, &responseStatus{Status: "Resource not found: Sandbox", StatusCode: http.StatusNotFound}
+		}
+		return nil, &responseStatus{Status: err.Error(), StatusCode: http.StatusBadRequest}
+	}
+	return sb, &successResponse
+}
+
 func convertNetworkError(err error) *responseStatus {
 	var code int
 	switch err.(type) {
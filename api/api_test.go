@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
 	"testing"
 
@@ -46,10 +47,18 @@ func i2e(i interface{}) *endpointResource {
 	return s
 }
 
-func i2c(i interface{}) *libnetwork.ContainerData {
-	s, ok := i.(*libnetwork.ContainerData)
+func i2sb(i interface{}) *sandboxResource {
+	s, ok := i.(*sandboxResource)
 	if !ok {
-		panic(fmt.Sprintf("Failed i2c for %v", i))
+		panic(fmt.Sprintf("Failed i2sb for %v", i))
+	}
+	return s
+}
+
+func i2sbL(i interface{}) []*sandboxResource {
+	s, ok := i.([]*sandboxResource)
+	if !ok {
+		panic(fmt.Sprintf("Failed i2sbL for %v", i))
 	}
 	return s
 }
@@ -85,7 +94,7 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func TestJoinOptionParser(t *testing.T) {
+func TestSandboxOptionParser(t *testing.T) {
 	hn := "host1"
 	dn := "docker.com"
 	hp := "/etc/hosts"
@@ -94,7 +103,7 @@ func TestJoinOptionParser(t *testing.T) {
 	ehs := []endpointExtraHost{endpointExtraHost{Name: "extra1", Address: "172.28.9.1"}, endpointExtraHost{Name: "extra2", Address: "172.28.9.2"}}
 	pus := []endpointParentUpdate{endpointParentUpdate{EndpointID: "abc123def456", Name: "serv1", Address: "172.28.30.123"}}
 
-	ej := endpointJoin{
+	sc := sandboxCreate{
 		HostName:          hn,
 		DomainName:        dn,
 		HostsPath:         hp,
@@ -105,8 +114,8 @@ func TestJoinOptionParser(t *testing.T) {
 		UseDefaultSandbox: true,
 	}
 
-	if len(ej.parseOptions()) != 10 {
-		t.Fatalf("Failed to generate all libnetwork.EndpointJoinOption methods libnetwork.EndpointJoinOption method")
+	if len(sc.parseOptions()) != 10 {
+		t.Fatalf("Failed to generate all libnetwork.SandboxOption methods")
 	}
 
 }
@@ -128,7 +137,23 @@ func TestJson(t *testing.T) {
 		t.Fatalf("Incorrect networkCreate after json encoding/deconding: %v", ncp)
 	}
 
-	jl := endpointJoin{ContainerID: "abcdef456789"}
+	sc := sandboxCreate{ContainerID: "abcdef456789"}
+	b, err = json.Marshal(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scd sandboxCreate
+	err = json.Unmarshal(b, &scd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.ContainerID != scd.ContainerID {
+		t.Fatalf("Incorrect sandboxCreate after json encoding/deconding: %v", scd)
+	}
+
+	jl := endpointJoin{SandboxID: "0123456789abcdef", Priority: 2, DNSOptions: []string{"ndots:5", "rotate"}}
 	b, err = json.Marshal(jl)
 	if err != nil {
 		t.Fatal(err)
@@ -140,7 +165,7 @@ func TestJson(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if jl.ContainerID != jld.ContainerID {
+	if !reflect.DeepEqual(jl, jld) {
 		t.Fatalf("Incorrect endpointJoin after json encoding/deconding: %v", jld)
 	}
 }
@@ -735,8 +760,16 @@ func TestJoinLeave(t *testing.T) {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 
-	cid := "abcdefghi"
-	jl := endpointJoin{ContainerID: cid}
+	sbb, err := json.Marshal(sandboxCreate{ContainerID: "abcdefghi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, errRsp := procCreateSandbox(c, nil, sbb)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	jl := endpointJoin{SandboxID: i2s(sid)}
 	jlb, err := json.Marshal(jl)
 	if err != nil {
 		t.Fatal(err)
@@ -764,72 +797,73 @@ func TestJoinLeave(t *testing.T) {
 	}
 
 	vars[urlEpName] = "endpoint"
-	cdi, errRsp := procJoinEndpoint(c, vars, jlb)
+	_, errRsp = procJoinEndpoint(c, vars, jlb)
 	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	_, errRsp = procJoinEndpoint(c, vars, jlb)
+	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 
-	cd := i2c(cdi)
-	if cd.SandboxKey == "" {
+	vars[urlSbID] = i2s(sid)
+	sbi, errRsp := procGetSandbox(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	sb := i2sb(sbi)
+	if sb.Key == "" {
 		t.Fatalf("Empty sandbox key")
 	}
+	if len(sb.Endpoints) != 1 || sb.Endpoints[0].Name != "endpoint" {
+		t.Fatalf("Unexpected endpoints for the sandbox: %v", sb.Endpoints)
+	}
+
 	_, errRsp = procDeleteEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 
 	vars[urlNwName] = "network2"
-	_, errRsp = procLeaveEndpoint(c, vars, vbad)
-	if errRsp == &successResponse {
-		t.Fatalf("Expected failure, got: %v", errRsp)
-	}
-	_, errRsp = procLeaveEndpoint(c, vars, bad)
-	if errRsp == &successResponse {
-		t.Fatalf("Expected failure, got: %v", errRsp)
-	}
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 	vars = make(map[string]string)
 	vars[urlNwName] = ""
 	vars[urlEpName] = ""
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	vars[urlSbID] = i2s(sid)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 	vars[urlNwName] = "network"
 	vars[urlEpName] = ""
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 	vars[urlEpName] = "2epoint"
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
-	if errRsp == &successResponse {
-		t.Fatalf("Expected failure, got: %v", errRsp)
-	}
-	vars[urlEpName] = "epoint"
-	vars[urlCnID] = "who"
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 
-	delete(vars, urlCnID)
 	vars[urlEpName] = "endpoint"
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	vars[urlSbID] = "who"
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
 
-	vars[urlCnID] = cid
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	vars[urlSbID] = i2s(sid)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp != &successResponse {
 		t.Fatalf("Unexepected failure: %v", errRsp)
 	}
 
-	_, errRsp = procLeaveEndpoint(c, vars, jlb)
+	_, errRsp = procLeaveEndpoint(c, vars, nil)
 	if errRsp == &successResponse {
 		t.Fatalf("Expected failure, got: %v", errRsp)
 	}
@@ -838,6 +872,103 @@ func TestJoinLeave(t *testing.T) {
 	if errRsp != &successResponse {
 		t.Fatalf("Unexepected failure: %v", errRsp)
 	}
+
+	_, errRsp = procDeleteSandbox(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+}
+
+func TestSandboxes(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+
+	_, errRsp := procCreateSandbox(c, vars, []byte("bad data"))
+	if errRsp == &createdResponse {
+		t.Fatalf("Expected failure, got: %v", errRsp)
+	}
+
+	bad, err := json.Marshal(sandboxCreate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procCreateSandbox(c, vars, bad)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest for an empty container id, got: %v", errRsp)
+	}
+
+	ids := make(map[string]string)
+	for _, cid := range []string{"container1", "container2"} {
+		sb, err := json.Marshal(sandboxCreate{ContainerID: cid, HostName: cid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, errRsp := procCreateSandbox(c, vars, sb)
+		if errRsp != &createdResponse {
+			t.Fatalf("Unexepected failure: %v", errRsp)
+		}
+		ids[cid] = i2s(id)
+	}
+
+	dup, err := json.Marshal(sandboxCreate{ContainerID: "container1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procCreateSandbox(c, vars, dup)
+	if errRsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected StatusForbidden for a second sandbox of the container, got: %v", errRsp)
+	}
+
+	list, errRsp := procGetSandboxes(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	if len(i2sbL(list)) != 2 {
+		t.Fatalf("Expected 2 sandboxes, got: %v", list)
+	}
+
+	vars[urlCnID] = "container2"
+	list, errRsp = procGetSandboxes(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	sbl := i2sbL(list)
+	if len(sbl) != 1 || sbl[0].ID != ids["container2"] || sbl[0].ContainerID != "container2" {
+		t.Fatalf("Unexpected sandboxes for container2: %v", sbl)
+	}
+	delete(vars, urlCnID)
+
+	vars[urlSbID] = "unknown"
+	_, errRsp = procGetSandbox(c, vars, nil)
+	if errRsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected StatusNotFound, got: %v", errRsp)
+	}
+	_, errRsp = procDeleteSandbox(c, vars, nil)
+	if errRsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected StatusNotFound, got: %v", errRsp)
+	}
+
+	for _, id := range ids {
+		vars[urlSbID] = id
+		_, errRsp = procDeleteSandbox(c, vars, nil)
+		if errRsp != &successResponse {
+			t.Fatalf("Unexepected failure: %v", errRsp)
+		}
+	}
+
+	list, errRsp = procGetSandboxes(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	if len(i2sbL(list)) != 0 {
+		t.Fatalf("Expected no sandboxes, got: %v", list)
+	}
 }
 
 func TestFindEndpointUtil(t *testing.T) {
@@ -1448,6 +1579,63 @@ func (noc *notclassified) Error() string {
 	return "I am a non classified error"
 }
 
+// streamWriter is a http.ResponseWriter which pipes the response body to a
+// reader and lets the test simulate the client going away
+type streamWriter struct {
+	header http.Header
+	status chan int
+	gone   chan bool
+	*io.PipeWriter
+}
+
+func (w *streamWriter) Header() http.Header      { return w.header }
+func (w *streamWriter) WriteHeader(status int)   { w.status <- status }
+func (w *streamWriter) CloseNotify() <-chan bool { return w.gone }
+
+func TestEvents(t *testing.T) {
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	w := &streamWriter{header: http.Header{}, status: make(chan int, 1), gone: make(chan bool), PipeWriter: pw}
+	req, err := http.NewRequest("GET", "/events?type=network-create&driver=null", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		NewHTTPHandler(c)(w, req)
+		pw.Close()
+		close(done)
+	}()
+
+	if status := <-w.status; status != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", status)
+	}
+
+	// The subscription is in place once the headers are written
+	n, err := c.NewNetwork("null", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Delete()
+
+	var e eventResource
+	if err := json.NewDecoder(pr).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Type != string(libnetwork.EventNetworkCreate) || e.NetworkID != n.ID() || e.NetworkName != "network" {
+		t.Fatalf("Unexpected event: %+v", e)
+	}
+
+	close(w.gone)
+	<-done
+}
+
 func TestErrorConversion(t *testing.T) {
 	if convertNetworkError(new(bre)).StatusCode != http.StatusBadRequest {
 		t.Fatalf("Failed to recognize BadRequest error")
@@ -1481,3 +1669,95 @@ func TestErrorConversion(t *testing.T) {
 		t.Fatalf("Failed to recognize not classified error as Internal error")
 	}
 }
+
+func TestNetworkLabels(t *testing.T) {
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nc := range []networkCreate{
+		{Name: "front", NetworkType: "null", Labels: map[string]string{"tier": "front", "public": ""}},
+		{Name: "back", NetworkType: "null", Labels: map[string]string{"tier": "back"}},
+		{Name: "nolabels", NetworkType: "null"},
+	} {
+		body, err := json.Marshal(nc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errRsp := procCreateNetwork(c, nil, body); errRsp != &createdResponse {
+			t.Fatalf("Unexepected failure: %v", errRsp)
+		}
+	}
+	defer func() {
+		for _, n := range c.Networks() {
+			n.Delete()
+		}
+	}()
+
+	ec := endpointCreate{Name: "ep", Labels: map[string]string{"role": "db"}}
+	body, err := json.Marshal(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{urlNwName: "back"}
+	if _, errRsp := procCreateEndpoint(c, vars, body); errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	defer func() {
+		if ep, err := c.NetworkByName("back"); err == nil {
+			for _, e := range ep.Endpoints() {
+				e.Delete()
+			}
+		}
+	}()
+
+	vars[urlEpName] = "ep"
+	i, errRsp := procGetEndpoint(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	if epr := i.(*endpointResource); epr.Labels["role"] != "db" {
+		t.Fatalf("Unexpected endpoint labels: %v", epr.Labels)
+	}
+
+	for filter, expected := range map[string][]string{
+		"tier%3Dfront": {"front"},
+		"tier=back":    {"back"},
+		"tier":         {"front", "back"},
+		"public":       {"front"},
+		"tier%3Dnone":  nil,
+	} {
+		req, err := http.NewRequest("GET", "/networks?label="+filter, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newWriter()
+		NewHTTPHandler(c)(w, req)
+		if w.statusCode != http.StatusOK {
+			t.Fatalf("Unexpected status code %d for filter %s", w.statusCode, filter)
+		}
+
+		var list []*networkResource
+		if err := json.Unmarshal(w.body, &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != len(expected) {
+			t.Fatalf("Expected %v for filter %s, got %d networks", expected, filter, len(list))
+		}
+		for _, name := range expected {
+			found := false
+			for _, nr := range list {
+				if nr.Name == name {
+					found = true
+					if nr.Labels["tier"] != name {
+						t.Fatalf("Unexpected labels for %s: %v", name, nr.Labels)
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("Network %s not returned for filter %s", name, filter)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ type networkResource struct {
 	Name      string
 	ID        string
 	Type      string
+	Labels    map[string]string
 	Endpoints []*endpointResource
 }
 
@@ -19,6 +20,27 @@ type endpointResource struct {
 	Name    string
 	ID      string
 	Network string
+	Labels  map[string]string
+}
+
+// sandboxResource is the body of the "get sandbox" http response message
+type sandboxResource struct {
+	ID          string
+	ContainerID string
+	Key         string
+	Endpoints   []*endpointResource
+}
+
+// eventResource is the body of each message of the "events" http response stream
+type eventResource struct {
+	Type         string
+	Time         int64
+	NetworkType  string
+	NetworkID    string
+	NetworkName  string
+	EndpointID   string
+	EndpointName string
+	ContainerID  string
 }
 
 /***********
@@ -29,18 +51,27 @@ type endpointResource struct {
 type networkCreate struct {
 	Name        string
 	NetworkType string
+	Labels      map[string]string
 	Options     map[string]interface{}
 }
 
 // endpointCreate represents the body of the "create endpoint" http request message
 type endpointCreate struct {
 	Name         string
+	Labels       map[string]string
 	ExposedPorts []types.TransportPort
 	PortMapping  []types.PortBinding
 }
 
-// endpointJoin represents the expected body of the "join endpoint" or "leave endpoint" http request messages
+// endpointJoin represents the expected body of the "join endpoint" http request message
 type endpointJoin struct {
+	SandboxID  string
+	Priority   int
+	DNSOptions []string
+}
+
+// sandboxCreate represents the body of the "create sandbox" http request message
+type sandboxCreate struct {
 	ContainerID       string
 	HostName          string
 	DomainName        string
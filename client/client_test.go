@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
 
 	_ "github.com/docker/libnetwork/netutils"
@@ -102,6 +103,44 @@ func TestClientNetworkLs(t *testing.T) {
 	}
 }
 
+func TestClientNetworkLabels(t *testing.T) {
+	var (
+		out, errOut bytes.Buffer
+		lastPath    string
+		lastData    interface{}
+	)
+	cFunc := func(method, path string, data interface{}, headers map[string][]string) (io.ReadCloser, int, error) {
+		lastPath, lastData = path, data
+		return nopCloser{bytes.NewBufferString("")}, 200, nil
+	}
+	cli := NewNetworkCli(&out, &errOut, cFunc)
+
+	err := cli.Cmd("docker", "network", "create", "-l", "tier=front", "--label=public", "test")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nc, ok := lastData.(networkCreate)
+	if !ok || nc.Labels["tier"] != "front" || len(nc.Labels) != 2 {
+		t.Fatalf("Unexpected create body: %v", lastData)
+	}
+	if _, ok := nc.Labels["public"]; !ok {
+		t.Fatalf("Missing label in create body: %v", nc.Labels)
+	}
+
+	err = cli.Cmd("docker", "network", "ls", "--filter=label=tier=front")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if lastPath != "/networks?label=tier%3Dfront" {
+		t.Fatalf("Unexpected path %s", lastPath)
+	}
+
+	err = cli.Cmd("docker", "network", "ls", "-f", "name=test")
+	if err == nil {
+		t.Fatal("Passing an unsupported filter must fail")
+	}
+}
+
 func TestClientNetworkInfo(t *testing.T) {
 	var out, errOut bytes.Buffer
 	info := "dummy info"
@@ -152,3 +191,38 @@ func TestClientNetworkCreateMissingArgument(t *testing.T) {
 	}
 }
 */
+
+func TestClientEvents(t *testing.T) {
+	var out, errOut bytes.Buffer
+	var path string
+	cFunc := func(method, p string, data interface{}, headers map[string][]string) (io.ReadCloser, int, error) {
+		path = p
+		stream := `{"Type":"network-create","NetworkType":"bridge","NetworkID":"abc","NetworkName":"net1"}
+{"Type":"endpoint-join","NetworkID":"abc","NetworkName":"net1","EndpointID":"def","EndpointName":"ep1","ContainerID":"c1"}
+`
+		return nopCloser{bytes.NewBufferString(stream)}, 200, nil
+	}
+	cli := NewNetworkCli(&out, &errOut, cFunc)
+
+	err := cli.Cmd("docker", "events", "--type=network-create,endpoint-join", "--network=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/events?network=abc&type=network-create&type=endpoint-join" {
+		t.Fatalf("Unexpected request path %s", path)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events. Got:\n%s", out.String())
+	}
+
+	if !strings.Contains(lines[0], "network-create driver=bridge network=net1(abc)") {
+		t.Fatalf("Unexpected output for the first event: %s", lines[0])
+	}
+
+	if !strings.Contains(lines[1], "endpoint-join network=net1(abc) endpoint=ep1(def) container=c1") {
+		t.Fatalf("Unexpected output for the second event: %s", lines[1])
+	}
+}
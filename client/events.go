@@ -0,0 +1,76 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CmdEvents handles the Events UI, printing the controller events as they happen
+func (cli *NetworkCli) CmdEvents(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "events", "", "Streams the network and endpoint events from the daemon", false)
+	flType := cmd.String([]string{"t", "-type"}, "", "Comma separated list of the event types to show")
+	flNetwork := cmd.String([]string{"n", "-network"}, "", "Only show the events of the network with this ID")
+	flDriver := cmd.String([]string{"d", "-driver"}, "", "Only show the events of the networks of this driver")
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *flType != "" {
+		for _, t := range strings.Split(*flType, ",") {
+			query.Add("type", strings.TrimSpace(t))
+		}
+	}
+	if *flNetwork != "" {
+		query.Set("network", *flNetwork)
+	}
+	if *flDriver != "" {
+		query.Set("driver", *flDriver)
+	}
+
+	path := "/events"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	stream, _, err := cli.call("GET", path, nil, nil)
+	if err != nil {
+		fmt.Fprintf(cli.err, "%s", err.Error())
+		return err
+	}
+	defer stream.Close()
+
+	dec := json.NewDecoder(stream)
+	for {
+		var e eventResource
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fmt.Fprintln(cli.out, formatEvent(&e))
+	}
+}
+
+func formatEvent(e *eventResource) string {
+	line := fmt.Sprintf("%s %s", time.Unix(0, e.Time).Format(time.RFC3339Nano), e.Type)
+	if e.NetworkType != "" {
+		line += " driver=" + e.NetworkType
+	}
+	if e.NetworkID != "" {
+		line += fmt.Sprintf(" network=%s(%s)", e.NetworkName, e.NetworkID)
+	}
+	if e.EndpointID != "" {
+		line += fmt.Sprintf(" endpoint=%s(%s)", e.EndpointName, e.EndpointID)
+	}
+	if e.ContainerID != "" {
+		line += " container=" + e.ContainerID
+	}
+	return line
+}
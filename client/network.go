@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
+	"strings"
 
 	flag "github.com/docker/docker/pkg/mflag"
+	"github.com/docker/libnetwork/netlabel"
 )
 
 const (
@@ -17,6 +20,30 @@ type command struct {
 	description string
 }
 
+// labelsOpt collects the values of a repeatable key=value label flag
+type labelsOpt []string
+
+func (l *labelsOpt) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labelsOpt) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *labelsOpt) toMap() map[string]string {
+	if len(*l) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(*l))
+	for _, label := range *l {
+		k, v := netlabel.Split(label)
+		labels[k] = v
+	}
+	return labels
+}
+
 var (
 	networkCommands = []command{
 		{"create", "Create a network"},
@@ -42,6 +69,8 @@ func (cli *NetworkCli) CmdNetwork(chain string, args ...string) error {
 func (cli *NetworkCli) CmdNetworkCreate(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "create", "NETWORK-NAME", "Creates a new network with a name specified by the user", false)
 	flDriver := cmd.String([]string{"d", "-driver"}, "null", "Driver to manage the Network")
+	var flLabels labelsOpt
+	cmd.Var(&flLabels, []string{"l", "-label"}, "Set a key=value label on the Network")
 	cmd.Require(flag.Min, 1)
 	err := cmd.ParseFlags(args, true)
 	if err != nil {
@@ -51,7 +80,7 @@ func (cli *NetworkCli) CmdNetworkCreate(chain string, args ...string) error {
 		*flDriver = nullNetType
 	}
 
-	nc := networkCreate{Name: cmd.Arg(0), NetworkType: *flDriver}
+	nc := networkCreate{Name: cmd.Arg(0), NetworkType: *flDriver, Labels: flLabels.toMap()}
 
 	obj, _, err := readBody(cli.call("POST", "/networks", nc, nil))
 	if err != nil {
@@ -86,11 +115,24 @@ func (cli *NetworkCli) CmdNetworkRm(chain string, args ...string) error {
 // CmdNetworkLs handles Network List UI
 func (cli *NetworkCli) CmdNetworkLs(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "ls", "", "Lists all the networks created by the user", false)
+	flFilter := cmd.String([]string{"f", "-filter"}, "", "Only list the networks matching the filter, in the label=key[=value] form")
 	err := cmd.ParseFlags(args, true)
 	if err != nil {
 		return err
 	}
-	obj, _, err := readBody(cli.call("GET", "/networks", nil, nil))
+
+	path := "/networks"
+	if *flFilter != "" {
+		kind, filter := netlabel.Split(*flFilter)
+		if kind != "label" || filter == "" {
+			err := fmt.Errorf("Invalid filter: %s", *flFilter)
+			fmt.Fprintf(cli.err, "%s", err.Error())
+			return err
+		}
+		path += "?" + url.Values{"label": []string{filter}}.Encode()
+	}
+
+	obj, _, err := readBody(cli.call("GET", path, nil, nil))
 	if err != nil {
 		fmt.Fprintf(cli.err, "%s", err.Error())
 		return err
@@ -11,6 +11,7 @@ type networkResource struct {
 	Name      string
 	ID        string
 	Type      string
+	Labels    map[string]string
 	Endpoints []*endpointResource
 }
 
@@ -19,9 +20,22 @@ type endpointResource struct {
 	Name    string
 	ID      string
 	Network string
+	Labels  map[string]string
 	Info    sandbox.Info
 }
 
+// eventResource is the body of each message of the "events" http response stream
+type eventResource struct {
+	Type         string
+	Time         int64
+	NetworkType  string
+	NetworkID    string
+	NetworkName  string
+	EndpointID   string
+	EndpointName string
+	ContainerID  string
+}
+
 /***********
   Body types
   ************/
@@ -30,5 +44,6 @@ type endpointResource struct {
 type networkCreate struct {
 	Name        string
 	NetworkType string
+	Labels      map[string]string
 	Options     map[string]interface{}
 }
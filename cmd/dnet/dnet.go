@@ -106,7 +106,7 @@ type dnetConnection struct {
 }
 
 func (d *dnetConnection) dnetDaemon() error {
-	controller, err := libnetwork.New()
+	controller, err := libnetwork.New(libnetwork.OptionLocalDataStore(*flDataDir))
 	if err != nil {
 		fmt.Println("Error starting dnetDaemon :", err)
 		return err
@@ -115,6 +115,7 @@ func (d *dnetConnection) dnetDaemon() error {
 	r := mux.NewRouter().StrictSlash(false)
 	post := r.PathPrefix("/networks").Subrouter()
 	post.Methods("GET", "PUT", "POST", "DELETE").HandlerFunc(httpHandler)
+	r.Path("/events").Methods("GET").HandlerFunc(httpHandler)
 	return http.ListenAndServe(d.addr, r)
 }
 
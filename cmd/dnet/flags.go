@@ -5,6 +5,7 @@ import (
 	"os"
 
 	flag "github.com/docker/docker/pkg/mflag"
+	"github.com/docker/libnetwork/datastore"
 )
 
 type command struct {
@@ -20,9 +21,11 @@ var (
 	flLogLevel = flag.String([]string{"l", "-log-level"}, "info", "Set the logging level")
 	flDebug    = flag.Bool([]string{"D", "-debug"}, false, "Enable debug mode")
 	flHelp     = flag.Bool([]string{"h", "-help"}, false, "Print usage")
+	flDataDir  = flag.String([]string{"-data-dir"}, datastore.DefaultLocalPath, "Directory the daemon persists its state to")
 
 	dnetCommands = []command{
 		{"network", "Network management commands"},
+		{"events", "Stream the network events"},
 	}
 )
 
@@ -43,13 +43,19 @@ func main() {
 		return
 	}
 
-	// A container can join the endpoint by providing the container ID to the join
-	// api which returns the sandbox key which can be used to access the sandbox
-	// created for the container during join.
-	// Join acceps Variadic arguments which will be made use of by libnetwork and Drivers
-	_, err = ep.Join("container1",
-		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"))
+	// Create the sandbox for the container. The sandbox owns the network
+	// namespace and the hosts and resolv.conf files of the container.
+	// NewSandbox accepts Variadic optional arguments which libnetwork can make use of.
+	sbx, err := controller.NewSandbox("container1",
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"))
+	if err != nil {
+		return
+	}
+
+	// A sandbox can join the endpoint via the join api.
+	// Join accepts Variadic arguments which libnetwork and Drivers can use.
+	err = ep.Join(sbx)
 	if err != nil {
 		return
 	}
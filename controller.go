@@ -32,13 +32,19 @@ create network namespaces and allocate interfaces for containers to use.
                 return
         }
 
-        // A container can join the endpoint by providing the container ID to the join
-        // api which returns the sandbox key which can be used to access the sandbox
-        // created for the container during join.
-        // Join acceps Variadic arguments which will be made use of by libnetwork and Drivers
-        _, err = ep.Join("container1",
-                libnetwork.JoinOptionHostname("test"),
-                libnetwork.JoinOptionDomainname("docker.io"))
+        // Create the sandbox for the container. The sandbox owns the network
+        // namespace and the hosts and resolv.conf files of the container.
+        // NewSandbox accepts Variadic optional arguments which libnetwork can make use of.
+        sbx, err := controller.NewSandbox("container1",
+                libnetwork.SandboxOptionHostname("test"),
+                libnetwork.SandboxOptionDomainname("docker.io"))
+        if err != nil {
+                return
+        }
+
+        // A sandbox can join the endpoint via the join api.
+        // Join accepts Variadic arguments which libnetwork and Drivers can use.
+        err = ep.Join(sbx)
         if err != nil {
                 return
         }
@@ -46,11 +52,18 @@ create network namespaces and allocate interfaces for containers to use.
 package libnetwork
 
 import (
+	"fmt"
+	"net"
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/plugins"
 	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/resolvconf"
 	"github.com/docker/libnetwork/sandbox"
 	"github.com/docker/libnetwork/types"
 )
@@ -62,7 +75,6 @@ type NetworkController interface {
 	ConfigureNetworkDriver(networkType string, options map[string]interface{}) error
 
 	// Create a new network. The options parameter carries network specific options.
-	// Labels support will be added in the near future.
 	NewNetwork(networkType, name string, options ...NetworkOption) (Network, error)
 
 	// Networks returns the list of Network(s) managed by this controller.
@@ -76,12 +88,50 @@ type NetworkController interface {
 
 	// NetworkByID returns the Network which has the passed id. If not found, the error ErrNoSuchNetwork is returned.
 	NetworkByID(id string) (Network, error)
+
+	// NewSandbox creates a new sandbox for the passed container id
+	NewSandbox(containerID string, options ...SandboxOption) (Sandbox, error)
+
+	// Sandboxes returns the list of Sandbox(es) managed by this controller.
+	Sandboxes() []Sandbox
+
+	// WalkSandboxes uses the provided function to walk the Sandbox(es) managed by this controller.
+	WalkSandboxes(walker SandboxWalker)
+
+	// SandboxByID returns the Sandbox which has the passed id. If not found, the error ErrNoSuchSandbox is returned.
+	SandboxByID(id string) (Sandbox, error)
+
+	// DriverCapability returns the capability the driver for the specified network type registered with.
+	DriverCapability(networkType string) (driverapi.Capability, error)
+
+	// Subscribe returns a channel on which the events matching the filter are delivered,
+	// and a function which cancels the subscription and closes the channel.
+	Subscribe(filter EventFilter) (<-chan Event, func())
+
+	// PeerAdd adds to the network with the passed id the endpoint of another host, or
+	// updates it. The driver of the network must implement driverapi.PeerDriver.
+	PeerAdd(networkID string, peer *driverapi.Peer) error
+
+	// PeerDelete removes the endpoint of another host with the passed address from the network.
+	PeerDelete(networkID string, ip net.IP) error
+
+	// Peers returns the local and remote endpoints known to the driver of the network. The
+	// local ones are the ones to advertise to the other hosts of the network.
+	Peers(networkID string) ([]*driverapi.Peer, error)
+
+	// Stop stops the background activities of the controller, such as watching the host
+	// resolv.conf. The networks and sandboxes are left in place.
+	Stop()
 }
 
 // NetworkWalker is a client provided function which will be used to walk the Networks.
 // When the function returns true, the walk will stop.
 type NetworkWalker func(nw Network) bool
 
+// SandboxWalker is a client provided function which will be used to walk the Sandboxes.
+// When the function returns true, the walk will stop.
+type SandboxWalker func(sb Sandbox) bool
+
 type sandboxData struct {
 	sandbox sandbox.Sandbox
 	refCnt  int
@@ -92,44 +142,241 @@ type endpointTable map[types.UUID]*endpoint
 type sandboxTable map[string]*sandboxData
 
 type controller struct {
-	networks  networkTable
-	drivers   driverTable
-	sandboxes sandboxTable
+	networks           networkTable
+	drivers            driverTable
+	ipams              ipamTable
+	sandboxes          sandboxTable
+	containerSandboxes containerSandboxTable
+	store              datastore.DataStore
+	localStore         bool
+	storePath          string
+	watchResolvConf    bool
+	resolvConfWatcher  *resolvconf.Watcher
+	events             *eventBus
 	sync.Mutex
 }
 
-// New creates a new instance of network controller.
-func New() (NetworkController, error) {
+// ControllerOption is a option setter function type used to pass various options to
+// New method. The various setter functions of type ControllerOption are
+// provided by libnetwork, they look like OptionXXXX(...)
+type ControllerOption func(c *controller)
+
+// OptionDataStore function returns an option setter for the datastore the
+// controller persists its state to and restores it from.
+func OptionDataStore(ds datastore.DataStore) ControllerOption {
+	return func(c *controller) {
+		c.store = ds
+	}
+}
+
+// OptionLocalDataStore function returns an option setter for persisting the
+// controller state to a local file-backed datastore rooted at the passed
+// directory. If dir is empty, datastore.DefaultLocalPath is used.
+func OptionLocalDataStore(dir string) ControllerOption {
+	return func(c *controller) {
+		c.localStore = true
+		c.storePath = dir
+	}
+}
+
+// OptionWatchResolvConf function returns an option setter for propagating
+// the changes of the host resolv.conf to the resolv.conf of the sandboxes
+// using the host DNS configuration, until the controller is stopped.
+func OptionWatchResolvConf() ControllerOption {
+	return func(c *controller) {
+		c.watchResolvConf = true
+	}
+}
+
+// New creates a new instance of network controller. If a datastore is
+// configured, the networks and endpoints it holds are restored.
+func New(options ...ControllerOption) (NetworkController, error) {
 	c := &controller{
-		networks:  networkTable{},
-		sandboxes: sandboxTable{},
-		drivers:   driverTable{}}
+		networks:           networkTable{},
+		sandboxes:          sandboxTable{},
+		containerSandboxes: containerSandboxTable{},
+		drivers:            driverTable{},
+		ipams:              ipamTable{},
+		events:             newEventBus()}
+	for _, opt := range options {
+		if opt != nil {
+			opt(c)
+		}
+	}
+
+	if c.store == nil && c.localStore {
+		ds, err := datastore.NewLocalStore(c.storePath)
+		if err != nil {
+			return nil, err
+		}
+		c.store = ds
+	}
+
+	if err := initIpams(c); err != nil {
+		return nil, err
+	}
+
 	if err := initDrivers(c); err != nil {
 		return nil, err
 	}
+
+	if c.store != nil {
+		if err := c.restoreFromStore(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.watchResolvConf {
+		if err := c.startResolvConfWatcher(); err != nil {
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
+// startResolvConfWatcher watches the host resolv.conf and propagates its
+// changes to the sandboxes.
+func (c *controller) startResolvConfWatcher() error {
+	w, err := resolvconf.NewWatcher(resolvconf.Path)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", resolvconf.Path, err)
+	}
+
+	// The changes are detected against the current content
+	if _, _, err := resolvconf.GetIfChanged(); err != nil {
+		w.Close()
+		return err
+	}
+
+	c.Lock()
+	c.resolvConfWatcher = w
+	c.Unlock()
+
+	go func() {
+		for range w.Events() {
+			resolvConf, _, err := resolvconf.GetIfChanged()
+			if err != nil {
+				log.Warnf("Failed to read %s: %v", resolvconf.Path, err)
+				continue
+			}
+			if resolvConf != nil {
+				c.updateResolvConfs(resolvConf)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *controller) Stop() {
+	c.Lock()
+	w := c.resolvConfWatcher
+	c.resolvConfWatcher = nil
+	c.Unlock()
+
+	if w != nil {
+		if err := w.Close(); err != nil {
+			log.Warnf("Failed to stop watching %s: %v", resolvconf.Path, err)
+		}
+	}
+}
+
 func (c *controller) ConfigureNetworkDriver(networkType string, options map[string]interface{}) error {
 	c.Lock()
-	d, ok := c.drivers[networkType]
+	dd, ok := c.drivers[networkType]
 	c.Unlock()
 	if !ok {
 		return NetworkTypeError(networkType)
 	}
-	return d.Config(options)
+	return dd.driver.Config(options)
 }
 
-func (c *controller) RegisterDriver(networkType string, driver driverapi.Driver) error {
+func (c *controller) RegisterDriver(networkType string, driver driverapi.Driver, capability driverapi.Capability) error {
 	c.Lock()
 	defer c.Unlock()
 	if _, ok := c.drivers[networkType]; ok {
 		return driverapi.ErrActiveRegistration(networkType)
 	}
-	c.drivers[networkType] = driver
+	c.drivers[networkType] = &driverData{driver: driver, capability: capability}
+	c.events.publish(Event{Type: EventDriverRegister, NetworkType: networkType})
 	return nil
 }
 
+func (c *controller) RegisterIpamDriver(name string, driver ipamapi.Ipam) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.ipams[name]; ok {
+		return driverapi.ErrActiveRegistration(name)
+	}
+	c.ipams[name] = driver
+	return nil
+}
+
+func (c *controller) GetIpam(name string) (ipamapi.Ipam, error) {
+	if name == "" {
+		name = ipamapi.DefaultIPAM
+	}
+	c.Lock()
+	ipam, ok := c.ipams[name]
+	c.Unlock()
+	if !ok {
+		return c.loadIpam(name)
+	}
+	return ipam, nil
+}
+
+func (c *controller) DriverCapability(networkType string) (driverapi.Capability, error) {
+	c.Lock()
+	dd, ok := c.drivers[networkType]
+	c.Unlock()
+	if !ok {
+		return driverapi.Capability{}, NetworkTypeError(networkType)
+	}
+	return dd.capability, nil
+}
+
+// peerDriver returns the network with the passed id and its driver, if it
+// keeps a peer database
+func (c *controller) peerDriver(networkID string) (*network, driverapi.PeerDriver, error) {
+	nw, err := c.NetworkByID(networkID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := nw.(*network)
+	pd, ok := n.driver.(driverapi.PeerDriver)
+	if !ok {
+		return nil, nil, types.NotImplementedErrorf("driver %s of network %s keeps no peer database", n.networkType, n.name)
+	}
+
+	return n, pd, nil
+}
+
+func (c *controller) PeerAdd(networkID string, peer *driverapi.Peer) error {
+	n, pd, err := c.peerDriver(networkID)
+	if err != nil {
+		return err
+	}
+	return pd.PeerAdd(n.id, peer)
+}
+
+func (c *controller) PeerDelete(networkID string, ip net.IP) error {
+	n, pd, err := c.peerDriver(networkID)
+	if err != nil {
+		return err
+	}
+	return pd.PeerDelete(n.id, ip)
+}
+
+func (c *controller) Peers(networkID string) ([]*driverapi.Peer, error) {
+	n, pd, err := c.peerDriver(networkID)
+	if err != nil {
+		return nil, err
+	}
+	return pd.Peers(n.id)
+}
+
 // NewNetwork creates a new network of the specified network type. The options
 // are network specific and modeled in a generic way.
 func (c *controller) NewNetwork(networkType, name string, options ...NetworkOption) (Network, error) {
@@ -138,15 +385,16 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 	}
 	// Check if a driver for the specified network type is available
 	c.Lock()
-	d, ok := c.drivers[networkType]
+	dd, ok := c.drivers[networkType]
 	c.Unlock()
 	if !ok {
 		var err error
-		d, err = c.loadDriver(networkType)
+		dd, err = c.loadDriver(networkType)
 		if err != nil {
 			return nil, err
 		}
 	}
+	d := dd.driver
 
 	// Check if a network already exists with the specified network name
 	c.Lock()
@@ -160,24 +408,52 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 
 	// Construct the network object
 	network := &network{
-		name:      name,
-		id:        types.UUID(stringid.GenerateRandomID()),
-		ctrlr:     c,
-		driver:    d,
-		endpoints: endpointTable{},
+		name:        name,
+		networkType: networkType,
+		id:          types.UUID(stringid.GenerateRandomID()),
+		ctrlr:       c,
+		driver:      d,
+		endpoints:   endpointTable{},
 	}
 
 	network.processOptions(options...)
+
+	// Make sure the IPAM driver is available before the network driver asks for it
+	if network.ipamType == "" {
+		network.ipamType = ipamapi.DefaultIPAM
+	}
+	if _, err := c.GetIpam(network.ipamType); err != nil {
+		return nil, err
+	}
+	generic := make(map[string]interface{}, len(network.generic)+1)
+	for k, v := range network.generic {
+		generic[k] = v
+	}
+	generic[netlabel.IpamDriver] = network.ipamType
+	if network.labels != nil {
+		generic[netlabel.Labels] = network.labels
+	}
+	network.generic = generic
+
 	// Create the network
 	if err := d.CreateNetwork(network.id, network.generic); err != nil {
 		return nil, err
 	}
 
+	if err := c.updateToStore(network); err != nil {
+		if e := d.DeleteNetwork(network.id); e != nil {
+			log.Warnf("Failed to delete network %s on store failure: %v", name, e)
+		}
+		return nil, err
+	}
+
 	// Store the network handler in controller
 	c.Lock()
 	c.networks[network.id] = network
 	c.Unlock()
 
+	c.publishNetworkEvent(EventNetworkCreate, network)
+
 	return network, nil
 }
 
@@ -269,33 +545,40 @@ func (c *controller) sandboxRm(key string) {
 	}
 }
 
-func (c *controller) sandboxGet(key string) sandbox.Sandbox {
+func (c *controller) loadDriver(networkType string) (*driverData, error) {
+	// Plugins pkg performs lazy loading of plugins that acts as remote drivers.
+	// As per the design, this Get call will result in remote driver discovery if there is a corresponding plugin available.
+	_, err := plugins.Get(networkType, driverapi.NetworkPluginEndpointType)
+	if err != nil {
+		if err == plugins.ErrNotFound {
+			return nil, types.NotFoundErrorf(err.Error())
+		}
+		return nil, err
+	}
 	c.Lock()
 	defer c.Unlock()
-
-	sData, ok := c.sandboxes[key]
+	dd, ok := c.drivers[networkType]
 	if !ok {
-		return nil
+		return nil, ErrInvalidNetworkDriver(networkType)
 	}
-
-	return sData.sandbox
+	return dd, nil
 }
 
-func (c *controller) loadDriver(networkType string) (driverapi.Driver, error) {
-	// Plugins pkg performs lazy loading of plugins that acts as remote drivers.
-	// As per the design, this Get call will result in remote driver discovery if there is a corresponding plugin available.
-	_, err := plugins.Get(networkType, driverapi.NetworkPluginEndpointType)
+func (c *controller) loadIpam(name string) (ipamapi.Ipam, error) {
+	// As for the drivers, this Get call results in the discovery of the
+	// remote IPAM if there is a corresponding plugin available.
+	_, err := plugins.Get(name, ipamapi.PluginEndpointType)
 	if err != nil {
 		if err == plugins.ErrNotFound {
-			return nil, types.NotFoundErrorf(err.Error())
+			return nil, IpamTypeError(name)
 		}
 		return nil, err
 	}
 	c.Lock()
 	defer c.Unlock()
-	d, ok := c.drivers[networkType]
+	ipam, ok := c.ipams[name]
 	if !ok {
-		return nil, ErrInvalidNetworkDriver(networkType)
+		return nil, IpamTypeError(name)
 	}
-	return d, nil
+	return ipam, nil
 }
@@ -0,0 +1,51 @@
+// Package datastore provides the persistence layer libnetwork uses to keep
+// its state across restarts. The DataStore interface is pluggable; a local
+// file-backed implementation is provided.
+package datastore
+
+import "errors"
+
+const (
+	// NetworkKeyPrefix is the prefix for network keys in the store
+	NetworkKeyPrefix = "network"
+	// EndpointKeyPrefix is the prefix for endpoint keys in the store
+	EndpointKeyPrefix = "endpoint"
+	// SandboxKeyPrefix is the prefix for sandbox keys in the store
+	SandboxKeyPrefix = "sandbox"
+)
+
+// ErrKeyNotFound is returned when no object is stored at the requested key
+var ErrKeyNotFound = errors.New("key not found in store")
+
+// DataStore is the interface to a persistent store of KV objects
+type DataStore interface {
+	// GetObject reads the object stored at the key of the passed object
+	// and restores it through its SetValue method
+	GetObject(kvObject KV) error
+
+	// PutObject stores the object at its key, replacing any previous value
+	PutObject(kvObject KV) error
+
+	// DeleteObject removes the object stored at the key of the passed object
+	DeleteObject(kvObject KV) error
+
+	// List returns the values of all the objects stored directly under
+	// the passed key prefix
+	List(prefix ...string) ([][]byte, error)
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// KV is the interface for objects which can be persisted in a DataStore
+type KV interface {
+	// Key returns the key, as an ordered list of path components, the
+	// object is stored at
+	Key() []string
+
+	// Value returns the serialized form of the object
+	Value() ([]byte, error)
+
+	// SetValue restores the object from its serialized form
+	SetValue([]byte) error
+}
@@ -0,0 +1,177 @@
+package datastore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultLocalPath is the directory used by the local store when none is specified
+const DefaultLocalPath = "/var/lib/docker/network/store"
+
+const valueSuffix = ".json"
+
+// localStore is a DataStore which keeps each object in its own file under a
+// root directory. Key components map to subdirectories, and files are
+// replaced atomically on update.
+type localStore struct {
+	root string
+	sync.Mutex
+}
+
+// NewLocalStore returns a file-backed DataStore rooted at the passed directory
+func NewLocalStore(root string) (DataStore, error) {
+	if root == "" {
+		root = DefaultLocalPath
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	return &localStore{root: root}, nil
+}
+
+func (s *localStore) path(key []string) (string, error) {
+	if len(key) == 0 {
+		return "", fmt.Errorf("empty key")
+	}
+
+	for _, k := range key {
+		if k == "" || k == "." || k == ".." || strings.ContainsRune(k, os.PathSeparator) {
+			return "", fmt.Errorf("invalid key component %q", k)
+		}
+	}
+
+	return filepath.Join(append([]string{s.root}, key...)...), nil
+}
+
+func (s *localStore) GetObject(kvObject KV) error {
+	p, err := s.path(kvObject.Key())
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	data, err := ioutil.ReadFile(p + valueSuffix)
+	s.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrKeyNotFound
+		}
+		return err
+	}
+
+	return kvObject.SetValue(data)
+}
+
+func (s *localStore) PutObject(kvObject KV) error {
+	p, err := s.path(kvObject.Key())
+	if err != nil {
+		return err
+	}
+
+	data, err := kvObject.Value()
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it for atomic replace
+	tmp, err := ioutil.TempFile(dir, filepath.Base(p))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p+valueSuffix)
+}
+
+func (s *localStore) DeleteObject(kvObject KV) error {
+	p, err := s.path(kvObject.Key())
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := os.Remove(p + valueSuffix); err != nil {
+		if os.IsNotExist(err) {
+			return ErrKeyNotFound
+		}
+		return err
+	}
+
+	// Objects may have children stored under their key
+	os.RemoveAll(p)
+
+	return nil
+}
+
+func (s *localStore) List(prefix ...string) ([][]byte, error) {
+	dir := s.root
+	if len(prefix) != 0 {
+		var err error
+		if dir, err = s.path(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var values [][]byte
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), valueSuffix) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, data)
+	}
+
+	return values, nil
+}
+
+func (s *localStore) Close() error {
+	return nil
+}
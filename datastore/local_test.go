@@ -0,0 +1,141 @@
+package datastore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type dummyObject struct {
+	ID    string
+	Name  string
+	Count int
+}
+
+func (o *dummyObject) Key() []string {
+	return []string{"dummy", o.ID}
+}
+
+func (o *dummyObject) Value() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+func (o *dummyObject) SetValue(value []byte) error {
+	return json.Unmarshal(value, o)
+}
+
+func newTestStore(t *testing.T) (DataStore, func()) {
+	dir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLocalStorePutGet(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	o := &dummyObject{ID: "one", Name: "first", Count: 1}
+	if err := s.PutObject(o); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Count = 2
+	if err := s.PutObject(o); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &dummyObject{ID: "one"}
+	if err := s.GetObject(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if *r != *o {
+		t.Fatalf("Expected %v. Got %v", o, r)
+	}
+}
+
+func TestLocalStoreDelete(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	o := &dummyObject{ID: "one"}
+	if err := s.PutObject(o); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteObject(o); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.GetObject(o); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got %v", err)
+	}
+
+	if err := s.DeleteObject(o); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got %v", err)
+	}
+}
+
+func TestLocalStoreList(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	values, err := s.List("dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 0 {
+		t.Fatalf("Expected empty list. Got %d values", len(values))
+	}
+
+	for _, id := range []string{"one", "two", "three"} {
+		if err := s.PutObject(&dummyObject{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	values, err = s.List("dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 {
+		t.Fatalf("Expected 3 values. Got %d", len(values))
+	}
+
+	found := make(map[string]bool)
+	for _, v := range values {
+		o := &dummyObject{}
+		if err := o.SetValue(v); err != nil {
+			t.Fatal(err)
+		}
+		found[o.ID] = true
+	}
+	for _, id := range []string{"one", "two", "three"} {
+		if !found[id] {
+			t.Fatalf("Object %s not listed", id)
+		}
+	}
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	for _, id := range []string{"", "..", "a/b"} {
+		if err := s.PutObject(&dummyObject{ID: id}); err == nil {
+			t.Fatalf("Expected failure for key component %q", id)
+		}
+	}
+}
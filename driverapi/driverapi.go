@@ -3,12 +3,22 @@ package driverapi
 import (
 	"net"
 
+	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/types"
 )
 
 // NetworkPluginEndpointType represents the Endpoint Type used by Plugin system
 const NetworkPluginEndpointType = "NetworkDriver"
 
+const (
+	// LocalScope represents the scope of a driver whose networks are
+	// confined to the local host
+	LocalScope = "local"
+	// GlobalScope represents the scope of a driver whose networks span
+	// across multiple hosts
+	GlobalScope = "global"
+)
+
 // Driver is an interface that every plugin driver needs to implement.
 type Driver interface {
 	// Push driver specific config to the driver
@@ -17,6 +27,9 @@ type Driver interface {
 	// CreateNetwork invokes the driver method to create a network passing
 	// the network id and network specific config. The config mechanism will
 	// eventually be replaced with labels which are yet to be introduced.
+	// libnetwork persists the options once the network is created and passes
+	// them back when it restores the network, so the driver may record in
+	// them what it needs to restore it.
 	CreateNetwork(nid types.UUID, options map[string]interface{}) error
 
 	// DeleteNetwork invokes the driver method to delete network passing
@@ -28,6 +41,10 @@ type Driver interface {
 	// specific config. The endpoint information can be either consumed by
 	// the driver or populated by the driver. The config mechanism will
 	// eventually be replaced with labels which are yet to be introduced.
+	// When libnetwork restores an endpoint created before a restart, the
+	// endpoint information already lists its interfaces and the driver takes
+	// over the resources it had created for them. A driver which cannot do so
+	// returns ErrNotRestorable, and libnetwork drops the endpoint.
 	CreateEndpoint(nid, eid types.UUID, epInfo EndpointInfo, options map[string]interface{}) error
 
 	// DeleteEndpoint invokes the driver method to delete an endpoint
@@ -47,6 +64,43 @@ type Driver interface {
 	Type() string
 }
 
+// PeerDriver is implemented by the drivers whose networks span multiple hosts
+// and which must be told where the endpoints of the other hosts live. The
+// local peers are recorded by the driver itself and must be advertised to the
+// other hosts of the network, which add them with PeerAdd.
+type PeerDriver interface {
+	// PeerAdd adds a remote peer to the network, or updates it.
+	PeerAdd(nid types.UUID, peer *Peer) error
+
+	// PeerDelete removes the remote peer with the passed address from the network.
+	PeerDelete(nid types.UUID, ip net.IP) error
+
+	// Peers returns the local and remote peers of the network.
+	Peers(nid types.UUID) ([]*Peer, error)
+}
+
+// Peer is an entry of the peer database of a network: the address of an
+// endpoint and the VTEP of the host the endpoint lives on.
+type Peer struct {
+	EndpointID types.UUID
+	IP         net.IP
+	Mac        net.HardwareAddr
+	Vtep       net.IP
+	// Local is set for the endpoints created by the local driver
+	Local bool
+}
+
+// GetCopy returns a copy of this Peer structure
+func (p *Peer) GetCopy() *Peer {
+	return &Peer{
+		EndpointID: p.EndpointID,
+		IP:         types.GetIPCopy(p.IP),
+		Mac:        types.GetMacCopy(p.Mac),
+		Vtep:       types.GetIPCopy(p.Vtep),
+		Local:      p.Local,
+	}
+}
+
 // EndpointInfo provides a go interface to fetch or populate endpoint assigned network resources.
 type EndpointInfo interface {
 	// Interfaces returns a list of interfaces bound to the endpoint.
@@ -109,10 +163,32 @@ type JoinInfo interface {
 
 	// SetResolvConfPath sets the overriding /etc/resolv.conf path to use for the container.
 	SetResolvConfPath(string) error
+
+	// AddStaticRoute adds a route to the sandbox of the container. A route of type
+	// types.NEXTHOP goes through nextHop, a route of type types.CONNECTED is on-link
+	// through the interface of the endpoint identified by interfaceID.
+	AddStaticRoute(destination *net.IPNet, routeType int, nextHop net.IP, interfaceID int) error
 }
 
 // DriverCallback provides a Callback interface for Drivers into LibNetwork
 type DriverCallback interface {
 	// RegisterDriver provides a way for Remote drivers to dynamically register new NetworkType and associate with a driver instance
-	RegisterDriver(name string, driver Driver) error
+	RegisterDriver(name string, driver Driver, capability Capability) error
+
+	// GetIpam returns the IPAM driver registered with the passed name, which the driver
+	// manages the address pools and the addresses of a network with
+	GetIpam(name string) (ipamapi.Ipam, error)
+}
+
+// Capability represents the high level capabilities of the drivers which libnetwork can make use of
+type Capability struct {
+	// Scope is the scope of the networks managed by the driver, either LocalScope or GlobalScope
+	Scope string
+
+	// Options is the list of driver specific option keys the driver understands
+	Options []string
+
+	// ProtocolVersion is the version of the driver protocol negotiated with
+	// the driver. It is only meaningful for remote drivers.
+	ProtocolVersion int
 }
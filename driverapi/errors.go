@@ -44,6 +44,17 @@ func (ene ErrNoEndpoint) Error() string {
 // NotFound denotes the type of this error
 func (ene ErrNoEndpoint) NotFound() {}
 
+// ErrNotRestorable is returned by a driver which cannot take over an
+// endpoint restored after a restart
+type ErrNotRestorable string
+
+func (enr ErrNotRestorable) Error() string {
+	return fmt.Sprintf("Endpoint (%s) cannot be restored", string(enr))
+}
+
+// Forbidden denotes the type of this error
+func (enr ErrNotRestorable) Forbidden() {}
+
 // ErrActiveRegistration represents an error when a driver is registered to a networkType that is previously registered
 type ErrActiveRegistration string
 
@@ -4,17 +4,33 @@ import (
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/drivers/bridge"
 	"github.com/docker/libnetwork/drivers/host"
+	"github.com/docker/libnetwork/drivers/ipvlan"
+	"github.com/docker/libnetwork/drivers/macvlan"
 	"github.com/docker/libnetwork/drivers/null"
+	"github.com/docker/libnetwork/drivers/overlay"
 	"github.com/docker/libnetwork/drivers/remote"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipams/builtin"
+	remoteIpam "github.com/docker/libnetwork/ipams/remote"
 )
 
-type driverTable map[string]driverapi.Driver
+type driverData struct {
+	driver     driverapi.Driver
+	capability driverapi.Capability
+}
+
+type driverTable map[string]*driverData
+
+type ipamTable map[string]ipamapi.Ipam
 
 func initDrivers(dc driverapi.DriverCallback) error {
 	for _, fn := range [](func(driverapi.DriverCallback) error){
 		bridge.Init,
 		host.Init,
+		ipvlan.Init,
+		macvlan.Init,
 		null.Init,
+		overlay.Init,
 		remote.Init,
 	} {
 		if err := fn(dc); err != nil {
@@ -23,3 +39,15 @@ func initDrivers(dc driverapi.DriverCallback) error {
 	}
 	return nil
 }
+
+func initIpams(ic ipamapi.Callback) error {
+	for _, fn := range [](func(ipamapi.Callback) error){
+		builtin.Init,
+		remoteIpam.Init,
+	} {
+		if err := fn(ic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,11 +3,11 @@ package bridge
 import (
 	"errors"
 	"net"
-	"strings"
 	"sync"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/driverapi"
-	"github.com/docker/libnetwork/ipallocator"
+	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/docker/libnetwork/options"
@@ -18,22 +18,24 @@ import (
 )
 
 const (
-	networkType             = "bridge"
-	vethPrefix              = "veth"
-	vethLen                 = 7
-	containerVeth           = "eth0"
-	maxAllocatePortAttempts = 10
-	ifaceID                 = 1
-)
-
-var (
-	ipAllocator *ipallocator.IPAllocator
-	portMapper  *portmapper.PortMapper
+	networkType   = "bridge"
+	vethPrefix    = "veth"
+	vethLen       = 7
+	containerVeth = "eth0"
+	ifaceID       = 1
+	bridgePrefix  = "br-"
+	bridgeIDLen   = 12
 )
 
 // Configuration info for the "bridge" driver.
 type Configuration struct {
 	EnableIPForwarding bool
+	// FirewallBackend is the backend programming the NAT and filter rules
+	// of the networks, IPTablesBackend (default) or NFTablesBackend
+	FirewallBackend string
+	// ExecUserlandProxy runs a docker-proxy process for every proxied
+	// port, instead of forwarding their traffic from within the process
+	ExecUserlandProxy bool
 }
 
 // NetworkConfiguration for network specific configuration
@@ -52,6 +54,17 @@ type NetworkConfiguration struct {
 	DefaultBindingIP      net.IP
 	AllowNonDefaultBridge bool
 	EnableUserlandProxy   bool
+	// VlanInterface is the 802.1Q sub interface, of the form parent.vid,
+	// created with the network and attached to its bridge
+	VlanInterface string
+	// VlanCreated is set by the driver when it created VlanInterface rather
+	// than taking an existing one over. It is persisted with the network, and
+	// the driver only deletes the sub interface it created.
+	VlanCreated bool
+	// EnableIPv6Masquerade masquerades the traffic from FixedCIDRv6 with
+	// ip6tables. The IPv6 forwarding rules and the publishing of the ports
+	// bound to IPv6 host addresses only depend on EnableIPv6.
+	EnableIPv6Masquerade bool
 }
 
 // EndpointConfiguration represents the user specified configuration for the sandbox endpoint
@@ -77,32 +90,37 @@ type bridgeEndpoint struct {
 }
 
 type bridgeNetwork struct {
-	id        types.UUID
-	bridge    *bridgeInterface // The bridge's L3 interface
-	config    *NetworkConfiguration
-	endpoints map[types.UUID]*bridgeEndpoint // key: endpoint id
+	id         types.UUID
+	bridge     *bridgeInterface // The bridge's L3 interface
+	config     *NetworkConfiguration
+	endpoints  map[types.UUID]*bridgeEndpoint // key: endpoint id
+	portMapper *portmapper.PortMapper
+	firewall   firewall     // The backend programming the network rules
+	ipam       ipamapi.Ipam // The IPAM driver managing the network addresses
+	poolIDv4   string
+	poolIDv6   string
 	sync.Mutex
 }
 
 type driver struct {
-	config  *Configuration
-	network *bridgeNetwork
+	config   *Configuration
+	networks map[types.UUID]*bridgeNetwork
+	dc       driverapi.DriverCallback
+	firewall firewall
 	sync.Mutex
 }
 
-func init() {
-	ipAllocator = ipallocator.New()
-	portMapper = portmapper.New()
-}
-
 // New constructs a new bridge driver
-func newDriver() driverapi.Driver {
-	return &driver{}
+func newDriver(dc driverapi.DriverCallback) driverapi.Driver {
+	return &driver{networks: map[types.UUID]*bridgeNetwork{}, dc: dc}
 }
 
 // Init registers a new instance of bridge driver
 func Init(dc driverapi.DriverCallback) error {
-	return dc.RegisterDriver(networkType, newDriver())
+	c := driverapi.Capability{
+		Scope: driverapi.LocalScope,
+	}
+	return dc.RegisterDriver(networkType, newDriver(dc), c)
 }
 
 // Validate performs a static validation on the network configuration parameters.
@@ -112,6 +130,12 @@ func (c *NetworkConfiguration) Validate() error {
 		return ErrInvalidMtu(c.Mtu)
 	}
 
+	if c.VlanInterface != "" {
+		if _, _, err := parseVlanInterface(c.VlanInterface); err != nil {
+			return err
+		}
+	}
+
 	// If bridge v4 subnet is specified
 	if c.AddressIPv4 != nil {
 		// If Container restricted subnet is specified, it must be a subset of bridge subnet
@@ -142,6 +166,11 @@ func (c *NetworkConfiguration) Validate() error {
 		}
 	}
 
+	// The masqueraded IPv6 traffic is the one from FixedCIDRv6
+	if c.EnableIPv6Masquerade && c.FixedCIDRv6 == nil {
+		return &ErrInvalidIPv6Masquerade{}
+	}
+
 	return nil
 }
 
@@ -190,6 +219,13 @@ func (d *driver) Config(option map[string]interface{}) error {
 		config = &Configuration{}
 	}
 
+	fw, err := newFirewall(config.FirewallBackend)
+	if err != nil {
+		d.config = nil
+		return err
+	}
+	d.firewall = fw
+
 	if config.EnableIPForwarding {
 		return setupIPForwarding(config)
 	}
@@ -198,11 +234,64 @@ func (d *driver) Config(option map[string]interface{}) error {
 }
 
 func (d *driver) getNetwork(id types.UUID) (*bridgeNetwork, error) {
-	// Just a dummy function to return the only network managed by Bridge driver.
-	// But this API makes the caller code unchanged when we move to support multiple networks.
 	d.Lock()
 	defer d.Unlock()
-	return d.network, nil
+
+	if id == "" {
+		return nil, InvalidNetworkIDError(id)
+	}
+
+	if nw, ok := d.networks[id]; ok {
+		return nw, nil
+	}
+
+	return nil, driverapi.ErrNoNetwork(id)
+}
+
+// defaultBridgeName returns the name of the bridge for a network created
+// without one: the default bridge, unless another network already uses it.
+// Must be called with the driver lock held.
+func (d *driver) defaultBridgeName(id types.UUID) string {
+	for _, nw := range d.networks {
+		if nw.config.BridgeName == DefaultBridgeName {
+			name := string(id)
+			if len(name) > bridgeIDLen {
+				name = name[:bridgeIDLen]
+			}
+			return bridgePrefix + name
+		}
+	}
+
+	return DefaultBridgeName
+}
+
+// checkConflict verifies the configuration of a new network does not clash
+// with the one of the existing networks. Must be called with the driver lock
+// held.
+func (d *driver) checkConflict(config *NetworkConfiguration) error {
+	for _, nw := range d.networks {
+		if nw.config.BridgeName == config.BridgeName {
+			return BridgeNameInUseError(config.BridgeName)
+		}
+
+		if config.VlanInterface != "" && nw.config.VlanInterface == config.VlanInterface {
+			return VlanInUseError(config.VlanInterface)
+		}
+
+		if config.AddressIPv4 == nil {
+			continue
+		}
+
+		nwAddr := nw.config.AddressIPv4
+		if nw.bridge != nil && nw.bridge.bridgeIPv4 != nil {
+			nwAddr = nw.bridge.bridgeIPv4
+		}
+		if nwAddr != nil && netutils.NetworkOverlaps(config.AddressIPv4, nwAddr) {
+			return &ErrNetworkOverlap{Subnet: config.AddressIPv4, Network: string(nw.id)}
+		}
+	}
+
+	return nil
 }
 
 func parseNetworkOptions(option options.Generic) (*NetworkConfiguration, error) {
@@ -241,39 +330,87 @@ func parseNetworkOptions(option options.Generic) (*NetworkConfiguration, error)
 func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) error {
 	var err error
 
-	// Driver must be configured
+	config, err := parseNetworkOptions(option)
+	if err != nil {
+		return err
+	}
+
+	ipamName, _ := option[netlabel.IpamDriver].(string)
+	ipam, err := d.dc.GetIpam(ipamName)
+	if err != nil {
+		return err
+	}
+
 	d.Lock()
 
 	// Sanity checks
-	if d.network != nil {
+	if _, ok := d.networks[id]; ok {
 		d.Unlock()
 		return &ErrNetworkExists{}
 	}
 
+	// A bridge created on behalf of a non default network is owned by the driver
+	if config.BridgeName == "" {
+		config.BridgeName = d.defaultBridgeName(id)
+		if config.BridgeName != DefaultBridgeName {
+			config.AllowNonDefaultBridge = true
+		}
+	}
+
+	if err = d.checkConflict(config); err != nil {
+		d.Unlock()
+		return err
+	}
+
+	pm := portmapper.New()
+	if d.config != nil && d.config.ExecUserlandProxy {
+		pm.SetProxyMode(portmapper.ExecProxy)
+	}
+
 	// Create and set network handler in driver
-	d.network = &bridgeNetwork{id: id, endpoints: make(map[types.UUID]*bridgeEndpoint)}
-	network := d.network
+	network := &bridgeNetwork{
+		id:         id,
+		endpoints:  make(map[types.UUID]*bridgeEndpoint),
+		config:     config,
+		portMapper: pm,
+		firewall:   d.firewall,
+		ipam:       ipam,
+	}
+	d.networks[id] = network
+
+	// The bridges of the existing networks this one must be isolated from
+	var peers []string
+	for _, nw := range d.networks {
+		if nw != network && nw.config.EnableIPTables {
+			peers = append(peers, nw.config.BridgeName)
+		}
+	}
 	d.Unlock()
 
-	// On failure make sure to reset driver network handler to nil
+	// On failure make sure to remove the network handler from the driver
+	// and to give its address pools back
 	defer func() {
 		if err != nil {
+			network.releasePools()
 			d.Lock()
-			d.network = nil
+			delete(d.networks, id)
 			d.Unlock()
 		}
 	}()
 
-	config, err := parseNetworkOptions(option)
-	if err != nil {
-		return err
-	}
-	network.config = config
-
 	// Create or retrieve the bridge L3 interface
 	bridgeIface := newInterface(config)
 	network.bridge = bridgeIface
 
+	// On failure delete the VLAN sub interface, unless it was taken over
+	defer func() {
+		if err != nil && bridgeIface.vlanCreated {
+			if e := removeVlan(config); e != nil {
+				logrus.Warnf("Failed to remove vlan interface %s: %v", config.VlanInterface, e)
+			}
+		}
+	}()
+
 	// Prepare the bridge setup configuration
 	bridgeSetup := newBridgeSetup(config, bridgeIface)
 
@@ -302,39 +439,59 @@ func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) err
 		// the case of a previously existing device.
 		{bridgeAlreadyExists, setupVerifyAndReconcile},
 
-		// Setup the bridge to allocate containers IPv4 addresses in the
-		// specified subnet.
-		{config.FixedCIDR != nil, setupFixedCIDRv4},
-
-		// Setup the bridge to allocate containers global IPv6 addresses in the
-		// specified subnet.
-		{config.FixedCIDRv6 != nil, setupFixedCIDRv6},
-
 		// Setup Loopback Adresses Routing
 		{!config.EnableUserlandProxy, setupLoopbackAdressesRouting},
 
 		// Setup IPTables.
-		{config.EnableIPTables, setupIPTables},
+		{config.EnableIPTables, network.setupIPTables},
 
 		// Setup DefaultGatewayIPv4
 		{config.DefaultGatewayIPv4 != nil, setupGatewayIPv4},
 
 		// Setup DefaultGatewayIPv6
 		{config.DefaultGatewayIPv6 != nil, setupGatewayIPv6},
+
+		// Attach the VLAN sub interface to the bridge
+		{config.VlanInterface != "", setupVlan},
 	} {
 		if step.Condition {
 			bridgeSetup.queueStep(step.Fn)
 		}
 	}
 
-	// Block bridge IP from being allocated.
-	bridgeSetup.queueStep(allocateBridgeIP)
+	// Request the address pools of the network, restricting the containers
+	// addresses to FixedCIDR and FixedCIDRv6 when specified, and block the
+	// bridge and gateway IPs from being allocated.
+	bridgeSetup.queueStep(network.setupIPAMv4)
+	if config.EnableIPv6 {
+		bridgeSetup.queueStep(network.setupIPAMv6)
+	}
+
 	// Apply the prepared list of steps, and abort at the first error.
 	bridgeSetup.queueStep(setupDeviceUp)
 	if err = bridgeSetup.apply(); err != nil {
 		return err
 	}
 
+	// Prevent traffic from being forwarded between this and the other bridges
+	if config.EnableIPTables {
+		for i, peer := range peers {
+			if err = network.getFirewall().setIsolation(config.BridgeName, peer, true); err != nil {
+				for _, p := range peers[:i] {
+					network.getFirewall().setIsolation(config.BridgeName, p, false)
+				}
+				return err
+			}
+		}
+	}
+
+	// Record the creation of the VLAN sub interface in the options, which
+	// libnetwork persists with the network and passes back on restore
+	if bridgeIface.vlanCreated {
+		config.VlanCreated = true
+		option[netlabel.GenericData] = config
+	}
+
 	return nil
 }
 
@@ -343,8 +500,29 @@ func (d *driver) DeleteNetwork(nid types.UUID) error {
 
 	// Get network handler and remove it from driver
 	d.Lock()
-	n := d.network
-	d.network = nil
+	n, ok := d.networks[nid]
+	if !ok {
+		d.Unlock()
+		return driverapi.ErrNoNetwork(nid)
+	}
+
+	// Cannot remove network if endpoints are still present
+	n.Lock()
+	numEps := len(n.endpoints)
+	n.Unlock()
+	if numEps != 0 {
+		d.Unlock()
+		return ActiveEndpointsError(n.id)
+	}
+
+	delete(d.networks, nid)
+
+	var peers []string
+	for _, nw := range d.networks {
+		if nw.config.EnableIPTables {
+			peers = append(peers, nw.config.BridgeName)
+		}
+	}
 	d.Unlock()
 
 	// On failure set network handler back in driver, but
@@ -352,29 +530,44 @@ func (d *driver) DeleteNetwork(nid types.UUID) error {
 	defer func() {
 		if err != nil {
 			d.Lock()
-			if d.network == nil {
-				d.network = n
+			if _, ok := d.networks[nid]; !ok {
+				d.networks[nid] = n
 			}
 			d.Unlock()
 		}
 	}()
 
-	// Sanity check
-	if n == nil {
-		err = driverapi.ErrNoNetwork(nid)
-		return err
-	}
+	// Remove the iptables rules of the bridge. Do not stop network delete on failure
+	config := n.config
+	if config.EnableIPTables {
+		for _, peer := range peers {
+			if e := n.getFirewall().setIsolation(config.BridgeName, peer, false); e != nil {
+				logrus.Warnf("Failed to remove isolation rules between %s and %s: %v", config.BridgeName, peer, e)
+			}
+		}
 
-	// Cannot remove network if endpoints are still present
-	if len(n.endpoints) != 0 {
-		err = ActiveEndpointsError(n.id)
-		return err
+		if n.bridge.bridgeIPv4 != nil {
+			if e := n.getFirewall().cleanupNetwork(config, n.bridge.bridgeIPv4, !config.EnableUserlandProxy); e != nil {
+				logrus.Warnf("Failed to remove iptables rules for %s: %v", config.BridgeName, e)
+			}
+		}
 	}
 
 	// Programming
+	if config.VlanCreated {
+		if e := removeVlan(config); e != nil {
+			logrus.Warnf("Failed to remove vlan interface %s: %v", config.VlanInterface, e)
+		}
+	}
+
 	err = netlink.LinkDel(n.bridge.Link)
+	if err != nil {
+		return err
+	}
 
-	return err
+	n.releasePools()
+
+	return nil
 }
 
 func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointInfo, epOptions map[string]interface{}) error {
@@ -387,26 +580,12 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 		return errors.New("invalid endpoint info passed")
 	}
 
-	if len(epInfo.Interfaces()) != 0 {
-		return errors.New("non empty interface list passed to bridge(local) driver")
-	}
-
 	// Get the network handler and make sure it exists
-	d.Lock()
-	n := d.network
-	config := n.config
-	d.Unlock()
-	if n == nil {
-		return driverapi.ErrNoNetwork(nid)
-	}
-
-	// Sanity check
-	n.Lock()
-	if n.id != nid {
-		n.Unlock()
-		return InvalidNetworkIDError(nid)
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
 	}
-	n.Unlock()
+	config := n.config
 
 	// Check if endpoint id is good and retrieve correspondent endpoint
 	ep, err := n.getEndpoint(eid)
@@ -440,14 +619,20 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 		}
 	}()
 
+	// A restored endpoint takes over its existing veth pair
+	if ifaces := epInfo.Interfaces(); len(ifaces) != 0 {
+		err = d.restoreEndpoint(n, endpoint, ifaces)
+		return err
+	}
+
 	// Generate a name for what will be the host side pipe interface
-	name1, err := generateIfaceName()
+	name1, err := netutils.GenerateIfaceName(vethPrefix, vethLen)
 	if err != nil {
 		return err
 	}
 
 	// Generate a name for what will be the sandbox side pipe interface
-	name2, err := generateIfaceName()
+	name2, err := netutils.GenerateIfaceName(vethPrefix, vethLen)
 	if err != nil {
 		return err
 	}
@@ -509,11 +694,15 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 	}
 
 	// v4 address for the sandbox side pipe interface
-	ip4, err := ipAllocator.RequestIP(n.bridge.bridgeIPv4, nil)
+	ipv4Addr, _, err := n.ipam.RequestAddress(n.poolIDv4, nil, nil)
 	if err != nil {
 		return err
 	}
-	ipv4Addr := &net.IPNet{IP: ip4, Mask: n.bridge.bridgeIPv4.Mask}
+	defer func() {
+		if err != nil {
+			n.ipam.ReleaseAddress(n.poolIDv4, ipv4Addr.IP)
+		}
+	}()
 
 	// v6 address for the sandbox side pipe interface
 	ipv6Addr = &net.IPNet{}
@@ -534,12 +723,15 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 			}
 		}
 
-		ip6, err := ipAllocator.RequestIP(network, ip6)
+		ipv6Addr, _, err = n.ipam.RequestAddress(n.poolIDv6, ip6, nil)
 		if err != nil {
 			return err
 		}
-
-		ipv6Addr = &net.IPNet{IP: ip6, Mask: network.Mask}
+		defer func() {
+			if err != nil {
+				n.ipam.ReleaseAddress(n.poolIDv6, ipv6Addr.IP)
+			}
+		}()
 	}
 
 	// Create the sandbox side pipe interface
@@ -561,7 +753,7 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 	}
 
 	// Program any required port mapping and store them in the endpoint
-	endpoint.portMapping, err = allocatePorts(epConfig, intf, config.DefaultBindingIP, config.EnableUserlandProxy)
+	endpoint.portMapping, err = n.allocatePorts(epConfig, intf, config.DefaultBindingIP, config.EnableUserlandProxy)
 	if err != nil {
 		return err
 	}
@@ -569,25 +761,71 @@ func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointIn
 	return nil
 }
 
-func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
-	var err error
+// restoreEndpoint reserves the resources of an interface which was created by
+// a previous instance of the driver and reprograms its port mappings.
+func (d *driver) restoreEndpoint(n *bridgeNetwork, endpoint *bridgeEndpoint, ifaces []driverapi.InterfaceInfo) error {
+	var iface driverapi.InterfaceInfo
+	for _, i := range ifaces {
+		if i.ID() == ifaceID {
+			iface = i
+		}
+	}
+	if iface == nil || len(ifaces) != 1 {
+		return errors.New("invalid interface list passed to bridge(local) driver")
+	}
 
-	// Get the network handler and make sure it exists
-	d.Lock()
-	n := d.network
 	config := n.config
-	d.Unlock()
-	if n == nil {
-		return driverapi.ErrNoNetwork(nid)
+	addr := iface.Address()
+	if addr.IP == nil {
+		return errors.New("no IPv4 address in the interface passed to bridge(local) driver")
 	}
 
-	// Sanity Check
-	n.Lock()
-	if n.id != nid {
-		n.Unlock()
-		return InvalidNetworkIDError(nid)
+	if _, _, err := n.ipam.RequestAddress(n.poolIDv4, addr.IP, nil); err != nil {
+		return err
 	}
-	n.Unlock()
+
+	intf := &sandbox.Interface{DstName: containerVeth, Address: &addr}
+
+	addrv6 := iface.AddressIPv6()
+	if config.EnableIPv6 && addrv6.IP != nil {
+		if _, _, err := n.ipam.RequestAddress(n.poolIDv6, addrv6.IP, nil); err != nil {
+			n.ipam.ReleaseAddress(n.poolIDv4, addr.IP)
+			return err
+		}
+		intf.AddressIPv6 = &addrv6
+	}
+
+	// The sandbox side of the pipe is still in the host namespace only if
+	// the endpoint was never joined. Otherwise its name is not needed, as
+	// libnetwork keeps the one the interface was moved to the sandbox with.
+	endpoint.macAddress = iface.MacAddress()
+	if link := netutils.LinkByMacAddress(endpoint.macAddress, ""); link != nil {
+		intf.SrcName = link.Attrs().Name
+	}
+	endpoint.intf = intf
+
+	var err error
+	endpoint.portMapping, err = n.allocatePorts(endpoint.config, intf, config.DefaultBindingIP, config.EnableUserlandProxy)
+	if err != nil {
+		n.ipam.ReleaseAddress(n.poolIDv4, addr.IP)
+		if intf.AddressIPv6 != nil {
+			n.ipam.ReleaseAddress(n.poolIDv6, addrv6.IP)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
+	var err error
+
+	// Get the network handler and make sure it exists
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	config := n.config
 
 	// Check endpoint id and if an endpoint is actually there
 	ep, err := n.getEndpoint(eid)
@@ -616,17 +854,17 @@ func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
 	}()
 
 	// Remove port mappings. Do not stop endpoint delete on unmap failure
-	releasePorts(ep)
+	n.releasePorts(ep)
 
 	// Release the v4 address allocated to this endpoint's sandbox interface
-	err = ipAllocator.ReleaseIP(n.bridge.bridgeIPv4, ep.intf.Address.IP)
+	err = n.ipam.ReleaseAddress(n.poolIDv4, ep.intf.Address.IP)
 	if err != nil {
 		return err
 	}
 
 	// Release the v6 address allocated to this endpoint's sandbox interface
-	if config.EnableIPv6 {
-		err := ipAllocator.ReleaseIP(n.bridge.bridgeIPv6, ep.intf.AddressIPv6.IP)
+	if config.EnableIPv6 && ep.intf.AddressIPv6 != nil {
+		err := n.ipam.ReleaseAddress(n.poolIDv6, ep.intf.AddressIPv6.IP)
 		if err != nil {
 			return err
 		}
@@ -634,8 +872,11 @@ func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
 
 	// Try removal of link. Discard error: link pair might have
 	// already been deleted by sandbox delete.
-	link, err := netlink.LinkByName(ep.intf.SrcName)
-	if err == nil {
+	if ep.intf.SrcName != "" {
+		if link, err := netlink.LinkByName(ep.intf.SrcName); err == nil {
+			netlink.LinkDel(link)
+		}
+	} else if link := netutils.LinkByMacAddress(ep.macAddress, ""); link != nil {
 		netlink.LinkDel(link)
 	}
 
@@ -644,20 +885,10 @@ func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
 
 func (d *driver) EndpointOperInfo(nid, eid types.UUID) (map[string]interface{}, error) {
 	// Get the network handler and make sure it exists
-	d.Lock()
-	n := d.network
-	d.Unlock()
-	if n == nil {
-		return nil, driverapi.ErrNoNetwork(nid)
-	}
-
-	// Sanity check
-	n.Lock()
-	if n.id != nid {
-		n.Unlock()
-		return nil, InvalidNetworkIDError(nid)
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
 	}
-	n.Unlock()
 
 	// Check if endpoint id is good and retrieve correspondent endpoint
 	ep, err := n.getEndpoint(eid)
@@ -703,8 +934,9 @@ func (d *driver) Join(nid, eid types.UUID, sboxKey string, jinfo driverapi.JoinI
 	}
 
 	for _, iNames := range jinfo.InterfaceNames() {
-		// Make sure to set names on the correct interface ID.
-		if iNames.ID() == ifaceID {
+		// Make sure to set names on the correct interface ID. A restored
+		// endpoint does not know the name of its sandbox side interface.
+		if iNames.ID() == ifaceID && endpoint.intf.SrcName != "" {
 			err = iNames.SetNames(endpoint.intf.SrcName, endpoint.intf.DstName)
 			if err != nil {
 				return err
@@ -785,7 +1017,7 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options
 
 			l := newLink(parentEndpoint.intf.Address.IP.String(),
 				endpoint.intf.Address.IP.String(),
-				endpoint.config.ExposedPorts, network.config.BridgeName)
+				endpoint.config.ExposedPorts, network.config.BridgeName, network.getFirewall())
 			if enable {
 				err = l.Enable()
 				if err != nil {
@@ -818,7 +1050,7 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options
 
 		l := newLink(endpoint.intf.Address.IP.String(),
 			childEndpoint.intf.Address.IP.String(),
-			childEndpoint.config.ExposedPorts, network.config.BridgeName)
+			childEndpoint.config.ExposedPorts, network.config.BridgeName, network.getFirewall())
 		if enable {
 			err = l.Enable()
 			if err != nil {
@@ -907,22 +1139,3 @@ func electMacAddress(epConfig *EndpointConfiguration) net.HardwareAddr {
 	}
 	return netutils.GenerateRandomMAC()
 }
-
-// Generates a name to be used for a virtual ethernet
-// interface. The name is constructed by 'veth' appended
-// by a randomly generated hex value. (example: veth0f60e2c)
-func generateIfaceName() (string, error) {
-	for i := 0; i < 3; i++ {
-		name, err := netutils.GenerateRandomName(vethPrefix, vethLen)
-		if err != nil {
-			continue
-		}
-		if _, err := net.InterfaceByName(name); err != nil {
-			if strings.Contains(err.Error(), "no such") {
-				return name, nil
-			}
-			return "", err
-		}
-	}
-	return "", &ErrIfaceName{}
-}
@@ -7,7 +7,7 @@ import (
 	"regexp"
 	"testing"
 
-	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/testutils"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
@@ -17,7 +17,7 @@ import (
 
 func TestCreateFullOptions(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &Configuration{
 		EnableIPForwarding: true,
@@ -48,7 +48,7 @@ func TestCreateFullOptions(t *testing.T) {
 
 func TestCreate(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{BridgeName: DefaultBridgeName}
 	genericOption := make(map[string]interface{})
@@ -61,7 +61,7 @@ func TestCreate(t *testing.T) {
 
 func TestCreateFail(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{BridgeName: "dummy0"}
 	genericOption := make(map[string]interface{})
@@ -72,89 +72,83 @@ func TestCreateFail(t *testing.T) {
 	}
 }
 
-type testInterface struct {
-	id      int
-	mac     net.HardwareAddr
-	addr    net.IPNet
-	addrv6  net.IPNet
-	srcName string
-	dstName string
-}
-
-type testEndpoint struct {
-	ifaces         []*testInterface
-	gw             net.IP
-	gw6            net.IP
-	hostsPath      string
-	resolvConfPath string
-}
-
-func (te *testEndpoint) Interfaces() []driverapi.InterfaceInfo {
-	iList := make([]driverapi.InterfaceInfo, len(te.ifaces))
+func TestCreateMultipleNetworks(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback())
+	dd := d.(*driver)
 
-	for i, iface := range te.ifaces {
-		iList[i] = iface
+	if err := d.CreateNetwork("network1", map[string]interface{}{}); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	return iList
-}
-
-func (te *testEndpoint) AddInterface(id int, mac net.HardwareAddr, ipv4 net.IPNet, ipv6 net.IPNet) error {
-	iface := &testInterface{id: id, addr: ipv4, addrv6: ipv6}
-	te.ifaces = append(te.ifaces, iface)
-	return nil
-}
-
-func (i *testInterface) ID() int {
-	return i.id
-}
+	if err := d.CreateNetwork("network2", map[string]interface{}{}); err != nil {
+		t.Fatalf("Failed to create a second bridge: %v", err)
+	}
 
-func (i *testInterface) MacAddress() net.HardwareAddr {
-	return i.mac
-}
+	if err := d.CreateNetwork("network2", map[string]interface{}{}); err == nil {
+		t.Fatal("Expected failure when creating a network with an existing id")
+	}
 
-func (i *testInterface) Address() net.IPNet {
-	return i.addr
-}
+	config := &NetworkConfiguration{BridgeName: DefaultBridgeName}
+	genericOption := make(map[string]interface{})
+	genericOption[netlabel.GenericData] = config
+	if err := d.CreateNetwork("network3", genericOption); err == nil {
+		t.Fatal("Expected failure when creating a network on a bridge in use")
+	} else if _, ok := err.(BridgeNameInUseError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
 
-func (i *testInterface) AddressIPv6() net.IPNet {
-	return i.addrv6
-}
+	n1, err := dd.getNetwork("network1")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func (i *testInterface) SetNames(srcName string, dstName string) error {
-	i.srcName = srcName
-	i.dstName = dstName
-	return nil
-}
+	n2, err := dd.getNetwork("network2")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func (te *testEndpoint) InterfaceNames() []driverapi.InterfaceNameInfo {
-	iList := make([]driverapi.InterfaceNameInfo, len(te.ifaces))
+	if n1.config.BridgeName != DefaultBridgeName || n2.config.BridgeName != bridgePrefix+"network2" {
+		t.Fatalf("Unexpected bridge names %s and %s", n1.config.BridgeName, n2.config.BridgeName)
+	}
 
-	for i, iface := range te.ifaces {
-		iList[i] = iface
+	if netutils.NetworkOverlaps(n1.bridge.bridgeIPv4, n2.bridge.bridgeIPv4) {
+		t.Fatalf("Bridge subnets %s and %s overlap", n1.bridge.bridgeIPv4, n2.bridge.bridgeIPv4)
 	}
 
-	return iList
-}
+	config = &NetworkConfiguration{BridgeName: "dummy1", AddressIPv4: n2.bridge.bridgeIPv4, AllowNonDefaultBridge: true}
+	genericOption[netlabel.GenericData] = config
+	if err := d.CreateNetwork("network3", genericOption); err == nil {
+		t.Fatal("Expected failure when creating a network overlapping an existing one")
+	} else if _, ok := err.(*ErrNetworkOverlap); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
 
-func (te *testEndpoint) SetGateway(gw net.IP) error {
-	te.gw = gw
-	return nil
-}
+	// Each network hands out addresses from its own subnet
+	for _, n := range []*bridgeNetwork{n1, n2} {
+		te := &testutils.Endpoint{}
+		if err := d.CreateEndpoint(n.id, "ep", te, nil); err != nil {
+			t.Fatalf("Failed to create an endpoint on %s: %v", n.id, err)
+		}
+		if !n.bridge.bridgeIPv4.Contains(te.Ifaces[0].Addr.IP) {
+			t.Fatalf("Endpoint address %s is not in the subnet %s of %s", te.Ifaces[0].Addr.IP, n.bridge.bridgeIPv4, n.id)
+		}
+		if err := d.DeleteEndpoint(n.id, "ep"); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-func (te *testEndpoint) SetGatewayIPv6(gw6 net.IP) error {
-	te.gw6 = gw6
-	return nil
-}
+	if err := d.DeleteNetwork("network1"); err != nil {
+		t.Fatal(err)
+	}
 
-func (te *testEndpoint) SetHostsPath(path string) error {
-	te.hostsPath = path
-	return nil
-}
+	if _, err := dd.getNetwork("network1"); err == nil {
+		t.Fatal("Deleted network still found")
+	}
 
-func (te *testEndpoint) SetResolvConfPath(path string) error {
-	te.resolvConfPath = path
-	return nil
+	if err := d.DeleteNetwork("network2"); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestQueryEndpointInfo(t *testing.T) {
@@ -167,7 +161,7 @@ func TestQueryEndpointInfoHairpin(t *testing.T) {
 
 func testQueryEndpointInfo(t *testing.T, ulPxyEnabled bool) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 	dd, _ := d.(*driver)
 
 	config := &NetworkConfiguration{
@@ -188,14 +182,15 @@ func testQueryEndpointInfo(t *testing.T, ulPxyEnabled bool) {
 	epOptions := make(map[string]interface{})
 	epOptions[netlabel.PortMap] = portMappings
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("net1", "ep1", te, epOptions)
 	if err != nil {
 		t.Fatalf("Failed to create an endpoint : %s", err.Error())
 	}
 
-	ep, _ := dd.network.endpoints["ep1"]
-	data, err := d.EndpointOperInfo(dd.network.id, ep.id)
+	network, _ := dd.getNetwork("net1")
+	ep, _ := network.endpoints["ep1"]
+	data, err := d.EndpointOperInfo(network.id, ep.id)
 	if err != nil {
 		t.Fatalf("Failed to ask for endpoint operational data:  %v", err)
 	}
@@ -217,7 +212,7 @@ func testQueryEndpointInfo(t *testing.T, ulPxyEnabled bool) {
 	}
 
 	// Cleanup as host ports are there
-	err = releasePorts(ep)
+	err = network.releasePorts(ep)
 	if err != nil {
 		t.Fatalf("Failed to release mapped ports: %v", err)
 	}
@@ -225,7 +220,7 @@ func testQueryEndpointInfo(t *testing.T, ulPxyEnabled bool) {
 
 func TestCreateLinkWithOptions(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{BridgeName: DefaultBridgeName}
 	netOptions := make(map[string]interface{})
@@ -240,7 +235,7 @@ func TestCreateLinkWithOptions(t *testing.T) {
 	epOptions := make(map[string]interface{})
 	epOptions[netlabel.MacAddress] = mac
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("net1", "ep", te, epOptions)
 	if err != nil {
 		t.Fatalf("Failed to create an endpoint: %s", err.Error())
@@ -251,7 +246,7 @@ func TestCreateLinkWithOptions(t *testing.T) {
 		t.Fatalf("Failed to join the endpoint: %v", err)
 	}
 
-	ifaceName := te.ifaces[0].srcName
+	ifaceName := te.Ifaces[0].SrcName
 	veth, err := netlink.LinkByName(ifaceName)
 	if err != nil {
 		t.Fatal(err)
@@ -281,7 +276,7 @@ func getPortMapping() []types.PortBinding {
 func TestLinkContainers(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
 
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{
 		BridgeName:     DefaultBridgeName,
@@ -300,24 +295,24 @@ func TestLinkContainers(t *testing.T) {
 	epOptions := make(map[string]interface{})
 	epOptions[netlabel.ExposedPorts] = exposedPorts
 
-	te1 := &testEndpoint{ifaces: []*testInterface{}}
+	te1 := &testutils.Endpoint{}
 	err = d.CreateEndpoint("net1", "ep1", te1, epOptions)
 	if err != nil {
 		t.Fatalf("Failed to create an endpoint : %s", err.Error())
 	}
 
-	addr1 := te1.ifaces[0].addr
+	addr1 := te1.Ifaces[0].Addr
 	if addr1.IP.To4() == nil {
 		t.Fatalf("No Ipv4 address assigned to the endpoint:  ep1")
 	}
 
-	te2 := &testEndpoint{ifaces: []*testInterface{}}
+	te2 := &testutils.Endpoint{}
 	err = d.CreateEndpoint("net1", "ep2", te2, nil)
 	if err != nil {
 		t.Fatalf("Failed to create an endpoint : %s", err.Error())
 	}
 
-	addr2 := te2.ifaces[0].addr
+	addr2 := te2.Ifaces[0].Addr
 	if addr2.IP.To4() == nil {
 		t.Fatalf("No Ipv4 address assigned to the endpoint:  ep2")
 	}
@@ -484,11 +479,37 @@ func TestValidateConfig(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Failed to detect invalid v6 default gateway")
 	}
+
+	// Test v6 masquerading
+	c = NetworkConfiguration{EnableIPv6: true, EnableIPv6Masquerade: true}
+	err = c.Validate()
+	if _, ok := err.(*ErrInvalidIPv6Masquerade); !ok {
+		t.Fatalf("Failed to detect v6 masquerading without FixedCIDRv6: %v", err)
+	}
+
+	c.FixedCIDRv6 = containerSubnet
+	err = c.Validate()
+	if err != nil {
+		t.Fatalf("Unexpected validation error on v6 masquerading")
+	}
+
+	// Test vlan interface
+	c = NetworkConfiguration{VlanInterface: "eth0.4095"}
+	err = c.Validate()
+	if err == nil {
+		t.Fatalf("Failed to detect invalid vlan interface")
+	}
+
+	c.VlanInterface = "eth0.100"
+	err = c.Validate()
+	if err != nil {
+		t.Fatalf("Unexpected validation error on vlan interface")
+	}
 }
 
 func TestSetDefaultGw(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	_, subnetv6, _ := net.ParseCIDR("2001:db8:ea9:9abc:b0c4::/80")
 	gw4 := bridgeNetworks[0].IP.To4()
@@ -511,7 +532,7 @@ func TestSetDefaultGw(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep", te, nil)
 	if err != nil {
 		t.Fatalf("Failed to create endpoint: %v", err)
@@ -522,11 +543,11 @@ func TestSetDefaultGw(t *testing.T) {
 		t.Fatalf("Failed to join endpoint: %v", err)
 	}
 
-	if !gw4.Equal(te.gw) {
-		t.Fatalf("Failed to configure default gateway. Expected %v. Found %v", gw4, te.gw)
+	if !gw4.Equal(te.Gateway) {
+		t.Fatalf("Failed to configure default gateway. Expected %v. Found %v", gw4, te.Gateway)
 	}
 
-	if !gw6.Equal(te.gw6) {
-		t.Fatalf("Failed to configure default gateway. Expected %v. Found %v", gw6, te.gw6)
+	if !gw6.Equal(te.GatewayIPv6) {
+		t.Fatalf("Failed to configure default gateway. Expected %v. Found %v", gw6, te.GatewayIPv6)
 	}
 }
@@ -55,25 +55,28 @@ func (eiec *ErrInvalidEndpointConfig) Error() string {
 // BadRequest denotes the type of this error
 func (eiec *ErrInvalidEndpointConfig) BadRequest() {}
 
-// ErrNetworkExists error is returned when a network already exists and another network is created.
+// ErrNetworkExists error is returned when a network is created with the id of an existing network.
 type ErrNetworkExists struct{}
 
 func (ene *ErrNetworkExists) Error() string {
-	return "network already exists, bridge can only have one network"
+	return "network already exists"
 }
 
 // Forbidden denotes the type of this error
 func (ene *ErrNetworkExists) Forbidden() {}
 
-// ErrIfaceName error is returned when a new name could not be generated.
-type ErrIfaceName struct{}
+// ErrNetworkOverlap error is returned when the subnet of a new network overlaps with an existing network.
+type ErrNetworkOverlap struct {
+	Subnet  *net.IPNet
+	Network string
+}
 
-func (ein *ErrIfaceName) Error() string {
-	return "failed to find name for new interface"
+func (eno *ErrNetworkOverlap) Error() string {
+	return fmt.Sprintf("subnet %s overlaps with the one of network %s", eno.Subnet, eno.Network)
 }
 
-// InternalError denotes the type of this error
-func (ein *ErrIfaceName) InternalError() {}
+// Forbidden denotes the type of this error
+func (eno *ErrNetworkOverlap) Forbidden() {}
 
 // ErrNoIPAddr error is returned when bridge has no IPv4 address configured.
 type ErrNoIPAddr struct{}
@@ -105,6 +108,16 @@ func (eis *ErrInvalidContainerSubnet) Error() string {
 // BadRequest denotes the type of this error
 func (eis *ErrInvalidContainerSubnet) BadRequest() {}
 
+// ErrInvalidIPv6Masquerade is returned when IPv6 masquerading is enabled without FixedCIDRv6.
+type ErrInvalidIPv6Masquerade struct{}
+
+func (eim *ErrInvalidIPv6Masquerade) Error() string {
+	return "IPv6 masquerading requires a container IPv6 subnet (FixedCIDRv6)"
+}
+
+// BadRequest denotes the type of this error
+func (eim *ErrInvalidIPv6Masquerade) BadRequest() {}
+
 // ErrInvalidMtu is returned when the user provided MTU is not valid.
 type ErrInvalidMtu int
 
@@ -222,6 +235,64 @@ func (ndbee NonDefaultBridgeExistError) Error() string {
 // Forbidden denotes the type of this error
 func (ndbee NonDefaultBridgeExistError) Forbidden() {}
 
+// BridgeNameInUseError is returned when a network is
+// created on a bridge already used by another network.
+type BridgeNameInUseError string
+
+func (name BridgeNameInUseError) Error() string {
+	return fmt.Sprintf("bridge %s is already in use by another network", string(name))
+}
+
+// Forbidden denotes the type of this error
+func (name BridgeNameInUseError) Forbidden() {}
+
+// VlanInUseError is returned when a network is
+// created on a VLAN sub interface already used by another network.
+type VlanInUseError string
+
+func (name VlanInUseError) Error() string {
+	return fmt.Sprintf("vlan interface %s is already in use by another network", string(name))
+}
+
+// Forbidden denotes the type of this error
+func (name VlanInUseError) Forbidden() {}
+
+// InvalidVlanInterfaceError is returned when the VLAN sub interface
+// of a network is not of the form parent.vid.
+type InvalidVlanInterfaceError string
+
+func (ivie InvalidVlanInterfaceError) Error() string {
+	return fmt.Sprintf("invalid vlan interface %q, expected parent.vid with a vlan id between 1 and %d", string(ivie), maxVlanID)
+}
+
+// BadRequest denotes the type of this error
+func (ivie InvalidVlanInterfaceError) BadRequest() {}
+
+// VlanParentNotFoundError is returned when the parent link
+// of the VLAN sub interface of a network does not exist.
+type VlanParentNotFoundError string
+
+func (vpnfe VlanParentNotFoundError) Error() string {
+	return fmt.Sprintf("parent link %s of the vlan interface not found", string(vpnfe))
+}
+
+// NotFound denotes the type of this error
+func (vpnfe VlanParentNotFoundError) NotFound() {}
+
+// VlanSetupError is returned when the VLAN sub interface
+// of a network could not be set up.
+type VlanSetupError struct {
+	Name string
+	Err  error
+}
+
+func (vse *VlanSetupError) Error() string {
+	return fmt.Sprintf("setup of vlan interface %s failed: %v", vse.Name, vse.Err)
+}
+
+// InternalError denotes the type of this error
+func (vse *VlanSetupError) InternalError() {}
+
 // FixedCIDRv4Error is returned when fixed-cidrv4 configuration
 // failed.
 type FixedCIDRv4Error struct {
@@ -271,6 +342,26 @@ func (action InvalidIPTablesCfgError) Error() string {
 // BadRequest denotes the type of this error
 func (action InvalidIPTablesCfgError) BadRequest() {}
 
+// InvalidFirewallBackendError is returned when the driver is configured with an unknown firewall backend
+type InvalidFirewallBackendError string
+
+func (name InvalidFirewallBackendError) Error() string {
+	return fmt.Sprintf("invalid firewall backend %q", string(name))
+}
+
+// BadRequest denotes the type of this error
+func (name InvalidFirewallBackendError) BadRequest() {}
+
+// UnsupportedIPv6Error is returned when a network with IPv6 enabled is set up with a firewall backend which has no IPv6 rules
+type UnsupportedIPv6Error string
+
+func (name UnsupportedIPv6Error) Error() string {
+	return fmt.Sprintf("IPv6 is not supported by the %s firewall backend", string(name))
+}
+
+// BadRequest denotes the type of this error
+func (name UnsupportedIPv6Error) BadRequest() {}
+
 // IPv4AddrRangeError is returned when a valid IP address range couldn't be found.
 type IPv4AddrRangeError string
 
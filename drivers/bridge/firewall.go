@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"net"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/portmapper"
+)
+
+const (
+	// IPTablesBackend programs the bridge networks rules with the iptables binary
+	IPTablesBackend = "iptables"
+	// NFTablesBackend programs the bridge networks rules through the nf_tables netlink interface
+	NFTablesBackend = "nftables"
+)
+
+// firewall is the backend programming the NAT and filter rules of the
+// bridge networks.
+type firewall interface {
+	// setupNetwork programs the masquerading, inter container communication
+	// and forwarding rules of the bridge and its DOCKER chains. It returns
+	// the chain the port mappings of the network are forwarded through.
+	setupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) (portmapper.Forwarder, error)
+	// cleanupNetwork removes the rules programmed by setupNetwork, but the
+	// DOCKER chains which are shared by all the networks.
+	cleanupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) error
+	// setIsolation programs, or removes, the rules preventing traffic from
+	// being forwarded between the two bridges.
+	setIsolation(bridge1, bridge2 string, insert bool) error
+	// link programs, or removes, the rule accepting the traffic from ip1 to
+	// the port of ip2 and its replies.
+	link(action iptables.Action, bridge string, ip1, ip2 net.IP, port int, proto string) error
+}
+
+// newFirewall returns the firewall backend with the passed name, iptables
+// being the default one.
+func newFirewall(name string) (firewall, error) {
+	switch name {
+	case "", IPTablesBackend:
+		return iptablesFirewall{}, nil
+	case NFTablesBackend:
+		return nftablesFirewall{}, nil
+	}
+	return nil, InvalidFirewallBackendError(name)
+}
+
+// getFirewall returns the firewall backend of the network
+func (n *bridgeNetwork) getFirewall() firewall {
+	if n.firewall == nil {
+		return iptablesFirewall{}
+	}
+	return n.firewall
+}
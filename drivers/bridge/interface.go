@@ -19,6 +19,9 @@ type bridgeInterface struct {
 	bridgeIPv6  *net.IPNet
 	gatewayIPv4 net.IP
 	gatewayIPv6 net.IP
+	// vlanCreated is set when setupVlan created the VLAN sub interface
+	// instead of taking over an existing one
+	vlanCreated bool
 }
 
 // newInterface creates a new bridge interface structure. It attempts to find
@@ -14,30 +14,32 @@ type link struct {
 	childIP  string
 	ports    []types.TransportPort
 	bridge   string
+	fw       firewall
 }
 
 func (l *link) String() string {
 	return fmt.Sprintf("%s <-> %s [%v] on %s", l.parentIP, l.childIP, l.ports, l.bridge)
 }
 
-func newLink(parentIP, childIP string, ports []types.TransportPort, bridge string) *link {
+func newLink(parentIP, childIP string, ports []types.TransportPort, bridge string, fw firewall) *link {
 	return &link{
 		childIP:  childIP,
 		parentIP: parentIP,
 		ports:    ports,
 		bridge:   bridge,
+		fw:       fw,
 	}
 
 }
 
 func (l *link) Enable() error {
 	// -A == iptables append flag
-	return linkContainers("-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
+	return linkContainers(l.fw, "-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
 }
 
 func (l *link) Disable() {
 	// -D == iptables delete flag
-	err := linkContainers("-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
+	err := linkContainers(l.fw, "-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
 	if err != nil {
 		log.Errorf("Error removing IPTables rules for a link %s due to %s", l.String(), err.Error())
 	}
@@ -45,7 +47,7 @@ func (l *link) Disable() {
 	// that returns typed errors
 }
 
-func linkContainers(action, parentIP, childIP string, ports []types.TransportPort, bridge string,
+func linkContainers(fw firewall, action, parentIP, childIP string, ports []types.TransportPort, bridge string,
 	ignoreErrors bool) error {
 	var nfAction iptables.Action
 
@@ -69,9 +71,8 @@ func linkContainers(action, parentIP, childIP string, ports []types.TransportPor
 		return InvalidLinkIPAddrError(childIP)
 	}
 
-	chain := iptables.Chain{Name: DockerChain, Bridge: bridge}
 	for _, port := range ports {
-		err := chain.Link(nfAction, ip1, ip2, int(port.Port), port.Proto.String())
+		err := fw.link(nfAction, bridge, ip1, ip2, int(port.Port), port.Proto.String())
 		if !ignoreErrors && err != nil {
 			return err
 		}
@@ -17,7 +17,7 @@ func getPorts() []types.TransportPort {
 func TestLinkNew(t *testing.T) {
 	ports := getPorts()
 
-	link := newLink("172.0.17.3", "172.0.17.2", ports, "docker0")
+	link := newLink("172.0.17.3", "172.0.17.2", ports, "docker0", iptablesFirewall{})
 
 	if link == nil {
 		t.FailNow()
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/testutils"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/vishvananda/netlink"
@@ -11,7 +12,7 @@ import (
 
 func TestLinkCreate(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 	dr := d.(*driver)
 
 	mtu := 1490
@@ -28,7 +29,7 @@ func TestLinkCreate(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "", te, nil)
 	if err != nil {
 		if _, ok := err.(InvalidEndpointIDError); !ok {
@@ -50,7 +51,7 @@ func TestLinkCreate(t *testing.T) {
 	}
 
 	// Verify sbox endoint interface inherited MTU value from bridge config
-	sboxLnk, err := netlink.LinkByName(te.ifaces[0].srcName)
+	sboxLnk, err := netlink.LinkByName(te.Ifaces[0].SrcName)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,50 +61,50 @@ func TestLinkCreate(t *testing.T) {
 	// TODO: if we could get peer name from (sboxLnk.(*netlink.Veth)).PeerName
 	// then we could check the MTU on hostLnk as well.
 
-	te1 := &testEndpoint{ifaces: []*testInterface{}}
+	te1 := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep", te1, nil)
 	if err == nil {
 		t.Fatalf("Failed to detect duplicate endpoint id on same network")
 	}
 
-	if len(te.ifaces) != 1 {
-		t.Fatalf("Expected exactly one interface. Instead got %d interface(s)", len(te.ifaces))
+	if len(te.Ifaces) != 1 {
+		t.Fatalf("Expected exactly one interface. Instead got %d interface(s)", len(te.Ifaces))
 	}
 
-	if te.ifaces[0].dstName == "" {
+	if te.Ifaces[0].DstName == "" {
 		t.Fatal("Invalid Dstname returned")
 	}
 
-	_, err = netlink.LinkByName(te.ifaces[0].srcName)
+	_, err = netlink.LinkByName(te.Ifaces[0].SrcName)
 	if err != nil {
-		t.Fatalf("Could not find source link %s: %v", te.ifaces[0].srcName, err)
+		t.Fatalf("Could not find source link %s: %v", te.Ifaces[0].SrcName, err)
 	}
 
-	n := dr.network
-	ip := te.ifaces[0].addr.IP
+	n, _ := dr.getNetwork("dummy")
+	ip := te.Ifaces[0].Addr.IP
 	if !n.bridge.bridgeIPv4.Contains(ip) {
 		t.Fatalf("IP %s is not a valid ip in the subnet %s", ip.String(), n.bridge.bridgeIPv4.String())
 	}
 
-	ip6 := te.ifaces[0].addrv6.IP
+	ip6 := te.Ifaces[0].AddrIPv6.IP
 	if !n.bridge.bridgeIPv6.Contains(ip6) {
 		t.Fatalf("IP %s is not a valid ip in the subnet %s", ip6.String(), bridgeIPv6.String())
 	}
 
-	if !te.gw.Equal(n.bridge.bridgeIPv4.IP) {
+	if !te.Gateway.Equal(n.bridge.bridgeIPv4.IP) {
 		t.Fatalf("Invalid default gateway. Expected %s. Got %s", n.bridge.bridgeIPv4.IP.String(),
-			te.gw.String())
+			te.Gateway.String())
 	}
 
-	if !te.gw6.Equal(n.bridge.bridgeIPv6.IP) {
+	if !te.GatewayIPv6.Equal(n.bridge.bridgeIPv6.IP) {
 		t.Fatalf("Invalid default gateway for IPv6. Expected %s. Got %s", n.bridge.bridgeIPv6.IP.String(),
-			te.gw6.String())
+			te.GatewayIPv6.String())
 	}
 }
 
 func TestLinkCreateTwo(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{
 		BridgeName: DefaultBridgeName,
@@ -116,13 +117,13 @@ func TestLinkCreateTwo(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te1 := &testEndpoint{ifaces: []*testInterface{}}
+	te1 := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep", te1, nil)
 	if err != nil {
 		t.Fatalf("Failed to create a link: %s", err.Error())
 	}
 
-	te2 := &testEndpoint{ifaces: []*testInterface{}}
+	te2 := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep", te2, nil)
 	if err != nil {
 		if _, ok := err.(driverapi.ErrEndpointExists); !ok {
@@ -135,7 +136,7 @@ func TestLinkCreateTwo(t *testing.T) {
 
 func TestLinkCreateNoEnableIPv6(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{
 		BridgeName: DefaultBridgeName}
@@ -147,25 +148,25 @@ func TestLinkCreateNoEnableIPv6(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep", te, nil)
 	if err != nil {
 		t.Fatalf("Failed to create a link: %s", err.Error())
 	}
 
-	interfaces := te.ifaces
-	if interfaces[0].addrv6.IP.To16() != nil {
-		t.Fatalf("Expectd IPv6 address to be nil when IPv6 is not enabled. Got IPv6 = %s", interfaces[0].addrv6.String())
+	interfaces := te.Ifaces
+	if interfaces[0].AddrIPv6.IP.To16() != nil {
+		t.Fatalf("Expectd IPv6 address to be nil when IPv6 is not enabled. Got IPv6 = %s", interfaces[0].AddrIPv6.String())
 	}
 
-	if te.gw6.To16() != nil {
-		t.Fatalf("Expected GatewayIPv6 to be nil when IPv6 is not enabled. Got GatewayIPv6 = %s", te.gw6.String())
+	if te.GatewayIPv6.To16() != nil {
+		t.Fatalf("Expected GatewayIPv6 to be nil when IPv6 is not enabled. Got GatewayIPv6 = %s", te.GatewayIPv6.String())
 	}
 }
 
 func TestLinkDelete(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	config := &NetworkConfiguration{
 		BridgeName: DefaultBridgeName,
@@ -178,7 +179,7 @@ func TestLinkDelete(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep1", te, nil)
 	if err != nil {
 		t.Fatalf("Failed to create a link: %s", err.Error())
@@ -7,6 +7,8 @@ import (
 	"net"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/portmapper"
 	"github.com/docker/libnetwork/sandbox"
 	"github.com/docker/libnetwork/types"
 )
@@ -15,7 +17,7 @@ var (
 	defaultBindingIP = net.IPv4(0, 0, 0, 0)
 )
 
-func allocatePorts(epConfig *EndpointConfiguration, intf *sandbox.Interface, reqDefBindIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
+func (n *bridgeNetwork) allocatePorts(epConfig *EndpointConfiguration, intf *sandbox.Interface, reqDefBindIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
 	if epConfig == nil || epConfig.PortBindings == nil {
 		return nil, nil
 	}
@@ -25,87 +27,102 @@ func allocatePorts(epConfig *EndpointConfiguration, intf *sandbox.Interface, req
 		defHostIP = reqDefBindIP
 	}
 
-	return allocatePortsInternal(epConfig.PortBindings, intf.Address.IP, defHostIP, ulPxyEnabled)
+	// The ports bound to IPv6 host addresses are published on the container
+	// IPv6 address when the network has IPv6 enabled
+	var containerIPv6 net.IP
+	if n.config != nil && n.config.EnableIPv6 && intf.AddressIPv6 != nil {
+		containerIPv6 = intf.AddressIPv6.IP
+	}
+
+	return n.allocatePortsInternal(epConfig.PortBindings, intf.Address.IP, containerIPv6, defHostIP, ulPxyEnabled)
 }
 
-func allocatePortsInternal(bindings []types.PortBinding, containerIP, defHostIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
+// allocatePortsInternal maps the bindings to the container address, or to
+// the container IPv6 address, when not nil, for the bindings to an IPv6 host
+// address. The forwarding rules of all the bindings are programmed at once,
+// and none of the bindings is left mapped on failure.
+func (n *bridgeNetwork) allocatePortsInternal(bindings []types.PortBinding, containerIP, containerIPv6, defHostIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
 	bs := make([]types.PortBinding, 0, len(bindings))
+	pbs := make([]portmapper.Binding, 0, len(bindings))
 	for _, c := range bindings {
-		b := c.GetCopy()
-		if err := allocatePort(&b, containerIP, defHostIP, ulPxyEnabled); err != nil {
-			// On allocation failure, release previously allocated ports. On cleanup error, just log a warning message
-			if cuErr := releasePortsInternal(bs); cuErr != nil {
-				logrus.Warnf("Upon allocation failure for %v, failed to clear previously allocated port bindings: %v", b, cuErr)
-			}
+		if err := c.Validate(); err != nil {
 			return nil, err
 		}
-		bs = append(bs, b)
-	}
-	return bs, nil
-}
 
-func allocatePort(bnd *types.PortBinding, containerIP, defHostIP net.IP, ulPxyEnabled bool) error {
-	var (
-		host net.Addr
-		err  error
-	)
+		b := c.GetCopy()
 
-	// Store the container interface address in the operational binding
-	bnd.IP = containerIP
+		// Adjust the host address in the operational binding
+		if len(b.HostIP) == 0 {
+			b.HostIP = defHostIP
+		}
 
-	// Adjust the host address in the operational binding
-	if len(bnd.HostIP) == 0 {
-		bnd.HostIP = defHostIP
+		// Store the container interface address in the operational binding
+		b.IP = containerIP
+		if containerIPv6 != nil && iptables.IPVersion(b.HostIP) == iptables.IP6Tables {
+			b.IP = containerIPv6
+		}
+
+		// Construct the container side transport address
+		container, err := b.ContainerAddr()
+		if err != nil {
+			return nil, err
+		}
+
+		bs = append(bs, b)
+		pbs = append(pbs, portmapper.Binding{Container: container, HostIP: b.HostIP, HostPort: int(b.HostPort), Count: b.PortCount()})
 	}
 
-	// Construct the container side transport address
-	container, err := bnd.ContainerAddr()
+	hosts, err := n.portMapper.MapAll(pbs, ulPxyEnabled)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Try up to maxAllocatePortAttempts times to get a port that's not already allocated.
-	for i := 0; i < maxAllocatePortAttempts; i++ {
-		if host, err = portMapper.Map(container, bnd.HostIP, int(bnd.HostPort), ulPxyEnabled); err == nil {
-			break
+	// Save the host port (regardless it was or not specified in the binding),
+	// and the end of the host range of a range binding
+	for i, host := range hosts {
+		switch netAddr := host.(type) {
+		case *net.TCPAddr:
+			bs[i].HostPort = uint16(netAddr.Port)
+		case *net.UDPAddr:
+			bs[i].HostPort = uint16(netAddr.Port)
+		case *types.SCTPAddr:
+			bs[i].HostPort = uint16(netAddr.Port)
+		default:
+			// For completeness
+			if cuErr := n.portMapper.UnmapAll(hosts); cuErr != nil {
+				logrus.Warnf("Upon allocation failure for %v, failed to clear previously allocated port bindings: %v", bs[i], cuErr)
+			}
+			return nil, ErrUnsupportedAddressType(fmt.Sprintf("%T", netAddr))
 		}
-		// There is no point in immediately retrying to map an explicitly chosen port.
-		if bnd.HostPort != 0 {
-			logrus.Warnf("Failed to allocate and map port %d: %s", bnd.HostPort, err)
-			break
+		if n := bs[i].PortCount(); n > 1 {
+			bs[i].HostPortEnd = bs[i].HostPort + uint16(n-1)
 		}
-		logrus.Warnf("Failed to allocate and map port: %s, retry: %d", err, i+1)
-	}
-	if err != nil {
-		return err
 	}
 
-	// Save the host port (regardless it was or not specified in the binding)
-	switch netAddr := host.(type) {
-	case *net.TCPAddr:
-		bnd.HostPort = uint16(host.(*net.TCPAddr).Port)
-		return nil
-	case *net.UDPAddr:
-		bnd.HostPort = uint16(host.(*net.UDPAddr).Port)
-		return nil
-	default:
-		// For completeness
-		return ErrUnsupportedAddressType(fmt.Sprintf("%T", netAddr))
-	}
+	return bs, nil
 }
 
-func releasePorts(ep *bridgeEndpoint) error {
-	return releasePortsInternal(ep.portMapping)
+func (n *bridgeNetwork) releasePorts(ep *bridgeEndpoint) error {
+	return n.releasePortsInternal(ep.portMapping)
 }
 
-func releasePortsInternal(bindings []types.PortBinding) error {
+func (n *bridgeNetwork) releasePortsInternal(bindings []types.PortBinding) error {
 	var errorBuf bytes.Buffer
 
 	// Attempt to release all port bindings, do not stop on failure
+	hosts := make([]net.Addr, 0, len(bindings))
 	for _, m := range bindings {
-		if err := releasePort(m); err != nil {
+		// Construct the host side transport address
+		host, err := m.HostAddr()
+		if err != nil {
 			errorBuf.WriteString(fmt.Sprintf("\ncould not release %v because of %v", m, err))
+			continue
 		}
+		hosts = append(hosts, host)
+	}
+
+	if err := n.portMapper.UnmapAll(hosts); err != nil {
+		errorBuf.WriteString(fmt.Sprintf("\ncould not release %v because of %v", bindings, err))
 	}
 
 	if errorBuf.Len() != 0 {
@@ -113,12 +130,3 @@ func releasePortsInternal(bindings []types.PortBinding) error {
 	}
 	return nil
 }
-
-func releasePort(bnd types.PortBinding) error {
-	// Construct the host side transport address
-	host, err := bnd.HostAddr()
-	if err != nil {
-		return err
-	}
-	return portMapper.Unmap(host)
-}
@@ -1,12 +1,16 @@
 package bridge
 
 import (
+	"net"
 	"os"
 	"testing"
 
 	"github.com/docker/docker/pkg/reexec"
+	"github.com/docker/libnetwork/drivers/testutils"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/portmapper"
+	"github.com/docker/libnetwork/sandbox"
 	"github.com/docker/libnetwork/types"
 )
 
@@ -19,7 +23,7 @@ func TestMain(m *testing.M) {
 
 func TestPortMappingConfig(t *testing.T) {
 	defer netutils.SetupTestNetNS(t)()
-	d := newDriver()
+	d := newDriver(testutils.NewCallback())
 
 	binding1 := types.PortBinding{Proto: types.UDP, Port: uint16(400), HostPort: uint16(54000)}
 	binding2 := types.PortBinding{Proto: types.TCP, Port: uint16(500), HostPort: uint16(65000)}
@@ -40,14 +44,15 @@ func TestPortMappingConfig(t *testing.T) {
 		t.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	te := &testEndpoint{ifaces: []*testInterface{}}
+	te := &testutils.Endpoint{}
 	err = d.CreateEndpoint("dummy", "ep1", te, epOptions)
 	if err != nil {
 		t.Fatalf("Failed to create the endpoint: %s", err.Error())
 	}
 
 	dd := d.(*driver)
-	ep, _ := dd.network.endpoints["ep1"]
+	network, _ := dd.getNetwork("dummy")
+	ep, _ := network.endpoints["ep1"]
 	if len(ep.portMapping) != 2 {
 		t.Fatalf("Failed to store the port bindings into the sandbox info. Found: %v", ep.portMapping)
 	}
@@ -60,8 +65,116 @@ func TestPortMappingConfig(t *testing.T) {
 		t.Fatalf("operational port mapping data not found on bridgeEndpoint")
 	}
 
-	err = releasePorts(ep)
+	err = network.releasePorts(ep)
 	if err != nil {
 		t.Fatalf("Failed to release mapped ports: %v", err)
 	}
 }
+
+func TestAllocatePortsIPv6(t *testing.T) {
+	n := &bridgeNetwork{portMapper: portmapper.New()}
+
+	containerIP := net.ParseIP("172.17.0.2")
+	containerIPv6 := net.ParseIP("2001:db8::2")
+	bindings := []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80), HostPort: uint16(18080)},
+		{Proto: types.TCP, Port: uint16(80), HostIP: net.ParseIP("::1"), HostPort: uint16(18080)},
+	}
+
+	bs, err := n.allocatePortsInternal(bindings, containerIP, containerIPv6, defaultBindingIP, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bs[0].IP.Equal(containerIP) || !bs[1].IP.Equal(containerIPv6) {
+		t.Fatalf("Unexpected container addresses of the bindings: %v", bs)
+	}
+
+	if err := n.releasePortsInternal(bs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an IPv6 container address, the port cannot be published on
+	// an IPv6 host address
+	if _, err := n.allocatePortsInternal(bindings, containerIP, nil, defaultBindingIP, false); err != portmapper.ErrIPVersionMismatch {
+		t.Fatalf("Expected an IP version mismatch error, got: %v", err)
+	}
+}
+
+func TestAllocatePortsIPv6Enabled(t *testing.T) {
+	intf := &sandbox.Interface{
+		Address:     &net.IPNet{IP: net.ParseIP("172.17.0.2"), Mask: net.CIDRMask(16, 32)},
+		AddressIPv6: &net.IPNet{IP: net.ParseIP("2001:db8::2"), Mask: net.CIDRMask(64, 128)},
+	}
+	epConfig := &EndpointConfiguration{PortBindings: []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80), HostIP: net.ParseIP("::1"), HostPort: uint16(18081)},
+	}}
+
+	// IPv6 publishing does not depend on masquerading
+	n := &bridgeNetwork{portMapper: portmapper.New(), config: &NetworkConfiguration{EnableIPv6: true}}
+	bs, err := n.allocatePorts(epConfig, intf, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bs[0].IP.Equal(intf.AddressIPv6.IP) {
+		t.Fatalf("Expected the binding to be published on %s, got %s", intf.AddressIPv6.IP, bs[0].IP)
+	}
+	if err := n.releasePortsInternal(bs); err != nil {
+		t.Fatal(err)
+	}
+
+	n = &bridgeNetwork{portMapper: portmapper.New(), config: &NetworkConfiguration{}}
+	if _, err := n.allocatePorts(epConfig, intf, nil, false); err != portmapper.ErrIPVersionMismatch {
+		t.Fatalf("Expected an IP version mismatch error without IPv6, got: %v", err)
+	}
+}
+
+func TestAllocatePortsRange(t *testing.T) {
+	n := &bridgeNetwork{portMapper: portmapper.New()}
+
+	containerIP := net.ParseIP("172.17.0.2")
+	bindings := []types.PortBinding{
+		{Proto: types.UDP, Port: uint16(10000), PortEnd: uint16(10999), HostPort: uint16(30000), HostPortEnd: uint16(30999)},
+		{Proto: types.TCP, Port: uint16(8000), PortEnd: uint16(8009)},
+	}
+
+	bs, err := n.allocatePortsInternal(bindings, containerIP, nil, defaultBindingIP, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bs[0].HostPort != 30000 || bs[0].HostPortEnd != 30999 {
+		t.Fatalf("Unexpected host range of the binding: %v", bs[0])
+	}
+	if bs[1].HostPort == 0 || bs[1].HostPortEnd != bs[1].HostPort+9 {
+		t.Fatalf("Unexpected host range of the binding: %v", bs[1])
+	}
+
+	if err := n.releasePortsInternal(bs); err != nil {
+		t.Fatal(err)
+	}
+
+	bindings[0].HostPortEnd = 30099
+	_, err = n.allocatePortsInternal(bindings, containerIP, nil, defaultBindingIP, true)
+	if _, ok := err.(types.ErrInvalidPortRange); !ok {
+		t.Fatalf("Expected an invalid port range error, got: %v", err)
+	}
+}
+
+func TestAllocatePortsSCTP(t *testing.T) {
+	n := &bridgeNetwork{portMapper: portmapper.New()}
+
+	bindings := []types.PortBinding{{Proto: types.SCTP, Port: uint16(3868)}}
+	bs, err := n.allocatePortsInternal(bindings, net.ParseIP("172.17.0.2"), nil, defaultBindingIP, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bs[0].HostPort == 0 {
+		t.Fatalf("Host port of the SCTP binding not set: %v", bs[0])
+	}
+
+	if err := n.releasePortsInternal(bs); err != nil {
+		t.Fatal(err)
+	}
+}
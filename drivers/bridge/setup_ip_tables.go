@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/portmapper"
 )
 
 // DockerChain: DOCKER iptable chain name
@@ -13,7 +15,7 @@ const (
 	DockerChain = "DOCKER"
 )
 
-func setupIPTables(config *NetworkConfiguration, i *bridgeInterface) error {
+func (n *bridgeNetwork) setupIPTables(config *NetworkConfiguration, i *bridgeInterface) error {
 	// Sanity check.
 	if config.EnableIPTables == false {
 		return IPTableCfgError(config.BridgeName)
@@ -25,107 +27,209 @@ func setupIPTables(config *NetworkConfiguration, i *bridgeInterface) error {
 	if err != nil {
 		return fmt.Errorf("Failed to setup IP tables, cannot acquire Interface address: %s", err.Error())
 	}
-	if err = setupIPTablesInternal(config.BridgeName, addrv4, config.EnableICC, config.EnableIPMasquerade, hairpinMode, true); err != nil {
-		return fmt.Errorf("Failed to Setup IP tables: %s", err.Error())
+
+	chain, err := n.getFirewall().setupNetwork(config, addrv4, hairpinMode)
+	if err != nil {
+		return err
 	}
 
-	_, err = iptables.NewChain(DockerChain, config.BridgeName, iptables.Nat, hairpinMode)
+	n.portMapper.SetForwarder(chain)
+
+	return nil
+}
+
+// iptablesFirewall programs the rules of the bridge networks with the
+// iptables binary.
+type iptablesFirewall struct{}
+
+func (iptablesFirewall) setupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) (portmapper.Forwarder, error) {
+	b := iptables.NewBatch()
+	addIPTablesRules(b, config.BridgeName, addr, config.EnableIPv6, ipv6MasqueradeNetwork(config), config.EnableICC, config.EnableIPMasquerade, hairpin, true)
+	if err := b.Commit(); err != nil {
+		return nil, fmt.Errorf("Failed to Setup IP tables: %s", err.Error())
+	}
+
+	// Do not leave the bridge rules behind when its chains cannot be set up
+	rollback := func() {
+		if err := b.Rollback(); err != nil {
+			logrus.Warnf("Failed to roll back the iptables rules of %s: %v", config.BridgeName, err)
+		}
+	}
+
+	_, err := iptables.NewChain(DockerChain, config.BridgeName, iptables.Nat, hairpin)
 	if err != nil {
-		return fmt.Errorf("Failed to create NAT chain: %s", err.Error())
+		rollback()
+		return nil, fmt.Errorf("Failed to create NAT chain: %s", err.Error())
 	}
 
-	chain, err := iptables.NewChain(DockerChain, config.BridgeName, iptables.Filter, hairpinMode)
+	chain, err := iptables.NewChain(DockerChain, config.BridgeName, iptables.Filter, hairpin)
 	if err != nil {
-		return fmt.Errorf("Failed to create FILTER chain: %s", err.Error())
+		rollback()
+		return nil, fmt.Errorf("Failed to create FILTER chain: %s", err.Error())
 	}
 
-	portMapper.SetIptablesChain(chain)
+	// The chain forwards the ports published on IPv6 addresses through the
+	// ip6tables chains of the same name
+	if config.EnableIPv6 {
+		if _, err := iptables.IP6Tables.NewChain(DockerChain, config.BridgeName, iptables.Nat, hairpin); err != nil {
+			rollback()
+			return nil, fmt.Errorf("Failed to create IPv6 NAT chain: %s", err.Error())
+		}
 
-	return nil
+		if _, err := iptables.IP6Tables.NewChain(DockerChain, config.BridgeName, iptables.Filter, hairpin); err != nil {
+			rollback()
+			return nil, fmt.Errorf("Failed to create IPv6 FILTER chain: %s", err.Error())
+		}
+	}
+
+	return chain, nil
+}
+
+func (iptablesFirewall) cleanupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) error {
+	return setupIPTablesInternal(config.BridgeName, addr, config.EnableIPv6, ipv6MasqueradeNetwork(config), config.EnableICC, config.EnableIPMasquerade, hairpin, false)
+}
+
+func (iptablesFirewall) setIsolation(bridge1, bridge2 string, insert bool) error {
+	return setNetworkIsolationRules(bridge1, bridge2, insert)
+}
+
+func (iptablesFirewall) link(action iptables.Action, bridge string, ip1, ip2 net.IP, port int, proto string) error {
+	chain := iptables.Chain{Name: DockerChain, Bridge: bridge}
+	return chain.Link(action, ip1, ip2, port, proto)
 }
 
 type iptRule struct {
-	table   iptables.Table
-	chain   string
-	preArgs []string
-	args    []string
+	ipv   iptables.IPV
+	table iptables.Table
+	chain string
+	args  []string
+}
+
+// ipv6MasqueradeNetwork returns the IPv6 network which traffic is
+// masqueraded, nil when IPv6 masquerading is not enabled.
+func ipv6MasqueradeNetwork(config *NetworkConfiguration) *net.IPNet {
+	if !config.EnableIPv6 || !config.EnableIPv6Masquerade {
+		return nil
+	}
+	return config.FixedCIDRv6
+}
+
+func setupIPTablesInternal(bridgeIface string, addr net.Addr, ipv6 bool, ipv6Masq *net.IPNet, icc, ipmasq, hairpin, enable bool) error {
+	b := iptables.NewBatch()
+	addIPTablesRules(b, bridgeIface, addr, ipv6, ipv6Masq, icc, ipmasq, hairpin, enable)
+	return b.Commit()
 }
 
-func setupIPTablesInternal(bridgeIface string, addr net.Addr, icc, ipmasq, hairpin, enable bool) error {
+// addIPTablesRules records in the batch the programming, or the removal,
+// of the masquerading, inter container communication and forwarding rules
+// of the bridge. The IPv6 traffic is forwarded with ip6tables rules when ipv6
+// is set, and the one from ipv6Masq, when not nil, is also masqueraded.
+func addIPTablesRules(b *iptables.Batch, bridgeIface string, addr net.Addr, ipv6 bool, ipv6Masq *net.IPNet, icc, ipmasq, hairpin, enable bool) {
 
 	var (
 		address   = addr.String()
-		natRule   = iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"}, args: []string{"-s", address, "!", "-o", bridgeIface, "-j", "MASQUERADE"}}
-		hpNatRule = iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"}, args: []string{"-m", "addrtype", "--src-type", "LOCAL", "-o", bridgeIface, "-j", "MASQUERADE"}}
+		natRule   = iptRule{table: iptables.Nat, chain: "POSTROUTING", args: []string{"-s", address, "!", "-o", bridgeIface, "-j", "MASQUERADE"}}
+		hpNatRule = iptRule{table: iptables.Nat, chain: "POSTROUTING", args: []string{"-m", "addrtype", "--src-type", "LOCAL", "-o", bridgeIface, "-j", "MASQUERADE"}}
 		outRule   = iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-i", bridgeIface, "!", "-o", bridgeIface, "-j", "ACCEPT"}}
 		inRule    = iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-o", bridgeIface, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}}
 	)
 
 	// Set NAT.
 	if ipmasq {
-		if err := programChainRule(natRule, "NAT", enable); err != nil {
-			return err
-		}
+		addChainRule(b, natRule, enable)
 	}
 
 	// In hairpin mode, masquerade traffic from localhost
 	if hairpin {
-		if err := programChainRule(hpNatRule, "MASQ LOCAL HOST", enable); err != nil {
-			return err
-		}
+		addChainRule(b, hpNatRule, enable)
 	}
 
 	// Set Inter Container Communication.
-	if err := setIcc(bridgeIface, icc, enable); err != nil {
-		return err
-	}
+	addIccRules(b, bridgeIface, icc, enable)
 
 	// Set Accept on all non-intercontainer outgoing packets.
-	if err := programChainRule(outRule, "ACCEPT NON_ICC OUTGOING", enable); err != nil {
-		return err
-	}
+	addChainRule(b, outRule, enable)
 
 	// Set Accept on incoming packets for existing connections.
-	if err := programChainRule(inRule, "ACCEPT INCOMING", enable); err != nil {
-		return err
+	addChainRule(b, inRule, enable)
+
+	// Set IPv6 NAT.
+	if ipv6Masq != nil {
+		addChainRule(b, iptRule{ipv: iptables.IP6Tables, table: iptables.Nat, chain: "POSTROUTING", args: []string{"-s", ipv6Masq.String(), "!", "-o", bridgeIface, "-j", "MASQUERADE"}}, enable)
 	}
 
-	return nil
+	// Set Accept on the IPv6 outgoing and incoming packets.
+	if ipv6 {
+		for _, rule := range []iptRule{
+			{ipv: iptables.IP6Tables, table: outRule.table, chain: outRule.chain, args: outRule.args},
+			{ipv: iptables.IP6Tables, table: inRule.table, chain: inRule.chain, args: inRule.args},
+		} {
+			addChainRule(b, rule, enable)
+		}
+	}
 }
 
 func programChainRule(rule iptRule, ruleDescr string, insert bool) error {
-	var (
-		prefix    []string
-		operation string
-		condition bool
-		doesExist = iptables.Exists(rule.table, rule.chain, rule.args...)
-	)
-
-	if insert {
-		condition = !doesExist
-		prefix = []string{"-I", rule.chain}
-		operation = "enable"
-	} else {
-		condition = doesExist
-		prefix = []string{"-D", rule.chain}
+	operation := "enable"
+	if !insert {
 		operation = "disable"
 	}
-	if rule.preArgs != nil {
-		prefix = append(rule.preArgs, prefix...)
+
+	b := iptables.NewBatch()
+	addChainRule(b, rule, insert)
+	if err := b.Commit(); err != nil {
+		return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
 	}
 
-	if condition {
-		if output, err := iptables.Raw(append(prefix, rule.args...)...); err != nil {
-			return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
-		} else if len(output) != 0 {
-			return &iptables.ChainError{Chain: rule.chain, Output: output}
-		}
+	return nil
+}
+
+// addChainRule records in the batch the insertion of the rule when it is
+// not programmed yet, or its deletion when it is.
+func addChainRule(b *iptables.Batch, rule iptRule, insert bool) {
+	doesExist := rule.ipv.Exists(rule.table, rule.chain, rule.args...)
+
+	if insert && !doesExist {
+		b.AddIPV(rule.ipv, iptables.Insert, rule.table, rule.chain, rule.args...)
+	} else if !insert && doesExist {
+		b.AddIPV(rule.ipv, iptables.Delete, rule.table, rule.chain, rule.args...)
+	}
+}
+
+// setNetworkIsolationRules programs the rules preventing traffic from being
+// forwarded between the two passed bridges.
+func setNetworkIsolationRules(bridge1, bridge2 string, insert bool) error {
+	b := iptables.NewBatch()
+	for _, args := range [][]string{
+		{"-i", bridge1, "-o", bridge2, "-j", "DROP"},
+		{"-i", bridge2, "-o", bridge1, "-j", "DROP"},
+	} {
+		addChainRule(b, iptRule{table: iptables.Filter, chain: "FORWARD", args: args}, insert)
+	}
+
+	if err := b.Commit(); err != nil {
+		return fmt.Errorf("Unable to program NETWORK ISOLATION rules: %s", err.Error())
 	}
 
 	return nil
 }
 
 func setIcc(bridgeIface string, iccEnable, insert bool) error {
+	b := iptables.NewBatch()
+	addIccRules(b, bridgeIface, iccEnable, insert)
+	if err := b.Commit(); err != nil {
+		if iccEnable {
+			return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
+		}
+		return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
+	}
+	return nil
+}
+
+// addIccRules records in the batch the rule allowing, or preventing, the
+// traffic between the containers of the bridge, and the removal of the
+// opposite rule.
+func addIccRules(b *iptables.Batch, bridgeIface string, iccEnable, insert bool) {
 	var (
 		table      = iptables.Filter
 		chain      = "FORWARD"
@@ -134,40 +238,22 @@ func setIcc(bridgeIface string, iccEnable, insert bool) error {
 		dropArgs   = append(args, "DROP")
 	)
 
+	enabledArgs, disabledArgs := dropArgs, acceptArgs
+	if iccEnable {
+		enabledArgs, disabledArgs = acceptArgs, dropArgs
+	}
+
 	if insert {
-		if !iccEnable {
-			iptables.Raw(append([]string{"-D", chain}, acceptArgs...)...)
-
-			if !iptables.Exists(table, chain, dropArgs...) {
-				if output, err := iptables.Raw(append([]string{"-A", chain}, dropArgs...)...); err != nil {
-					return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
-				} else if len(output) != 0 {
-					return fmt.Errorf("Error disabling intercontainer communication: %s", output)
-				}
-			}
-		} else {
-			iptables.Raw(append([]string{"-D", chain}, dropArgs...)...)
-
-			if !iptables.Exists(table, chain, acceptArgs...) {
-				if output, err := iptables.Raw(append([]string{"-A", chain}, acceptArgs...)...); err != nil {
-					return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
-				} else if len(output) != 0 {
-					return fmt.Errorf("Error enabling intercontainer communication: %s", output)
-				}
-			}
+		if iptables.Exists(table, chain, disabledArgs...) {
+			b.Add(iptables.Delete, table, chain, disabledArgs...)
+		}
+		if !iptables.Exists(table, chain, enabledArgs...) {
+			b.Add(iptables.Append, table, chain, enabledArgs...)
 		}
 	} else {
 		// Remove any ICC rule.
-		if !iccEnable {
-			if iptables.Exists(table, chain, dropArgs...) {
-				iptables.Raw(append([]string{"-D", chain}, dropArgs...)...)
-			}
-		} else {
-			if iptables.Exists(table, chain, acceptArgs...) {
-				iptables.Raw(append([]string{"-D", chain}, acceptArgs...)...)
-			}
+		if iptables.Exists(table, chain, enabledArgs...) {
+			b.Add(iptables.Delete, table, chain, enabledArgs...)
 		}
 	}
-
-	return nil
 }
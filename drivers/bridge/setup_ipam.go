@@ -0,0 +1,95 @@
+package bridge
+
+import (
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+// setupIPAMv4 requests the IPv4 address pool of the bridge to the network IPAM
+// driver, restricting the containers addresses to FixedCIDR when specified,
+// and reserves the bridge and the default gateway addresses in it.
+func (n *bridgeNetwork) setupIPAMv4(config *NetworkConfiguration, i *bridgeInterface) error {
+	var subPool string
+	if config.FixedCIDR != nil {
+		log.Debugf("Using IPv4 subnet: %v", config.FixedCIDR)
+		subPool = config.FixedCIDR.String()
+	}
+
+	pool := &net.IPNet{IP: i.bridgeIPv4.IP.Mask(i.bridgeIPv4.Mask), Mask: i.bridgeIPv4.Mask}
+	poolID, _, _, err := n.ipam.RequestPool(ipamapi.LocalDefaultAddressSpace, pool.String(), subPool, nil, false)
+	if err != nil {
+		if config.FixedCIDR != nil {
+			return &FixedCIDRv4Error{Subnet: config.FixedCIDR, Net: i.bridgeIPv4, Err: err}
+		}
+		return err
+	}
+	n.poolIDv4 = poolID
+
+	// A failure to reserve the bridge IP is not fatal, as it may not be
+	// an allocatable address of the pool.
+	if _, _, err := n.ipam.RequestAddress(poolID, i.bridgeIPv4.IP, nil); err != nil {
+		log.Debugf("Could not reserve bridge IP %s: %v", i.bridgeIPv4.IP, err)
+	}
+
+	if i.gatewayIPv4 != nil && !i.gatewayIPv4.Equal(i.bridgeIPv4.IP) {
+		if _, _, err := n.ipam.RequestAddress(poolID, i.gatewayIPv4, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setupIPAMv6 requests the IPv6 address pool the containers addresses are
+// allocated from, FixedCIDRv6 or else the bridge link-local network, and
+// reserves the default gateway address in it.
+func (n *bridgeNetwork) setupIPAMv6(config *NetworkConfiguration, i *bridgeInterface) error {
+	pool := config.FixedCIDRv6
+	addressSpace := ipamapi.LocalDefaultAddressSpace
+	if pool == nil {
+		// Link-local addresses are only unique on the bridge link, so the
+		// pool is requested in an address space private to the bridge.
+		pool = &net.IPNet{IP: i.bridgeIPv6.IP.Mask(i.bridgeIPv6.Mask), Mask: i.bridgeIPv6.Mask}
+		addressSpace = config.BridgeName
+	} else {
+		log.Debugf("Using IPv6 subnet: %v", config.FixedCIDRv6)
+	}
+
+	poolID, _, _, err := n.ipam.RequestPool(addressSpace, pool.String(), "", nil, true)
+	if err != nil {
+		if config.FixedCIDRv6 != nil {
+			return &FixedCIDRv6Error{Net: config.FixedCIDRv6, Err: err}
+		}
+		return err
+	}
+	n.poolIDv6 = poolID
+
+	if config.FixedCIDRv6 == nil {
+		if _, _, err := n.ipam.RequestAddress(poolID, i.bridgeIPv6.IP, nil); err != nil {
+			log.Debugf("Could not reserve bridge IPv6 %s: %v", i.bridgeIPv6.IP, err)
+		}
+	}
+
+	if config.DefaultGatewayIPv6 != nil {
+		if _, _, err := n.ipam.RequestAddress(poolID, i.gatewayIPv6, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releasePools gives the address pools of the network back to the IPAM driver
+func (n *bridgeNetwork) releasePools() {
+	for _, poolID := range []string{n.poolIDv4, n.poolIDv6} {
+		if poolID == "" {
+			continue
+		}
+		if err := n.ipam.ReleasePool(poolID); err != nil {
+			log.Warnf("Failed to release address pool %s of network %s: %v", poolID, n.id, err)
+		}
+	}
+	n.poolIDv4, n.poolIDv6 = "", ""
+}
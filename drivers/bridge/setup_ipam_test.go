@@ -4,6 +4,8 @@ import (
 	"net"
 	"testing"
 
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipams/builtin"
 	"github.com/docker/libnetwork/netutils"
 )
 
@@ -23,15 +25,21 @@ func TestSetupFixedCIDRv4(t *testing.T) {
 		t.Fatalf("Assign IPv4 to bridge failed: %v", err)
 	}
 
-	if err := setupFixedCIDRv4(config, br); err != nil {
+	n := &bridgeNetwork{ipam: builtin.NewAllocator()}
+	if err := n.setupIPAMv4(config, br); err != nil {
 		t.Fatalf("Failed to setup bridge FixedCIDRv4: %v", err)
 	}
 
-	if ip, err := ipAllocator.RequestIP(config.FixedCIDR, nil); err != nil {
+	if ip, _, err := n.ipam.RequestAddress(n.poolIDv4, nil, nil); err != nil {
 		t.Fatalf("Failed to request IP to allocator: %v", err)
-	} else if expected := "192.168.2.1"; ip.String() != expected {
+	} else if expected := "192.168.2.1/16"; ip.String() != expected {
 		t.Fatalf("Expected allocated IP %s, got %s", expected, ip)
 	}
+
+	n.releasePools()
+	if _, _, _, err := n.ipam.RequestPool(ipamapi.LocalDefaultAddressSpace, "192.168.0.0/16", "", nil, false); err != nil {
+		t.Fatalf("Expected the pool to be released, got: %v", err)
+	}
 }
 
 func TestSetupBadFixedCIDRv4(t *testing.T) {
@@ -50,7 +58,8 @@ func TestSetupBadFixedCIDRv4(t *testing.T) {
 		t.Fatalf("Assign IPv4 to bridge failed: %v", err)
 	}
 
-	err := setupFixedCIDRv4(config, br)
+	n := &bridgeNetwork{ipam: builtin.NewAllocator()}
+	err := n.setupIPAMv4(config, br)
 	if err == nil {
 		t.Fatal("Setup bridge FixedCIDRv4 should have failed")
 	}
@@ -60,3 +69,33 @@ func TestSetupBadFixedCIDRv4(t *testing.T) {
 	}
 
 }
+
+func TestSetupFixedCIDRv6(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	config := &NetworkConfiguration{}
+	br := newInterface(config)
+
+	_, config.FixedCIDRv6, _ = net.ParseCIDR("2002:db8::/48")
+	if err := setupDevice(config, br); err != nil {
+		t.Fatalf("Bridge creation failed: %v", err)
+	}
+	if err := setupBridgeIPv4(config, br); err != nil {
+		t.Fatalf("Assign IPv4 to bridge failed: %v", err)
+	}
+
+	if err := setupBridgeIPv6(config, br); err != nil {
+		t.Fatalf("Assign IPv4 to bridge failed: %v", err)
+	}
+
+	n := &bridgeNetwork{ipam: builtin.NewAllocator()}
+	if err := n.setupIPAMv6(config, br); err != nil {
+		t.Fatalf("Failed to setup bridge FixedCIDRv6: %v", err)
+	}
+
+	if ip, _, err := n.ipam.RequestAddress(n.poolIDv6, nil, nil); err != nil {
+		t.Fatalf("Failed to request IP to allocator: %v", err)
+	} else if expected := "2002:db8::1/48"; ip.String() != expected {
+		t.Fatalf("Expected allocated IP %s, got %s", expected, ip)
+	}
+}
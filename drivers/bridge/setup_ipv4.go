@@ -81,11 +81,6 @@ func setupBridgeIPv4(config *NetworkConfiguration, i *bridgeInterface) error {
 	return nil
 }
 
-func allocateBridgeIP(config *NetworkConfiguration, i *bridgeInterface) error {
-	ipAllocator.RequestIP(i.bridgeIPv4, i.bridgeIPv4.IP)
-	return nil
-}
-
 func electBridgeIPv4(config *NetworkConfiguration) (*net.IPNet, error) {
 	// Use the requested IPv4 CIDR when available.
 	if config.AddressIPv4 != nil {
@@ -116,11 +111,8 @@ func setupGatewayIPv4(config *NetworkConfiguration, i *bridgeInterface) error {
 	if !i.bridgeIPv4.Contains(config.DefaultGatewayIPv4) {
 		return &ErrInvalidGateway{}
 	}
-	if _, err := ipAllocator.RequestIP(i.bridgeIPv4, config.DefaultGatewayIPv4); err != nil {
-		return err
-	}
-
-	// Store requested default gateway
+	// Store requested default gateway, it is reserved along with the
+	// bridge IP once the network address pool is requested
 	i.gatewayIPv4 = config.DefaultGatewayIPv4
 
 	return nil
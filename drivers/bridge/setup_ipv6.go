@@ -55,11 +55,8 @@ func setupGatewayIPv6(config *NetworkConfiguration, i *bridgeInterface) error {
 	if !config.FixedCIDRv6.Contains(config.DefaultGatewayIPv6) {
 		return &ErrInvalidGateway{}
 	}
-	if _, err := ipAllocator.RequestIP(config.FixedCIDRv6, config.DefaultGatewayIPv6); err != nil {
-		return err
-	}
-
-	// Store requested default gateway
+	// Store requested default gateway, it is reserved once the
+	// network address pool is requested
 	i.gatewayIPv6 = config.DefaultGatewayIPv6
 
 	return nil
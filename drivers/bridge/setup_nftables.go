@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/nftables"
+	"github.com/docker/libnetwork/portmapper"
+)
+
+// nftablesFirewall programs the rules of the bridge networks through the
+// nf_tables netlink interface. The rules are the iptables backend ones, in
+// the tables of the nftables package.
+type nftablesFirewall struct{}
+
+type nftRule struct {
+	table nftables.Table
+	chain string
+	rule  *nftables.Rule
+}
+
+func (nftablesFirewall) setupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) (portmapper.Forwarder, error) {
+	// The forwarding rules, and those of the ports bound to IPv6 host
+	// addresses, are only programmed for IPv4
+	if config.EnableIPv6 {
+		return nil, UnsupportedIPv6Error(NFTablesBackend)
+	}
+
+	if err := setupNFTablesInternal(config.BridgeName, addr, config.EnableICC, config.EnableIPMasquerade, hairpin, true); err != nil {
+		return nil, fmt.Errorf("Failed to Setup nftables: %s", err.Error())
+	}
+
+	_, err := nftables.NewChain(DockerChain, config.BridgeName, nftables.Nat, hairpin)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create NAT chain: %s", err.Error())
+	}
+
+	chain, err := nftables.NewChain(DockerChain, config.BridgeName, nftables.Filter, hairpin)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create FILTER chain: %s", err.Error())
+	}
+
+	return chain, nil
+}
+
+func (nftablesFirewall) cleanupNetwork(config *NetworkConfiguration, addr net.Addr, hairpin bool) error {
+	return setupNFTablesInternal(config.BridgeName, addr, config.EnableICC, config.EnableIPMasquerade, hairpin, false)
+}
+
+func (nftablesFirewall) setIsolation(bridge1, bridge2 string, insert bool) error {
+	for _, r := range []nftRule{
+		{nftables.Filter, "FORWARD", nftables.NewRule(fmt.Sprintf("-i %s -o %s -j DROP", bridge1, bridge2),
+			nftables.IIFName(nftables.Eq, bridge1), nftables.OIFName(nftables.Eq, bridge2), nftables.Drop())},
+		{nftables.Filter, "FORWARD", nftables.NewRule(fmt.Sprintf("-i %s -o %s -j DROP", bridge2, bridge1),
+			nftables.IIFName(nftables.Eq, bridge2), nftables.OIFName(nftables.Eq, bridge1), nftables.Drop())},
+	} {
+		if err := programNFTRule(r, "NETWORK ISOLATION", insert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (nftablesFirewall) link(action iptables.Action, bridge string, ip1, ip2 net.IP, port int, proto string) error {
+	chain := nftables.Chain{Name: DockerChain, Bridge: bridge, Table: nftables.Filter}
+	return chain.Link(action, ip1, ip2, port, proto)
+}
+
+func setupNFTablesInternal(bridgeIface string, addr net.Addr, icc, ipmasq, hairpin, enable bool) error {
+	network, ok := addr.(*net.IPNet)
+	if !ok {
+		return fmt.Errorf("invalid bridge address %v", addr)
+	}
+
+	var (
+		eq  = nftables.Eq
+		neq = nftables.Neq
+
+		natRule = nftRule{nftables.Nat, "POSTROUTING", nftables.NewRule(fmt.Sprintf("-s %s ! -o %s -j MASQUERADE", addr, bridgeIface),
+			nftables.Saddr(eq, network), nftables.OIFName(neq, bridgeIface), nftables.Masquerade())}
+		hpNatRule = nftRule{nftables.Nat, "POSTROUTING", nftables.NewRule(fmt.Sprintf("-m addrtype --src-type LOCAL -o %s -j MASQUERADE", bridgeIface),
+			nftables.SrcLocal(), nftables.OIFName(eq, bridgeIface), nftables.Masquerade())}
+		outRule = nftRule{nftables.Filter, "FORWARD", nftables.NewRule(fmt.Sprintf("-i %s ! -o %s -j ACCEPT", bridgeIface, bridgeIface),
+			nftables.IIFName(eq, bridgeIface), nftables.OIFName(neq, bridgeIface), nftables.Accept())}
+		inRule = nftRule{nftables.Filter, "FORWARD", nftables.NewRule(fmt.Sprintf("-o %s -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT", bridgeIface),
+			nftables.OIFName(eq, bridgeIface), nftables.Ct(nftables.Related|nftables.Established), nftables.Accept())}
+	)
+
+	// Set NAT.
+	if ipmasq {
+		if err := programNFTRule(natRule, "NAT", enable); err != nil {
+			return err
+		}
+	}
+
+	// In hairpin mode, masquerade traffic from localhost
+	if hairpin {
+		if err := programNFTRule(hpNatRule, "MASQ LOCAL HOST", enable); err != nil {
+			return err
+		}
+	}
+
+	// Set Inter Container Communication.
+	if err := setNFTIcc(bridgeIface, icc, enable); err != nil {
+		return err
+	}
+
+	// Set Accept on all non-intercontainer outgoing packets.
+	if err := programNFTRule(outRule, "ACCEPT NON_ICC OUTGOING", enable); err != nil {
+		return err
+	}
+
+	// Set Accept on incoming packets for existing connections.
+	if err := programNFTRule(inRule, "ACCEPT INCOMING", enable); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func programNFTRule(r nftRule, ruleDescr string, insert bool) error {
+	action, operation := iptables.Insert, "enable"
+	if !insert {
+		action, operation = iptables.Delete, "disable"
+	}
+
+	if err := nftables.Program(action, r.table, r.chain, r.rule); err != nil {
+		return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
+	}
+
+	return nil
+}
+
+func setNFTIcc(bridgeIface string, iccEnable, insert bool) error {
+	var (
+		match  = []nftables.Expr{nftables.IIFName(nftables.Eq, bridgeIface), nftables.OIFName(nftables.Eq, bridgeIface)}
+		accept = nftables.NewRule(fmt.Sprintf("-i %s -o %s -j ACCEPT", bridgeIface, bridgeIface), append(match, nftables.Accept())...)
+		drop   = nftables.NewRule(fmt.Sprintf("-i %s -o %s -j DROP", bridgeIface, bridgeIface), append(match, nftables.Drop())...)
+	)
+
+	enabled, disabled := drop, accept
+	if iccEnable {
+		enabled, disabled = accept, drop
+	}
+
+	if !insert {
+		return nftables.Program(iptables.Delete, nftables.Filter, "FORWARD", enabled)
+	}
+
+	if err := nftables.Program(iptables.Delete, nftables.Filter, "FORWARD", disabled); err != nil {
+		return err
+	}
+
+	if err := nftables.Program(iptables.Append, nftables.Filter, "FORWARD", enabled); err != nil {
+		if iccEnable {
+			return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
+		}
+		return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
+	}
+
+	return nil
+}
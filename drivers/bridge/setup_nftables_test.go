@@ -0,0 +1,213 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/nftables"
+	"github.com/docker/libnetwork/portmapper"
+	"github.com/docker/libnetwork/types"
+)
+
+func TestSetupNFTables(t *testing.T) {
+	// Create a test bridge with a basic bridge configuration (name + IPv4).
+	defer netutils.SetupTestNetNS(t)()
+	config := getBasicTestConfig()
+	br := &bridgeInterface{}
+
+	createTestBridge(config, br, t)
+
+	config.EnableIPTables = true
+	config.EnableIPMasquerade = true
+	config.EnableICC = false
+
+	n := &bridgeNetwork{portMapper: portmapper.New(), firewall: nftablesFirewall{}}
+	if err := n.setupIPTables(config, br); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []struct {
+		table nftables.Table
+		chain string
+		key   string
+	}{
+		{nftables.Nat, "POSTROUTING", fmt.Sprintf("-s %s/16 ! -o %s -j MASQUERADE", iptablesTestBridgeIP, DefaultBridgeName)},
+		{nftables.Nat, "POSTROUTING", fmt.Sprintf("-m addrtype --src-type LOCAL -o %s -j MASQUERADE", DefaultBridgeName)},
+		{nftables.Filter, "FORWARD", fmt.Sprintf("-i %s ! -o %s -j ACCEPT", DefaultBridgeName, DefaultBridgeName)},
+		{nftables.Filter, "FORWARD", fmt.Sprintf("-o %s -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT", DefaultBridgeName)},
+		{nftables.Filter, "FORWARD", fmt.Sprintf("-i %s -o %s -j DROP", DefaultBridgeName, DefaultBridgeName)},
+		{nftables.Filter, "FORWARD", fmt.Sprintf("-o %s -j %s", DefaultBridgeName, DockerChain)},
+		{nftables.Nat, "PREROUTING", fmt.Sprintf("-m addrtype --dst-type LOCAL -j %s", DockerChain)},
+	}
+
+	for _, r := range rules {
+		if !nftables.Exists(r.table, r.chain, r.key) {
+			t.Fatalf("Rule %q missing from %s/%s", r.key, r.table, r.chain)
+		}
+	}
+
+	// Enabling inter container communication replaces the DROP rule
+	config.EnableICC = true
+	if err := n.setupIPTables(config, br); err != nil {
+		t.Fatal(err)
+	}
+
+	iccKey := fmt.Sprintf("-i %s -o %s -j ACCEPT", DefaultBridgeName, DefaultBridgeName)
+	if !nftables.Exists(nftables.Filter, "FORWARD", iccKey) {
+		t.Fatalf("ICC ACCEPT rule missing")
+	}
+	if nftables.Exists(nftables.Filter, "FORWARD", rules[4].key) {
+		t.Fatalf("ICC DROP rule still present")
+	}
+
+	addr, _, err := netutils.GetIfaceAddr(config.BridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.firewall.cleanupNetwork(config, addr, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The DOCKER chains linking rules are shared by all the bridges
+	for _, r := range rules[:5] {
+		if nftables.Exists(r.table, r.chain, r.key) {
+			t.Fatalf("Rule %q still present in %s/%s", r.key, r.table, r.chain)
+		}
+	}
+	if nftables.Exists(nftables.Filter, "FORWARD", iccKey) {
+		t.Fatalf("ICC ACCEPT rule still present")
+	}
+}
+
+func TestNFTablesPortMapping(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback())
+
+	config := &Configuration{
+		EnableIPForwarding: true,
+		FirewallBackend:    NFTablesBackend,
+	}
+	genericOption := make(map[string]interface{})
+	genericOption[netlabel.GenericData] = config
+
+	if err := d.Config(genericOption); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netConfig := &NetworkConfiguration{
+		BridgeName:         DefaultBridgeName,
+		EnableIPTables:     true,
+		EnableIPMasquerade: true,
+		EnableICC:          true,
+	}
+	netOptions := make(map[string]interface{})
+	netOptions[netlabel.GenericData] = netConfig
+
+	if err := d.CreateNetwork("net1", netOptions); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	binding := types.PortBinding{Proto: types.TCP, Port: uint16(80), HostPort: uint16(8080)}
+	epOptions := make(map[string]interface{})
+	epOptions[netlabel.PortMap] = []types.PortBinding{binding}
+
+	te := &testutils.Endpoint{}
+	if err := d.CreateEndpoint("net1", "ep1", te, epOptions); err != nil {
+		t.Fatalf("Failed to create the endpoint: %v", err)
+	}
+
+	ip := te.Ifaces[0].Addr.IP
+	dnatKey := fmt.Sprintf("-p tcp -d %s --dport 8080 -j DNAT --to-destination %s:80", net.IPv4zero, ip)
+	if !nftables.Exists(nftables.Nat, DockerChain, dnatKey) {
+		t.Fatalf("DNAT rule of the port binding missing")
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if nftables.Exists(nftables.Nat, DockerChain, dnatKey) {
+		t.Fatalf("DNAT rule of the port binding still present after the endpoint deletion")
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidFirewallBackend(t *testing.T) {
+	d := newDriver(testutils.NewCallback())
+
+	genericOption := map[string]interface{}{netlabel.GenericData: &Configuration{FirewallBackend: "ebtables"}}
+	err := d.Config(genericOption)
+	if _, ok := err.(InvalidFirewallBackendError); !ok {
+		t.Fatalf("Expected an invalid firewall backend error, got: %v", err)
+	}
+
+	// The driver can still be configured
+	genericOption[netlabel.GenericData] = &Configuration{FirewallBackend: IPTablesBackend}
+	if err := d.Config(genericOption); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNFTablesIPv6Masquerade(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("2001:db8::/64")
+	config := &NetworkConfiguration{BridgeName: DefaultBridgeName, EnableIPv6: true, FixedCIDRv6: subnet, EnableIPv6Masquerade: true}
+
+	if _, err := (nftablesFirewall{}).setupNetwork(config, nil, false); err == nil {
+		t.Fatalf("Expected IPv6 masquerading to be rejected by the nftables backend")
+	}
+}
+
+func TestNFTablesIPv6PortMapping(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback())
+
+	genericOption := map[string]interface{}{netlabel.GenericData: &Configuration{FirewallBackend: NFTablesBackend}}
+	if err := d.Config(genericOption); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netConfig := &NetworkConfiguration{
+		BridgeName:         DefaultBridgeName,
+		EnableIPv6:         true,
+		EnableIPTables:     true,
+		EnableIPMasquerade: true,
+	}
+	_, netConfig.FixedCIDRv6, _ = net.ParseCIDR("2001:db8::/64")
+	netOptions := map[string]interface{}{netlabel.GenericData: netConfig}
+
+	err := d.CreateNetwork("net1", netOptions)
+	if _, ok := err.(UnsupportedIPv6Error); !ok {
+		t.Fatalf("Expected the IPv6 network to be rejected by the nftables backend, got: %v", err)
+	}
+
+	// The IPv6 port bindings cannot reach the IPv4 only forwarding rules
+	epOptions := map[string]interface{}{
+		netlabel.PortMap: []types.PortBinding{{Proto: types.TCP, Port: uint16(80), HostIP: net.IPv6zero, HostPort: uint16(8080)}},
+	}
+	if err := d.CreateEndpoint("net1", "ep1", &testutils.Endpoint{}, epOptions); err == nil {
+		t.Fatalf("Endpoint created on the rejected network")
+	}
+
+	if nftables.Exists(nftables.Nat, "POSTROUTING", fmt.Sprintf("-m addrtype --src-type LOCAL -o %s -j MASQUERADE", DefaultBridgeName)) {
+		t.Fatalf("Rules of the rejected network left behind")
+	}
+
+	// The network is supported without IPv6
+	netConfig.EnableIPv6 = false
+	netConfig.FixedCIDRv6 = nil
+	if err := d.CreateNetwork("net1", netOptions); err != nil {
+		t.Fatalf("Failed to create the IPv4 network: %v", err)
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+}
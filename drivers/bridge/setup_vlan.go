@@ -0,0 +1,85 @@
+package bridge
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	maxVlanID       = 4094
+	maxIfaceNameLen = 15
+)
+
+// parseVlanInterface splits a VLAN sub interface name of the form parent.vid
+// into the name of its parent link and its VLAN id.
+func parseVlanInterface(name string) (string, int, error) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || len(name) > maxIfaceNameLen {
+		return "", 0, InvalidVlanInterfaceError(name)
+	}
+
+	vid, err := strconv.Atoi(name[i+1:])
+	if err != nil || vid < 1 || vid > maxVlanID {
+		return "", 0, InvalidVlanInterfaceError(name)
+	}
+
+	return name[:i], vid, nil
+}
+
+// setupVlan creates the VLAN sub interface of the network on its parent link
+// and attaches it to the bridge, which must exist. A sub interface left over
+// by a previous instance of the driver is taken over.
+func setupVlan(config *NetworkConfiguration, i *bridgeInterface) error {
+	parentName, vid, err := parseVlanInterface(config.VlanInterface)
+	if err != nil {
+		return err
+	}
+
+	parent, err := netlink.LinkByName(parentName)
+	if err != nil {
+		return VlanParentNotFoundError(parentName)
+	}
+
+	link, err := netlink.LinkByName(config.VlanInterface)
+	if err != nil {
+		link = &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{
+				Name:        config.VlanInterface,
+				ParentIndex: parent.Attrs().Index,
+			},
+			VlanId: vid,
+		}
+		if err := netlink.LinkAdd(link); err != nil {
+			return &VlanSetupError{Name: config.VlanInterface, Err: err}
+		}
+		i.vlanCreated = true
+	} else if vlan, ok := link.(*netlink.Vlan); !ok || vlan.VlanId != vid || vlan.ParentIndex != parent.Attrs().Index {
+		return &VlanSetupError{Name: config.VlanInterface, Err: InvalidVlanInterfaceError(config.VlanInterface)}
+	}
+
+	if err := netlink.LinkSetMasterByIndex(link, i.Link.Attrs().Index); err != nil {
+		return &VlanSetupError{Name: config.VlanInterface, Err: err}
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &VlanSetupError{Name: config.VlanInterface, Err: err}
+	}
+
+	return nil
+}
+
+// removeVlan deletes the VLAN sub interface of the network, if any.
+func removeVlan(config *NetworkConfiguration) error {
+	if config.VlanInterface == "" {
+		return nil
+	}
+
+	link, err := netlink.LinkByName(config.VlanInterface)
+	if err != nil {
+		return nil
+	}
+
+	return netlink.LinkDel(link)
+}
@@ -0,0 +1,203 @@
+package bridge
+
+import (
+	"encoding/json"
+	"syscall"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+func TestParseVlanInterface(t *testing.T) {
+	parent, vid, err := parseVlanInterface("eth0.100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != "eth0" || vid != 100 {
+		t.Fatalf("Unexpected parent %s and vlan id %d", parent, vid)
+	}
+
+	parent, vid, err = parseVlanInterface("bond0.2.4094")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != "bond0.2" || vid != 4094 {
+		t.Fatalf("Unexpected parent %s and vlan id %d", parent, vid)
+	}
+
+	for _, name := range []string{"eth0", ".100", "eth0.", "eth0.0", "eth0.4095", "eth0.vid", "longparentname.100"} {
+		if _, _, err := parseVlanInterface(name); err == nil {
+			t.Fatalf("Expected failure parsing vlan interface %q", name)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Failed for unexpected reason: %v", err)
+		}
+	}
+}
+
+func TestSetupVlan(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "veth0"}, PeerName: "veth1"}
+	if err := netlink.LinkAdd(veth); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &NetworkConfiguration{BridgeName: DefaultBridgeName, VlanInterface: "veth0.100"}
+	br := &bridgeInterface{}
+	if err := setupDevice(config, br); err != nil {
+		t.Fatalf("Bridge creation failed: %v", err)
+	}
+
+	err := setupVlan(config, br)
+	if vse, ok := err.(*VlanSetupError); ok && vse.Err == syscall.EOPNOTSUPP {
+		t.Skip("Kernel does not support 802.1Q vlan links")
+	}
+	if err != nil {
+		t.Fatalf("Vlan interface setup failed: %v", err)
+	}
+
+	link, err := netlink.LinkByName("veth0.100")
+	if err != nil {
+		t.Fatalf("Failed to retrieve the vlan interface: %v", err)
+	}
+
+	vlan, ok := link.(*netlink.Vlan)
+	if !ok || vlan.VlanId != 100 {
+		t.Fatalf("Unexpected vlan interface %v", link)
+	}
+
+	if vlan.MasterIndex != br.Link.Attrs().Index {
+		t.Fatalf("Vlan interface is not attached to the bridge")
+	}
+
+	if !br.vlanCreated {
+		t.Fatalf("Vlan interface creation not recorded")
+	}
+
+	// An existing sub interface is taken over
+	taken := &bridgeInterface{Link: br.Link}
+	if err := setupVlan(config, taken); err != nil {
+		t.Fatalf("Failed to take the existing vlan interface over: %v", err)
+	}
+
+	if taken.vlanCreated {
+		t.Fatalf("Existing vlan interface recorded as created")
+	}
+
+	if err := removeVlan(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := netlink.LinkByName("veth0.100"); err == nil {
+		t.Fatalf("Vlan interface still present after its removal")
+	}
+}
+
+func TestDeleteNetworkVlan(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback())
+
+	parent := testutils.SetupParent(t, "veth0")
+	existing := &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{Name: "veth0.100", ParentIndex: parent.Attrs().Index},
+		VlanId:    100,
+	}
+	if err := netlink.LinkAdd(existing); err == syscall.EOPNOTSUPP {
+		t.Skip("Kernel does not support 802.1Q vlan links")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	// A sub interface the driver took over is left in place
+	option := map[string]interface{}{
+		netlabel.GenericData: options.Generic{"BridgeName": "br-vlan100", "VlanInterface": "veth0.100"},
+	}
+	if err := d.CreateNetwork("network1", option); err != nil {
+		t.Fatalf("Failed to create the network: %v", err)
+	}
+
+	if _, ok := option[netlabel.GenericData].(options.Generic); !ok {
+		t.Fatalf("Existing vlan interface recorded as created")
+	}
+
+	if err := d.DeleteNetwork("network1"); err != nil {
+		t.Fatalf("Failed to delete the network: %v", err)
+	}
+
+	if _, err := netlink.LinkByName("veth0.100"); err != nil {
+		t.Fatalf("Existing vlan interface deleted with the network: %v", err)
+	}
+
+	// The creation of a sub interface is recorded in the options, and a
+	// network restored from them deletes the sub interface it took over
+	option = map[string]interface{}{
+		netlabel.GenericData: options.Generic{"BridgeName": "br-vlan200", "VlanInterface": "veth0.200"},
+	}
+	if err := d.CreateNetwork("network2", option); err != nil {
+		t.Fatalf("Failed to create the network: %v", err)
+	}
+
+	config, ok := option[netlabel.GenericData].(*NetworkConfiguration)
+	if !ok || !config.VlanCreated {
+		t.Fatalf("Vlan interface creation not recorded in the network options")
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persisted := options.Generic{}
+	if err := json.Unmarshal(b, &persisted); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newDriver(testutils.NewCallback())
+	if err := restored.CreateNetwork("network2", map[string]interface{}{netlabel.GenericData: persisted}); err != nil {
+		t.Fatalf("Failed to restore the network: %v", err)
+	}
+
+	if err := restored.DeleteNetwork("network2"); err != nil {
+		t.Fatalf("Failed to delete the restored network: %v", err)
+	}
+
+	if _, err := netlink.LinkByName("veth0.200"); err == nil {
+		t.Fatalf("Vlan interface still present after the deletion of its network")
+	}
+}
+
+func TestSetupVlanNoParent(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	config := &NetworkConfiguration{BridgeName: DefaultBridgeName, VlanInterface: "nolink0.100"}
+	br := &bridgeInterface{}
+	if err := setupDevice(config, br); err != nil {
+		t.Fatalf("Bridge creation failed: %v", err)
+	}
+
+	if _, ok := setupVlan(config, br).(VlanParentNotFoundError); !ok {
+		t.Fatalf("Expected failure setting up a vlan interface without parent")
+	}
+}
+
+func TestVlanInUse(t *testing.T) {
+	d := newDriver(testutils.NewCallback()).(*driver)
+	d.networks["network1"] = &bridgeNetwork{
+		id:     "network1",
+		config: &NetworkConfiguration{BridgeName: "br-network1", VlanInterface: "eth0.100"},
+	}
+
+	config := &NetworkConfiguration{BridgeName: "br-network2", VlanInterface: "eth0.100"}
+	if _, ok := d.checkConflict(config).(VlanInUseError); !ok {
+		t.Fatalf("Expected failure using the vlan interface of another network")
+	}
+
+	config.VlanInterface = "eth0.200"
+	if err := d.checkConflict(config); err != nil {
+		t.Fatalf("Unexpected conflict on a different vlan: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package ipvlan
+
+import "fmt"
+
+// ErrInvalidNetworkConfig error is returned when a network is created on a driver without valid config.
+type ErrInvalidNetworkConfig struct{}
+
+func (einc *ErrInvalidNetworkConfig) Error() string {
+	return "trying to create a network on a driver without valid config"
+}
+
+// Forbidden denotes the type of this error
+func (einc *ErrInvalidNetworkConfig) Forbidden() {}
+
+// ErrNetworkExists error is returned when a network is created with the id of an existing network.
+type ErrNetworkExists struct{}
+
+func (ene *ErrNetworkExists) Error() string {
+	return "network already exists, ipvlan can only have one network per id"
+}
+
+// Forbidden denotes the type of this error
+func (ene *ErrNetworkExists) Forbidden() {}
+
+// ErrNoParent error is returned when a network is created without a parent link.
+type ErrNoParent struct{}
+
+func (enp *ErrNoParent) Error() string {
+	return "a parent link is required to create an ipvlan network"
+}
+
+// BadRequest denotes the type of this error
+func (enp *ErrNoParent) BadRequest() {}
+
+// ErrNoSubnet error is returned when a network is created without an IPv4 subnet.
+type ErrNoSubnet struct{}
+
+func (ens *ErrNoSubnet) Error() string {
+	return "at least one IPv4 subnet is required to create an ipvlan network"
+}
+
+// BadRequest denotes the type of this error
+func (ens *ErrNoSubnet) BadRequest() {}
+
+// ErrMultipleSubnets error is returned when a network in l2 mode is created with more than one subnet of an address family.
+type ErrMultipleSubnets struct{}
+
+func (ems *ErrMultipleSubnets) Error() string {
+	return "an ipvlan network in l2 mode supports a single subnet per address family"
+}
+
+// BadRequest denotes the type of this error
+func (ems *ErrMultipleSubnets) BadRequest() {}
+
+// ErrInvalidGateway is returned when the user provided default gateway is not in the subnet.
+type ErrInvalidGateway struct{}
+
+func (eig *ErrInvalidGateway) Error() string {
+	return "default gateway ip must be part of the network"
+}
+
+// BadRequest denotes the type of this error
+func (eig *ErrInvalidGateway) BadRequest() {}
+
+// ErrL3Gateway is returned when a default gateway is provided for a network in l3 mode.
+type ErrL3Gateway struct{}
+
+func (elg *ErrL3Gateway) Error() string {
+	return "an ipvlan network in l3 mode routes through its parent and takes no default gateway"
+}
+
+// BadRequest denotes the type of this error
+func (elg *ErrL3Gateway) BadRequest() {}
+
+// ErrInvalidMtu is returned when the user provided MTU is not valid.
+type ErrInvalidMtu int
+
+func (eim ErrInvalidMtu) Error() string {
+	return fmt.Sprintf("invalid MTU number: %d", int(eim))
+}
+
+// BadRequest denotes the type of this error
+func (eim ErrInvalidMtu) BadRequest() {}
+
+// InvalidModeError is returned when the ipvlan mode of a network is not supported.
+type InvalidModeError string
+
+func (ime InvalidModeError) Error() string {
+	return fmt.Sprintf("invalid ipvlan mode %q, expected l2 or l3", string(ime))
+}
+
+// BadRequest denotes the type of this error
+func (ime InvalidModeError) BadRequest() {}
+
+// OverlappingSubnetsError is returned when the subnets of a network overlap.
+type OverlappingSubnetsError string
+
+func (ose OverlappingSubnetsError) Error() string {
+	return fmt.Sprintf("subnet %s overlaps with another subnet of the network", string(ose))
+}
+
+// BadRequest denotes the type of this error
+func (ose OverlappingSubnetsError) BadRequest() {}
+
+// ParentNotFoundError is returned when the parent link of a network does not exist.
+type ParentNotFoundError string
+
+func (pnfe ParentNotFoundError) Error() string {
+	return fmt.Sprintf("parent link %s not found", string(pnfe))
+}
+
+// NotFound denotes the type of this error
+func (pnfe ParentNotFoundError) NotFound() {}
+
+// ActiveEndpointsError is returned when there are
+// still active endpoints in the network being deleted.
+type ActiveEndpointsError string
+
+func (aee ActiveEndpointsError) Error() string {
+	return fmt.Sprintf("network %s has active endpoint", string(aee))
+}
+
+// Forbidden denotes the type of this error
+func (aee ActiveEndpointsError) Forbidden() {}
+
+// InvalidNetworkIDError is returned when the passed
+// network id for an existing network is not a known id.
+type InvalidNetworkIDError string
+
+func (inie InvalidNetworkIDError) Error() string {
+	return fmt.Sprintf("invalid network id %s", string(inie))
+}
+
+// NotFound denotes the type of this error
+func (inie InvalidNetworkIDError) NotFound() {}
+
+// InvalidEndpointIDError is returned when the passed
+// endpoint id is not valid.
+type InvalidEndpointIDError string
+
+func (ieie InvalidEndpointIDError) Error() string {
+	return fmt.Sprintf("invalid endpoint id: %s", string(ieie))
+}
+
+// BadRequest denotes the type of this error
+func (ieie InvalidEndpointIDError) BadRequest() {}
+
+// EndpointNotFoundError is returned when the no endpoint
+// with the passed endpoint id is found.
+type EndpointNotFoundError string
+
+func (enfe EndpointNotFoundError) Error() string {
+	return fmt.Sprintf("endpoint not found: %s", string(enfe))
+}
+
+// NotFound denotes the type of this error
+func (enfe EndpointNotFoundError) NotFound() {}
+
+// RestoredAddressError is returned when the address of an endpoint
+// restored after a restart is not in the subnets of its network.
+type RestoredAddressError string
+
+func (rae RestoredAddressError) Error() string {
+	return fmt.Sprintf("address %s of the restored endpoint is not in the network subnets", string(rae))
+}
+
+// BadRequest denotes the type of this error
+func (rae RestoredAddressError) BadRequest() {}
+
+// NoAddressError is returned when none of the subnets of
+// the network has an address left for a new endpoint.
+type NoAddressError string
+
+func (nae NoAddressError) Error() string {
+	return fmt.Sprintf("no address available in the subnets of network %s", string(nae))
+}
+
+// NoService denotes the type of this error
+func (nae NoAddressError) NoService() {}
@@ -0,0 +1,692 @@
+package ipvlan
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	networkType    = "ipvlan"
+	linkPrefix     = "ipv"
+	linkIDLen      = 7
+	containerIface = "eth0"
+	ifaceID        = 1
+)
+
+var (
+	defaultRoute     = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	defaultRouteIPv6 = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+)
+
+var ipvlanModes = map[string]netlink.IPVlanMode{
+	"l2": netlink.IPVLAN_MODE_L2,
+	"l3": netlink.IPVLAN_MODE_L3,
+}
+
+// NetworkConfiguration for network specific configuration
+type NetworkConfiguration struct {
+	// Parent is the name of the host link the ipvlan links are created on
+	Parent string
+	// Mode is either l2 (default) or l3
+	Mode string
+	// Subnets are the networks the endpoint addresses are allocated from.
+	// At least one of them is IPv4. An endpoint also gets an IPv6 address
+	// when some of them are IPv6. A network in l2 mode has a single subnet
+	// of each address family.
+	Subnets []*net.IPNet
+	// DefaultGatewayIPv4 is the gateway of a network in l2 mode, the first
+	// address of the subnet if not specified
+	DefaultGatewayIPv4 net.IP
+	// DefaultGatewayIPv6 is the IPv6 gateway of a network in l2 mode with an
+	// IPv6 subnet, the first address of the subnet if not specified
+	DefaultGatewayIPv6 net.IP
+	Mtu                int
+}
+
+type ipvlanEndpoint struct {
+	id         types.UUID
+	srcName    string
+	macAddress net.HardwareAddr
+	addr       *net.IPNet
+	addrv6     *net.IPNet
+	poolID     string
+	poolIDv6   string
+}
+
+// ipvlanPool is the address pool of one of the subnets of a network
+type ipvlanPool struct {
+	subnet *net.IPNet
+	poolID string
+	v6     bool
+}
+
+type ipvlanNetwork struct {
+	id        types.UUID
+	config    *NetworkConfiguration
+	mode      netlink.IPVlanMode
+	gateway   net.IP
+	gatewayv6 net.IP
+	pools     []*ipvlanPool
+	endpoints map[types.UUID]*ipvlanEndpoint // key: endpoint id
+	ipam      ipamapi.Ipam                   // The IPAM driver managing the network addresses
+	sync.Mutex
+}
+
+type driver struct {
+	networks map[types.UUID]*ipvlanNetwork
+	dc       driverapi.DriverCallback
+	sync.Mutex
+}
+
+// New constructs a new ipvlan driver
+func newDriver(dc driverapi.DriverCallback) driverapi.Driver {
+	return &driver{networks: map[types.UUID]*ipvlanNetwork{}, dc: dc}
+}
+
+// Init registers a new instance of ipvlan driver
+func Init(dc driverapi.DriverCallback) error {
+	c := driverapi.Capability{
+		Scope: driverapi.LocalScope,
+	}
+	return dc.RegisterDriver(networkType, newDriver(dc), c)
+}
+
+// parseMode returns the kernel value of the named ipvlan mode, l2 if the
+// name is empty.
+func parseMode(mode string) (netlink.IPVlanMode, error) {
+	if mode == "" {
+		return netlink.IPVLAN_MODE_L2, nil
+	}
+
+	m, ok := ipvlanModes[strings.ToLower(mode)]
+	if !ok {
+		return 0, InvalidModeError(mode)
+	}
+
+	return m, nil
+}
+
+// Validate performs a static validation on the network configuration parameters.
+// Whatever can be assessed a priori before attempting any programming.
+func (c *NetworkConfiguration) Validate() error {
+	if c.Parent == "" {
+		return &ErrNoParent{}
+	}
+
+	mode, err := parseMode(c.Mode)
+	if err != nil {
+		return err
+	}
+
+	var subnets, subnetsv6 []*net.IPNet
+	for i, s := range c.Subnets {
+		for _, o := range c.Subnets[:i] {
+			if netutils.NetworkOverlaps(s, o) {
+				return OverlappingSubnetsError(s.String())
+			}
+		}
+		if s.IP.To4() == nil {
+			subnetsv6 = append(subnetsv6, s)
+		} else {
+			subnets = append(subnets, s)
+		}
+	}
+
+	if len(subnets) == 0 {
+		return &ErrNoSubnet{}
+	}
+
+	if mode == netlink.IPVLAN_MODE_L2 {
+		if len(subnets) > 1 || len(subnetsv6) > 1 {
+			return &ErrMultipleSubnets{}
+		}
+		if c.DefaultGatewayIPv4 != nil && !subnets[0].Contains(c.DefaultGatewayIPv4) {
+			return &ErrInvalidGateway{}
+		}
+		if c.DefaultGatewayIPv6 != nil && (len(subnetsv6) == 0 || !subnetsv6[0].Contains(c.DefaultGatewayIPv6)) {
+			return &ErrInvalidGateway{}
+		}
+	} else if c.DefaultGatewayIPv4 != nil || c.DefaultGatewayIPv6 != nil {
+		return &ErrL3Gateway{}
+	}
+
+	if c.Mtu < 0 {
+		return ErrInvalidMtu(c.Mtu)
+	}
+
+	return nil
+}
+
+func (n *ipvlanNetwork) getEndpoint(eid types.UUID) (*ipvlanEndpoint, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if eid == "" {
+		return nil, InvalidEndpointIDError(eid)
+	}
+
+	if ep, ok := n.endpoints[eid]; ok {
+		return ep, nil
+	}
+
+	return nil, nil
+}
+
+func (d *driver) Config(option map[string]interface{}) error {
+	return nil
+}
+
+func (d *driver) getNetwork(id types.UUID) (*ipvlanNetwork, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if id == "" {
+		return nil, InvalidNetworkIDError(id)
+	}
+
+	if nw, ok := d.networks[id]; ok {
+		return nw, nil
+	}
+
+	return nil, driverapi.ErrNoNetwork(id)
+}
+
+func parseNetworkOptions(option options.Generic) (*NetworkConfiguration, error) {
+	var config *NetworkConfiguration
+
+	switch opt := option[netlabel.GenericData].(type) {
+	case options.Generic:
+		opaqueConfig, err := options.GenerateFromModel(opt, &NetworkConfiguration{})
+		if err != nil {
+			return nil, err
+		}
+		config = opaqueConfig.(*NetworkConfiguration)
+	case *NetworkConfiguration:
+		config = opt
+	default:
+		return nil, &ErrInvalidNetworkConfig{}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Create a new network using ipvlan plugin
+func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) error {
+	var err error
+
+	config, err := parseNetworkOptions(option)
+	if err != nil {
+		return err
+	}
+
+	mode, _ := parseMode(config.Mode)
+
+	if _, err = netlink.LinkByName(config.Parent); err != nil {
+		return ParentNotFoundError(config.Parent)
+	}
+
+	ipamName, _ := option[netlabel.IpamDriver].(string)
+	ipam, err := d.dc.GetIpam(ipamName)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	if _, ok := d.networks[id]; ok {
+		d.Unlock()
+		return &ErrNetworkExists{}
+	}
+
+	network := &ipvlanNetwork{
+		id:        id,
+		config:    config,
+		mode:      mode,
+		endpoints: make(map[types.UUID]*ipvlanEndpoint),
+		ipam:      ipam,
+	}
+	d.networks[id] = network
+	d.Unlock()
+
+	// On failure make sure to remove the network handler from the driver
+	// and to give its address pools back
+	defer func() {
+		if err != nil {
+			network.releasePools()
+			d.Lock()
+			delete(d.networks, id)
+			d.Unlock()
+		}
+	}()
+
+	err = network.setupIPAM()
+	return err
+}
+
+// setupIPAM requests the subnets of the network to the IPAM driver and, in
+// l2 mode, reserves the gateway address.
+func (n *ipvlanNetwork) setupIPAM() error {
+	for _, s := range n.config.Subnets {
+		subnet := &net.IPNet{IP: s.IP.Mask(s.Mask), Mask: s.Mask}
+		v6 := s.IP.To4() == nil
+		poolID, _, _, err := n.ipam.RequestPool(ipamapi.LocalDefaultAddressSpace, subnet.String(), "", nil, v6)
+		if err != nil {
+			return err
+		}
+		n.pools = append(n.pools, &ipvlanPool{subnet: subnet, poolID: poolID, v6: v6})
+	}
+
+	// In l3 mode the parent routes the traffic, there is no gateway
+	if n.mode != netlink.IPVLAN_MODE_L2 {
+		return nil
+	}
+
+	// Without an explicit gateway the first address of the pool is taken.
+	// In l2 mode there is a single pool of each address family.
+	for _, p := range n.pools {
+		gw := n.config.DefaultGatewayIPv4
+		if p.v6 {
+			gw = n.config.DefaultGatewayIPv6
+		}
+		gwAddr, _, err := n.ipam.RequestAddress(p.poolID, gw, nil)
+		if err != nil {
+			return err
+		}
+		if p.v6 {
+			n.gatewayv6 = gwAddr.IP
+		} else {
+			n.gateway = gwAddr.IP
+		}
+	}
+
+	return nil
+}
+
+// releasePools gives the address pools of the network back to the IPAM driver
+func (n *ipvlanNetwork) releasePools() {
+	for _, p := range n.pools {
+		if err := n.ipam.ReleasePool(p.poolID); err != nil {
+			logrus.Warnf("Failed to release address pool %s of network %s: %v", p.poolID, n.id, err)
+		}
+	}
+	n.pools = nil
+}
+
+// requestAddress allocates an endpoint address from the first subnet of the
+// network of the address family which has one left, and returns it along
+// with the id of its pool.
+func (n *ipvlanNetwork) requestAddress(v6 bool) (*net.IPNet, string, error) {
+	for _, p := range n.pools {
+		if p.v6 != v6 {
+			continue
+		}
+		addr, _, err := n.ipam.RequestAddress(p.poolID, nil, nil)
+		if err == nil {
+			return addr, p.poolID, nil
+		}
+		if err != ipamapi.ErrNoAvailableIPs {
+			return nil, "", err
+		}
+	}
+
+	return nil, "", NoAddressError(n.id)
+}
+
+// hasIPv6 tells whether the network has IPv6 subnets
+func (n *ipvlanNetwork) hasIPv6() bool {
+	for _, p := range n.pools {
+		if p.v6 {
+			return true
+		}
+	}
+	return false
+}
+
+// poolOf returns the id of the pool of the network ip belongs to.
+func (n *ipvlanNetwork) poolOf(ip net.IP) (string, bool) {
+	for _, p := range n.pools {
+		if p.subnet.Contains(ip) {
+			return p.poolID, true
+		}
+	}
+
+	return "", false
+}
+
+func (d *driver) DeleteNetwork(nid types.UUID) error {
+	d.Lock()
+	n, ok := d.networks[nid]
+	if !ok {
+		d.Unlock()
+		return driverapi.ErrNoNetwork(nid)
+	}
+
+	// Cannot remove network if endpoints are still present
+	n.Lock()
+	numEps := len(n.endpoints)
+	n.Unlock()
+	if numEps != 0 {
+		d.Unlock()
+		return ActiveEndpointsError(n.id)
+	}
+
+	delete(d.networks, nid)
+	d.Unlock()
+
+	n.releasePools()
+
+	return nil
+}
+
+// linkName returns the name of the ipvlan link of the endpoint. It is derived
+// from the endpoint id so that a restored endpoint can find its link again:
+// all the links of a parent share its MAC address.
+func linkName(eid types.UUID) string {
+	id := string(eid)
+	if len(id) > linkIDLen {
+		id = id[:linkIDLen]
+	}
+	return linkPrefix + id
+}
+
+func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointInfo, epOptions map[string]interface{}) error {
+	var err error
+
+	if epInfo == nil {
+		return errors.New("invalid endpoint info passed")
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	config := n.config
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+
+	if ep != nil {
+		return driverapi.ErrEndpointExists(eid)
+	}
+
+	n.Lock()
+	endpoint := &ipvlanEndpoint{id: eid}
+	n.endpoints[eid] = endpoint
+	n.Unlock()
+
+	// On failure make sure to remove the endpoint
+	defer func() {
+		if err != nil {
+			n.Lock()
+			delete(n.endpoints, eid)
+			n.Unlock()
+		}
+	}()
+
+	// A restored endpoint takes over the address it was created with
+	if ifaces := epInfo.Interfaces(); len(ifaces) != 0 {
+		err = n.restoreEndpoint(endpoint, ifaces)
+		return err
+	}
+
+	parent, err := netlink.LinkByName(config.Parent)
+	if err != nil {
+		err = ParentNotFoundError(config.Parent)
+		return err
+	}
+
+	name := linkName(eid)
+	ipvlan := &netlink.IPVlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			ParentIndex: parent.Attrs().Index,
+			MTU:         config.Mtu,
+		},
+		Mode: n.mode,
+	}
+	if err = netlink.LinkAdd(ipvlan); err != nil {
+		return err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			netlink.LinkDel(link)
+		}
+	}()
+
+	addr, poolID, err := n.requestAddress(false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			n.ipam.ReleaseAddress(poolID, addr.IP)
+		}
+	}()
+
+	addrv6 := &net.IPNet{}
+	if n.hasIPv6() {
+		if addrv6, endpoint.poolIDv6, err = n.requestAddress(true); err != nil {
+			return err
+		}
+		endpoint.addrv6 = addrv6
+		defer func() {
+			if err != nil {
+				n.ipam.ReleaseAddress(endpoint.poolIDv6, addrv6.IP)
+			}
+		}()
+	}
+
+	// The ipvlan links all carry the address of their parent
+	endpoint.srcName = name
+	endpoint.macAddress = link.Attrs().HardwareAddr
+	endpoint.addr = addr
+	endpoint.poolID = poolID
+
+	err = epInfo.AddInterface(ifaceID, endpoint.macAddress, *addr, *addrv6)
+	return err
+}
+
+// restoreEndpoint reserves the address of an interface which was created by
+// a previous instance of the driver.
+func (n *ipvlanNetwork) restoreEndpoint(endpoint *ipvlanEndpoint, ifaces []driverapi.InterfaceInfo) error {
+	if len(ifaces) != 1 || ifaces[0].ID() != ifaceID {
+		return errors.New("invalid interface list passed to ipvlan driver")
+	}
+
+	iface := ifaces[0]
+	addr := iface.Address()
+	if addr.IP == nil {
+		return errors.New("no IPv4 address in the interface passed to ipvlan driver")
+	}
+
+	poolID, ok := n.poolOf(addr.IP)
+	if !ok {
+		return RestoredAddressError(addr.IP.String())
+	}
+
+	if _, _, err := n.ipam.RequestAddress(poolID, addr.IP, nil); err != nil {
+		return err
+	}
+
+	if addrv6 := iface.AddressIPv6(); addrv6.IP != nil {
+		poolIDv6, ok := n.poolOf(addrv6.IP)
+		if !ok {
+			n.ipam.ReleaseAddress(poolID, addr.IP)
+			return RestoredAddressError(addrv6.IP.String())
+		}
+		if _, _, err := n.ipam.RequestAddress(poolIDv6, addrv6.IP, nil); err != nil {
+			n.ipam.ReleaseAddress(poolID, addr.IP)
+			return err
+		}
+		endpoint.addrv6 = &addrv6
+		endpoint.poolIDv6 = poolIDv6
+	}
+
+	// The link is still in the host namespace only if the endpoint was
+	// never joined. Otherwise libnetwork keeps the name it was moved with.
+	if _, err := netlink.LinkByName(linkName(endpoint.id)); err == nil {
+		endpoint.srcName = linkName(endpoint.id)
+	}
+	endpoint.macAddress = iface.MacAddress()
+	endpoint.addr = &addr
+	endpoint.poolID = poolID
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	if err := n.ipam.ReleaseAddress(ep.poolID, ep.addr.IP); err != nil {
+		return err
+	}
+	if ep.addrv6 != nil {
+		if err := n.ipam.ReleaseAddress(ep.poolIDv6, ep.addrv6.IP); err != nil {
+			logrus.Warnf("Failed to release IPv6 address %s of endpoint %s: %v", ep.addrv6.IP, eid, err)
+		}
+	}
+
+	n.Lock()
+	delete(n.endpoints, eid)
+	n.Unlock()
+
+	// Discard error: the link may have been deleted along with the sandbox
+	if link, err := netlink.LinkByName(linkName(eid)); err == nil {
+		netlink.LinkDel(link)
+	}
+
+	return nil
+}
+
+func (d *driver) EndpointOperInfo(nid, eid types.UUID) (map[string]interface{}, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return nil, err
+	}
+	if ep == nil {
+		return nil, driverapi.ErrNoEndpoint(eid)
+	}
+
+	m := make(map[string]interface{})
+	if len(ep.macAddress) != 0 {
+		m[netlabel.MacAddress] = ep.macAddress
+	}
+
+	return m, nil
+}
+
+// Join method is invoked when a Sandbox is attached to an endpoint.
+func (d *driver) Join(nid, eid types.UUID, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	for _, iNames := range jinfo.InterfaceNames() {
+		// A restored endpoint does not know the name of its link
+		if iNames.ID() == ifaceID && ep.srcName != "" {
+			if err := iNames.SetNames(ep.srcName, containerIface); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.mode == netlink.IPVLAN_MODE_L2 {
+		if err := jinfo.SetGateway(n.gateway); err != nil {
+			return err
+		}
+		if ep.addrv6 != nil {
+			return jinfo.SetGatewayIPv6(n.gatewayv6)
+		}
+		return nil
+	}
+
+	// In l3 mode the other subnets of the network are reached on-link, the
+	// parent routing between them. The subnet of the endpoint address is
+	// already routed by the kernel, as is the one of its IPv6 address.
+	for _, p := range n.pools {
+		if p.subnet.Contains(ep.addr.IP) || (ep.addrv6 != nil && p.subnet.Contains(ep.addrv6.IP)) {
+			continue
+		}
+		if err := jinfo.AddStaticRoute(p.subnet, types.CONNECTED, nil, ifaceID); err != nil {
+			return err
+		}
+	}
+
+	// Everything else goes on-link too, the parent being the router
+	if err := jinfo.AddStaticRoute(defaultRoute, types.CONNECTED, nil, ifaceID); err != nil {
+		return err
+	}
+	if ep.addrv6 != nil {
+		return jinfo.AddStaticRoute(defaultRouteIPv6, types.CONNECTED, nil, ifaceID)
+	}
+
+	return nil
+}
+
+// Leave method is invoked when a Sandbox detaches from an endpoint.
+func (d *driver) Leave(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	return nil
+}
+
+func (d *driver) Type() string {
+	return networkType
+}
@@ -0,0 +1,334 @@
+package ipvlan
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const parentName = "veth0"
+
+func networkOption(config *NetworkConfiguration) map[string]interface{} {
+	return map[string]interface{}{netlabel.GenericData: config}
+}
+
+func parseCIDR(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestParseMode(t *testing.T) {
+	for name, mode := range map[string]netlink.IPVlanMode{
+		"":   netlink.IPVLAN_MODE_L2,
+		"l2": netlink.IPVLAN_MODE_L2,
+		"L3": netlink.IPVLAN_MODE_L3,
+	} {
+		m, err := parseMode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != mode {
+			t.Fatalf("Unexpected mode %d for %q. Expected %d", m, name, mode)
+		}
+	}
+
+	if _, err := parseMode("bridge"); err == nil {
+		t.Fatalf("Expected failure parsing an invalid mode")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+}
+
+func TestCreateNetworkInvalidConfig(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback())
+
+	subnet := parseCIDR(t, "192.168.100.0/24")
+	other := parseCIDR(t, "192.168.200.0/24")
+
+	for _, config := range []*NetworkConfiguration{
+		{Subnets: []*net.IPNet{subnet}},
+		{Parent: parentName},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet}, Mode: "private"},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet, other}},
+		{Parent: parentName, Subnets: []*net.IPNet{parseCIDR(t, "2001:db8:1::/64")}, Mode: "l3"},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet, parseCIDR(t, "2001:db8:1::/64"), parseCIDR(t, "2001:db8:2::/64")}},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet, parseCIDR(t, "192.168.0.0/16")}, Mode: "l3"},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet}, DefaultGatewayIPv4: net.ParseIP("192.168.200.1")},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet}, Mode: "l3", DefaultGatewayIPv4: net.ParseIP("192.168.100.1")},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet}, DefaultGatewayIPv6: net.ParseIP("2001:db8:1::1")},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet, parseCIDR(t, "2001:db8:1::/64")}, DefaultGatewayIPv6: net.ParseIP("2001:db8:2::1")},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet, parseCIDR(t, "2001:db8:1::/64")}, Mode: "l3", DefaultGatewayIPv6: net.ParseIP("2001:db8:1::1")},
+		{Parent: parentName, Subnets: []*net.IPNet{subnet}, Mtu: -1},
+	} {
+		err := d.CreateNetwork("dummy", networkOption(config))
+		if err == nil {
+			t.Fatalf("Expected failure creating a network with config %v", config)
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Failed for unexpected reason: %v", err)
+		}
+	}
+
+	err := d.CreateNetwork("dummy", networkOption(&NetworkConfiguration{Parent: "nolink0", Subnets: []*net.IPNet{subnet}}))
+	if _, ok := err.(types.NotFoundError); !ok {
+		t.Fatalf("Expected a not found error for a missing parent link, got: %v", err)
+	}
+
+	if err := d.CreateNetwork("dummy", map[string]interface{}{}); err == nil {
+		t.Fatalf("Expected failure creating a network without config")
+	}
+}
+
+func TestRequestAddressMultipleSubnets(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	first := parseCIDR(t, "192.168.100.0/30")
+	second := parseCIDR(t, "192.168.200.0/24")
+	config := &NetworkConfiguration{Parent: parentName, Mode: "l3", Subnets: []*net.IPNet{first, second}}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an ipvlan network: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.gateway != nil {
+		t.Fatalf("Unexpected gateway %s reserved in l3 mode", n.gateway)
+	}
+
+	// The first subnet has two usable addresses, the next one spills over
+	for i, s := range []*net.IPNet{first, first, second} {
+		addr, poolID, err := n.requestAddress(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Contains(addr.IP) {
+			t.Fatalf("Address %d %s not allocated from the expected subnet %s", i, addr.IP, s)
+		}
+		if id, _ := n.poolOf(addr.IP); id != poolID {
+			t.Fatalf("Address %s allocated from pool %s, expected %s", addr.IP, poolID, id)
+		}
+	}
+}
+
+func TestJoinL2GatewayIPv6(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	subnets := []*net.IPNet{
+		parseCIDR(t, "192.168.100.0/24"),
+		parseCIDR(t, "2001:db8:1::/64"),
+	}
+	gw6 := net.ParseIP("2001:db8:1::254")
+	config := &NetworkConfiguration{Parent: parentName, Subnets: subnets, DefaultGatewayIPv6: gw6}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an ipvlan network: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bypass the link creation, only the gateways are checked
+	addr := &net.IPNet{IP: net.ParseIP("192.168.100.10"), Mask: subnets[0].Mask}
+	addrv6 := &net.IPNet{IP: net.ParseIP("2001:db8:1::10"), Mask: subnets[1].Mask}
+	n.endpoints["ep1"] = &ipvlanEndpoint{id: "ep1", srcName: linkName("ep1"), addr: addr, addrv6: addrv6}
+	n.endpoints["ep2"] = &ipvlanEndpoint{id: "ep2", srcName: linkName("ep2"), addr: addr}
+
+	te := &testutils.Endpoint{}
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	if !te.Gateway.Equal(net.ParseIP("192.168.100.1")) {
+		t.Fatalf("Unexpected gateway %s. Expected the first address of the subnet", te.Gateway)
+	}
+	if !te.GatewayIPv6.Equal(gw6) {
+		t.Fatalf("Unexpected IPv6 gateway %s. Expected %s", te.GatewayIPv6, gw6)
+	}
+	if len(te.Routes) != 0 {
+		t.Fatalf("Unexpected static routes in l2 mode: %v", te.Routes)
+	}
+
+	// An endpoint without an IPv6 address gets no IPv6 gateway
+	te = &testutils.Endpoint{}
+	if err := d.Join("net1", "ep2", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+	if te.GatewayIPv6 != nil {
+		t.Fatalf("Unexpected IPv6 gateway %s for an IPv4 only endpoint", te.GatewayIPv6)
+	}
+}
+
+func TestJoinL3Routes(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	subnets := []*net.IPNet{
+		parseCIDR(t, "192.168.100.0/24"),
+		parseCIDR(t, "192.168.200.0/24"),
+		parseCIDR(t, "10.10.0.0/16"),
+	}
+	config := &NetworkConfiguration{Parent: parentName, Mode: "l3", Subnets: subnets}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an ipvlan network: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bypass the link creation, only the routes are checked
+	addr := &net.IPNet{IP: net.ParseIP("192.168.200.10"), Mask: subnets[1].Mask}
+	n.endpoints["ep1"] = &ipvlanEndpoint{id: "ep1", srcName: linkName("ep1"), addr: addr}
+
+	te := &testutils.Endpoint{}
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	if te.Gateway != nil {
+		t.Fatalf("Unexpected gateway %s set in l3 mode", te.Gateway)
+	}
+
+	if len(te.Routes) != 3 {
+		t.Fatalf("Expected 3 static routes, got %d", len(te.Routes))
+	}
+
+	for i, s := range []*net.IPNet{subnets[0], subnets[2], defaultRoute} {
+		r := te.Routes[i]
+		if !types.CompareIPNet(r.Destination, s) || r.RouteType != types.CONNECTED || r.InterfaceID != ifaceID {
+			t.Fatalf("Unexpected static route %d: %v. Expected an on-link route to %s", i, r, s)
+		}
+	}
+
+	// An address outside every subnet is routed through the endpoint
+	if r := te.Route(net.ParseIP("8.8.8.8")); r == nil || r.InterfaceID != ifaceID {
+		t.Fatalf("Expected a route to an address outside the network subnets, got %v", r)
+	}
+	if r := te.Route(net.ParseIP("2001:db8::1")); r != nil {
+		t.Fatalf("Unexpected IPv6 route %v without an IPv6 subnet", r)
+	}
+}
+
+func TestJoinL3RoutesIPv6(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	subnets := []*net.IPNet{
+		parseCIDR(t, "192.168.100.0/24"),
+		parseCIDR(t, "2001:db8:1::/64"),
+	}
+	config := &NetworkConfiguration{Parent: parentName, Mode: "l3", Subnets: subnets}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an ipvlan network: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := &net.IPNet{IP: net.ParseIP("192.168.100.10"), Mask: subnets[0].Mask}
+	addrv6 := &net.IPNet{IP: net.ParseIP("2001:db8:1::10"), Mask: subnets[1].Mask}
+	n.endpoints["ep1"] = &ipvlanEndpoint{id: "ep1", srcName: linkName("ep1"), addr: addr, addrv6: addrv6}
+
+	te := &testutils.Endpoint{}
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	// The subnets of both endpoint addresses are routed by the kernel
+	if len(te.Routes) != 2 {
+		t.Fatalf("Expected only the default routes, got %v", te.Routes)
+	}
+
+	for _, ip := range []string{"8.8.8.8", "2001:db8:2::1"} {
+		if r := te.Route(net.ParseIP(ip)); r == nil || r.RouteType != types.CONNECTED || r.InterfaceID != ifaceID {
+			t.Fatalf("Expected an on-link route to %s, got %v", ip, r)
+		}
+	}
+}
+
+func TestCreateEndpointJoin(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	parent := testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback())
+
+	subnet := parseCIDR(t, "192.168.100.0/24")
+	config := &NetworkConfiguration{Parent: parentName, Subnets: []*net.IPNet{subnet}}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an ipvlan network: %v", err)
+	}
+
+	te := &testutils.Endpoint{}
+	err := d.CreateEndpoint("net1", "ep1", te, nil)
+	if errno, ok := err.(syscall.Errno); ok && errno == syscall.EOPNOTSUPP {
+		t.Skip("Kernel does not support ipvlan links")
+	}
+	if err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	if len(te.Ifaces) != 1 {
+		t.Fatalf("Expected one interface, got %d", len(te.Ifaces))
+	}
+	iface := te.Ifaces[0]
+
+	if !subnet.Contains(iface.Addr.IP) || iface.Addr.IP.Equal(net.ParseIP("192.168.100.1")) {
+		t.Fatalf("Unexpected address %s allocated to the endpoint", iface.Addr.IP)
+	}
+
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	if !te.Gateway.Equal(net.ParseIP("192.168.100.1")) {
+		t.Fatalf("Unexpected gateway %s. Expected the first address of the subnet", te.Gateway)
+	}
+
+	link, err := netlink.LinkByName(iface.SrcName)
+	if err != nil {
+		t.Fatalf("Could not find the ipvlan link %s: %v", iface.SrcName, err)
+	}
+
+	if link.Type() != "ipvlan" || link.Attrs().ParentIndex != parent.Attrs().Index {
+		t.Fatalf("Link %s is not an ipvlan link of %s", iface.SrcName, parentName)
+	}
+
+	if err := d.DeleteNetwork("net1"); err == nil {
+		t.Fatalf("Expected failure deleting a network with active endpoints")
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := netlink.LinkByName(iface.SrcName); err == nil {
+		t.Fatalf("Ipvlan link %s still present after the endpoint deletion", iface.SrcName)
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package macvlan
+
+import "fmt"
+
+// ErrInvalidNetworkConfig error is returned when a network is created on a driver without valid config.
+type ErrInvalidNetworkConfig struct{}
+
+func (einc *ErrInvalidNetworkConfig) Error() string {
+	return "trying to create a network on a driver without valid config"
+}
+
+// Forbidden denotes the type of this error
+func (einc *ErrInvalidNetworkConfig) Forbidden() {}
+
+// ErrInvalidEndpointConfig error is returned when a endpoint create is attempted with an invalid endpoint configuration.
+type ErrInvalidEndpointConfig struct{}
+
+func (eiec *ErrInvalidEndpointConfig) Error() string {
+	return "trying to create an endpoint with an invalid endpoint configuration"
+}
+
+// BadRequest denotes the type of this error
+func (eiec *ErrInvalidEndpointConfig) BadRequest() {}
+
+// ErrNetworkExists error is returned when a network is created with the id of an existing network.
+type ErrNetworkExists struct{}
+
+func (ene *ErrNetworkExists) Error() string {
+	return "network already exists, macvlan can only have one network per id"
+}
+
+// Forbidden denotes the type of this error
+func (ene *ErrNetworkExists) Forbidden() {}
+
+// ErrNoParent error is returned when a network is created without a parent link.
+type ErrNoParent struct{}
+
+func (enp *ErrNoParent) Error() string {
+	return "a parent link is required to create a macvlan network"
+}
+
+// BadRequest denotes the type of this error
+func (enp *ErrNoParent) BadRequest() {}
+
+// ErrNoSubnet error is returned when a network is created without a subnet.
+type ErrNoSubnet struct{}
+
+func (ens *ErrNoSubnet) Error() string {
+	return "a subnet is required to create a macvlan network"
+}
+
+// BadRequest denotes the type of this error
+func (ens *ErrNoSubnet) BadRequest() {}
+
+// ErrInvalidGateway is returned when the user provided default gateway is not in the subnet.
+type ErrInvalidGateway struct{}
+
+func (eig *ErrInvalidGateway) Error() string {
+	return "default gateway ip must be part of the network"
+}
+
+// BadRequest denotes the type of this error
+func (eig *ErrInvalidGateway) BadRequest() {}
+
+// ErrInvalidMtu is returned when the user provided MTU is not valid.
+type ErrInvalidMtu int
+
+func (eim ErrInvalidMtu) Error() string {
+	return fmt.Sprintf("invalid MTU number: %d", int(eim))
+}
+
+// BadRequest denotes the type of this error
+func (eim ErrInvalidMtu) BadRequest() {}
+
+// InvalidModeError is returned when the macvlan mode of a network is not supported.
+type InvalidModeError string
+
+func (ime InvalidModeError) Error() string {
+	return fmt.Sprintf("invalid macvlan mode %q, expected one of bridge, private, vepa or passthru", string(ime))
+}
+
+// BadRequest denotes the type of this error
+func (ime InvalidModeError) BadRequest() {}
+
+// ParentNotFoundError is returned when the parent link of a network does not exist.
+type ParentNotFoundError string
+
+func (pnfe ParentNotFoundError) Error() string {
+	return fmt.Sprintf("parent link %s not found", string(pnfe))
+}
+
+// NotFound denotes the type of this error
+func (pnfe ParentNotFoundError) NotFound() {}
+
+// PassthruInUseError is returned when a second endpoint is created on a passthru network.
+type PassthruInUseError string
+
+func (piue PassthruInUseError) Error() string {
+	return fmt.Sprintf("network %s is in passthru mode and already has an endpoint", string(piue))
+}
+
+// Forbidden denotes the type of this error
+func (piue PassthruInUseError) Forbidden() {}
+
+// ActiveEndpointsError is returned when there are
+// still active endpoints in the network being deleted.
+type ActiveEndpointsError string
+
+func (aee ActiveEndpointsError) Error() string {
+	return fmt.Sprintf("network %s has active endpoint", string(aee))
+}
+
+// Forbidden denotes the type of this error
+func (aee ActiveEndpointsError) Forbidden() {}
+
+// InvalidNetworkIDError is returned when the passed
+// network id for an existing network is not a known id.
+type InvalidNetworkIDError string
+
+func (inie InvalidNetworkIDError) Error() string {
+	return fmt.Sprintf("invalid network id %s", string(inie))
+}
+
+// NotFound denotes the type of this error
+func (inie InvalidNetworkIDError) NotFound() {}
+
+// InvalidEndpointIDError is returned when the passed
+// endpoint id is not valid.
+type InvalidEndpointIDError string
+
+func (ieie InvalidEndpointIDError) Error() string {
+	return fmt.Sprintf("invalid endpoint id: %s", string(ieie))
+}
+
+// BadRequest denotes the type of this error
+func (ieie InvalidEndpointIDError) BadRequest() {}
+
+// EndpointNotFoundError is returned when the no endpoint
+// with the passed endpoint id is found.
+type EndpointNotFoundError string
+
+func (enfe EndpointNotFoundError) Error() string {
+	return fmt.Sprintf("endpoint not found: %s", string(enfe))
+}
+
+// NotFound denotes the type of this error
+func (enfe EndpointNotFoundError) NotFound() {}
@@ -0,0 +1,66 @@
+package macvlan
+
+import (
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Macvlan modes, as defined by the kernel
+const (
+	modePrivate  = 1
+	modeVepa     = 2
+	modeBridge   = 4
+	modePassthru = 8
+)
+
+// iflaMacvlanMode is the attribute carrying the mode of a macvlan link. The
+// vendored netlink library cannot set it, hence the links are created with
+// a handcrafted request.
+const iflaMacvlanMode = 1
+
+var macvlanModes = map[string]uint32{
+	"private":  modePrivate,
+	"vepa":     modeVepa,
+	"bridge":   modeBridge,
+	"passthru": modePassthru,
+}
+
+// parseMode returns the kernel value of the named macvlan mode, bridge if
+// the name is empty.
+func parseMode(mode string) (uint32, error) {
+	if mode == "" {
+		return modeBridge, nil
+	}
+
+	m, ok := macvlanModes[strings.ToLower(mode)]
+	if !ok {
+		return 0, InvalidModeError(mode)
+	}
+
+	return m, nil
+}
+
+// createMacvlan creates the macvlan link name, sub interface of parent in the
+// passed mode.
+func createMacvlan(name string, parent netlink.Link, mode uint32, mtu int) error {
+	req := nl.NewNetlinkRequest(syscall.RTM_NEWLINK, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(syscall.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(syscall.IFLA_LINK, nl.Uint32Attr(uint32(parent.Attrs().Index))))
+	req.AddData(nl.NewRtAttr(syscall.IFLA_IFNAME, nl.ZeroTerminated(name)))
+
+	if mtu > 0 {
+		req.AddData(nl.NewRtAttr(syscall.IFLA_MTU, nl.Uint32Attr(uint32(mtu))))
+	}
+
+	linkInfo := nl.NewRtAttr(syscall.IFLA_LINKINFO, nil)
+	nl.NewRtAttrChild(linkInfo, nl.IFLA_INFO_KIND, nl.NonZeroTerminated("macvlan"))
+	data := nl.NewRtAttrChild(linkInfo, nl.IFLA_INFO_DATA, nil)
+	nl.NewRtAttrChild(data, iflaMacvlanMode, nl.Uint32Attr(mode))
+	req.AddData(linkInfo)
+
+	_, err := req.Execute(syscall.NETLINK_ROUTE, 0)
+	return err
+}
@@ -0,0 +1,534 @@
+package macvlan
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	networkType    = "macvlan"
+	linkPrefix     = "macv"
+	linkLen        = 7
+	containerIface = "eth0"
+	ifaceID        = 1
+)
+
+// NetworkConfiguration for network specific configuration
+type NetworkConfiguration struct {
+	// Parent is the name of the host link the macvlan links are created on
+	Parent string
+	// Mode is one of bridge (default), private, vepa or passthru
+	Mode string
+	// Subnet is the network of the L2 segment the containers are attached to
+	Subnet *net.IPNet
+	// DefaultGatewayIPv4 is the gateway of the segment, the first address of
+	// the subnet if not specified
+	DefaultGatewayIPv4 net.IP
+	Mtu                int
+}
+
+// EndpointConfiguration represents the user specified configuration for the sandbox endpoint
+type EndpointConfiguration struct {
+	MacAddress net.HardwareAddr
+}
+
+type macvlanEndpoint struct {
+	id         types.UUID
+	srcName    string
+	macAddress net.HardwareAddr
+	addr       *net.IPNet
+}
+
+type macvlanNetwork struct {
+	id        types.UUID
+	config    *NetworkConfiguration
+	mode      uint32
+	gateway   net.IP
+	endpoints map[types.UUID]*macvlanEndpoint // key: endpoint id
+	ipam      ipamapi.Ipam                    // The IPAM driver managing the network addresses
+	poolID    string
+	sync.Mutex
+}
+
+type driver struct {
+	networks map[types.UUID]*macvlanNetwork
+	dc       driverapi.DriverCallback
+	sync.Mutex
+}
+
+// New constructs a new macvlan driver
+func newDriver(dc driverapi.DriverCallback) driverapi.Driver {
+	return &driver{networks: map[types.UUID]*macvlanNetwork{}, dc: dc}
+}
+
+// Init registers a new instance of macvlan driver
+func Init(dc driverapi.DriverCallback) error {
+	c := driverapi.Capability{
+		Scope: driverapi.LocalScope,
+	}
+	return dc.RegisterDriver(networkType, newDriver(dc), c)
+}
+
+// Validate performs a static validation on the network configuration parameters.
+// Whatever can be assessed a priori before attempting any programming.
+func (c *NetworkConfiguration) Validate() error {
+	if c.Parent == "" {
+		return &ErrNoParent{}
+	}
+
+	if _, err := parseMode(c.Mode); err != nil {
+		return err
+	}
+
+	if c.Subnet == nil {
+		return &ErrNoSubnet{}
+	}
+
+	if c.DefaultGatewayIPv4 != nil && !c.Subnet.Contains(c.DefaultGatewayIPv4) {
+		return &ErrInvalidGateway{}
+	}
+
+	if c.Mtu < 0 {
+		return ErrInvalidMtu(c.Mtu)
+	}
+
+	return nil
+}
+
+func (n *macvlanNetwork) getEndpoint(eid types.UUID) (*macvlanEndpoint, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if eid == "" {
+		return nil, InvalidEndpointIDError(eid)
+	}
+
+	if ep, ok := n.endpoints[eid]; ok {
+		return ep, nil
+	}
+
+	return nil, nil
+}
+
+func (d *driver) Config(option map[string]interface{}) error {
+	return nil
+}
+
+func (d *driver) getNetwork(id types.UUID) (*macvlanNetwork, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if id == "" {
+		return nil, InvalidNetworkIDError(id)
+	}
+
+	if nw, ok := d.networks[id]; ok {
+		return nw, nil
+	}
+
+	return nil, driverapi.ErrNoNetwork(id)
+}
+
+func parseNetworkOptions(option options.Generic) (*NetworkConfiguration, error) {
+	var config *NetworkConfiguration
+
+	switch opt := option[netlabel.GenericData].(type) {
+	case options.Generic:
+		opaqueConfig, err := options.GenerateFromModel(opt, &NetworkConfiguration{})
+		if err != nil {
+			return nil, err
+		}
+		config = opaqueConfig.(*NetworkConfiguration)
+	case *NetworkConfiguration:
+		config = opt
+	default:
+		return nil, &ErrInvalidNetworkConfig{}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Create a new network using macvlan plugin
+func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) error {
+	var err error
+
+	config, err := parseNetworkOptions(option)
+	if err != nil {
+		return err
+	}
+
+	mode, _ := parseMode(config.Mode)
+
+	if _, err = netlink.LinkByName(config.Parent); err != nil {
+		return ParentNotFoundError(config.Parent)
+	}
+
+	ipamName, _ := option[netlabel.IpamDriver].(string)
+	ipam, err := d.dc.GetIpam(ipamName)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	if _, ok := d.networks[id]; ok {
+		d.Unlock()
+		return &ErrNetworkExists{}
+	}
+
+	network := &macvlanNetwork{
+		id:        id,
+		config:    config,
+		mode:      mode,
+		endpoints: make(map[types.UUID]*macvlanEndpoint),
+		ipam:      ipam,
+	}
+	d.networks[id] = network
+	d.Unlock()
+
+	// On failure make sure to remove the network handler from the driver
+	// and to give its address pool back
+	defer func() {
+		if err != nil {
+			network.releasePool()
+			d.Lock()
+			delete(d.networks, id)
+			d.Unlock()
+		}
+	}()
+
+	err = network.setupIPAM()
+	return err
+}
+
+// setupIPAM requests the subnet of the network to the IPAM driver and
+// reserves the gateway address in it.
+func (n *macvlanNetwork) setupIPAM() error {
+	subnet := &net.IPNet{IP: n.config.Subnet.IP.Mask(n.config.Subnet.Mask), Mask: n.config.Subnet.Mask}
+	poolID, _, _, err := n.ipam.RequestPool(ipamapi.LocalDefaultAddressSpace, subnet.String(), "", nil, false)
+	if err != nil {
+		return err
+	}
+	n.poolID = poolID
+
+	// Without an explicit gateway the first address of the pool is taken
+	gwAddr, _, err := n.ipam.RequestAddress(poolID, n.config.DefaultGatewayIPv4, nil)
+	if err != nil {
+		return err
+	}
+	n.gateway = gwAddr.IP
+
+	return nil
+}
+
+// releasePool gives the address pool of the network back to the IPAM driver
+func (n *macvlanNetwork) releasePool() {
+	if n.poolID == "" {
+		return
+	}
+
+	if err := n.ipam.ReleasePool(n.poolID); err != nil {
+		logrus.Warnf("Failed to release address pool %s of network %s: %v", n.poolID, n.id, err)
+	}
+	n.poolID = ""
+}
+
+func (d *driver) DeleteNetwork(nid types.UUID) error {
+	d.Lock()
+	n, ok := d.networks[nid]
+	if !ok {
+		d.Unlock()
+		return driverapi.ErrNoNetwork(nid)
+	}
+
+	// Cannot remove network if endpoints are still present
+	n.Lock()
+	numEps := len(n.endpoints)
+	n.Unlock()
+	if numEps != 0 {
+		d.Unlock()
+		return ActiveEndpointsError(n.id)
+	}
+
+	delete(d.networks, nid)
+	d.Unlock()
+
+	n.releasePool()
+
+	return nil
+}
+
+func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointInfo, epOptions map[string]interface{}) error {
+	var err error
+
+	if epInfo == nil {
+		return errors.New("invalid endpoint info passed")
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	config := n.config
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+
+	if ep != nil {
+		return driverapi.ErrEndpointExists(eid)
+	}
+
+	epConfig, err := parseEndpointOptions(epOptions)
+	if err != nil {
+		return err
+	}
+
+	// A passthru link takes the whole parent over
+	n.Lock()
+	if n.mode == modePassthru && len(n.endpoints) != 0 {
+		n.Unlock()
+		return PassthruInUseError(nid)
+	}
+	endpoint := &macvlanEndpoint{id: eid}
+	n.endpoints[eid] = endpoint
+	n.Unlock()
+
+	// On failure make sure to remove the endpoint
+	defer func() {
+		if err != nil {
+			n.Lock()
+			delete(n.endpoints, eid)
+			n.Unlock()
+		}
+	}()
+
+	// A restored endpoint takes over the macvlan link holding its address
+	if ifaces := epInfo.Interfaces(); len(ifaces) != 0 {
+		err = n.restoreEndpoint(endpoint, ifaces)
+		return err
+	}
+
+	parent, err := netlink.LinkByName(config.Parent)
+	if err != nil {
+		err = ParentNotFoundError(config.Parent)
+		return err
+	}
+
+	name, err := netutils.GenerateIfaceName(linkPrefix, linkLen)
+	if err != nil {
+		return err
+	}
+
+	if err = createMacvlan(name, parent, n.mode, config.Mtu); err != nil {
+		return err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			netlink.LinkDel(link)
+		}
+	}()
+
+	// A passthru link inherits the address of its parent
+	mac := link.Attrs().HardwareAddr
+	if n.mode != modePassthru {
+		mac = electMacAddress(epConfig)
+		if err = netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			return err
+		}
+	}
+
+	addr, _, err := n.ipam.RequestAddress(n.poolID, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			n.ipam.ReleaseAddress(n.poolID, addr.IP)
+		}
+	}()
+
+	endpoint.srcName = name
+	endpoint.macAddress = mac
+	endpoint.addr = addr
+
+	err = epInfo.AddInterface(ifaceID, mac, *addr, net.IPNet{})
+	return err
+}
+
+// restoreEndpoint reserves the address of an interface which was created by
+// a previous instance of the driver.
+func (n *macvlanNetwork) restoreEndpoint(endpoint *macvlanEndpoint, ifaces []driverapi.InterfaceInfo) error {
+	if len(ifaces) != 1 || ifaces[0].ID() != ifaceID {
+		return errors.New("invalid interface list passed to macvlan driver")
+	}
+
+	iface := ifaces[0]
+	addr := iface.Address()
+	if addr.IP == nil {
+		return errors.New("no IPv4 address in the interface passed to macvlan driver")
+	}
+
+	if _, _, err := n.ipam.RequestAddress(n.poolID, addr.IP, nil); err != nil {
+		return err
+	}
+
+	// The link is still in the host namespace only if the endpoint was
+	// never joined. Otherwise libnetwork keeps the name it was moved with.
+	endpoint.macAddress = iface.MacAddress()
+	if link := netutils.LinkByMacAddress(endpoint.macAddress, "macvlan"); link != nil {
+		endpoint.srcName = link.Attrs().Name
+	}
+	endpoint.addr = &addr
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	if err := n.ipam.ReleaseAddress(n.poolID, ep.addr.IP); err != nil {
+		return err
+	}
+
+	n.Lock()
+	delete(n.endpoints, eid)
+	n.Unlock()
+
+	// Discard error: the link may have been deleted along with the sandbox
+	if ep.srcName != "" {
+		if link, err := netlink.LinkByName(ep.srcName); err == nil {
+			netlink.LinkDel(link)
+		}
+	} else if link := netutils.LinkByMacAddress(ep.macAddress, "macvlan"); link != nil {
+		netlink.LinkDel(link)
+	}
+
+	return nil
+}
+
+func (d *driver) EndpointOperInfo(nid, eid types.UUID) (map[string]interface{}, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return nil, err
+	}
+	if ep == nil {
+		return nil, driverapi.ErrNoEndpoint(eid)
+	}
+
+	m := make(map[string]interface{})
+	if len(ep.macAddress) != 0 {
+		m[netlabel.MacAddress] = ep.macAddress
+	}
+
+	return m, nil
+}
+
+// Join method is invoked when a Sandbox is attached to an endpoint.
+func (d *driver) Join(nid, eid types.UUID, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	for _, iNames := range jinfo.InterfaceNames() {
+		// A restored endpoint does not know the name of its link
+		if iNames.ID() == ifaceID && ep.srcName != "" {
+			if err := iNames.SetNames(ep.srcName, containerIface); err != nil {
+				return err
+			}
+		}
+	}
+
+	return jinfo.SetGateway(n.gateway)
+}
+
+// Leave method is invoked when a Sandbox detaches from an endpoint.
+func (d *driver) Leave(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	return nil
+}
+
+func (d *driver) Type() string {
+	return networkType
+}
+
+func parseEndpointOptions(epOptions map[string]interface{}) (*EndpointConfiguration, error) {
+	if epOptions == nil {
+		return nil, nil
+	}
+
+	ec := &EndpointConfiguration{}
+
+	if opt, ok := epOptions[netlabel.MacAddress]; ok {
+		if mac, ok := opt.(net.HardwareAddr); ok {
+			ec.MacAddress = mac
+		} else {
+			return nil, &ErrInvalidEndpointConfig{}
+		}
+	}
+
+	return ec, nil
+}
+
+func electMacAddress(epConfig *EndpointConfiguration) net.HardwareAddr {
+	if epConfig != nil && epConfig.MacAddress != nil {
+		return epConfig.MacAddress
+	}
+	return netutils.GenerateRandomMAC()
+}
@@ -0,0 +1,196 @@
+package macvlan
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const parentName = "dummy0"
+
+func networkOption(config *NetworkConfiguration) map[string]interface{} {
+	return map[string]interface{}{netlabel.GenericData: config}
+}
+
+func TestParseMode(t *testing.T) {
+	for name, mode := range map[string]uint32{
+		"":         modeBridge,
+		"bridge":   modeBridge,
+		"private":  modePrivate,
+		"VEPA":     modeVepa,
+		"passthru": modePassthru,
+	} {
+		m, err := parseMode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != mode {
+			t.Fatalf("Unexpected mode %d for %q. Expected %d", m, name, mode)
+		}
+	}
+
+	if _, err := parseMode("l2"); err == nil {
+		t.Fatalf("Expected failure parsing an invalid mode")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+}
+
+func TestCreateNetworkInvalidConfig(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback())
+
+	_, subnet, _ := net.ParseCIDR("192.168.100.0/24")
+
+	for _, config := range []*NetworkConfiguration{
+		{Subnet: subnet},
+		{Parent: parentName},
+		{Parent: parentName, Subnet: subnet, Mode: "l3"},
+		{Parent: parentName, Subnet: subnet, DefaultGatewayIPv4: net.ParseIP("192.168.200.1")},
+		{Parent: parentName, Subnet: subnet, Mtu: -1},
+	} {
+		err := d.CreateNetwork("dummy", networkOption(config))
+		if err == nil {
+			t.Fatalf("Expected failure creating a network with config %v", config)
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Failed for unexpected reason: %v", err)
+		}
+	}
+
+	err := d.CreateNetwork("dummy", networkOption(&NetworkConfiguration{Parent: "nolink0", Subnet: subnet}))
+	if _, ok := err.(types.NotFoundError); !ok {
+		t.Fatalf("Expected a not found error for a missing parent link, got: %v", err)
+	}
+
+	if err := d.CreateNetwork("dummy", map[string]interface{}{}); err == nil {
+		t.Fatalf("Expected failure creating a network without config")
+	}
+}
+
+func TestCreateEndpointJoin(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	parent := testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback())
+
+	_, subnet, _ := net.ParseCIDR("192.168.100.0/24")
+	config := &NetworkConfiguration{Parent: parentName, Mode: "private", Subnet: subnet}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create a macvlan network: %v", err)
+	}
+
+	mac, _ := net.ParseMAC("02:42:c0:a8:64:0a")
+	te := &testutils.Endpoint{}
+	if err := d.CreateEndpoint("net1", "ep1", te, map[string]interface{}{netlabel.MacAddress: mac}); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	if len(te.Ifaces) != 1 {
+		t.Fatalf("Expected one interface, got %d", len(te.Ifaces))
+	}
+	iface := te.Ifaces[0]
+
+	if !bytes.Equal(iface.Mac, mac) {
+		t.Fatalf("Unexpected mac address %s. Expected %s", iface.Mac, mac)
+	}
+
+	if !subnet.Contains(iface.Addr.IP) || iface.Addr.IP.Equal(net.ParseIP("192.168.100.1")) {
+		t.Fatalf("Unexpected address %s allocated to the endpoint", iface.Addr.IP)
+	}
+
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	if !te.Gateway.Equal(net.ParseIP("192.168.100.1")) {
+		t.Fatalf("Unexpected gateway %s. Expected the first address of the subnet", te.Gateway)
+	}
+
+	if iface.DstName != containerIface {
+		t.Fatalf("Unexpected container interface name %s", iface.DstName)
+	}
+
+	link, err := netlink.LinkByName(iface.SrcName)
+	if err != nil {
+		t.Fatalf("Could not find the macvlan link %s: %v", iface.SrcName, err)
+	}
+
+	if link.Type() != "macvlan" || link.Attrs().ParentIndex != parent.Attrs().Index {
+		t.Fatalf("Link %s is not a macvlan link of %s", iface.SrcName, parentName)
+	}
+
+	if !bytes.Equal(link.Attrs().HardwareAddr, mac) {
+		t.Fatalf("Unexpected mac address %s on the macvlan link. Expected %s", link.Attrs().HardwareAddr, mac)
+	}
+
+	if err := d.DeleteNetwork("net1"); err == nil {
+		t.Fatalf("Expected failure deleting a network with active endpoints")
+	}
+
+	if err := d.Leave("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := netlink.LinkByName(iface.SrcName); err == nil {
+		t.Fatalf("Macvlan link %s still present after the endpoint deletion", iface.SrcName)
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPassthruSingleEndpoint(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	parent := testutils.SetupParent(t, parentName)
+	d := newDriver(testutils.NewCallback())
+
+	_, subnet, _ := net.ParseCIDR("192.168.100.0/24")
+	config := &NetworkConfiguration{Parent: parentName, Mode: "passthru", Subnet: subnet, DefaultGatewayIPv4: net.ParseIP("192.168.100.254")}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create a macvlan network: %v", err)
+	}
+
+	te := &testutils.Endpoint{}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	// The passthru link keeps the address of its parent
+	if !bytes.Equal(te.Ifaces[0].Mac, parent.Attrs().HardwareAddr) {
+		t.Fatalf("Unexpected mac address %s. Expected the parent one %s", te.Ifaces[0].Mac, parent.Attrs().HardwareAddr)
+	}
+
+	if err := d.Join("net1", "ep1", "sandbox-key", te, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !te.Gateway.Equal(config.DefaultGatewayIPv4) {
+		t.Fatalf("Unexpected gateway %s. Expected %s", te.Gateway, config.DefaultGatewayIPv4)
+	}
+
+	err := d.CreateEndpoint("net1", "ep2", &testutils.Endpoint{}, nil)
+	if _, ok := err.(PassthruInUseError); !ok {
+		t.Fatalf("Expected failure creating a second passthru endpoint, got: %v", err)
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent is free again
+	if err := d.CreateEndpoint("net1", "ep2", &testutils.Endpoint{}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,179 @@
+package overlay
+
+import "fmt"
+
+// ErrConfigExists error is returned when driver already has a config applied.
+type ErrConfigExists struct{}
+
+func (ece *ErrConfigExists) Error() string {
+	return "configuration already exists, overlay configuration can be applied only once"
+}
+
+// Forbidden denotes the type of this error
+func (ece *ErrConfigExists) Forbidden() {}
+
+// ErrInvalidDriverConfig error is returned when overlay driver is passed an invalid config
+type ErrInvalidDriverConfig struct{}
+
+func (eidc *ErrInvalidDriverConfig) Error() string {
+	return "invalid configuration passed to overlay driver"
+}
+
+// BadRequest denotes the type of this error
+func (eidc *ErrInvalidDriverConfig) BadRequest() {}
+
+// ErrInvalidNetworkConfig error is returned when a network is created on a driver without valid config.
+type ErrInvalidNetworkConfig struct{}
+
+func (einc *ErrInvalidNetworkConfig) Error() string {
+	return "trying to create a network on a driver without valid config"
+}
+
+// Forbidden denotes the type of this error
+func (einc *ErrInvalidNetworkConfig) Forbidden() {}
+
+// ErrInvalidEndpointConfig error is returned when a endpoint create is attempted with an invalid endpoint configuration.
+type ErrInvalidEndpointConfig struct{}
+
+func (eiec *ErrInvalidEndpointConfig) Error() string {
+	return "trying to create an endpoint with an invalid endpoint configuration"
+}
+
+// BadRequest denotes the type of this error
+func (eiec *ErrInvalidEndpointConfig) BadRequest() {}
+
+// ErrNetworkExists error is returned when a network is created with the id of an existing network.
+type ErrNetworkExists struct{}
+
+func (ene *ErrNetworkExists) Error() string {
+	return "network already exists, overlay can only have one network per id"
+}
+
+// Forbidden denotes the type of this error
+func (ene *ErrNetworkExists) Forbidden() {}
+
+// ErrNoSubnet error is returned when a network is created without a subnet.
+type ErrNoSubnet struct{}
+
+func (ens *ErrNoSubnet) Error() string {
+	return "a subnet is required to create an overlay network"
+}
+
+// BadRequest denotes the type of this error
+func (ens *ErrNoSubnet) BadRequest() {}
+
+// ErrInvalidContainerSubnet is returned when the container subnet (FixedCIDR) is not valid.
+type ErrInvalidContainerSubnet struct{}
+
+func (eis *ErrInvalidContainerSubnet) Error() string {
+	return "container subnet must be a subset of the overlay network subnet"
+}
+
+// BadRequest denotes the type of this error
+func (eis *ErrInvalidContainerSubnet) BadRequest() {}
+
+// ErrInvalidMtu is returned when the user provided MTU is not valid.
+type ErrInvalidMtu int
+
+func (eim ErrInvalidMtu) Error() string {
+	return fmt.Sprintf("invalid MTU number: %d", int(eim))
+}
+
+// BadRequest denotes the type of this error
+func (eim ErrInvalidMtu) BadRequest() {}
+
+// InvalidVNIError is returned when the VXLAN network identifier of a network is out of range.
+type InvalidVNIError uint32
+
+func (ive InvalidVNIError) Error() string {
+	return fmt.Sprintf("invalid VXLAN network identifier %d, expected a value between 1 and %d", uint32(ive), maxVNI)
+}
+
+// BadRequest denotes the type of this error
+func (ive InvalidVNIError) BadRequest() {}
+
+// VNIInUseError is returned when a network is created with the VXLAN network identifier of another network.
+type VNIInUseError uint32
+
+func (viue VNIInUseError) Error() string {
+	return fmt.Sprintf("VXLAN network identifier %d is already in use", uint32(viue))
+}
+
+// Forbidden denotes the type of this error
+func (viue VNIInUseError) Forbidden() {}
+
+// ActiveEndpointsError is returned when there are
+// still active endpoints in the network being deleted.
+type ActiveEndpointsError string
+
+func (aee ActiveEndpointsError) Error() string {
+	return fmt.Sprintf("network %s has active endpoint", string(aee))
+}
+
+// Forbidden denotes the type of this error
+func (aee ActiveEndpointsError) Forbidden() {}
+
+// InvalidNetworkIDError is returned when the passed
+// network id for an existing network is not a known id.
+type InvalidNetworkIDError string
+
+func (inie InvalidNetworkIDError) Error() string {
+	return fmt.Sprintf("invalid network id %s", string(inie))
+}
+
+// NotFound denotes the type of this error
+func (inie InvalidNetworkIDError) NotFound() {}
+
+// InvalidEndpointIDError is returned when the passed
+// endpoint id is not valid.
+type InvalidEndpointIDError string
+
+func (ieie InvalidEndpointIDError) Error() string {
+	return fmt.Sprintf("invalid endpoint id: %s", string(ieie))
+}
+
+// BadRequest denotes the type of this error
+func (ieie InvalidEndpointIDError) BadRequest() {}
+
+// EndpointNotFoundError is returned when the no endpoint
+// with the passed endpoint id is found.
+type EndpointNotFoundError string
+
+func (enfe EndpointNotFoundError) Error() string {
+	return fmt.Sprintf("endpoint not found: %s", string(enfe))
+}
+
+// NotFound denotes the type of this error
+func (enfe EndpointNotFoundError) NotFound() {}
+
+// InvalidPeerError is returned when a peer is added without
+// its address, MAC address or VTEP.
+type InvalidPeerError string
+
+func (ipe InvalidPeerError) Error() string {
+	return fmt.Sprintf("invalid peer: %s", string(ipe))
+}
+
+// BadRequest denotes the type of this error
+func (ipe InvalidPeerError) BadRequest() {}
+
+// PeerNotFoundError is returned when the peer to delete is not in the peer database.
+type PeerNotFoundError string
+
+func (pnfe PeerNotFoundError) Error() string {
+	return fmt.Sprintf("peer not found: %s", string(pnfe))
+}
+
+// NotFound denotes the type of this error
+func (pnfe PeerNotFoundError) NotFound() {}
+
+// LocalPeerError is returned when a peer update targets a local endpoint,
+// which is managed by the driver itself.
+type LocalPeerError string
+
+func (lpe LocalPeerError) Error() string {
+	return fmt.Sprintf("peer %s is a local endpoint", string(lpe))
+}
+
+// Forbidden denotes the type of this error
+func (lpe LocalPeerError) Forbidden() {}
@@ -0,0 +1,245 @@
+package overlay
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/sandbox"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	bridgeName  = "br0"
+	vxlanPrefix = "vx-"
+	vxlanPort   = 4789
+	// The namespace of a network is named after the prefix and the network id
+	sandboxPrefix = "ov-"
+)
+
+// nsInvoke runs fn inside the network namespace mounted at path. The
+// optional prefunc runs before in the caller namespace and gets passed the
+// file descriptor of the target one, to move links into it.
+func nsInvoke(path string, prefunc func(nsFD int) error, fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed get network namespace %q: %v", path, err)
+	}
+	defer f.Close()
+
+	nsFD := f.Fd()
+
+	if prefunc != nil {
+		if err := prefunc(int(nsFD)); err != nil {
+			return err
+		}
+	}
+
+	if err = netns.Set(netns.NsHandle(nsFD)); err != nil {
+		return err
+	}
+	defer netns.Set(origns)
+
+	return fn()
+}
+
+// initSandbox creates the namespace of the network with its bridge, and the
+// VXLAN link the bridge forwards the traffic to the remote peers through.
+// The VXLAN link is created in the caller namespace before being moved, so
+// that its UDP socket stays bound there, on the underlay.
+func (n *overlayNetwork) initSandbox(bindAddress net.IP) error {
+	key := sandbox.GenerateKey(sandboxPrefix + string(n.id))
+	deleteStaleLinks(key)
+
+	sbox, err := sandbox.NewSandbox(key, true)
+	if err != nil {
+		return fmt.Errorf("could not create the namespace of network %s: %v", n.id, err)
+	}
+	n.sbox = sbox
+
+	err = nsInvoke(sbox.Key(), nil, func() error {
+		br := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: bridgeName}}
+		if err := netlink.LinkAdd(br); err != nil {
+			return fmt.Errorf("could not create bridge %s: %v", bridgeName, err)
+		}
+		return netlink.LinkSetUp(br)
+	})
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s%d", vxlanPrefix, n.config.VNI)
+	vxlan := &netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{Name: name, MTU: n.mtu()},
+		VxlanId:   int(n.config.VNI),
+		SrcAddr:   bindAddress,
+		Learning:  true,
+		// Answer the ARP requests for the remote peers from the neighbor
+		// table instead of flooding them
+		Proxy: true,
+		// The vendored netlink library does not convert the port to
+		// network byte order
+		Port: int(nl.Swap16(vxlanPort)),
+	}
+	if err := netlink.LinkAdd(vxlan); err != nil {
+		return fmt.Errorf("could not create vxlan link %s: %v", name, err)
+	}
+	n.vxlanName = name
+
+	return nsInvoke(sbox.Key(), func(nsFD int) error {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return err
+		}
+		if err := netlink.LinkSetNsFd(link, nsFD); err != nil {
+			netlink.LinkDel(link)
+			return fmt.Errorf("could not move vxlan link %s to the network namespace: %v", name, err)
+		}
+		return nil
+	}, func() error {
+		return enslave(name)
+	})
+}
+
+// deleteStaleLinks deletes the links left in the namespace mounted at path
+// by a previous instance of the driver, if any. The kernel tears down an
+// unmounted namespace asynchronously, while its VXLAN link would clash with
+// the new one. Deleting the veth ends also deletes their container side.
+func deleteStaleLinks(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	err := nsInvoke(path, nil, func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if link.Attrs().Name == "lo" {
+				continue
+			}
+			if err := netlink.LinkDel(link); err != nil {
+				logrus.Warnf("Failed to delete stale link %s: %v", link.Attrs().Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Debugf("Failed to clean up the namespace at %s: %v", path, err)
+	}
+}
+
+// enslave attaches the named link to the bridge of the network and brings
+// it up. Must be called inside the namespace of the network.
+func enslave(name string) error {
+	br, err := netlink.LinkByName(bridgeName)
+	if err != nil {
+		return err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetMasterByIndex(link, br.Attrs().Index); err != nil {
+		return fmt.Errorf("could not attach %s to bridge %s: %v", name, bridgeName, err)
+	}
+
+	return netlink.LinkSetUp(link)
+}
+
+// destroySandbox deletes the links of the network and its namespace
+func (n *overlayNetwork) destroySandbox() {
+	if n.sbox == nil {
+		return
+	}
+
+	err := nsInvoke(n.sbox.Key(), nil, func() error {
+		for _, name := range []string{n.vxlanName, bridgeName} {
+			if link, err := netlink.LinkByName(name); err == nil {
+				netlink.LinkDel(link)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("Failed to delete the links of network %s: %v", n.id, err)
+	}
+
+	if err := n.sbox.Destroy(); err != nil {
+		logrus.Warnf("Failed to destroy the namespace of network %s: %v", n.id, err)
+	}
+	n.sbox = nil
+}
+
+// createVeth creates the veth pair of a new endpoint. One end is attached to
+// the bridge in the namespace of the network, the other one, with the passed
+// MAC address, is left in the caller namespace for the container and its
+// name returned.
+func (n *overlayNetwork) createVeth(mac net.HardwareAddr) (string, error) {
+	name1, err := netutils.GenerateIfaceName(vethPrefix, vethLen)
+	if err != nil {
+		return "", err
+	}
+
+	name2, err := netutils.GenerateIfaceName(vethPrefix, vethLen)
+	if err != nil {
+		return "", err
+	}
+
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: name1, TxQLen: 0, MTU: n.mtu()},
+		PeerName:  name2}
+	if err = netlink.LinkAdd(veth); err != nil {
+		return "", err
+	}
+
+	sbox, err := netlink.LinkByName(name2)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			netlink.LinkDel(sbox)
+		}
+	}()
+
+	if err = netlink.LinkSetMTU(sbox, n.mtu()); err != nil {
+		return "", err
+	}
+
+	if err = netlink.LinkSetHardwareAddr(sbox, mac); err != nil {
+		return "", err
+	}
+
+	err = nsInvoke(n.sbox.Key(), func(nsFD int) error {
+		host, err := netlink.LinkByName(name1)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkSetNsFd(host, nsFD)
+	}, func() error {
+		return enslave(name1)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return name2, nil
+}
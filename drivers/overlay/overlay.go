@@ -0,0 +1,537 @@
+package overlay
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/sandbox"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	networkType    = "overlay"
+	vethPrefix     = "veth"
+	vethLen        = 7
+	containerIface = "eth0"
+	ifaceID        = 1
+	maxVNI         = 1<<24 - 1
+	// The VXLAN header and the outer UDP, IP and Ethernet headers take 50
+	// bytes off the MTU of the underlay
+	defaultMtu = 1450
+)
+
+// Configuration info for the overlay driver
+type Configuration struct {
+	// BindAddress is the address of the local VTEP, the source of the
+	// VXLAN traffic and the VTEP of the local peers
+	BindAddress net.IP
+}
+
+// NetworkConfiguration for network specific configuration
+type NetworkConfiguration struct {
+	// VNI is the VXLAN network identifier, the same on all the hosts the
+	// network spans
+	VNI uint32
+	// Subnet is the network the endpoint addresses are allocated from
+	Subnet *net.IPNet
+	// FixedCIDR restricts the addresses allocated on this host to a range
+	// of the subnet. The hosts the network spans must allocate from
+	// disjoint ranges.
+	FixedCIDR *net.IPNet
+	// Mtu is the MTU of the endpoints, 1450 if not specified
+	Mtu int
+}
+
+// EndpointConfiguration represents the user specified configuration for the sandbox endpoint
+type EndpointConfiguration struct {
+	MacAddress net.HardwareAddr
+}
+
+type overlayEndpoint struct {
+	id         types.UUID
+	srcName    string
+	macAddress net.HardwareAddr
+	addr       *net.IPNet
+}
+
+type overlayNetwork struct {
+	id        types.UUID
+	config    *NetworkConfiguration
+	sbox      sandbox.Sandbox // The namespace holding the bridge and the VXLAN link
+	vxlanName string
+	endpoints map[types.UUID]*overlayEndpoint // key: endpoint id
+	peers     map[string]*driverapi.Peer      // key: peer IP address
+	ipam      ipamapi.Ipam                    // The IPAM driver managing the network addresses
+	poolID    string
+	sync.Mutex
+}
+
+type driver struct {
+	config   *Configuration
+	networks map[types.UUID]*overlayNetwork
+	dc       driverapi.DriverCallback
+	sync.Mutex
+}
+
+// New constructs a new overlay driver
+func newDriver(dc driverapi.DriverCallback) driverapi.Driver {
+	return &driver{networks: map[types.UUID]*overlayNetwork{}, dc: dc}
+}
+
+// Init registers a new instance of overlay driver
+func Init(dc driverapi.DriverCallback) error {
+	c := driverapi.Capability{
+		Scope: driverapi.GlobalScope,
+	}
+	return dc.RegisterDriver(networkType, newDriver(dc), c)
+}
+
+// Validate performs a static validation on the network configuration parameters.
+// Whatever can be assessed a priori before attempting any programming.
+func (c *NetworkConfiguration) Validate() error {
+	if c.VNI == 0 || c.VNI > maxVNI {
+		return InvalidVNIError(c.VNI)
+	}
+
+	if c.Subnet == nil {
+		return &ErrNoSubnet{}
+	}
+
+	// The container subnet must be a subset of the network subnet
+	if c.FixedCIDR != nil {
+		nwLen, _ := c.Subnet.Mask.Size()
+		cnLen, _ := c.FixedCIDR.Mask.Size()
+		if !c.Subnet.Contains(c.FixedCIDR.IP) || nwLen > cnLen {
+			return &ErrInvalidContainerSubnet{}
+		}
+	}
+
+	if c.Mtu < 0 {
+		return ErrInvalidMtu(c.Mtu)
+	}
+
+	return nil
+}
+
+func (n *overlayNetwork) getEndpoint(eid types.UUID) (*overlayEndpoint, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if eid == "" {
+		return nil, InvalidEndpointIDError(eid)
+	}
+
+	if ep, ok := n.endpoints[eid]; ok {
+		return ep, nil
+	}
+
+	return nil, nil
+}
+
+// mtu returns the MTU of the links of the network
+func (n *overlayNetwork) mtu() int {
+	if n.config.Mtu != 0 {
+		return n.config.Mtu
+	}
+	return defaultMtu
+}
+
+func (d *driver) Config(option map[string]interface{}) error {
+	var config *Configuration
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.config != nil {
+		return &ErrConfigExists{}
+	}
+
+	genericData, ok := option[netlabel.GenericData]
+	if !ok || genericData == nil {
+		return nil
+	}
+
+	switch opt := genericData.(type) {
+	case options.Generic:
+		opaqueConfig, err := options.GenerateFromModel(opt, &Configuration{})
+		if err != nil {
+			return err
+		}
+		config = opaqueConfig.(*Configuration)
+	case *Configuration:
+		config = opt
+	default:
+		return &ErrInvalidDriverConfig{}
+	}
+
+	d.config = config
+
+	return nil
+}
+
+// bindAddress returns the address of the local VTEP, if configured
+func (d *driver) bindAddress() net.IP {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.config == nil {
+		return nil
+	}
+	return d.config.BindAddress
+}
+
+func (d *driver) getNetwork(id types.UUID) (*overlayNetwork, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if id == "" {
+		return nil, InvalidNetworkIDError(id)
+	}
+
+	if nw, ok := d.networks[id]; ok {
+		return nw, nil
+	}
+
+	return nil, driverapi.ErrNoNetwork(id)
+}
+
+func parseNetworkOptions(option options.Generic) (*NetworkConfiguration, error) {
+	var config *NetworkConfiguration
+
+	switch opt := option[netlabel.GenericData].(type) {
+	case options.Generic:
+		opaqueConfig, err := options.GenerateFromModel(opt, &NetworkConfiguration{})
+		if err != nil {
+			return nil, err
+		}
+		config = opaqueConfig.(*NetworkConfiguration)
+	case *NetworkConfiguration:
+		config = opt
+	default:
+		return nil, &ErrInvalidNetworkConfig{}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Create a new network using overlay plugin
+func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) error {
+	var err error
+
+	config, err := parseNetworkOptions(option)
+	if err != nil {
+		return err
+	}
+
+	ipamName, _ := option[netlabel.IpamDriver].(string)
+	ipam, err := d.dc.GetIpam(ipamName)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	if _, ok := d.networks[id]; ok {
+		d.Unlock()
+		return &ErrNetworkExists{}
+	}
+
+	for _, nw := range d.networks {
+		if nw.config.VNI == config.VNI {
+			d.Unlock()
+			return VNIInUseError(config.VNI)
+		}
+	}
+
+	network := &overlayNetwork{
+		id:        id,
+		config:    config,
+		endpoints: make(map[types.UUID]*overlayEndpoint),
+		peers:     make(map[string]*driverapi.Peer),
+		ipam:      ipam,
+	}
+	d.networks[id] = network
+	d.Unlock()
+
+	// On failure make sure to remove the network handler from the driver,
+	// to tear its namespace down and to give its address pool back
+	defer func() {
+		if err != nil {
+			network.destroySandbox()
+			network.releasePool()
+			d.Lock()
+			delete(d.networks, id)
+			d.Unlock()
+		}
+	}()
+
+	var subPool string
+	if config.FixedCIDR != nil {
+		subPool = config.FixedCIDR.String()
+	}
+	subnet := &net.IPNet{IP: config.Subnet.IP.Mask(config.Subnet.Mask), Mask: config.Subnet.Mask}
+	if network.poolID, _, _, err = ipam.RequestPool(ipamapi.GlobalDefaultAddressSpace, subnet.String(), subPool, nil, false); err != nil {
+		return err
+	}
+
+	err = network.initSandbox(d.bindAddress())
+	return err
+}
+
+// releasePool gives the address pool of the network back to the IPAM driver
+func (n *overlayNetwork) releasePool() {
+	if n.poolID == "" {
+		return
+	}
+
+	if err := n.ipam.ReleasePool(n.poolID); err != nil {
+		logrus.Warnf("Failed to release address pool %s of network %s: %v", n.poolID, n.id, err)
+	}
+	n.poolID = ""
+}
+
+func (d *driver) DeleteNetwork(nid types.UUID) error {
+	d.Lock()
+	n, ok := d.networks[nid]
+	if !ok {
+		d.Unlock()
+		return driverapi.ErrNoNetwork(nid)
+	}
+
+	// Cannot remove network if endpoints are still present
+	n.Lock()
+	numEps := len(n.endpoints)
+	n.Unlock()
+	if numEps != 0 {
+		d.Unlock()
+		return ActiveEndpointsError(n.id)
+	}
+
+	delete(d.networks, nid)
+	d.Unlock()
+
+	n.destroySandbox()
+	n.releasePool()
+
+	return nil
+}
+
+func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointInfo, epOptions map[string]interface{}) error {
+	var err error
+
+	if epInfo == nil {
+		return errors.New("invalid endpoint info passed")
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+
+	if ep != nil {
+		return driverapi.ErrEndpointExists(eid)
+	}
+
+	// The links of a restored endpoint went away with the namespace of the
+	// network, and cannot be plugged back into its sandbox
+	if len(epInfo.Interfaces()) != 0 {
+		return driverapi.ErrNotRestorable(eid)
+	}
+
+	epConfig, err := parseEndpointOptions(epOptions)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	endpoint := &overlayEndpoint{id: eid}
+	n.endpoints[eid] = endpoint
+	n.Unlock()
+
+	// On failure make sure to remove the endpoint
+	defer func() {
+		if err != nil {
+			n.Lock()
+			delete(n.endpoints, eid)
+			n.Unlock()
+		}
+	}()
+
+	addr, _, err := n.ipam.RequestAddress(n.poolID, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			n.ipam.ReleaseAddress(n.poolID, addr.IP)
+		}
+	}()
+
+	mac := electMacAddress(epConfig)
+	name, err := n.createVeth(mac)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if link, err := netlink.LinkByName(name); err == nil {
+				netlink.LinkDel(link)
+			}
+		}
+	}()
+
+	endpoint.srcName = name
+	endpoint.macAddress = mac
+	endpoint.addr = addr
+
+	if err = epInfo.AddInterface(ifaceID, mac, *addr, net.IPNet{}); err != nil {
+		return err
+	}
+
+	n.addLocalPeer(endpoint, d.bindAddress())
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	if err := n.ipam.ReleaseAddress(n.poolID, ep.addr.IP); err != nil {
+		return err
+	}
+
+	n.Lock()
+	delete(n.endpoints, eid)
+	delete(n.peers, ep.addr.IP.String())
+	n.Unlock()
+
+	// Discard error: the veth pair may have been deleted along with the
+	// sandbox. Deleting the container side deletes the overlay side too.
+	if link, err := netlink.LinkByName(ep.srcName); err == nil {
+		netlink.LinkDel(link)
+	}
+
+	return nil
+}
+
+func (d *driver) EndpointOperInfo(nid, eid types.UUID) (map[string]interface{}, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return nil, err
+	}
+	if ep == nil {
+		return nil, driverapi.ErrNoEndpoint(eid)
+	}
+
+	m := make(map[string]interface{})
+	if len(ep.macAddress) != 0 {
+		m[netlabel.MacAddress] = ep.macAddress
+	}
+
+	return m, nil
+}
+
+// Join method is invoked when a Sandbox is attached to an endpoint.
+func (d *driver) Join(nid, eid types.UUID, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	for _, iNames := range jinfo.InterfaceNames() {
+		if iNames.ID() == ifaceID {
+			if err := iNames.SetNames(ep.srcName, containerIface); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Leave method is invoked when a Sandbox detaches from an endpoint.
+func (d *driver) Leave(nid, eid types.UUID) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	return nil
+}
+
+func (d *driver) Type() string {
+	return networkType
+}
+
+func parseEndpointOptions(epOptions map[string]interface{}) (*EndpointConfiguration, error) {
+	if epOptions == nil {
+		return nil, nil
+	}
+
+	ec := &EndpointConfiguration{}
+
+	if opt, ok := epOptions[netlabel.MacAddress]; ok {
+		if mac, ok := opt.(net.HardwareAddr); ok {
+			ec.MacAddress = mac
+		} else {
+			return nil, &ErrInvalidEndpointConfig{}
+		}
+	}
+
+	return ec, nil
+}
+
+func electMacAddress(epConfig *EndpointConfiguration) net.HardwareAddr {
+	if epConfig != nil && epConfig.MacAddress != nil {
+		return epConfig.MacAddress
+	}
+	return netutils.GenerateRandomMAC()
+}
@@ -0,0 +1,433 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/sandbox"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+func networkOption(config *NetworkConfiguration) map[string]interface{} {
+	return map[string]interface{}{netlabel.GenericData: config}
+}
+
+func parseCIDR(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// inNamespace runs fn with the calling thread in the namespace mounted at
+// path. The thread must be locked.
+func inNamespace(t *testing.T, path string, fn func()) {
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := netns.Set(netns.NsHandle(f.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns)
+
+	fn()
+}
+
+func TestCreateNetworkInvalidConfig(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback())
+
+	subnet := parseCIDR(t, "10.1.0.0/16")
+
+	for _, config := range []*NetworkConfiguration{
+		{Subnet: subnet},
+		{VNI: maxVNI + 1, Subnet: subnet},
+		{VNI: 42},
+		{VNI: 42, Subnet: subnet, Mtu: -1},
+		{VNI: 42, Subnet: subnet, FixedCIDR: parseCIDR(t, "10.2.0.0/24")},
+		{VNI: 42, Subnet: subnet, FixedCIDR: parseCIDR(t, "10.0.0.0/8")},
+	} {
+		err := d.CreateNetwork("dummy", networkOption(config))
+		if err == nil {
+			t.Fatalf("Expected failure creating a network with config %v", config)
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Failed for unexpected reason: %v", err)
+		}
+	}
+
+	if err := d.CreateNetwork("dummy", map[string]interface{}{}); err == nil {
+		t.Fatalf("Expected failure creating a network without config")
+	}
+
+	if err := d.CreateNetwork("net1", networkOption(&NetworkConfiguration{VNI: 42, Subnet: subnet})); err != nil {
+		t.Fatalf("Failed to create an overlay network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	err := d.CreateNetwork("net2", networkOption(&NetworkConfiguration{VNI: 42, Subnet: parseCIDR(t, "10.2.0.0/16")}))
+	if _, ok := err.(VNIInUseError); !ok {
+		t.Fatalf("Expected failure creating a network with a VNI in use, got: %v", err)
+	}
+}
+
+func TestCreateDeleteNetwork(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	config := &NetworkConfiguration{VNI: 42, Subnet: parseCIDR(t, "10.1.0.0/16")}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an overlay network: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := n.sbox.Key()
+
+	inNamespace(t, key, func() {
+		br, err := netlink.LinkByName(bridgeName)
+		if err != nil {
+			t.Fatalf("Could not find the bridge of the network: %v", err)
+		}
+
+		link, err := netlink.LinkByName(n.vxlanName)
+		if err != nil {
+			t.Fatalf("Could not find the vxlan link of the network: %v", err)
+		}
+
+		vxlan, ok := link.(*netlink.Vxlan)
+		if !ok {
+			t.Fatalf("Link %s is not a vxlan link", n.vxlanName)
+		}
+
+		if vxlan.VxlanId != 42 || vxlan.MasterIndex != br.Attrs().Index {
+			t.Fatalf("Unexpected vxlan link configuration: %v", vxlan)
+		}
+	})
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(key); !os.IsNotExist(err) {
+		t.Fatalf("Namespace %s of the network still present after its deletion", key)
+	}
+}
+
+func TestPeerDB(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	vtep := net.ParseIP("192.168.1.1")
+	if err := d.Config(map[string]interface{}{netlabel.GenericData: &Configuration{BindAddress: vtep}}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &NetworkConfiguration{VNI: 42, Subnet: parseCIDR(t, "10.1.0.0/16")}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an overlay network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	te := &testutils.Endpoint{}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+	defer d.DeleteEndpoint("net1", "ep1")
+
+	peers, err := d.Peers("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || !peers[0].Local || peers[0].EndpointID != "ep1" ||
+		!peers[0].IP.Equal(te.Ifaces[0].Addr.IP) || !peers[0].Vtep.Equal(vtep) {
+		t.Fatalf("Unexpected peers %v. Expected the local endpoint", peers)
+	}
+
+	local := &driverapi.Peer{IP: te.Ifaces[0].Addr.IP, Mac: te.Ifaces[0].Mac, Vtep: net.ParseIP("192.168.1.2")}
+	if err := d.PeerAdd("net1", local); err == nil {
+		t.Fatalf("Expected failure overriding a local peer")
+	} else if _, ok := err.(LocalPeerError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+
+	if err := d.PeerAdd("net1", &driverapi.Peer{IP: net.ParseIP("10.1.0.100")}); err == nil {
+		t.Fatalf("Expected failure adding a peer without MAC address nor VTEP")
+	}
+
+	mac, _ := net.ParseMAC("02:42:0a:01:00:64")
+	remote := &driverapi.Peer{EndpointID: "ep2", IP: net.ParseIP("10.1.0.100"), Mac: mac, Vtep: net.ParseIP("192.168.1.2")}
+	if err := d.PeerAdd("net1", remote); err != nil {
+		t.Fatalf("Failed to add a remote peer: %v", err)
+	}
+
+	n, err := d.getNetwork("net1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkEntries verifies the presence of the neighbor and forwarding
+	// entries of the remote peer
+	checkEntries := func(present bool) {
+		inNamespace(t, n.sbox.Key(), func() {
+			link, err := netlink.LinkByName(n.vxlanName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			neighs, err := netlink.NeighList(link.Attrs().Index, netlink.FAMILY_V4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, neigh := range neighs {
+				if neigh.IP.Equal(remote.IP) && bytes.Equal(neigh.HardwareAddr, remote.Mac) {
+					found = true
+				}
+			}
+			if found != present {
+				t.Fatalf("Unexpected neighbor entry presence for %s: %t", remote.IP, found)
+			}
+
+			fdbs, err := netlink.NeighList(link.Attrs().Index, syscall.AF_BRIDGE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found = false
+			for _, fdb := range fdbs {
+				if fdb.IP.Equal(remote.Vtep) && bytes.Equal(fdb.HardwareAddr, remote.Mac) {
+					found = true
+				}
+			}
+			if found != present {
+				t.Fatalf("Unexpected forwarding entry presence for %s: %t", remote.Mac, found)
+			}
+		})
+	}
+
+	checkEntries(true)
+
+	if peers, _ := d.Peers("net1"); len(peers) != 2 {
+		t.Fatalf("Expected 2 peers, got %d", len(peers))
+	}
+
+	if err := d.PeerDelete("net1", remote.IP); err != nil {
+		t.Fatalf("Failed to delete the remote peer: %v", err)
+	}
+
+	checkEntries(false)
+
+	if err := d.PeerDelete("net1", remote.IP); err == nil {
+		t.Fatalf("Expected failure deleting an unknown peer")
+	} else if _, ok := err.(PeerNotFoundError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+}
+
+func TestCreateRestoredEndpoint(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	d := newDriver(testutils.NewCallback()).(*driver)
+
+	config := &NetworkConfiguration{VNI: 42, Subnet: parseCIDR(t, "10.1.0.0/16")}
+	if err := d.CreateNetwork("net1", networkOption(config)); err != nil {
+		t.Fatalf("Failed to create an overlay network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	mac, _ := net.ParseMAC("02:42:0a:01:00:0a")
+	addr := net.IPNet{IP: net.ParseIP("10.1.0.10"), Mask: net.CIDRMask(16, 32)}
+	te := &testutils.Endpoint{Ifaces: []*testutils.Interface{{Index: ifaceID, Mac: mac, Addr: addr}}}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err == nil {
+		t.Fatalf("Expected failure restoring an endpoint")
+	} else if _, ok := err.(driverapi.ErrNotRestorable); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+
+	// Nothing is left behind for the endpoint
+	if peers, err := d.Peers("net1"); err != nil || len(peers) != 0 {
+		t.Fatalf("Unexpected peers %v (%v) after a refused restore", peers, err)
+	}
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatalf("Failed to delete the network after a refused restore: %v", err)
+	}
+}
+
+// host is a network namespace acting as a host with its overlay driver
+type host struct {
+	ns     sandbox.Sandbox
+	driver *driver
+	vtep   net.IP
+}
+
+// setupHosts creates two namespaces acting as hosts, connected through a
+// veth pair as underlay.
+func setupHosts(t *testing.T) []*host {
+	var hosts []*host
+
+	for i := 1; i <= 2; i++ {
+		ns, err := sandbox.NewSandbox(sandbox.GenerateKey(fmt.Sprintf("ovtesthost%d", i)), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, &host{
+			ns:     ns,
+			driver: newDriver(testutils.NewCallback()).(*driver),
+			vtep:   net.IPv4(192, 168, 1, byte(i)),
+		})
+	}
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "underlay1"}, PeerName: "underlay2"}
+	if err := netlink.LinkAdd(veth); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, h := range hosts {
+		name := fmt.Sprintf("underlay%d", i+1)
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = h.ns.AddInterface(&sandbox.Interface{
+			SrcName: name,
+			DstName: name,
+			Address: &net.IPNet{IP: h.vtep, Mask: net.CIDRMask(24, 32)},
+		})
+		if err != nil {
+			t.Fatalf("Failed to move %s to its host: %v", link.Attrs().Name, err)
+		}
+
+		err = h.driver.Config(map[string]interface{}{netlabel.GenericData: &Configuration{BindAddress: h.vtep}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hosts
+}
+
+func TestMultiHost(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hosts := setupHosts(t)
+	defer func() {
+		for _, h := range hosts {
+			h.ns.Destroy()
+		}
+	}()
+
+	subnet := parseCIDR(t, "10.1.0.0/16")
+	var containers []*testutils.Endpoint
+
+	for i, h := range hosts {
+		// The hosts allocate the addresses of their endpoints from disjoint
+		// ranges of the subnet
+		nid := types.UUID(fmt.Sprintf("net%d", i+1))
+		config := &NetworkConfiguration{VNI: 42, Subnet: subnet, FixedCIDR: parseCIDR(t, fmt.Sprintf("10.1.%d.0/24", i+1))}
+		te := &testutils.Endpoint{}
+
+		inNamespace(t, h.ns.Key(), func() {
+			if err := h.driver.CreateNetwork(nid, networkOption(config)); err != nil {
+				t.Fatalf("Failed to create the overlay network on host %d: %v", i+1, err)
+			}
+
+			if err := h.driver.CreateEndpoint(nid, "ep1", te, nil); err != nil {
+				t.Fatalf("Failed to create an endpoint on host %d: %v", i+1, err)
+			}
+
+			if err := h.driver.Join(nid, "ep1", "", te, nil); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		defer func(h *host, nid types.UUID) {
+			inNamespace(t, h.ns.Key(), func() {
+				h.driver.DeleteEndpoint(nid, "ep1")
+				h.driver.DeleteNetwork(nid)
+			})
+		}(h, nid)
+
+		cns, err := sandbox.NewSandbox(sandbox.GenerateKey(fmt.Sprintf("ovtestctr%d", i+1)), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cns.Destroy()
+
+		iface := te.Ifaces[0]
+		inNamespace(t, h.ns.Key(), func() {
+			err := cns.AddInterface(&sandbox.Interface{SrcName: iface.SrcName, DstName: iface.DstName, Address: &iface.Addr})
+			if err != nil {
+				t.Fatalf("Failed to move the endpoint interface into the container on host %d: %v", i+1, err)
+			}
+		})
+		containers = append(containers, te)
+	}
+
+	// Advertise the local peers of each host to the other one
+	for i, h := range hosts {
+		other := hosts[1-i]
+		peers, err := h.driver.Peers(types.UUID(fmt.Sprintf("net%d", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range peers {
+			if !p.Local {
+				continue
+			}
+			if !p.Vtep.Equal(h.vtep) {
+				t.Fatalf("Unexpected VTEP %s for a local peer of host %d", p.Vtep, i+1)
+			}
+			inNamespace(t, other.ns.Key(), func() {
+				if err := other.driver.PeerAdd(types.UUID(fmt.Sprintf("net%d", 2-i)), p); err != nil {
+					t.Fatalf("Failed to add a peer of host %d to host %d: %v", i+1, 2-i, err)
+				}
+			})
+		}
+	}
+
+	// The container of the second host listens, the one of the first
+	// host connects to it through the overlay
+	dst := containers[1].Ifaces[0].Addr.IP
+	var l net.Listener
+	inNamespace(t, sandbox.GenerateKey("ovtestctr2"), func() {
+		var err error
+		if l, err = net.Listen("tcp", net.JoinHostPort(dst.String(), "8000")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer l.Close()
+
+	inNamespace(t, sandbox.GenerateKey("ovtestctr1"), func() {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(dst.String(), "8000"), 5*time.Second)
+		if err != nil {
+			t.Fatalf("Failed to connect across the overlay: %v", err)
+		}
+		conn.Close()
+	})
+}
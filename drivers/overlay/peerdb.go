@@ -0,0 +1,151 @@
+package overlay
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// addLocalPeer records a local endpoint in the peer database. Nothing needs
+// to be programmed: the bridge of the network reaches it directly.
+func (n *overlayNetwork) addLocalPeer(ep *overlayEndpoint, vtep net.IP) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.peers[ep.addr.IP.String()] = &driverapi.Peer{
+		EndpointID: ep.id,
+		IP:         ep.addr.IP,
+		Mac:        ep.macAddress,
+		Vtep:       vtep,
+		Local:      true,
+	}
+}
+
+// PeerAdd programs the neighbor entry of the remote peer, which lets the
+// VXLAN link answer the ARP requests for it, and the forwarding entry which
+// sends the traffic for its MAC address to its VTEP.
+func (d *driver) PeerAdd(nid types.UUID, peer *driverapi.Peer) error {
+	if peer == nil || peer.IP == nil || len(peer.Mac) == 0 || peer.Vtep == nil {
+		return InvalidPeerError("address, MAC address and VTEP are required")
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	peer = peer.GetCopy()
+	peer.Local = false
+
+	n.Lock()
+	defer n.Unlock()
+
+	old, ok := n.peers[peer.IP.String()]
+	if ok && old.Local {
+		return LocalPeerError(peer.IP.String())
+	}
+
+	// The entries of a peer which moved to another MAC address would linger
+	if ok && !bytes.Equal(old.Mac, peer.Mac) {
+		if err := n.programPeer(old, true); err != nil {
+			return err
+		}
+	}
+
+	if err := n.programPeer(peer, false); err != nil {
+		return err
+	}
+
+	n.peers[peer.IP.String()] = peer
+
+	return nil
+}
+
+// PeerDelete removes the neighbor and forwarding entries of a remote peer.
+func (d *driver) PeerDelete(nid types.UUID, ip net.IP) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	peer, ok := n.peers[ip.String()]
+	if !ok {
+		return PeerNotFoundError(ip.String())
+	}
+
+	if peer.Local {
+		return LocalPeerError(ip.String())
+	}
+
+	if err := n.programPeer(peer, true); err != nil {
+		return err
+	}
+
+	delete(n.peers, ip.String())
+
+	return nil
+}
+
+// Peers returns the peer database of the network.
+func (d *driver) Peers(nid types.UUID) ([]*driverapi.Peer, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	list := make([]*driverapi.Peer, 0, len(n.peers))
+	for _, p := range n.peers {
+		list = append(list, p.GetCopy())
+	}
+
+	return list, nil
+}
+
+// programPeer adds, or deletes if remove is set, the static neighbor and
+// forwarding entries of a remote peer on the VXLAN link of the network.
+func (n *overlayNetwork) programPeer(peer *driverapi.Peer, remove bool) error {
+	return nsInvoke(n.sbox.Key(), nil, func() error {
+		vxlan, err := netlink.LinkByName(n.vxlanName)
+		if err != nil {
+			return err
+		}
+
+		neigh := &netlink.Neigh{
+			LinkIndex:    vxlan.Attrs().Index,
+			State:        netlink.NUD_PERMANENT,
+			IP:           peer.IP,
+			HardwareAddr: peer.Mac,
+		}
+
+		fdb := &netlink.Neigh{
+			LinkIndex:    vxlan.Attrs().Index,
+			Family:       syscall.AF_BRIDGE,
+			State:        netlink.NUD_PERMANENT,
+			Flags:        netlink.NTF_SELF,
+			IP:           peer.Vtep,
+			HardwareAddr: peer.Mac,
+		}
+
+		if remove {
+			if err := netlink.NeighDel(neigh); err != nil {
+				return err
+			}
+			return netlink.NeighDel(fdb)
+		}
+
+		if err := netlink.NeighSet(neigh); err != nil {
+			return err
+		}
+		return netlink.NeighSet(fdb)
+	})
+}
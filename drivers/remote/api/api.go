@@ -0,0 +1,172 @@
+/*
+Package api represents all requests and responses suitable for conversation
+with a remote driver.
+*/
+package api
+
+import "net"
+
+// ProtocolVersion is the version of the remote driver protocol spoken by
+// libnetwork. Plugins reporting a different version are rejected.
+const ProtocolVersion = 1
+
+// Response is the basic response structure used in all responses.
+type Response struct {
+	Err string
+}
+
+// GetError returns the error from the response, if any.
+func (r *Response) GetError() string {
+	return r.Err
+}
+
+// GetCapabilityRequest is the request for the capabilities of the plugin.
+// It is sent once, when the plugin is activated.
+type GetCapabilityRequest struct {
+	// The version of the protocol spoken by libnetwork.
+	ProtocolVersion int
+}
+
+// GetCapabilityResponse is the response of GetCapabilityRequest.
+type GetCapabilityResponse struct {
+	Response
+	// The scope of the networks managed by the plugin, "local" or "global".
+	Scope string
+	// The driver specific option keys the plugin understands.
+	Options []string
+	// The version of the protocol spoken by the plugin.
+	ProtocolVersion int
+}
+
+// CreateNetworkRequest requests a new network.
+type CreateNetworkRequest struct {
+	// A network ID that remote plugins are expected to store for future
+	// reference.
+	NetworkID string
+
+	// A free form map->object interface for communication of options.
+	Options map[string]interface{}
+}
+
+// CreateNetworkResponse is the response to the CreateNetworkRequest.
+type CreateNetworkResponse struct {
+	Response
+}
+
+// DeleteNetworkRequest is the request to delete an existing network.
+type DeleteNetworkRequest struct {
+	// The ID of the network to delete.
+	NetworkID string
+}
+
+// DeleteNetworkResponse is the response to a request for deleting a network.
+type DeleteNetworkResponse struct {
+	Response
+}
+
+// CreateEndpointRequest is the request to create an endpoint within a network.
+type CreateEndpointRequest struct {
+	// Provided at create time, this will be the network id referenced.
+	NetworkID string
+	// The ID of the endpoint for later reference.
+	EndpointID string
+	// The interfaces already assigned to the endpoint, if any.
+	Interfaces []*EndpointInterface
+	// A free form map->object interface for communication of options.
+	Options map[string]interface{}
+}
+
+// EndpointInterface represents an interface endpoint in its wire format.
+// Addresses are in CIDR notation and the MAC address is in the usual
+// colon separated hex notation.
+type EndpointInterface struct {
+	ID          int
+	Address     string
+	AddressIPv6 string
+	MacAddress  string
+}
+
+// CreateEndpointResponse is the response to the CreateEndpoint action.
+type CreateEndpointResponse struct {
+	Response
+	Interfaces []*EndpointInterface
+}
+
+// Interface is the parsed representation of an EndpointInterface.
+type Interface struct {
+	ID          int
+	Address     *net.IPNet
+	AddressIPv6 *net.IPNet
+	MacAddress  net.HardwareAddr
+}
+
+// DeleteEndpointRequest describes the API for deleting an endpoint.
+type DeleteEndpointRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// DeleteEndpointResponse is the response to the DeleteEndpoint action.
+type DeleteEndpointResponse struct {
+	Response
+}
+
+// EndpointInfoRequest retrieves information about the endpoint from the network driver.
+type EndpointInfoRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// EndpointInfoResponse is the response to an EndpointInfoRequest.
+type EndpointInfoResponse struct {
+	Response
+	Value map[string]interface{}
+}
+
+// JoinRequest describes the API for joining an endpoint to a sandbox.
+type JoinRequest struct {
+	NetworkID  string
+	EndpointID string
+	SandboxKey string
+	Options    map[string]interface{}
+}
+
+// InterfaceName is the struct represetation of a pair of devices with source
+// and destination, for the purposes of putting an endpoint into a container.
+type InterfaceName struct {
+	SrcName string
+	DstName string
+}
+
+// StaticRoute is the wire format of a route to program in the sandbox. The
+// Destination is in CIDR notation, the RouteType is 0 for a route through the
+// NextHop and 1 for an on-link route through the interface InterfaceID.
+type StaticRoute struct {
+	Destination string
+	RouteType   int
+	NextHop     string
+	InterfaceID int
+}
+
+// JoinResponse is the response to a JoinRequest. The InterfaceNames are
+// expected in the same order as the interface IDs returned by CreateEndpoint.
+type JoinResponse struct {
+	Response
+	InterfaceNames []*InterfaceName
+	Gateway        string
+	GatewayIPv6    string
+	HostsPath      string
+	ResolvConfPath string
+	StaticRoutes   []*StaticRoute
+}
+
+// LeaveRequest describes the API for detaching an endpoint from a sandbox.
+type LeaveRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// LeaveResponse is the answer to LeaveRequest.
+type LeaveResponse struct {
+	Response
+}
@@ -1,69 +1,320 @@
 package remote
 
 import (
-	"errors"
+	"fmt"
+	"net"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/plugins"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/remote/api"
 	"github.com/docker/libnetwork/types"
 )
 
-var errNoCallback = errors.New("No Callback handler registered with Driver")
-
 type driver struct {
 	endpoint    *plugins.Client
 	networkType string
 }
 
-// Init does the necessary work to register remote drivers
-func Init(dc driverapi.DriverCallback) error {
-	plugins.Handle(driverapi.NetworkPluginEndpointType, func(name string, client *plugins.Client) {
+type maybeError interface {
+	GetError() string
+}
 
-		// TODO : Handhake with the Remote Plugin goes here
+func newDriver(name string, client *plugins.Client) *driver {
+	return &driver{networkType: name, endpoint: client}
+}
 
-		newDriver := &driver{networkType: name, endpoint: client}
-		if err := dc.RegisterDriver(name, newDriver); err != nil {
+// Init makes sure a remote driver is registered when a network driver
+// plugin is activated.
+func Init(dc driverapi.DriverCallback) error {
+	plugins.Handle(driverapi.NetworkPluginEndpointType, func(name string, client *plugins.Client) {
+		// Negotiate the driver capability with the plugin before registering it
+		d := newDriver(name, client)
+		c, err := d.getCapabilities()
+		if err != nil {
+			log.Errorf("Error getting capability for %s due to %v", name, err)
+			return
+		}
+		if err := dc.RegisterDriver(name, d, *c); err != nil {
 			log.Errorf("Error registering Driver for %s due to %v", name, err)
 		}
 	})
 	return nil
 }
 
+// getCapabilities performs the handshake with the plugin and validates the
+// returned capability against what libnetwork supports.
+func (d *driver) getCapabilities() (*driverapi.Capability, error) {
+	req := &api.GetCapabilityRequest{ProtocolVersion: api.ProtocolVersion}
+	var res api.GetCapabilityResponse
+	if err := d.call("GetCapabilities", req, &res); err != nil {
+		return nil, err
+	}
+
+	if res.ProtocolVersion != api.ProtocolVersion {
+		return nil, &IncompatibleVersionError{Plugin: d.networkType, Version: res.ProtocolVersion}
+	}
+
+	c := &driverapi.Capability{ProtocolVersion: res.ProtocolVersion, Options: res.Options}
+	switch res.Scope {
+	case driverapi.LocalScope, driverapi.GlobalScope:
+		c.Scope = res.Scope
+	default:
+		return nil, &InvalidScopeError{Plugin: d.networkType, Scope: res.Scope}
+	}
+
+	return c, nil
+}
+
+// Config is not implemented for remote drivers, since it is assumed
+// to be supplied to the remote process out-of-band (e.g., as command
+// line arguments).
 func (d *driver) Config(option map[string]interface{}) error {
 	return &driverapi.ErrNotImplemented{}
 }
 
-func (d *driver) CreateNetwork(id types.UUID, option map[string]interface{}) error {
-	return &driverapi.ErrNotImplemented{}
+func (d *driver) call(methodName string, arg interface{}, retVal maybeError) error {
+	method := driverapi.NetworkPluginEndpointType + "." + methodName
+	err := d.endpoint.Call(method, arg, retVal)
+	if err != nil {
+		return err
+	}
+	if e := retVal.GetError(); e != "" {
+		return fmt.Errorf("remote: %s", e)
+	}
+	return nil
+}
+
+func (d *driver) CreateNetwork(id types.UUID, options map[string]interface{}) error {
+	create := &api.CreateNetworkRequest{
+		NetworkID: string(id),
+		Options:   options,
+	}
+	return d.call("CreateNetwork", create, &api.CreateNetworkResponse{})
 }
 
 func (d *driver) DeleteNetwork(nid types.UUID) error {
-	return &driverapi.ErrNotImplemented{}
+	delete := &api.DeleteNetworkRequest{NetworkID: string(nid)}
+	return d.call("DeleteNetwork", delete, &api.DeleteNetworkResponse{})
 }
 
 func (d *driver) CreateEndpoint(nid, eid types.UUID, epInfo driverapi.EndpointInfo, epOptions map[string]interface{}) error {
-	return &driverapi.ErrNotImplemented{}
+	if epInfo == nil {
+		return fmt.Errorf("must not be called with nil EndpointInfo")
+	}
+
+	reqIfaces := make([]*api.EndpointInterface, len(epInfo.Interfaces()))
+	for i, iface := range epInfo.Interfaces() {
+		addr4 := iface.Address()
+		addr6 := iface.AddressIPv6()
+		reqIfaces[i] = &api.EndpointInterface{
+			ID:          iface.ID(),
+			Address:     addrString(&addr4),
+			AddressIPv6: addrString(&addr6),
+			MacAddress:  macString(iface.MacAddress()),
+		}
+	}
+	create := &api.CreateEndpointRequest{
+		NetworkID:  string(nid),
+		EndpointID: string(eid),
+		Interfaces: reqIfaces,
+		Options:    epOptions,
+	}
+	var res api.CreateEndpointResponse
+	if err := d.call("CreateEndpoint", create, &res); err != nil {
+		return err
+	}
+
+	ifaces, err := parseInterfaces(res)
+	if err != nil {
+		return errorWithRollback(fmt.Sprintf("failed to parse interfaces: %v", err), d.DeleteEndpoint(nid, eid))
+	}
+	if len(reqIfaces) > 0 && len(ifaces) > 0 {
+		// We're not supposed to add interfaces if there already are
+		// some. Attempt to roll back
+		return errorWithRollback("driver attempted to add more interfaces", d.DeleteEndpoint(nid, eid))
+	}
+	for _, iface := range ifaces {
+		var addr4, addr6 net.IPNet
+		if iface.Address != nil {
+			addr4 = *(iface.Address)
+		}
+		if iface.AddressIPv6 != nil {
+			addr6 = *(iface.AddressIPv6)
+		}
+		if err := epInfo.AddInterface(iface.ID, iface.MacAddress, addr4, addr6); err != nil {
+			return errorWithRollback(fmt.Sprintf("failed to AddInterface %v: %s", iface, err), d.DeleteEndpoint(nid, eid))
+		}
+	}
+	return nil
+}
+
+func errorWithRollback(msg string, err error) error {
+	rollback := "rolled back"
+	if err != nil {
+		rollback = "failed to roll back: " + err.Error()
+	}
+	return fmt.Errorf("%s; %s", msg, rollback)
 }
 
 func (d *driver) DeleteEndpoint(nid, eid types.UUID) error {
-	return &driverapi.ErrNotImplemented{}
+	delete := &api.DeleteEndpointRequest{
+		NetworkID:  string(nid),
+		EndpointID: string(eid),
+	}
+	return d.call("DeleteEndpoint", delete, &api.DeleteEndpointResponse{})
 }
 
 func (d *driver) EndpointOperInfo(nid, eid types.UUID) (map[string]interface{}, error) {
-	return nil, &driverapi.ErrNotImplemented{}
+	info := &api.EndpointInfoRequest{
+		NetworkID:  string(nid),
+		EndpointID: string(eid),
+	}
+	var res api.EndpointInfoResponse
+	if err := d.call("EndpointOperInfo", info, &res); err != nil {
+		return nil, err
+	}
+	return res.Value, nil
 }
 
 // Join method is invoked when a Sandbox is attached to an endpoint.
 func (d *driver) Join(nid, eid types.UUID, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
-	return &driverapi.ErrNotImplemented{}
+	join := &api.JoinRequest{
+		NetworkID:  string(nid),
+		EndpointID: string(eid),
+		SandboxKey: sboxKey,
+		Options:    options,
+	}
+	var (
+		res api.JoinResponse
+		err error
+	)
+	if err = d.call("Join", join, &res); err != nil {
+		return err
+	}
+
+	// Expect each interface ID given by CreateEndpoint to have an
+	// entry at that index in the names supplied here. In other words,
+	// if you supply 0..n interfaces with IDs 0..n above, you should
+	// supply the names in the same order.
+	ifaceNames := res.InterfaceNames
+	for _, iface := range jinfo.InterfaceNames() {
+		i := iface.ID()
+		if i >= len(ifaceNames) || i < 0 {
+			return errorWithRollback(fmt.Sprintf("no correlating interface %d in supplied interface names", i), d.Leave(nid, eid))
+		}
+		supplied := ifaceNames[i]
+		if err := iface.SetNames(supplied.SrcName, supplied.DstName); err != nil {
+			return errorWithRollback(fmt.Sprintf("failed to set interface name: %s", err), d.Leave(nid, eid))
+		}
+	}
+
+	var addr net.IP
+	if res.Gateway != "" {
+		if addr = net.ParseIP(res.Gateway); addr == nil {
+			return errorWithRollback(fmt.Sprintf("unable to parse Gateway %q", res.Gateway), d.Leave(nid, eid))
+		}
+		if jinfo.SetGateway(addr) != nil {
+			return errorWithRollback(fmt.Sprintf("failed to set gateway: %v", addr), d.Leave(nid, eid))
+		}
+	}
+	if res.GatewayIPv6 != "" {
+		if addr = net.ParseIP(res.GatewayIPv6); addr == nil {
+			return errorWithRollback(fmt.Sprintf("unable to parse GatewayIPv6 %q", res.GatewayIPv6), d.Leave(nid, eid))
+		}
+		if jinfo.SetGatewayIPv6(addr) != nil {
+			return errorWithRollback(fmt.Sprintf("failed to set gateway IPv6: %v", addr), d.Leave(nid, eid))
+		}
+	}
+	if res.HostsPath != "" {
+		if jinfo.SetHostsPath(res.HostsPath) != nil {
+			return errorWithRollback(fmt.Sprintf("failed to set hosts path: %s", res.HostsPath), d.Leave(nid, eid))
+		}
+	}
+	if res.ResolvConfPath != "" {
+		if jinfo.SetResolvConfPath(res.ResolvConfPath) != nil {
+			return errorWithRollback(fmt.Sprintf("failed to set resolv.conf path: %s", res.ResolvConfPath), d.Leave(nid, eid))
+		}
+	}
+	for _, r := range res.StaticRoutes {
+		_, dest, err := net.ParseCIDR(r.Destination)
+		if err != nil {
+			return errorWithRollback(fmt.Sprintf("unable to parse static route destination %q", r.Destination), d.Leave(nid, eid))
+		}
+		var nh net.IP
+		if r.NextHop != "" {
+			if nh = net.ParseIP(r.NextHop); nh == nil {
+				return errorWithRollback(fmt.Sprintf("unable to parse static route next hop %q", r.NextHop), d.Leave(nid, eid))
+			}
+		}
+		if err := jinfo.AddStaticRoute(dest, r.RouteType, nh, r.InterfaceID); err != nil {
+			return errorWithRollback(fmt.Sprintf("failed to add static route to %s: %v", r.Destination, err), d.Leave(nid, eid))
+		}
+	}
+	return nil
 }
 
 // Leave method is invoked when a Sandbox detaches from an endpoint.
 func (d *driver) Leave(nid, eid types.UUID) error {
-	return &driverapi.ErrNotImplemented{}
+	leave := &api.LeaveRequest{
+		NetworkID:  string(nid),
+		EndpointID: string(eid),
+	}
+	return d.call("Leave", leave, &api.LeaveResponse{})
 }
 
 func (d *driver) Type() string {
 	return d.networkType
 }
+
+func parseInterfaces(r api.CreateEndpointResponse) ([]*api.Interface, error) {
+	var interfaces []*api.Interface
+
+	for _, inIf := range r.Interfaces {
+		var err error
+		outIf := &api.Interface{ID: inIf.ID}
+		if inIf.Address != "" {
+			if outIf.Address, err = toAddr(inIf.Address); err != nil {
+				return nil, err
+			}
+		}
+		if inIf.AddressIPv6 != "" {
+			if outIf.AddressIPv6, err = toAddr(inIf.AddressIPv6); err != nil {
+				return nil, err
+			}
+		}
+		if inIf.MacAddress != "" {
+			if outIf.MacAddress, err = net.ParseMAC(inIf.MacAddress); err != nil {
+				return nil, err
+			}
+		}
+		interfaces = append(interfaces, outIf)
+	}
+
+	return interfaces, nil
+}
+
+// toAddr parses an address in CIDR notation preserving the host part,
+// which net.ParseCIDR would otherwise mask out.
+func toAddr(ipAddr string) (*net.IPNet, error) {
+	ip, ipnet, err := net.ParseCIDR(ipAddr)
+	if err != nil {
+		return nil, err
+	}
+	ipnet.IP = ip
+	return ipnet, nil
+}
+
+func addrString(addr *net.IPNet) string {
+	if addr == nil || addr.IP == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func macString(mac net.HardwareAddr) string {
+	if len(mac) == 0 {
+		return ""
+	}
+	return mac.String()
+}
@@ -0,0 +1,31 @@
+package remote
+
+import "fmt"
+
+// IncompatibleVersionError is returned when a plugin speaks a version of the
+// remote driver protocol which libnetwork does not support.
+type IncompatibleVersionError struct {
+	Plugin  string
+	Version int
+}
+
+func (ive *IncompatibleVersionError) Error() string {
+	return fmt.Sprintf("plugin %s speaks unsupported protocol version %d", ive.Plugin, ive.Version)
+}
+
+// Forbidden denotes the type of this error
+func (ive *IncompatibleVersionError) Forbidden() {}
+
+// InvalidScopeError is returned when a plugin reports a scope which is
+// neither local nor global.
+type InvalidScopeError struct {
+	Plugin string
+	Scope  string
+}
+
+func (ise *InvalidScopeError) Error() string {
+	return fmt.Sprintf("plugin %s reported invalid scope %q", ise.Plugin, ise.Scope)
+}
+
+// Forbidden denotes the type of this error
+func (ise *InvalidScopeError) Forbidden() {}
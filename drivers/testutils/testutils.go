@@ -0,0 +1,191 @@
+// Package testutils provides the fixtures the network driver tests drive the
+// drivers with outside of libnetwork.
+package testutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipams/builtin"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// Callback is the driver callback of the drivers under test. It hands out
+// its own instance of the built-in IPAM driver.
+type Callback struct {
+	ipam ipamapi.Ipam
+}
+
+// NewCallback returns a callback with a fresh built-in IPAM driver
+func NewCallback() *Callback {
+	return &Callback{ipam: builtin.NewAllocator()}
+}
+
+// RegisterDriver accepts any driver
+func (c *Callback) RegisterDriver(name string, driver driverapi.Driver, capability driverapi.Capability) error {
+	return nil
+}
+
+// GetIpam returns the built-in IPAM driver of the callback
+func (c *Callback) GetIpam(name string) (ipamapi.Ipam, error) {
+	if name != "" && name != ipamapi.DefaultIPAM {
+		return nil, types.NotFoundErrorf("unknown IPAM driver %s", name)
+	}
+	return c.ipam, nil
+}
+
+// Interface records the configuration of an interface of an Endpoint
+type Interface struct {
+	Index    int
+	Mac      net.HardwareAddr
+	Addr     net.IPNet
+	AddrIPv6 net.IPNet
+	SrcName  string
+	DstName  string
+}
+
+// ID returns the index of the interface
+func (i *Interface) ID() int {
+	return i.Index
+}
+
+// MacAddress returns the hardware address of the interface
+func (i *Interface) MacAddress() net.HardwareAddr {
+	return i.Mac
+}
+
+// Address returns the IPv4 address of the interface
+func (i *Interface) Address() net.IPNet {
+	return i.Addr
+}
+
+// AddressIPv6 returns the IPv6 address of the interface
+func (i *Interface) AddressIPv6() net.IPNet {
+	return i.AddrIPv6
+}
+
+// SetNames records the names of the interface
+func (i *Interface) SetNames(srcName string, dstName string) error {
+	i.SrcName = srcName
+	i.DstName = dstName
+	return nil
+}
+
+// Route is a static route added to an Endpoint
+type Route struct {
+	Destination *net.IPNet
+	RouteType   int
+	NextHop     net.IP
+	InterfaceID int
+}
+
+// Endpoint records what a driver sets on the endpoints it creates and joins
+// to a sandbox. It is both their endpoint and join information.
+type Endpoint struct {
+	Ifaces         []*Interface
+	Gateway        net.IP
+	GatewayIPv6    net.IP
+	HostsPath      string
+	ResolvConfPath string
+	Routes         []Route
+}
+
+// Interfaces returns the interfaces of the endpoint
+func (e *Endpoint) Interfaces() []driverapi.InterfaceInfo {
+	iList := make([]driverapi.InterfaceInfo, len(e.Ifaces))
+	for i, iface := range e.Ifaces {
+		iList[i] = iface
+	}
+	return iList
+}
+
+// AddInterface adds an interface to the endpoint
+func (e *Endpoint) AddInterface(id int, mac net.HardwareAddr, ipv4 net.IPNet, ipv6 net.IPNet) error {
+	e.Ifaces = append(e.Ifaces, &Interface{Index: id, Mac: mac, Addr: ipv4, AddrIPv6: ipv6})
+	return nil
+}
+
+// InterfaceNames returns the interfaces of the endpoint
+func (e *Endpoint) InterfaceNames() []driverapi.InterfaceNameInfo {
+	iList := make([]driverapi.InterfaceNameInfo, len(e.Ifaces))
+	for i, iface := range e.Ifaces {
+		iList[i] = iface
+	}
+	return iList
+}
+
+// SetGateway records the IPv4 gateway of the endpoint
+func (e *Endpoint) SetGateway(gw net.IP) error {
+	e.Gateway = gw
+	return nil
+}
+
+// SetGatewayIPv6 records the IPv6 gateway of the endpoint
+func (e *Endpoint) SetGatewayIPv6(gw6 net.IP) error {
+	e.GatewayIPv6 = gw6
+	return nil
+}
+
+// SetHostsPath records the hosts file path of the endpoint
+func (e *Endpoint) SetHostsPath(path string) error {
+	e.HostsPath = path
+	return nil
+}
+
+// SetResolvConfPath records the resolv.conf path of the endpoint
+func (e *Endpoint) SetResolvConfPath(path string) error {
+	e.ResolvConfPath = path
+	return nil
+}
+
+// AddStaticRoute records a static route of the endpoint
+func (e *Endpoint) AddStaticRoute(destination *net.IPNet, routeType int, nextHop net.IP, interfaceID int) error {
+	e.Routes = append(e.Routes, Route{Destination: destination, RouteType: routeType, NextHop: nextHop, InterfaceID: interfaceID})
+	return nil
+}
+
+// Route returns the most specific static route of the endpoint to the
+// address, if any
+func (e *Endpoint) Route(ip net.IP) *Route {
+	var best *Route
+	for i, r := range e.Routes {
+		if !r.Destination.Contains(ip) {
+			continue
+		}
+		if best == nil || prefixLen(r.Destination) > prefixLen(best.Destination) {
+			best = &e.Routes[i]
+		}
+	}
+	return best
+}
+
+func prefixLen(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
+
+// SetupParent creates and brings up the link of the passed name which the
+// links of a driver are created on: a dummy link, or a veth pair on kernels
+// without dummy links support.
+func SetupParent(t *testing.T, name string) netlink.Link {
+	if err := netlink.LinkAdd(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name}}); err != nil {
+		veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: name}, PeerName: name + "p"}
+		if err := netlink.LinkAdd(veth); err != nil {
+			t.Fatalf("Failed to create the parent link: %v", err)
+		}
+	}
+
+	parent, err := netlink.LinkByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := netlink.LinkSetUp(parent); err != nil {
+		t.Fatal(err)
+	}
+
+	return parent
+}
@@ -1,19 +1,14 @@
 package libnetwork
 
 import (
-	"bytes"
-	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/docker/docker/pkg/ioutils"
-	"github.com/docker/libnetwork/etchosts"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/resolvconf"
-	"github.com/docker/libnetwork/sandbox"
 	"github.com/docker/libnetwork/types"
 )
 
@@ -28,14 +23,15 @@ type Endpoint interface {
 	// Network returns the name of the network to which this endpoint is attached.
 	Network() string
 
-	// Join creates a new sandbox for the given container ID and populates the
-	// network resources allocated for the endpoint and joins the sandbox to
-	// the endpoint. It returns the sandbox key to the caller
-	Join(containerID string, options ...EndpointOption) (*ContainerData, error)
+	// Labels returns the labels the endpoint was created with.
+	Labels() map[string]string
 
-	// Leave removes the sandbox associated with  container ID and detaches
-	// the network resources populated in the sandbox
-	Leave(containerID string, options ...EndpointOption) error
+	// Join joins the sandbox to the endpoint and populates into the sandbox
+	// the network resources allocated for the endpoint.
+	Join(sb Sandbox, options ...EndpointOption) error
+
+	// Leave detaches the network resources populated in the sandbox.
+	Leave(sb Sandbox, options ...EndpointOption) error
 
 	// Return certain operational data belonging to this endpoint
 	Info() EndpointInfo
@@ -52,67 +48,21 @@ type Endpoint interface {
 // provided by libnetwork, they look like <Create|Join|Leave>Option[...](...)
 type EndpointOption func(ep *endpoint)
 
-// ContainerData is a set of data returned when a container joins an endpoint.
-type ContainerData struct {
-	SandboxKey string
-}
-
-// These are the container configs used to customize container /etc/hosts file.
-type hostsPathConfig struct {
-	hostName      string
-	domainName    string
-	hostsPath     string
-	extraHosts    []extraHost
-	parentUpdates []parentUpdate
-}
-
-// These are the container configs used to customize container /etc/resolv.conf file.
-type resolvConfPathConfig struct {
-	resolvConfPath string
-	dnsList        []string
-	dnsSearchList  []string
-}
-
-type containerConfig struct {
-	hostsPathConfig
-	resolvConfPathConfig
-	generic           map[string]interface{}
-	useDefaultSandBox bool
-}
-
-type extraHost struct {
-	name string
-	IP   string
-}
-
-type parentUpdate struct {
-	eid  string
-	name string
-	ip   string
-}
-
-type containerInfo struct {
-	id     string
-	config containerConfig
-	data   ContainerData
-}
-
 type endpoint struct {
 	name          string
 	id            types.UUID
 	network       *network
-	sandboxInfo   *sandbox.Info
 	iFaces        []*endpointInterface
 	joinInfo      *endpointJoinInfo
-	container     *containerInfo
+	sandboxID     string
 	exposedPorts  []types.TransportPort
+	aliases       []string
+	labels        map[string]string
 	generic       map[string]interface{}
 	joinLeaveDone chan struct{}
 	sync.Mutex
 }
 
-const defaultPrefix = "/var/lib/docker/network/files"
-
 func (ep *endpoint) ID() string {
 	ep.Lock()
 	defer ep.Unlock()
@@ -134,6 +84,29 @@ func (ep *endpoint) Network() string {
 	return ep.network.name
 }
 
+func (ep *endpoint) Labels() map[string]string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return copyLabels(ep.labels)
+}
+
+// hasName tells whether name is the name or an alias of the endpoint, case
+// insensitively. The caller holds the endpoint lock.
+func (ep *endpoint) hasName(name string) bool {
+	if strings.EqualFold(ep.name, name) {
+		return true
+	}
+
+	for _, alias := range ep.aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (ep *endpoint) processOptions(options ...EndpointOption) {
 	ep.Lock()
 	defer ep.Unlock()
@@ -203,46 +176,36 @@ func (ep *endpoint) joinLeaveEnd() {
 	}
 }
 
-func (ep *endpoint) Join(containerID string, options ...EndpointOption) (*ContainerData, error) {
+func (ep *endpoint) Join(sbox Sandbox, options ...EndpointOption) error {
 	var err error
 
-	if containerID == "" {
-		return nil, InvalidContainerIDError(containerID)
+	sb, ok := sbox.(*containerSandbox)
+	if !ok || sb == nil {
+		return InvalidSandboxError("")
 	}
 
 	ep.joinLeaveStart()
 	defer ep.joinLeaveEnd()
 
 	ep.Lock()
-	if ep.container != nil {
+	if ep.sandboxID != "" {
 		ep.Unlock()
-		return nil, ErrInvalidJoin{}
+		return ErrInvalidJoin{}
 	}
 
-	ep.container = &containerInfo{
-		id: containerID,
-		config: containerConfig{
-			hostsPathConfig: hostsPathConfig{
-				extraHosts:    []extraHost{},
-				parentUpdates: []parentUpdate{},
-			},
-		}}
-
+	ep.sandboxID = sb.id
 	ep.joinInfo = &endpointJoinInfo{}
 
-	container := ep.container
 	network := ep.network
 	epid := ep.id
-	joinInfo := ep.joinInfo
-	ifaces := ep.iFaces
 
 	ep.Unlock()
 	defer func() {
-		ep.Lock()
 		if err != nil {
-			ep.container = nil
+			ep.Lock()
+			ep.sandboxID = ""
+			ep.Unlock()
 		}
-		ep.Unlock()
 	}()
 
 	network.Lock()
@@ -251,98 +214,116 @@ func (ep *endpoint) Join(containerID string, options ...EndpointOption) (*Contai
 	ctrlr := network.ctrlr
 	network.Unlock()
 
-	ep.processOptions(options...)
-
-	sboxKey := sandbox.GenerateKey(containerID)
-	if container.config.useDefaultSandBox {
-		sboxKey = sandbox.GenerateKey("default")
+	if sb.controller != ctrlr {
+		err = InvalidSandboxError(sb.id)
+		return err
 	}
 
-	err = driver.Join(nid, epid, sboxKey, ep, container.config.generic)
-	if err != nil {
-		return nil, err
-	}
+	ep.processOptions(options...)
 
-	err = ep.buildHostsFiles()
-	if err != nil {
-		return nil, err
-	}
+	sb.Lock()
+	sb.processOptions(ep.joinInfo.sandboxOptions...)
+	sb.Unlock()
 
-	err = ep.updateParentHosts()
-	if err != nil {
-		return nil, err
+	for _, o := range ep.joinInfo.dnsOptions {
+		if err = resolvconf.ValidateOption(o); err != nil {
+			err = types.BadRequestErrorf("%v", err)
+			return err
+		}
 	}
 
-	err = ep.setupDNS()
+	sb.Lock()
+	generic := sb.config.generic
+	sb.Unlock()
+
+	err = driver.Join(nid, epid, sb.key, ep, generic)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer func() {
+		if err != nil {
+			if e := driver.Leave(nid, epid); e != nil {
+				logrus.Warnf("Failed to leave endpoint %s after a failed join: %v", ep.Name(), e)
+			}
+		}
+	}()
 
-	sb, err := ctrlr.sandboxAdd(sboxKey, !container.config.useDefaultSandBox)
+	err = sb.populateNetworkResources(ep)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() {
 		if err != nil {
-			ctrlr.sandboxRm(sboxKey)
+			sb.clearNetworkResources(ep)
 		}
 	}()
 
-	for _, i := range ifaces {
-		iface := &sandbox.Interface{
-			SrcName: i.srcName,
-			DstName: i.dstName,
-			Address: &i.addr,
-		}
-		if i.addrv6.IP.To16() != nil {
-			iface.AddressIPv6 = &i.addrv6
-		}
-		err = sb.AddInterface(iface)
+	// The hosts file resolves the container name to the address of the
+	// first endpoint joined to the sandbox
+	if sb.isPrimary(ep) {
+		err = sb.buildHostsFile()
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	err = sb.SetGateway(joinInfo.gw)
+	err = sb.updateParentHosts(ep)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer func() {
+		if err != nil {
+			if e := sb.removeParentHosts(ep); e != nil {
+				logrus.Warnf("Failed to remove the parent hosts records of endpoint %s after a failed join: %v", ep.Name(), e)
+			}
+		}
+	}()
 
-	err = sb.SetGatewayIPv6(joinInfo.gw6)
+	err = sb.setupDNS()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	container.data.SandboxKey = sb.Key()
-	cData := container.data
+	if e := ctrlr.updateToStore(ep); e != nil {
+		logrus.Warnf("Failed to update endpoint %s in the store: %v", ep.Name(), e)
+	}
+
+	if e := ctrlr.updateToStore(sb.kv()); e != nil {
+		logrus.Warnf("Failed to update sandbox %s in the store: %v", sb.id, e)
+	}
+
+	ctrlr.publishEndpointEvent(EventEndpointJoin, ep, sb.containerID)
 
-	return &cData, nil
+	return nil
 }
 
-func (ep *endpoint) Leave(containerID string, options ...EndpointOption) error {
+func (ep *endpoint) Leave(sbox Sandbox, options ...EndpointOption) error {
 	var err error
 
+	sb, ok := sbox.(*containerSandbox)
+	if !ok || sb == nil {
+		return InvalidSandboxError("")
+	}
+
 	ep.joinLeaveStart()
 	defer ep.joinLeaveEnd()
 
 	ep.processOptions(options...)
 
 	ep.Lock()
-	container := ep.container
 	n := ep.network
 
-	if container == nil || container.id == "" ||
-		containerID == "" || container.id != containerID {
-		if container == nil {
+	if ep.sandboxID != sb.id {
+		if ep.sandboxID == "" {
 			err = ErrNoContainer{}
 		} else {
-			err = InvalidContainerIDError(containerID)
+			err = InvalidSandboxError(sb.id)
 		}
 
 		ep.Unlock()
 		return err
 	}
-	ep.container = nil
+	ep.sandboxID = ""
 	ep.Unlock()
 
 	n.Lock()
@@ -352,26 +333,70 @@ func (ep *endpoint) Leave(containerID string, options ...EndpointOption) error {
 
 	err = driver.Leave(n.id, ep.id)
 
-	sb := ctrlr.sandboxGet(container.data.SandboxKey)
-	for _, i := range sb.Interfaces() {
-		err = sb.RemoveInterface(i)
-		if err != nil {
-			logrus.Debugf("Remove interface failed: %v", err)
+	if e := sb.removeParentHosts(ep); e != nil {
+		logrus.Warnf("Failed to remove the parent hosts records of endpoint %s: %v", ep.Name(), e)
+	}
+
+	primary := sb.isPrimary(ep)
+	ep.Lock()
+	hasDNSOptions := ep.joinInfo != nil && len(ep.joinInfo.dnsOptions) > 0
+	ep.Unlock()
+	sb.clearNetworkResources(ep)
+
+	// The resolv.conf no longer carries the DNS options of the endpoint
+	if hasDNSOptions {
+		if e := sb.setupDNS(); e != nil {
+			logrus.Warnf("Failed to update the resolv.conf of sandbox %s: %v", sb.id, e)
 		}
 	}
 
-	ctrlr.sandboxRm(container.data.SandboxKey)
+	if primary {
+		if e := sb.buildHostsFile(); e != nil {
+			logrus.Warnf("Failed to build the hosts file of sandbox %s: %v", sb.id, e)
+		}
+	}
+
+	if e := ctrlr.updateToStore(ep); e != nil {
+		logrus.Warnf("Failed to update endpoint %s in the store: %v", ep.Name(), e)
+	}
+
+	if e := ctrlr.updateToStore(sb.kv()); e != nil {
+		logrus.Warnf("Failed to update sandbox %s in the store: %v", sb.id, e)
+	}
+
+	ctrlr.publishEndpointEvent(EventEndpointLeave, ep, sb.containerID)
 
 	return err
 }
 
+// getSandbox returns the sandbox joined to the endpoint, if any.
+func (ep *endpoint) getSandbox() *containerSandbox {
+	ep.Lock()
+	sid := ep.sandboxID
+	n := ep.network
+	ep.Unlock()
+
+	if sid == "" {
+		return nil
+	}
+
+	n.Lock()
+	c := n.ctrlr
+	n.Unlock()
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.containerSandboxes[sid]
+}
+
 func (ep *endpoint) Delete() error {
 	var err error
 
 	ep.Lock()
 	epid := ep.id
 	name := ep.name
-	if ep.container != nil {
+	if ep.sandboxID != "" {
 		ep.Unlock()
 		return &ActiveContainerError{name: name, id: string(epid)}
 	}
@@ -399,330 +424,171 @@ func (ep *endpoint) Delete() error {
 	}()
 
 	err = driver.DeleteEndpoint(nid, epid)
-	return err
-}
-
-func (ep *endpoint) buildHostsFiles() error {
-	var extraContent []etchosts.Record
-
-	ep.Lock()
-	container := ep.container
-	joinInfo := ep.joinInfo
-	ifaces := ep.iFaces
-	ep.Unlock()
-
-	if container == nil {
-		return ErrNoContainer{}
-	}
-
-	if container.config.hostsPath == "" {
-		container.config.hostsPath = defaultPrefix + "/" + container.id + "/hosts"
-	}
-
-	dir, _ := filepath.Split(container.config.hostsPath)
-	err := createBasePath(dir)
 	if err != nil {
 		return err
 	}
 
-	if joinInfo != nil && joinInfo.hostsPath != "" {
-		content, err := ioutil.ReadFile(joinInfo.hostsPath)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
-
-		if err == nil {
-			return ioutil.WriteFile(container.config.hostsPath, content, 0644)
-		}
+	if e := n.ctrlr.deleteFromStore(ep); e != nil {
+		logrus.Warnf("Failed to delete endpoint %s from the store: %v", name, e)
 	}
 
-	name := container.config.hostName
-	if container.config.domainName != "" {
-		name = name + "." + container.config.domainName
-	}
-
-	for _, extraHost := range container.config.extraHosts {
-		extraContent = append(extraContent,
-			etchosts.Record{Hosts: extraHost.name, IP: extraHost.IP})
-	}
-
-	IP := ""
-	if len(ifaces) != 0 && ifaces[0] != nil {
-		IP = ifaces[0].addr.IP.String()
-	}
-
-	return etchosts.Build(container.config.hostsPath, IP, container.config.hostName,
-		container.config.domainName, extraContent)
-}
-
-func (ep *endpoint) updateParentHosts() error {
-	ep.Lock()
-	container := ep.container
-	network := ep.network
-	ep.Unlock()
-
-	if container == nil {
-		return ErrNoContainer{}
-	}
-
-	for _, update := range container.config.parentUpdates {
-		network.Lock()
-		pep, ok := network.endpoints[types.UUID(update.eid)]
-		if !ok {
-			network.Unlock()
-			continue
-		}
-		network.Unlock()
-
-		pep.Lock()
-		pContainer := pep.container
-		pep.Unlock()
-
-		if pContainer != nil {
-			if err := etchosts.Update(pContainer.config.hostsPath, update.ip, update.name); err != nil {
-				return err
-			}
-		}
-	}
+	n.ctrlr.publishEndpointEvent(EventEndpointDelete, ep, "")
 
 	return nil
 }
 
-func (ep *endpoint) updateDNS(resolvConf []byte) error {
-	ep.Lock()
-	container := ep.container
-	network := ep.network
-	ep.Unlock()
-
-	if container == nil {
-		return ErrNoContainer{}
-	}
-
-	oldHash := []byte{}
-	hashFile := container.config.resolvConfPath + ".hash"
-
-	resolvBytes, err := ioutil.ReadFile(container.config.resolvConfPath)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-	} else {
-		oldHash, err = ioutil.ReadFile(hashFile)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				return err
-			}
-
-			oldHash = []byte{}
+// EndpointOptionGeneric function returns an option setter for a Generic option defined
+// in a Dictionary of Key-Value pair
+func EndpointOptionGeneric(generic map[string]interface{}) EndpointOption {
+	return func(ep *endpoint) {
+		for k, v := range generic {
+			ep.generic[k] = v
 		}
 	}
+}
 
-	curHash, err := ioutils.HashData(bytes.NewReader(resolvBytes))
-	if err != nil {
-		return err
-	}
-
-	if string(oldHash) != "" && curHash != string(oldHash) {
-		// Seems the user has changed the container resolv.conf since the last time
-		// we checked so return without doing anything.
-		return nil
-	}
-
-	// replace any localhost/127.* and remove IPv6 nameservers if IPv6 disabled.
-	resolvConf, _ = resolvconf.FilterResolvDNS(resolvConf, network.enableIPv6)
-
-	newHash, err := ioutils.HashData(bytes.NewReader(resolvConf))
-	if err != nil {
-		return err
-	}
-
-	// for atomic updates to these files, use temporary files with os.Rename:
-	dir := path.Dir(container.config.resolvConfPath)
-	tmpHashFile, err := ioutil.TempFile(dir, "hash")
-	if err != nil {
-		return err
-	}
-	tmpResolvFile, err := ioutil.TempFile(dir, "resolv")
-	if err != nil {
-		return err
-	}
-
-	// Change the perms to 0644 since ioutil.TempFile creates it by default as 0600
-	if err := os.Chmod(tmpResolvFile.Name(), 0644); err != nil {
-		return err
-	}
-
-	// write the updates to the temp files
-	if err = ioutil.WriteFile(tmpHashFile.Name(), []byte(newHash), 0644); err != nil {
-		return err
-	}
-	if err = ioutil.WriteFile(tmpResolvFile.Name(), resolvConf, 0644); err != nil {
-		return err
-	}
-
-	// rename the temp files for atomic replace
-	if err = os.Rename(tmpHashFile.Name(), hashFile); err != nil {
-		return err
+// CreateOptionExposedPorts function returns an option setter for the container exposed
+// ports option to be passed to network.CreateEndpoint() method.
+func CreateOptionExposedPorts(exposedPorts []types.TransportPort) EndpointOption {
+	return func(ep *endpoint) {
+		// Defensive copy
+		eps := make([]types.TransportPort, len(exposedPorts))
+		copy(eps, exposedPorts)
+		// Store endpoint label and in generic because driver needs it
+		ep.exposedPorts = eps
+		ep.generic[netlabel.ExposedPorts] = eps
 	}
-	return os.Rename(tmpResolvFile.Name(), container.config.resolvConfPath)
 }
 
-func (ep *endpoint) setupDNS() error {
-	ep.Lock()
-	container := ep.container
-	ep.Unlock()
-
-	if container == nil {
-		return ErrNoContainer{}
+// CreateOptionLabels function returns an option setter for the labels of the
+// endpoint to be passed to network.CreateEndpoint() method.
+func CreateOptionLabels(labels map[string]string) EndpointOption {
+	return func(ep *endpoint) {
+		// Store endpoint label and in generic because driver needs it
+		ep.labels = copyLabels(labels)
+		ep.generic[netlabel.Labels] = ep.labels
 	}
+}
 
-	if container.config.resolvConfPath == "" {
-		container.config.resolvConfPath = defaultPrefix + "/" + container.id + "/resolv.conf"
+// CreateOptionAlias function returns an option setter for an alias the
+// embedded DNS servers of the sandboxes resolve the endpoint with, to be
+// passed to network.CreateEndpoint() method.
+func CreateOptionAlias(alias string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.aliases = append(ep.aliases, alias)
 	}
+}
 
-	dir, _ := filepath.Split(container.config.resolvConfPath)
-	err := createBasePath(dir)
-	if err != nil {
-		return err
+// CreateOptionPortMapping function returns an option setter for the mapping
+// ports option to be passed to network.CreateEndpoint() method.
+func CreateOptionPortMapping(portBindings []types.PortBinding) EndpointOption {
+	return func(ep *endpoint) {
+		// Store a copy of the bindings as generic data to pass to the driver
+		pbs := make([]types.PortBinding, len(portBindings))
+		copy(pbs, portBindings)
+		ep.generic[netlabel.PortMap] = pbs
 	}
+}
 
-	resolvConf, err := resolvconf.Get()
-	if err != nil {
-		return err
+// JoinOptionPriority function returns an option setter for the priority of
+// the endpoint to be passed to endpoint.Join() method. Among the endpoints
+// joined to a sandbox, the one with the highest priority provides the default
+// gateway, the first one joined winning in case of a tie.
+func JoinOptionPriority(prio int) EndpointOption {
+	return func(ep *endpoint) {
+		ep.joinInfo.priority = prio
 	}
+}
 
-	if len(container.config.dnsList) > 0 ||
-		len(container.config.dnsSearchList) > 0 {
-		var (
-			dnsList       = resolvconf.GetNameservers(resolvConf)
-			dnsSearchList = resolvconf.GetSearchDomains(resolvConf)
-		)
-
-		if len(container.config.dnsList) > 0 {
-			dnsList = container.config.dnsList
-		}
-
-		if len(container.config.dnsSearchList) > 0 {
-			dnsSearchList = container.config.dnsSearchList
-		}
-
-		return resolvconf.Build(container.config.resolvConfPath, dnsList, dnsSearchList)
+// JoinOptionDNSOptions function returns an option setter for the resolver
+// options to be passed to endpoint.Join() method: ndots:n, timeout:n,
+// attempts:n, rotate and edns0. They are merged into the options of the
+// resolv.conf of the sandbox for as long as the endpoint stays joined.
+func JoinOptionDNSOptions(options ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.joinInfo.dnsOptions = append(ep.joinInfo.dnsOptions, options...)
 	}
-
-	return ep.updateDNS(resolvConf)
 }
 
-// EndpointOptionGeneric function returns an option setter for a Generic option defined
-// in a Dictionary of Key-Value pair
-func EndpointOptionGeneric(generic map[string]interface{}) EndpointOption {
+// joinSandboxOption returns an endpoint option applying the sandbox option
+// to the sandbox passed to endpoint.Join() method.
+func joinSandboxOption(opt SandboxOption) EndpointOption {
 	return func(ep *endpoint) {
-		for k, v := range generic {
-			ep.generic[k] = v
+		if ep.joinInfo != nil {
+			ep.joinInfo.sandboxOptions = append(ep.joinInfo.sandboxOptions, opt)
 		}
 	}
 }
 
 // JoinOptionHostname function returns an option setter for hostname option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionHostname when creating the sandbox.
 func JoinOptionHostname(name string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.hostName = name
-	}
+	return joinSandboxOption(SandboxOptionHostname(name))
 }
 
 // JoinOptionDomainname function returns an option setter for domainname option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionDomainname when creating the sandbox.
 func JoinOptionDomainname(name string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.domainName = name
-	}
+	return joinSandboxOption(SandboxOptionDomainname(name))
 }
 
 // JoinOptionHostsPath function returns an option setter for hostspath option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionHostsPath when creating the sandbox.
 func JoinOptionHostsPath(path string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.hostsPath = path
-	}
+	return joinSandboxOption(SandboxOptionHostsPath(path))
 }
 
 // JoinOptionExtraHost function returns an option setter for extra /etc/hosts options
 // which is a name and IP as strings.
+//
+// Deprecated: use SandboxOptionExtraHost when creating the sandbox.
 func JoinOptionExtraHost(name string, IP string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.extraHosts = append(ep.container.config.extraHosts, extraHost{name: name, IP: IP})
-	}
+	return joinSandboxOption(SandboxOptionExtraHost(name, IP))
 }
 
 // JoinOptionParentUpdate function returns an option setter for parent container
 // which needs to update the IP address for the linked container.
+//
+// Deprecated: use SandboxOptionParentUpdate when creating the sandbox.
 func JoinOptionParentUpdate(eid string, name, ip string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.parentUpdates = append(ep.container.config.parentUpdates, parentUpdate{eid: eid, name: name, ip: ip})
-	}
+	return joinSandboxOption(SandboxOptionParentUpdate(eid, name, ip))
 }
 
 // JoinOptionResolvConfPath function returns an option setter for resolvconfpath option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionResolvConfPath when creating the sandbox.
 func JoinOptionResolvConfPath(path string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.resolvConfPath = path
-	}
+	return joinSandboxOption(SandboxOptionResolvConfPath(path))
 }
 
 // JoinOptionDNS function returns an option setter for dns entry option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionDNS when creating the sandbox.
 func JoinOptionDNS(dns string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.dnsList = append(ep.container.config.dnsList, dns)
-	}
+	return joinSandboxOption(SandboxOptionDNS(dns))
 }
 
 // JoinOptionDNSSearch function returns an option setter for dns search entry option to
 // be passed to endpoint Join method.
+//
+// Deprecated: use SandboxOptionDNSSearch when creating the sandbox.
 func JoinOptionDNSSearch(search string) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.dnsSearchList = append(ep.container.config.dnsSearchList, search)
-	}
-}
-
-// JoinOptionUseDefaultSandbox function returns an option setter for using default sandbox to
-// be passed to endpoint Join method.
-func JoinOptionUseDefaultSandbox() EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.useDefaultSandBox = true
-	}
-}
-
-// CreateOptionExposedPorts function returns an option setter for the container exposed
-// ports option to be passed to network.CreateEndpoint() method.
-func CreateOptionExposedPorts(exposedPorts []types.TransportPort) EndpointOption {
-	return func(ep *endpoint) {
-		// Defensive copy
-		eps := make([]types.TransportPort, len(exposedPorts))
-		copy(eps, exposedPorts)
-		// Store endpoint label and in generic because driver needs it
-		ep.exposedPorts = eps
-		ep.generic[netlabel.ExposedPorts] = eps
-	}
-}
-
-// CreateOptionPortMapping function returns an option setter for the mapping
-// ports option to be passed to network.CreateEndpoint() method.
-func CreateOptionPortMapping(portBindings []types.PortBinding) EndpointOption {
-	return func(ep *endpoint) {
-		// Store a copy of the bindings as generic data to pass to the driver
-		pbs := make([]types.PortBinding, len(portBindings))
-		copy(pbs, portBindings)
-		ep.generic[netlabel.PortMap] = pbs
-	}
+	return joinSandboxOption(SandboxOptionDNSSearch(search))
 }
 
 // JoinOptionGeneric function returns an option setter for Generic configuration
 // that is not managed by libNetwork but can be used by the Drivers during the call to
 // endpoint join method. Container Labels are a good example.
+//
+// Deprecated: use SandboxOptionGeneric when creating the sandbox.
 func JoinOptionGeneric(generic map[string]interface{}) EndpointOption {
-	return func(ep *endpoint) {
-		ep.container.config.generic = generic
-	}
+	return joinSandboxOption(SandboxOptionGeneric(generic))
 }
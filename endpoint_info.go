@@ -25,6 +25,10 @@ type EndpointInfo interface {
 	// the endpoint. If there is no container joined then this will return an
 	// empty string.
 	SandboxKey() string
+
+	// ProvidesGateway returns true if the default gateway of the sandbox
+	// which has joined the endpoint is the one of this endpoint.
+	ProvidesGateway() bool
 }
 
 // InterfaceInfo provides an interface to retrieve interface addresses bound to the endpoint.
@@ -53,6 +57,12 @@ type endpointJoinInfo struct {
 	gw6            net.IP
 	hostsPath      string
 	resolvConfPath string
+	priority       int
+	dnsOptions     []string
+	staticRoutes   []*types.StaticRoute
+	// sandboxOptions are the sandbox options passed to Join through the
+	// deprecated JoinOption setters
+	sandboxOptions []SandboxOption
 }
 
 func (ep *endpoint) Info() EndpointInfo {
@@ -150,14 +160,24 @@ func (ep *endpoint) InterfaceNames() []driverapi.InterfaceNameInfo {
 }
 
 func (ep *endpoint) SandboxKey() string {
-	ep.Lock()
-	defer ep.Unlock()
-
-	if ep.container == nil {
+	sb := ep.getSandbox()
+	if sb == nil {
 		return ""
 	}
 
-	return ep.container.data.SandboxKey
+	return sb.Key()
+}
+
+func (ep *endpoint) ProvidesGateway() bool {
+	sb := ep.getSandbox()
+	if sb == nil {
+		return false
+	}
+
+	sb.Lock()
+	defer sb.Unlock()
+
+	return sb.gwEndpoint == ep
 }
 
 func (ep *endpoint) Gateway() net.IP {
@@ -213,3 +233,42 @@ func (ep *endpoint) SetResolvConfPath(path string) error {
 	ep.joinInfo.resolvConfPath = path
 	return nil
 }
+
+func (ep *endpoint) AddStaticRoute(destination *net.IPNet, routeType int, nextHop net.IP, interfaceID int) error {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if destination == nil {
+		return types.BadRequestErrorf("static route without a destination")
+	}
+
+	r := &types.StaticRoute{
+		Destination: types.GetIPNetCopy(destination),
+		RouteType:   routeType,
+		NextHop:     types.GetIPCopy(nextHop),
+		InterfaceID: interfaceID,
+	}
+
+	switch routeType {
+	case types.NEXTHOP:
+		if len(nextHop) == 0 {
+			return types.BadRequestErrorf("next hop route to %s without a next hop", destination)
+		}
+	case types.CONNECTED:
+		found := false
+		for _, i := range ep.iFaces {
+			if i.id == interfaceID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return types.BadRequestErrorf("on-link route to %s through unknown interface %d", destination, interfaceID)
+		}
+	default:
+		return types.BadRequestErrorf("static route to %s with invalid type %d", destination, routeType)
+	}
+
+	ep.joinInfo.staticRoutes = append(ep.joinInfo.staticRoutes, r)
+	return nil
+}
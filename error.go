@@ -24,6 +24,16 @@ func (nse ErrNoSuchEndpoint) Error() string {
 // BadRequest denotes the type of this error
 func (nse ErrNoSuchEndpoint) BadRequest() {}
 
+// ErrNoSuchSandbox is returned when a sandbox query finds no result
+type ErrNoSuchSandbox string
+
+func (nss ErrNoSuchSandbox) Error() string {
+	return fmt.Sprintf("sandbox %s not found", string(nss))
+}
+
+// BadRequest denotes the type of this error
+func (nss ErrNoSuchSandbox) BadRequest() {}
+
 // ErrInvalidNetworkDriver is returned if an invalid driver
 // name is passed.
 type ErrInvalidNetworkDriver string
@@ -90,6 +100,17 @@ func (nt NetworkTypeError) Error() string {
 // NotFound denotes the type of this error
 func (nt NetworkTypeError) NotFound() {}
 
+// IpamTypeError type is returned when the IPAM driver name is not
+// known to libnetwork.
+type IpamTypeError string
+
+func (it IpamTypeError) Error() string {
+	return fmt.Sprintf("unknown IPAM driver %q", string(it))
+}
+
+// NotFound denotes the type of this error
+func (it IpamTypeError) NotFound() {}
+
 // NetworkNameError is returned when a network with the same name already exists.
 type NetworkNameError string
 
@@ -166,3 +187,26 @@ func (id InvalidContainerIDError) Error() string {
 
 // BadRequest denotes the type of this error
 func (id InvalidContainerIDError) BadRequest() {}
+
+// InvalidSandboxError is returned when an endpoint is joined by a sandbox
+// which does not belong to its controller, or left by a sandbox which has not
+// joined it.
+type InvalidSandboxError string
+
+func (is InvalidSandboxError) Error() string {
+	return fmt.Sprintf("invalid sandbox %s", string(is))
+}
+
+// BadRequest denotes the type of this error
+func (is InvalidSandboxError) BadRequest() {}
+
+// SandboxExistsError is returned when a sandbox is created for a container
+// which already has one.
+type SandboxExistsError string
+
+func (se SandboxExistsError) Error() string {
+	return fmt.Sprintf("a sandbox already exists for container %s", string(se))
+}
+
+// Forbidden denotes the type of this error
+func (se SandboxExistsError) Forbidden() {}
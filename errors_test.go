@@ -8,7 +8,7 @@ import (
 
 func TestErrorInterfaces(t *testing.T) {
 
-	badRequestErrorList := []error{ErrInvalidID(""), ErrInvalidName(""), ErrInvalidJoin{}, ErrInvalidNetworkDriver(""), InvalidContainerIDError(""), ErrNoSuchNetwork(""), ErrNoSuchEndpoint("")}
+	badRequestErrorList := []error{ErrInvalidID(""), ErrInvalidName(""), ErrInvalidJoin{}, ErrInvalidNetworkDriver(""), InvalidContainerIDError(""), ErrNoSuchNetwork(""), ErrNoSuchEndpoint(""), ErrNoSuchSandbox(""), InvalidSandboxError("")}
 	for _, err := range badRequestErrorList {
 		switch u := err.(type) {
 		case types.BadRequestError:
@@ -28,7 +28,7 @@ func TestErrorInterfaces(t *testing.T) {
 		}
 	}
 
-	notFoundErrorList := []error{NetworkTypeError(""), &UnknownNetworkError{}, &UnknownEndpointError{}}
+	notFoundErrorList := []error{NetworkTypeError(""), IpamTypeError(""), &UnknownNetworkError{}, &UnknownEndpointError{}}
 	for _, err := range notFoundErrorList {
 		switch u := err.(type) {
 		case types.NotFoundError:
@@ -38,7 +38,7 @@ func TestErrorInterfaces(t *testing.T) {
 		}
 	}
 
-	forbiddenErrorList := []error{NetworkTypeError(""), &UnknownNetworkError{}, &UnknownEndpointError{}}
+	forbiddenErrorList := []error{NetworkTypeError(""), &UnknownNetworkError{}, &UnknownEndpointError{}, SandboxExistsError("")}
 	for _, err := range forbiddenErrorList {
 		switch u := err.(type) {
 		case types.ForbiddenError:
@@ -1,11 +1,16 @@
 package etchosts
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"syscall"
 )
 
 // Record Structure for a single host record
@@ -62,7 +67,94 @@ func Build(path, IP, hostname, domainname string, extraContent []Record) error {
 		}
 	}
 
-	return ioutil.WriteFile(path, content.Bytes(), 0644)
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeFile(path, content.Bytes())
+}
+
+// Add appends the records missing from the hosts file at path.
+func Add(path string, recs []Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	old, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	content := bytes.NewBuffer(old)
+	if len(old) > 0 && old[len(old)-1] != '\n' {
+		content.WriteByte('\n')
+	}
+
+	var added bool
+	for _, r := range recs {
+		if hasRecord(old, r) {
+			continue
+		}
+		if _, err := r.WriteTo(content); err != nil {
+			return err
+		}
+		added = true
+	}
+	if !added {
+		return nil
+	}
+
+	return writeFile(path, content.Bytes())
+}
+
+// Delete removes the lines of the records from the hosts file at path. The
+// other lines, comments included, are left untouched.
+func Delete(path string, recs []Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	old, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	content := bytes.NewBuffer(nil)
+	s := bufio.NewScanner(bytes.NewReader(old))
+	var deleted bool
+lines:
+	for s.Scan() {
+		for _, r := range recs {
+			if r.matches(s.Text()) {
+				deleted = true
+				continue lines
+			}
+		}
+		content.Write(s.Bytes())
+		content.WriteByte('\n')
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if !deleted {
+		return nil
+	}
+
+	return writeFile(path, content.Bytes())
 }
 
 // Update all IP addresses where hostname matches.
@@ -70,10 +162,82 @@ func Build(path, IP, hostname, domainname string, extraContent []Record) error {
 // IP is new IP address
 // hostname is hostname to search for to replace IP
 func Update(path, IP, hostname string) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	old, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 	var re = regexp.MustCompile(fmt.Sprintf("(\\S*)(\\t%s)", regexp.QuoteMeta(hostname)))
-	return ioutil.WriteFile(path, re.ReplaceAll(old, []byte(IP+"$2")), 0644)
+	return writeFile(path, re.ReplaceAll(old, []byte(IP+"$2")))
+}
+
+// matches tells whether the hosts file line is the one of the record,
+// whatever the blanks separating its fields
+func (r Record) matches(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != r.IP {
+		return false
+	}
+	return strings.Join(fields[1:], " ") == strings.Join(strings.Fields(r.Hosts), " ")
+}
+
+func hasRecord(content []byte, r Record) bool {
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		if r.matches(s.Text()) {
+			return true
+		}
+	}
+	return false
+}
+
+// lock takes an exclusive lock on the directory of the hosts file at path,
+// which serializes the updates of the file across processes, and returns the
+// function releasing it. The file itself cannot be locked as it is replaced
+// on every update.
+func lock(path string) (func(), error) {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to lock the directory of %s: %v", path, err)
+	}
+
+	return func() {
+		syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+		dir.Close()
+	}, nil
+}
+
+// writeFile atomically replaces the file at path with the content: readers
+// see either the old or the new content, never a partial write.
+func writeFile(path string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
 }
@@ -2,8 +2,11 @@ package etchosts
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	_ "github.com/docker/libnetwork/netutils"
@@ -134,3 +137,112 @@ func TestUpdate(t *testing.T) {
 		t.Fatalf("Expected to find '%s' got '%s'", expected, content)
 	}
 }
+
+func TestAddDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etchosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+
+	if err := Build(file, "10.11.12.13", "testhostname", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := []Record{
+		{Hosts: "db", IP: "172.17.0.3"},
+		{Hosts: "web web.example.com", IP: "172.17.0.4"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := Add(file, recs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"172.17.0.3\tdb\n", "172.17.0.4\tweb web.example.com\n"} {
+		if c := bytes.Count(content, []byte(expected)); c != 1 {
+			t.Fatalf("Expected to find '%s' once, found it %d times in '%s'", expected, c, content)
+		}
+	}
+
+	if err := Delete(file, recs[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unexpected := "172.17.0.4\tweb"; bytes.Contains(content, []byte(unexpected)) {
+		t.Fatalf("Did not expect to find '%s' in '%s'", unexpected, content)
+	}
+	for _, expected := range []string{"10.11.12.13\ttesthostname\n", "127.0.0.1\tlocalhost\n", "172.17.0.3\tdb\n"} {
+		if !bytes.Contains(content, []byte(expected)) {
+			t.Fatalf("Expected to find '%s' got '%s'", expected, content)
+		}
+	}
+
+	// The records are matched whatever the blanks separating the fields
+	if err := ioutil.WriteFile(file, []byte("172.17.0.3   db\n# 172.17.0.3\tdb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(file, recs); err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# 172.17.0.3\tdb\n"; string(content) != expected {
+		t.Fatalf("Expected '%s' got '%s'", expected, content)
+	}
+
+	// No temporary file is left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Mode().Perm() != 0644 {
+		t.Fatalf("Expected the hosts file alone with mode 0644 in %s, got %v", dir, files)
+	}
+}
+
+func TestAddConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etchosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+
+	if err := Build(file, "", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := Add(file, []Record{{Hosts: fmt.Sprintf("host%d", i), IP: fmt.Sprintf("172.17.0.%d", i+2)}}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if expected := fmt.Sprintf("172.17.0.%d\thost%d\n", i+2, i); !bytes.Contains(content, []byte(expected)) {
+			t.Fatalf("Expected to find '%s' got '%s'", expected, content)
+		}
+	}
+}
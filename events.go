@@ -0,0 +1,158 @@
+package libnetwork
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventType identifies the kind of change an Event reports.
+type EventType string
+
+const (
+	// EventNetworkCreate is emitted when a network is created
+	EventNetworkCreate EventType = "network-create"
+	// EventNetworkDelete is emitted when a network is deleted
+	EventNetworkDelete EventType = "network-delete"
+	// EventEndpointCreate is emitted when an endpoint is created
+	EventEndpointCreate EventType = "endpoint-create"
+	// EventEndpointDelete is emitted when an endpoint is deleted
+	EventEndpointDelete EventType = "endpoint-delete"
+	// EventEndpointJoin is emitted when a container joins an endpoint
+	EventEndpointJoin EventType = "endpoint-join"
+	// EventEndpointLeave is emitted when a container leaves an endpoint
+	EventEndpointLeave EventType = "endpoint-leave"
+	// EventDriverRegister is emitted when a network driver is registered
+	EventDriverRegister EventType = "driver-register"
+)
+
+// eventBufferSize is the number of events buffered for a subscriber. Events
+// are dropped for subscribers which do not keep up.
+const eventBufferSize = 128
+
+// Event describes a change to the objects managed by the controller. Fields
+// which do not apply to the event type are left empty.
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	NetworkType  string
+	NetworkID    string
+	NetworkName  string
+	EndpointID   string
+	EndpointName string
+	ContainerID  string
+}
+
+// EventFilter selects the events delivered to a subscriber. Empty fields
+// match any event.
+type EventFilter struct {
+	// Types restricts the events to the listed types
+	Types []EventType
+	// NetworkID restricts the events to the ones about the network
+	NetworkID string
+	// NetworkType restricts the events to the ones about the driver
+	NetworkType string
+}
+
+func (f *EventFilter) match(e *Event) bool {
+	if f.NetworkID != "" && f.NetworkID != e.NetworkID {
+		return false
+	}
+
+	if f.NetworkType != "" && f.NetworkType != e.NetworkType {
+		return false
+	}
+
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+type subscriber struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+type eventBus struct {
+	subscribers map[*subscriber]struct{}
+	sync.Mutex
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*subscriber]struct{})}
+}
+
+func (b *eventBus) subscribe(filter EventFilter) (<-chan Event, func()) {
+	s := &subscriber{filter: filter, ch: make(chan Event, eventBufferSize)}
+
+	b.Lock()
+	b.subscribers[s] = struct{}{}
+	b.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.Lock()
+			delete(b.subscribers, s)
+			close(s.ch)
+			b.Unlock()
+		})
+	}
+
+	return s.ch, cancel
+}
+
+func (b *eventBus) publish(e Event) {
+	e.Time = time.Now()
+
+	b.Lock()
+	defer b.Unlock()
+
+	for s := range b.subscribers {
+		if !s.filter.match(&e) {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			log.Warnf("Dropping %s event for a slow subscriber", e.Type)
+		}
+	}
+}
+
+func (c *controller) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	return c.events.subscribe(filter)
+}
+
+func (c *controller) publishNetworkEvent(t EventType, n *network) {
+	n.Lock()
+	e := Event{Type: t, NetworkType: n.networkType, NetworkID: string(n.id), NetworkName: n.name}
+	n.Unlock()
+
+	c.events.publish(e)
+}
+
+func (c *controller) publishEndpointEvent(t EventType, ep *endpoint, containerID string) {
+	ep.Lock()
+	n := ep.network
+	e := Event{Type: t, EndpointID: string(ep.id), EndpointName: ep.name, ContainerID: containerID}
+	ep.Unlock()
+
+	n.Lock()
+	e.NetworkType = n.networkType
+	e.NetworkID = string(n.id)
+	e.NetworkName = n.name
+	n.Unlock()
+
+	c.events.publish(e)
+}
@@ -1,9 +1,13 @@
 // Package ipallocator defines the default IP allocator. It will move out of libnetwork as an external IPAM plugin.
-// This has been imported unchanged from Docker, besides additon of registration logic
+// It has been imported from Docker, and its allocations are now tracked in bitmaps
+// so that the large IPv4 and IPv6 subnets are handled in constant space.
 package ipallocator
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"net"
 	"sync"
@@ -12,12 +16,18 @@ import (
 	"github.com/docker/libnetwork/netutils"
 )
 
-// allocatedMap is thread-unsafe set of allocated IP
+// maxBits is the largest number of IPs tracked in a subnet. Only the first
+// maxBits IPs of the larger IPv6 subnets can be allocated.
+const maxBits = ^uint64(0)
+
+// allocatedMap is thread-unsafe set of allocated IP. The IPs are tracked by
+// their ordinal from begin in a bitmap.
 type allocatedMap struct {
-	p     map[string]struct{}
-	last  *big.Int
-	begin *big.Int
-	end   *big.Int
+	begin  net.IP
+	bitmap *bitmap
+	// next is the ordinal the search for an available IP starts from, the
+	// one following the last allocated IP
+	next uint64
 }
 
 func newAllocatedMap(network *net.IPNet) *allocatedMap {
@@ -25,11 +35,18 @@ func newAllocatedMap(network *net.IPNet) *allocatedMap {
 	begin := big.NewInt(0).Add(ipToBigInt(firstIP), big.NewInt(1))
 	end := big.NewInt(0).Sub(ipToBigInt(lastIP), big.NewInt(1))
 
+	var bits uint64
+	if size := big.NewInt(0).Sub(end, begin); size.Sign() >= 0 {
+		if size.BitLen() > 64 || size.Uint64() == maxBits {
+			bits = maxBits
+		} else {
+			bits = size.Uint64() + 1
+		}
+	}
+
 	return &allocatedMap{
-		p:     make(map[string]struct{}),
-		begin: begin,
-		end:   end,
-		last:  big.NewInt(0).Sub(begin, big.NewInt(1)), // so first allocated will be begin
+		begin:  ipAdd(normalizeIP(firstIP), 1),
+		bitmap: newBitmap(bits),
 	}
 }
 
@@ -110,24 +127,88 @@ func (a *IPAllocator) ReleaseIP(network *net.IPNet, ip net.IP) error {
 	defer a.mutex.Unlock()
 
 	if allocated, exists := a.allocatedIPs[network.String()]; exists {
-		delete(allocated.p, ip.String())
+		if ord, ok := allocated.ordinal(ip); ok {
+			allocated.bitmap.unset(ord)
+		}
 	}
 	return nil
 }
 
-func (allocated *allocatedMap) checkIP(ip net.IP) (net.IP, error) {
-	if _, ok := allocated.p[ip.String()]; ok {
-		return nil, ErrIPAlreadyAllocated
+// allocatedRecord is the serialized form of an allocatedMap
+type allocatedRecord struct {
+	Begin  net.IP
+	Bits   uint64
+	Next   uint64
+	Bitmap []byte
+}
+
+// MarshalJSON encodes the allocations of the allocator, so they can be
+// persisted and restored with UnmarshalJSON.
+func (a *IPAllocator) MarshalJSON() ([]byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	records := make(map[string]*allocatedRecord, len(a.allocatedIPs))
+	for key, allocated := range a.allocatedIPs {
+		data, err := allocated.bitmap.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		records[key] = &allocatedRecord{
+			Begin:  allocated.begin,
+			Bits:   allocated.bitmap.bits,
+			Next:   allocated.next,
+			Bitmap: data,
+		}
 	}
 
-	pos := ipToBigInt(ip)
+	return json.Marshal(records)
+}
+
+// UnmarshalJSON replaces the allocations of the allocator with the ones
+// encoded by MarshalJSON.
+func (a *IPAllocator) UnmarshalJSON(data []byte) error {
+	var records map[string]*allocatedRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	allocatedIPs := make(networkSet, len(records))
+	for key, r := range records {
+		if r == nil || r.Begin == nil || (r.Bits != 0 && r.Next >= r.Bits) {
+			return fmt.Errorf("invalid allocations of network %s", key)
+		}
+		b := &bitmap{bits: r.Bits}
+		if err := b.UnmarshalBinary(r.Bitmap); err != nil {
+			return fmt.Errorf("invalid allocations of network %s: %v", key, err)
+		}
+		allocatedIPs[key] = &allocatedMap{
+			begin:  normalizeIP(r.Begin),
+			bitmap: b,
+			next:   r.Next,
+		}
+	}
+
+	a.mutex.Lock()
+	a.allocatedIPs = allocatedIPs
+	a.mutex.Unlock()
+
+	return nil
+}
+
+func (allocated *allocatedMap) checkIP(ip net.IP) (net.IP, error) {
 	// Verify that the IP address is within our network range.
-	if pos.Cmp(allocated.begin) == -1 || pos.Cmp(allocated.end) == 1 {
+	ord, ok := allocated.ordinal(ip)
+	if !ok {
 		return nil, ErrIPOutOfRange
 	}
 
+	if allocated.bitmap.isSet(ord) {
+		return nil, ErrIPAlreadyAllocated
+	}
+
 	// Register the IP.
-	allocated.p[ip.String()] = struct{}{}
+	allocated.bitmap.set(ord)
 
 	return ip, nil
 }
@@ -135,21 +216,83 @@ func (allocated *allocatedMap) checkIP(ip net.IP) (net.IP, error) {
 // return an available ip if one is currently available.  If not,
 // return the next available ip for the network
 func (allocated *allocatedMap) getNextIP() (net.IP, error) {
-	pos := big.NewInt(0).Set(allocated.last)
-	allRange := big.NewInt(0).Sub(allocated.end, allocated.begin)
-	for i := big.NewInt(0); i.Cmp(allRange) <= 0; i.Add(i, big.NewInt(1)) {
-		pos.Add(pos, big.NewInt(1))
-		if pos.Cmp(allocated.end) == 1 {
-			pos.Set(allocated.begin)
+	ord, ok := allocated.bitmap.nextUnset(allocated.next)
+	if !ok {
+		// Wrap around to the beginning of the range
+		if ord, ok = allocated.bitmap.nextUnset(0); !ok {
+			return nil, ErrNoAvailableIPs
+		}
+	}
+
+	allocated.bitmap.set(ord)
+	if allocated.next = ord + 1; allocated.next == allocated.bitmap.bits {
+		allocated.next = 0
+	}
+
+	return ipAdd(allocated.begin, ord), nil
+}
+
+// ordinal returns the ordinal of the ip in the range, false if the ip is out
+// of the range
+func (allocated *allocatedMap) ordinal(ip net.IP) (uint64, bool) {
+	begin := allocated.begin
+	if len(begin) == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return 0, false
+	}
+
+	diff := make([]byte, len(ip))
+	borrow := 0
+	for i := len(ip) - 1; i >= 0; i-- {
+		d := int(ip[i]) - int(begin[i]) - borrow
+		borrow = 0
+		if d < 0 {
+			d += 256
+			borrow = 1
 		}
-		if _, ok := allocated.p[bigIntToIP(pos).String()]; ok {
-			continue
+		diff[i] = byte(d)
+	}
+	if borrow != 0 {
+		return 0, false
+	}
+
+	// The ordinal must fit the 64 low bits
+	for len(diff) > 8 {
+		if diff[0] != 0 {
+			return 0, false
 		}
-		allocated.p[bigIntToIP(pos).String()] = struct{}{}
-		allocated.last.Set(pos)
-		return bigIntToIP(pos), nil
+		diff = diff[1:]
+	}
+	buf := make([]byte, 8)
+	copy(buf[8-len(diff):], diff)
+
+	ord := binary.BigEndian.Uint64(buf)
+	return ord, ord < allocated.bitmap.bits
+}
+
+// normalizeIP returns the 4 bytes form of an IPv4 address, the 16 bytes form
+// of an IPv6 address
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// ipAdd returns the IP n addresses after ip, in the same form
+func ipAdd(ip net.IP, n uint64) net.IP {
+	res := make(net.IP, len(ip))
+	copy(res, ip)
+	for i := len(res) - 1; i >= 0 && n != 0; i-- {
+		sum := uint64(res[i]) + n&0xff
+		res[i] = byte(sum)
+		n = n>>8 + sum>>8
 	}
-	return nil, ErrNoAvailableIPs
+	return res
 }
 
 // Converts a 4 bytes IP into a 128 bit integer
@@ -1,6 +1,7 @@
 package ipallocator
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"net"
@@ -664,6 +665,128 @@ func TestAllocateFromRange(t *testing.T) {
 	}
 }
 
+func TestAllocateLargeSubnet(t *testing.T) {
+	a := New()
+	network := &net.IPNet{
+		IP:   []byte{10, 0, 0, 0},
+		Mask: []byte{255, 0, 0, 0},
+	}
+
+	for i := 1; i <= 1000; i++ {
+		ip, err := a.RequestIP(network, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIPEquals(t, net.IPv4(10, 0, byte(i>>8), byte(i)), ip)
+	}
+
+	last := net.IPv4(10, 255, 255, 254)
+	if _, err := a.RequestIP(network, last); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RequestIP(network, last); err != ErrIPAlreadyAllocated {
+		t.Fatalf("Expected ErrIPAlreadyAllocated error, got %v", err)
+	}
+	if _, err := a.RequestIP(network, net.IPv4(10, 255, 255, 255)); err != ErrIPOutOfRange {
+		t.Fatalf("Expected ErrIPOutOfRange error, got %v", err)
+	}
+
+	if sequences(a.allocatedIPs[network.String()].bitmap) > 4 {
+		t.Fatalf("Expected the allocations to take a few sequences, got %d", sequences(a.allocatedIPs[network.String()].bitmap))
+	}
+}
+
+func TestAllocateLargeIPv6Subnet(t *testing.T) {
+	a := New()
+	_, network, err := net.ParseCIDR("2001:db8::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"2001:db8::1", "2001:db8::2"} {
+		ip, err := a.RequestIP(network, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIPEquals(t, net.ParseIP(expected), ip)
+	}
+
+	// Only the first 2^64-1 addresses of the subnet are tracked
+	for ip, expected := range map[string]error{
+		"2001:db8::1:0:0:0":                nil,
+		"2001:db8::ffff:ffff:ffff:ffff":    nil,
+		"2001:db8:0:1::":                   ErrIPOutOfRange,
+		"2001:db8:0:ffff:ffff:ffff:ffff:1": ErrIPOutOfRange,
+		"2001:db9::1":                      ErrIPOutOfRange,
+		"192.168.0.1":                      ErrIPOutOfRange,
+	} {
+		if _, err := a.RequestIP(network, net.ParseIP(ip)); err != expected {
+			t.Fatalf("Expected %v requesting %s, got %v", expected, ip, err)
+		}
+	}
+
+	if err := a.ReleaseIP(network, net.ParseIP("2001:db8::ffff:ffff:ffff:ffff")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RequestIP(network, net.ParseIP("2001:db8::ffff:ffff:ffff:ffff")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocatorSerialization(t *testing.T) {
+	a := New()
+	network := &net.IPNet{
+		IP:   []byte{192, 168, 0, 1},
+		Mask: []byte{255, 255, 255, 0},
+	}
+	network6 := &net.IPNet{
+		IP:   []byte{0x2a, 0x00, 0x14, 0x50, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		Mask: []byte{255, 255, 255, 255, 255, 255, 255, 255, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.RequestIP(network, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.RequestIP(network6, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.ReleaseIP(network, net.IPv4(192, 168, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	if err := json.Unmarshal(data, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The allocations and the position of the last allocated ip are restored
+	if _, err := r.RequestIP(network, net.IPv4(192, 168, 0, 3)); err != ErrIPAlreadyAllocated {
+		t.Fatalf("Expected ErrIPAlreadyAllocated error, got %v", err)
+	}
+	ip, err := r.RequestIP(network, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIPEquals(t, net.IPv4(192, 168, 0, 4), ip)
+
+	ip, err = r.RequestIP(network6, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIPEquals(t, net.ParseIP("2a00:1450::4"), ip)
+
+	if err := json.Unmarshal([]byte(`{"192.168.0.0/24":{"Begin":"192.168.0.1","Bits":254,"Bitmap":"AAAA"}}`), r); err == nil {
+		t.Fatal("Expected failure restoring invalid allocations")
+	}
+}
+
 func assertIPEquals(t *testing.T, ip1, ip2 net.IP) {
 	if !ip1.Equal(ip2) {
 		t.Fatalf("Expected IP %s, got %s", ip1, ip2)
@@ -688,3 +811,89 @@ func BenchmarkRequestIP(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkRequestIPLargeSubnet(b *testing.B) {
+	network := &net.IPNet{
+		IP:   []byte{10, 0, 0, 0},
+		Mask: []byte{255, 0, 0, 0},
+	}
+	a := New()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := a.RequestIP(network, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestIPv6(b *testing.B) {
+	_, network, err := net.ParseCIDR("2001:db8::/64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	a := New()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := a.RequestIP(network, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestReleaseIP(b *testing.B) {
+	network := &net.IPNet{
+		IP:   []byte{10, 0, 0, 0},
+		Mask: []byte{255, 255, 0, 0},
+	}
+	a := New()
+	for j := 0; j < 1000; j++ {
+		if _, err := a.RequestIP(network, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ip, err := a.RequestIP(network, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := a.ReleaseIP(network, ip); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestReleaseIPFragmented(b *testing.B) {
+	network := &net.IPNet{
+		IP:   []byte{10, 0, 0, 0},
+		Mask: []byte{255, 255, 0, 0},
+	}
+	a := New()
+	var ips []net.IP
+	for j := 0; j < 1<<14; j++ {
+		ip, err := a.RequestIP(network, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		// Every other block of addresses is released
+		if j/blockLen%2 == 0 {
+			ips = append(ips, ip)
+		} else if err := a.ReleaseIP(network, ip); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ip := ips[i*7919%len(ips)]
+		if err := a.ReleaseIP(network, ip); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := a.RequestIP(network, ip); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package ipallocator
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	blockLen   = 32
+	blockBytes = blockLen / 8
+	blockFull  = uint32(0xffffffff)
+	// seqBytes is the length of a serialized sequence: block and count
+	seqBytes = blockBytes + 8
+	// fragmentedSeqs is the number of sequences from which the lookups walk
+	// the list from the cursor rather than from its head
+	fragmentedSeqs = 16
+)
+
+var errInvalidBitmap = errors.New("invalid serialized bitmap")
+
+// sequence is a run of count identical blocks of blockLen bits. The bits of
+// a block are ordered from the most significant one.
+type sequence struct {
+	block      uint32
+	count      uint64
+	prev, next *sequence
+}
+
+// bitmap tracks which of the ordinals in [0, bits) are set. It is stored as
+// a list of sequences, so a bitmap made of large free or used runs, as the
+// ones of sequential allocations, takes a few sequences whatever its size.
+// The bits of the last block past the end of the bitmap are set so they are
+// never handed out. A bitmap is not safe for concurrent use.
+type bitmap struct {
+	bits uint64
+	head *sequence
+	// seqs is the number of sequences of the list
+	seqs int
+	// cur is the sequence last looked up, starting at block index curStart.
+	// The lookups of a fragmented bitmap walk the list from it, so the ones
+	// around the same blocks don't walk every sequence before them.
+	cur      *sequence
+	curStart uint64
+}
+
+func newBitmap(bits uint64) *bitmap {
+	b := &bitmap{bits: bits, head: &sequence{count: blocks(bits)}, seqs: 1}
+	if pad := bits % blockLen; pad != 0 {
+		b.setBlock(b.head.count-1, blockFull>>pad)
+	}
+	return b
+}
+
+// blocks returns the number of blocks holding the bits
+func blocks(bits uint64) uint64 {
+	n := bits / blockLen
+	if bits%blockLen != 0 {
+		n++
+	}
+	return n
+}
+
+// isSet tells whether the ordinal is set
+func (b *bitmap) isSet(ord uint64) bool {
+	seq, _ := b.find(ord / blockLen)
+	return seq.block&bitMask(ord) != 0
+}
+
+// set sets the ordinal
+func (b *bitmap) set(ord uint64) {
+	seq, _ := b.find(ord / blockLen)
+	b.setBlock(ord/blockLen, seq.block|bitMask(ord))
+}
+
+// unset clears the ordinal
+func (b *bitmap) unset(ord uint64) {
+	seq, _ := b.find(ord / blockLen)
+	b.setBlock(ord/blockLen, seq.block&^bitMask(ord))
+}
+
+// nextUnset returns the first ordinal not set from the passed one, false if
+// all of them are set
+func (b *bitmap) nextUnset(from uint64) (uint64, bool) {
+	if from >= b.bits {
+		return 0, false
+	}
+
+	first := from / blockLen
+	seq, start := b.find(first)
+	if seq.block != blockFull {
+		// Only the free bits from the ordinal count in its block
+		if pos, ok := freeBit(seq.block, uint(from%blockLen)); ok {
+			return first*blockLen + uint64(pos), true
+		}
+		if bi := first + 1; bi < start+seq.count {
+			pos, _ := freeBit(seq.block, 0)
+			return bi*blockLen + uint64(pos), true
+		}
+	}
+
+	for start, seq = start+seq.count, seq.next; seq != nil; start, seq = start+seq.count, seq.next {
+		if seq.block != blockFull {
+			pos, _ := freeBit(seq.block, 0)
+			return start*blockLen + uint64(pos), true
+		}
+	}
+
+	return 0, false
+}
+
+// find returns the sequence holding the block at index bi and the index of
+// its first block, and makes it the cursor of the bitmap. The list is walked
+// from the cursor once it is fragmented, and from its head otherwise.
+func (b *bitmap) find(bi uint64) (*sequence, uint64) {
+	seq, start := b.head, uint64(0)
+	if b.cur != nil && b.seqs >= fragmentedSeqs {
+		seq, start = b.cur, b.curStart
+	}
+	for bi < start {
+		seq = seq.prev
+		start -= seq.count
+	}
+	for bi >= start+seq.count {
+		start += seq.count
+		seq = seq.next
+	}
+
+	b.cur, b.curStart = seq, start
+	return seq, start
+}
+
+// setBlock replaces the block at index bi with value, splitting its sequence
+// and merging the result with the neighbouring sequences of the same block.
+func (b *bitmap) setBlock(bi uint64, value uint32) {
+	seq, start := b.find(bi)
+	if seq.block == value {
+		return
+	}
+
+	prev, next := seq.prev, seq.next
+	if after := start + seq.count - bi - 1; after > 0 {
+		rest := &sequence{block: seq.block, count: after}
+		b.link(rest, next)
+		next = rest
+		b.seqs++
+	}
+
+	// The sequence holds the block alone, unless blocks precede it
+	node := seq
+	if before := bi - start; before > 0 {
+		seq.count = before
+		prev = seq
+		node = &sequence{}
+		b.seqs++
+	}
+	node.block, node.count, start = value, 1, bi
+	if node != seq {
+		b.link(prev, node)
+	}
+	if node.next != next {
+		b.link(node, next)
+	}
+
+	if prev != nil && prev.block == node.block {
+		prev.count += node.count
+		b.link(prev, node.next)
+		node, start = prev, bi+1-prev.count
+		b.seqs--
+	}
+	if next := node.next; next != nil && next.block == node.block {
+		node.count += next.count
+		b.link(node, next.next)
+		b.seqs--
+	}
+
+	// The sequence the cursor was on may have been dropped
+	b.cur, b.curStart = node, start
+}
+
+// link makes next follow prev in the list, a nil prev making next the head
+func (b *bitmap) link(prev, next *sequence) {
+	if prev == nil {
+		b.head = next
+	} else {
+		prev.next = next
+	}
+	if next != nil {
+		next.prev = prev
+	}
+}
+
+// MarshalBinary encodes the sequences of the bitmap
+func (b *bitmap) MarshalBinary() ([]byte, error) {
+	var data []byte
+	for seq := b.head; seq != nil; seq = seq.next {
+		buf := make([]byte, seqBytes)
+		binary.BigEndian.PutUint32(buf, seq.block)
+		binary.BigEndian.PutUint64(buf[blockBytes:], seq.count)
+		data = append(data, buf...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the sequences of a bitmap of b.bits ordinals
+func (b *bitmap) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || len(data)%seqBytes != 0 {
+		return errInvalidBitmap
+	}
+
+	var (
+		head, tail *sequence
+		total      uint64
+		seqs       int
+	)
+	for ; len(data) > 0; data = data[seqBytes:] {
+		seq := &sequence{
+			block: binary.BigEndian.Uint32(data),
+			count: binary.BigEndian.Uint64(data[blockBytes:]),
+		}
+		if (seq.count == 0 && b.bits != 0) || total+seq.count < total {
+			return errInvalidBitmap
+		}
+		total += seq.count
+
+		if head == nil {
+			head = seq
+		} else {
+			tail.next, seq.prev = seq, tail
+		}
+		tail = seq
+		seqs++
+	}
+	if total != blocks(b.bits) {
+		return errInvalidBitmap
+	}
+
+	b.head, b.seqs, b.cur, b.curStart = head, seqs, nil, 0
+	return nil
+}
+
+// bitMask returns the mask of the ordinal in its block
+func bitMask(ord uint64) uint32 {
+	return uint32(1) << (blockLen - 1 - ord%blockLen)
+}
+
+// freeBit returns the position of the first bit not set in the block from
+// the passed one
+func freeBit(block uint32, from uint) (uint, bool) {
+	for pos := from; pos < blockLen; pos++ {
+		if block&(uint32(1)<<(blockLen-1-pos)) == 0 {
+			return pos, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package ipallocator
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// sequences returns the number of sequences of the bitmap
+func sequences(b *bitmap) int {
+	n := 0
+	for seq := b.head; seq != nil; seq = seq.next {
+		n++
+	}
+	return n
+}
+
+func TestBitmapSetUnset(t *testing.T) {
+	b := newBitmap(100)
+	if sequences(b) != 2 {
+		t.Fatalf("Expected the padding in a sequence of its own, got %d sequences", sequences(b))
+	}
+
+	for _, ord := range []uint64{0, 31, 32, 99} {
+		if b.isSet(ord) {
+			t.Fatalf("Expected ordinal %d to be unset", ord)
+		}
+		b.set(ord)
+		if !b.isSet(ord) {
+			t.Fatalf("Expected ordinal %d to be set", ord)
+		}
+	}
+
+	for _, ord := range []uint64{0, 31, 32, 99} {
+		b.unset(ord)
+		if b.isSet(ord) {
+			t.Fatalf("Expected ordinal %d to be unset", ord)
+		}
+	}
+
+	// The sequences are merged back
+	if sequences(b) != 2 {
+		t.Fatalf("Expected 2 sequences, got %d", sequences(b))
+	}
+
+	// The padding is never handed out
+	for ord := uint64(0); ord < 100; ord++ {
+		b.set(ord)
+	}
+	if ord, ok := b.nextUnset(0); ok {
+		t.Fatalf("Expected a full bitmap, got free ordinal %d", ord)
+	}
+	if sequences(b) != 1 {
+		t.Fatalf("Expected a single sequence for a full bitmap, got %d", sequences(b))
+	}
+}
+
+func TestBitmapNextUnset(t *testing.T) {
+	b := newBitmap(1 << 20)
+	for ord := uint64(0); ord < 1000; ord++ {
+		b.set(ord)
+	}
+	b.unset(10)
+	b.unset(500)
+
+	for from, expected := range map[uint64]uint64{
+		0:       10,
+		10:      10,
+		11:      500,
+		501:     1000,
+		1 << 19: 1 << 19,
+	} {
+		if ord, ok := b.nextUnset(from); !ok || ord != expected {
+			t.Fatalf("Expected %d from %d, got %d (%t)", expected, from, ord, ok)
+		}
+	}
+
+	if _, ok := b.nextUnset(1 << 20); ok {
+		t.Fatal("Expected no ordinal past the end of the bitmap")
+	}
+}
+
+func TestBitmapRandom(t *testing.T) {
+	const bits = 10000
+	b := newBitmap(bits)
+	set := make(map[uint64]bool)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		ord := uint64(r.Intn(bits))
+		if r.Intn(2) == 0 {
+			b.set(ord)
+			set[ord] = true
+		} else {
+			b.unset(ord)
+			delete(set, ord)
+		}
+	}
+
+	for ord := uint64(0); ord < bits; ord++ {
+		if b.isSet(ord) != set[ord] {
+			t.Fatalf("Unexpected state of ordinal %d: %t", ord, b.isSet(ord))
+		}
+	}
+
+	for from := uint64(0); from < bits; from += 7 {
+		expected := from
+		for expected < bits && set[expected] {
+			expected++
+		}
+		ord, ok := b.nextUnset(from)
+		if ok != (expected < bits) || (ok && ord != expected) {
+			t.Fatalf("Expected %d from %d, got %d (%t)", expected, from, ord, ok)
+		}
+	}
+
+	// The bitmap is fragmented enough for its lookups to use the cursor
+	if b.seqs != sequences(b) || b.seqs < fragmentedSeqs {
+		t.Fatalf("Unexpected count of %d sequences out of %d", b.seqs, sequences(b))
+	}
+
+	// No two neighbour sequences are made of the same block
+	for seq := b.head; seq.next != nil; seq = seq.next {
+		if seq.block == seq.next.block {
+			t.Fatalf("Unmerged sequences of block %x", seq.block)
+		}
+		if seq.next.prev != seq {
+			t.Fatalf("Broken link after the sequence of block %x", seq.block)
+		}
+	}
+}
+
+func TestBitmapSerialization(t *testing.T) {
+	b := newBitmap(maxBits)
+	for _, ord := range []uint64{0, 1, 2, 1 << 40, maxBits - 1} {
+		b.set(ord)
+	}
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &bitmap{bits: maxBits}
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if r.seqs != sequences(b) {
+		t.Fatalf("Unexpected count of %d sequences out of %d", r.seqs, sequences(b))
+	}
+	for _, ord := range []uint64{0, 1, 2, 1 << 40, maxBits - 1} {
+		if !r.isSet(ord) {
+			t.Fatalf("Expected ordinal %d to be set in the restored bitmap", ord)
+		}
+	}
+	if ord, ok := r.nextUnset(0); !ok || ord != 3 {
+		t.Fatalf("Expected 3 to be the first free ordinal, got %d (%t)", ord, ok)
+	}
+
+	for _, invalid := range [][]byte{nil, data[:len(data)-1], data[:seqBytes]} {
+		if err := (&bitmap{bits: maxBits}).UnmarshalBinary(invalid); err != errInvalidBitmap {
+			t.Fatalf("Expected errInvalidBitmap for %v, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package ipamapi specifies the contract the IPAM (IP Address Management) drivers need to satisfy,
+// decoupling the managing of address pools and addresses from the network drivers
+package ipamapi
+
+import (
+	"errors"
+	"net"
+)
+
+const (
+	// DefaultIPAM is the name of the built-in default IPAM driver
+	DefaultIPAM = "default"
+	// PluginEndpointType represents the Endpoint Type used by Plugin system
+	PluginEndpointType = "IpamDriver"
+	// LocalDefaultAddressSpace is the address space used when none is specified
+	LocalDefaultAddressSpace = "local"
+	// GlobalDefaultAddressSpace is the address space of the networks spanning multiple hosts
+	GlobalDefaultAddressSpace = "global"
+)
+
+// Callback provides a Callback interface for registering an IPAM instance into LibNetwork
+type Callback interface {
+	// RegisterIpamDriver provides a way for Remote drivers to dynamically register with libnetwork
+	RegisterIpamDriver(name string, driver Ipam) error
+}
+
+// Well-known errors returned by IPAM
+var (
+	ErrInvalidAddressSpace = errors.New("invalid address space")
+	ErrInvalidPool         = errors.New("invalid address pool")
+	ErrInvalidSubPool      = errors.New("invalid address subpool")
+	ErrInvalidRequest      = errors.New("invalid request")
+	ErrPoolNotFound        = errors.New("address pool not found")
+	ErrOverlapPool         = errors.New("address pool overlaps with existing pool on this address space")
+	ErrNoAvailablePool     = errors.New("no available pool")
+	ErrNoAvailableIPs      = errors.New("no available addresses on this pool")
+	ErrIPAlreadyAllocated  = errors.New("address already in use")
+	ErrIPOutOfRange        = errors.New("requested address is out of range")
+)
+
+// Ipam represents the interface the IPAM service plugins must implement
+// in order to allow injection/modification of IPAM database.
+type Ipam interface {
+	// RequestPool returns an address pool along with its unique id. Address space is a mandatory field
+	// which denotes a set of non-overlapping pools. pool describes the pool of addresses in CIDR notation.
+	// subpool indicates a smaller range of addresses from the pool, for now it is specified in CIDR notation.
+	// Both pool and subpool are non mandatory fields. When they are not specified, Ipam driver may choose to
+	// return a self chosen pool for this request. In such case the v6 flag needs to be set appropriately so
+	// that the driver would return the expected ip version pool.
+	RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error)
+	// ReleasePool releases the address pool identified by the passed id
+	ReleasePool(poolID string) error
+	// RequestAddress requests an address from the address pool. If ip is nil, the first available
+	// address of the pool (or of its subpool) is returned, otherwise the passed address is reserved
+	RequestAddress(poolID string, ip net.IP, options map[string]string) (*net.IPNet, map[string]string, error)
+	// ReleaseAddress releases the address from the specified address pool
+	ReleaseAddress(poolID string, ip net.IP) error
+}
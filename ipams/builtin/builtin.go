@@ -0,0 +1,261 @@
+// Package builtin provides the default IPAM driver, which manages the address
+// pools and addresses in memory on top of the ipallocator package.
+package builtin
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/ipallocator"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+)
+
+// predefinedPools is the list of the IPv4 pools handed out when a pool is
+// requested without specifying one.
+var predefinedPools []*net.IPNet
+
+func init() {
+	for _, p := range []string{
+		"172.18.0.0/16",
+		"172.19.0.0/16",
+		"172.20.0.0/16",
+		"172.21.0.0/16",
+		"172.22.0.0/16",
+		"172.23.0.0/16",
+		"10.2.0.0/16",
+		"10.3.0.0/16",
+		"192.168.45.0/24",
+		"192.168.46.0/24",
+	} {
+		_, nw, err := net.ParseCIDR(p)
+		if err != nil {
+			log.Errorf("Failed to parse address pool %s", p)
+			continue
+		}
+		predefinedPools = append(predefinedPools, nw)
+	}
+}
+
+// pool is an address pool handed out by the allocator. Dynamic allocations
+// are served from the subnet, which defaults to the whole pool, while the
+// addresses of the pool outside the subnet can only be explicitly reserved.
+type pool struct {
+	addressSpace string
+	network      *net.IPNet
+	subnet       *net.IPNet
+	allocator    *ipallocator.IPAllocator
+	reserved     map[string]struct{}
+}
+
+// Allocator is the default IPAM driver
+type Allocator struct {
+	pools map[string]*pool
+	sync.Mutex
+}
+
+// Init registers the default IPAM driver with libnetwork
+func Init(cb ipamapi.Callback) error {
+	return cb.RegisterIpamDriver(ipamapi.DefaultIPAM, NewAllocator())
+}
+
+// NewAllocator returns a new instance of the default IPAM driver
+func NewAllocator() *Allocator {
+	return &Allocator{pools: make(map[string]*pool)}
+}
+
+// RequestPool returns a new address pool in the address space. If no pool is
+// specified, the first predefined IPv4 pool which does not overlap with the
+// pools of the address space nor with the host routes is returned.
+func (a *Allocator) RequestPool(addressSpace, poolStr, subPoolStr string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
+	if addressSpace == "" {
+		addressSpace = ipamapi.LocalDefaultAddressSpace
+	}
+	if strings.Contains(addressSpace, "/") {
+		return "", nil, nil, ipamapi.ErrInvalidAddressSpace
+	}
+
+	var (
+		nw, sub *net.IPNet
+		err     error
+	)
+
+	if poolStr != "" {
+		if _, nw, err = net.ParseCIDR(poolStr); err != nil {
+			return "", nil, nil, ipamapi.ErrInvalidPool
+		}
+		if (nw.IP.To4() == nil) != v6 {
+			return "", nil, nil, ipamapi.ErrInvalidPool
+		}
+	} else if subPoolStr != "" {
+		return "", nil, nil, ipamapi.ErrInvalidSubPool
+	}
+
+	if subPoolStr != "" {
+		if _, sub, err = net.ParseCIDR(subPoolStr); err != nil {
+			return "", nil, nil, ipamapi.ErrInvalidSubPool
+		}
+		begin, end := netutils.NetworkRange(sub)
+		if !nw.Contains(begin) || !nw.Contains(end) {
+			return "", nil, nil, ipamapi.ErrInvalidSubPool
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if nw == nil {
+		if v6 {
+			return "", nil, nil, ipamapi.ErrNoAvailablePool
+		}
+		if nw = a.electPool(addressSpace); nw == nil {
+			return "", nil, nil, ipamapi.ErrNoAvailablePool
+		}
+	} else if a.overlaps(addressSpace, nw) {
+		return "", nil, nil, ipamapi.ErrOverlapPool
+	}
+
+	if sub == nil {
+		sub = nw
+	}
+
+	p := &pool{
+		addressSpace: addressSpace,
+		network:      nw,
+		subnet:       sub,
+		allocator:    ipallocator.New(),
+		reserved:     make(map[string]struct{}),
+	}
+	if err := p.allocator.RegisterSubnet(nw, sub); err != nil {
+		return "", nil, nil, err
+	}
+
+	id := poolID(addressSpace, nw, sub)
+	a.pools[id] = p
+
+	return id, types.GetIPNetCopy(nw), nil, nil
+}
+
+// ReleasePool releases the address pool identified by the passed id
+func (a *Allocator) ReleasePool(poolID string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.pools[poolID]; !ok {
+		return ipamapi.ErrPoolNotFound
+	}
+	delete(a.pools, poolID)
+
+	return nil
+}
+
+// RequestAddress reserves the passed address or, if nil, the first available
+// one of the pool subnet. The returned address carries the pool mask.
+func (a *Allocator) RequestAddress(poolID string, ip net.IP, options map[string]string) (*net.IPNet, map[string]string, error) {
+	p, err := a.getPool(poolID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addr net.IP
+	switch {
+	case ip == nil || p.subnet.Contains(ip):
+		addr, err = p.allocator.RequestIP(p.network, ip)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+	case p.network.Contains(ip):
+		a.Lock()
+		if _, ok := p.reserved[ip.String()]; ok {
+			a.Unlock()
+			return nil, nil, ipamapi.ErrIPAlreadyAllocated
+		}
+		p.reserved[ip.String()] = struct{}{}
+		a.Unlock()
+		addr = ip
+	default:
+		return nil, nil, ipamapi.ErrIPOutOfRange
+	}
+
+	return &net.IPNet{IP: addr, Mask: p.network.Mask}, nil, nil
+}
+
+// ReleaseAddress releases the address from the pool
+func (a *Allocator) ReleaseAddress(poolID string, ip net.IP) error {
+	p, err := a.getPool(poolID)
+	if err != nil {
+		return err
+	}
+
+	if p.subnet.Contains(ip) {
+		return p.allocator.ReleaseIP(p.network, ip)
+	}
+
+	a.Lock()
+	delete(p.reserved, ip.String())
+	a.Unlock()
+
+	return nil
+}
+
+func (a *Allocator) getPool(poolID string) (*pool, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	p, ok := a.pools[poolID]
+	if !ok {
+		return nil, ipamapi.ErrPoolNotFound
+	}
+
+	return p, nil
+}
+
+// overlaps returns whether the network overlaps with a pool of the address
+// space. Must be called with the allocator lock held.
+func (a *Allocator) overlaps(addressSpace string, nw *net.IPNet) bool {
+	for _, p := range a.pools {
+		if p.addressSpace == addressSpace && netutils.NetworkOverlaps(p.network, nw) {
+			return true
+		}
+	}
+	return false
+}
+
+// electPool returns the first predefined pool available in the address space.
+// Must be called with the allocator lock held.
+func (a *Allocator) electPool(addressSpace string) *net.IPNet {
+	for _, nw := range predefinedPools {
+		if a.overlaps(addressSpace, nw) {
+			continue
+		}
+		if err := netutils.CheckRouteOverlaps(nw); err != nil {
+			continue
+		}
+		return types.GetIPNetCopy(nw)
+	}
+	return nil
+}
+
+func poolID(addressSpace string, nw, sub *net.IPNet) string {
+	id := fmt.Sprintf("%s/%s", addressSpace, nw)
+	if sub.String() != nw.String() {
+		id = fmt.Sprintf("%s/%s", id, sub)
+	}
+	return id
+}
+
+func mapError(err error) error {
+	switch err {
+	case ipallocator.ErrNoAvailableIPs:
+		return ipamapi.ErrNoAvailableIPs
+	case ipallocator.ErrIPAlreadyAllocated:
+		return ipamapi.ErrIPAlreadyAllocated
+	case ipallocator.ErrIPOutOfRange:
+		return ipamapi.ErrIPOutOfRange
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package builtin
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+func TestRequestPool(t *testing.T) {
+	a := NewAllocator()
+
+	id, nw, _, err := a.RequestPool("local", "192.168.0.0/16", "192.168.2.0/24", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nw.String() != "192.168.0.0/16" {
+		t.Fatalf("Unexpected pool: %s", nw)
+	}
+
+	if _, _, _, err := a.RequestPool("local", "192.168.5.0/24", "", nil, false); err != ipamapi.ErrOverlapPool {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrOverlapPool, err)
+	}
+
+	// Pools in different address spaces may overlap
+	if _, _, _, err := a.RequestPool("other", "192.168.5.0/24", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := a.RequestPool("local", "10.10.0.0/16", "10.11.0.0/24", nil, false); err != ipamapi.ErrInvalidSubPool {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrInvalidSubPool, err)
+	}
+
+	if _, _, _, err := a.RequestPool("local", "10.10.0.0/16", "", nil, true); err != ipamapi.ErrInvalidPool {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrInvalidPool, err)
+	}
+
+	if err := a.ReleasePool(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReleasePool(id); err != ipamapi.ErrPoolNotFound {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrPoolNotFound, err)
+	}
+
+	if _, _, _, err := a.RequestPool("local", "192.168.5.0/24", "", nil, false); err != nil {
+		t.Fatalf("Expected the released pool to be available, got %v", err)
+	}
+}
+
+func TestRequestPredefinedPool(t *testing.T) {
+	a := NewAllocator()
+
+	_, nw1, _, err := a.RequestPool("local", "", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, nw2, _, err := a.RequestPool("local", "", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nw1.String() == nw2.String() {
+		t.Fatalf("Same predefined pool %s returned twice", nw1)
+	}
+
+	if _, _, _, err := a.RequestPool("local", "", "", nil, true); err != ipamapi.ErrNoAvailablePool {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrNoAvailablePool, err)
+	}
+}
+
+func TestRequestAddress(t *testing.T) {
+	a := NewAllocator()
+
+	id, _, _, err := a.RequestPool("local", "192.168.0.0/16", "192.168.2.0/30", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Addresses outside the subpool can be explicitly reserved
+	ip, _, err := a.RequestAddress(id, net.ParseIP("192.168.0.1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "192.168.0.1/16" {
+		t.Fatalf("Unexpected address: %s", ip)
+	}
+	if _, _, err := a.RequestAddress(id, net.ParseIP("192.168.0.1"), nil); err != ipamapi.ErrIPAlreadyAllocated {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPAlreadyAllocated, err)
+	}
+	if _, _, err := a.RequestAddress(id, net.ParseIP("10.0.0.1"), nil); err != ipamapi.ErrIPOutOfRange {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPOutOfRange, err)
+	}
+
+	// Dynamic allocations are served from the subpool
+	for _, expected := range []string{"192.168.2.1/16", "192.168.2.2/16"} {
+		ip, _, err := a.RequestAddress(id, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip.String() != expected {
+			t.Fatalf("Expected %s, got %s", expected, ip)
+		}
+	}
+	if _, _, err := a.RequestAddress(id, nil, nil); err != ipamapi.ErrNoAvailableIPs {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrNoAvailableIPs, err)
+	}
+
+	if err := a.ReleaseAddress(id, net.ParseIP("192.168.2.1")); err != nil {
+		t.Fatal(err)
+	}
+	if ip, _, err := a.RequestAddress(id, nil, nil); err != nil || ip.String() != "192.168.2.1/16" {
+		t.Fatalf("Expected the released address back, got %v (%v)", ip, err)
+	}
+
+	if err := a.ReleaseAddress(id, net.ParseIP("192.168.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.RequestAddress(id, net.ParseIP("192.168.0.1"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := a.RequestAddress("local/10.0.0.0/8", nil, nil); err != ipamapi.ErrPoolNotFound {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrPoolNotFound, err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Package api represents all requests and responses suitable for conversation
+with a remote IPAM driver.
+*/
+package api
+
+// Response is the basic response structure used in all responses.
+type Response struct {
+	Err string
+}
+
+// GetError returns the error from the response, if any.
+func (r *Response) GetError() string {
+	return r.Err
+}
+
+// RequestPoolRequest represents the expected data in a "request address pool" request message
+type RequestPoolRequest struct {
+	AddressSpace string
+	Pool         string
+	SubPool      string
+	Options      map[string]string
+	V6           bool
+}
+
+// RequestPoolResponse represents the response message to a "request address pool" request
+type RequestPoolResponse struct {
+	Response
+	PoolID string
+	// The pool in CIDR notation
+	Pool string
+	Data map[string]string
+}
+
+// ReleasePoolRequest represents the expected data in a "release address pool" request message
+type ReleasePoolRequest struct {
+	PoolID string
+}
+
+// ReleasePoolResponse represents the response message to a "release address pool" request
+type ReleasePoolResponse struct {
+	Response
+}
+
+// RequestAddressRequest represents the expected data in a "request address" request message
+type RequestAddressRequest struct {
+	PoolID string
+	// The preferred address, empty if any address of the pool will do
+	Address string
+	Options map[string]string
+}
+
+// RequestAddressResponse represents the expected data in the response message to a "request address" request
+type RequestAddressResponse struct {
+	Response
+	// The address in CIDR notation
+	Address string
+	Data    map[string]string
+}
+
+// ReleaseAddressRequest represents the expected data in a "release address" request message
+type ReleaseAddressRequest struct {
+	PoolID  string
+	Address string
+}
+
+// ReleaseAddressResponse represents the response message to a "release address" request
+type ReleaseAddressResponse struct {
+	Response
+}
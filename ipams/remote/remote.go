@@ -0,0 +1,97 @@
+// Package remote provides the IPAM driver proxying the requests to an IPAM
+// plugin over the plugins protocol.
+package remote
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/plugins"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipams/remote/api"
+)
+
+type allocator struct {
+	endpoint *plugins.Client
+	name     string
+}
+
+type maybeError interface {
+	GetError() string
+}
+
+// newAllocator returns the IPAM driver talking to the plugin through the client
+func newAllocator(name string, client *plugins.Client) ipamapi.Ipam {
+	return &allocator{name: name, endpoint: client}
+}
+
+// Init registers a remote ipam when its plugin is activated
+func Init(cb ipamapi.Callback) error {
+	plugins.Handle(ipamapi.PluginEndpointType, func(name string, client *plugins.Client) {
+		if err := cb.RegisterIpamDriver(name, newAllocator(name, client)); err != nil {
+			log.Errorf("error registering remote ipam %s due to %v", name, err)
+		}
+	})
+	return nil
+}
+
+func (a *allocator) call(methodName string, arg interface{}, retVal maybeError) error {
+	method := ipamapi.PluginEndpointType + "." + methodName
+	err := a.endpoint.Call(method, arg, retVal)
+	if err != nil {
+		return err
+	}
+	if e := retVal.GetError(); e != "" {
+		return fmt.Errorf("remote: %s", e)
+	}
+	return nil
+}
+
+// RequestPool requests an address pool in the specified address space
+func (a *allocator) RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
+	req := &api.RequestPoolRequest{AddressSpace: addressSpace, Pool: pool, SubPool: subPool, Options: options, V6: v6}
+	res := &api.RequestPoolResponse{}
+	if err := a.call("RequestPool", req, res); err != nil {
+		return "", nil, nil, err
+	}
+
+	_, nw, err := net.ParseCIDR(res.Pool)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("remote: invalid pool %q returned by %s: %v", res.Pool, a.name, err)
+	}
+
+	return res.PoolID, nw, res.Data, nil
+}
+
+// ReleasePool removes an address pool from the specified address space
+func (a *allocator) ReleasePool(poolID string) error {
+	req := &api.ReleasePoolRequest{PoolID: poolID}
+	return a.call("ReleasePool", req, &api.ReleasePoolResponse{})
+}
+
+// RequestAddress requests an address from the address pool
+func (a *allocator) RequestAddress(poolID string, address net.IP, options map[string]string) (*net.IPNet, map[string]string, error) {
+	req := &api.RequestAddressRequest{PoolID: poolID, Options: options}
+	if address != nil {
+		req.Address = address.String()
+	}
+	res := &api.RequestAddressResponse{}
+	if err := a.call("RequestAddress", req, res); err != nil {
+		return nil, nil, err
+	}
+
+	ip, nw, err := net.ParseCIDR(res.Address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote: invalid address %q returned by %s: %v", res.Address, a.name, err)
+	}
+	nw.IP = ip
+
+	return nw, res.Data, nil
+}
+
+// ReleaseAddress releases the address from the specified address pool
+func (a *allocator) ReleaseAddress(poolID string, address net.IP) error {
+	req := &api.ReleaseAddressRequest{PoolID: poolID, Address: address.String()}
+	return a.call("ReleaseAddress", req, &api.ReleaseAddressResponse{})
+}
@@ -0,0 +1,150 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/pkg/plugins"
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+const pluginsDir = "/usr/share/docker/plugins"
+
+func decodeToMap(r *http.Request) (res map[string]interface{}, err error) {
+	err = json.NewDecoder(r.Body).Decode(&res)
+	return
+}
+
+func handle(t *testing.T, mux *http.ServeMux, method string, h func(map[string]interface{}) interface{}) {
+	mux.HandleFunc(fmt.Sprintf("/%s.%s", ipamapi.PluginEndpointType, method), func(w http.ResponseWriter, r *http.Request) {
+		ask, err := decodeToMap(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer := h(ask)
+		err = json.NewEncoder(w).Encode(&answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func setupPlugin(t *testing.T, name string, mux *http.ServeMux) func() {
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(pluginsDir, name+".sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Could not listen to the plugin socket: %v", err)
+	}
+
+	mux.HandleFunc("/Plugin.Activate", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Implements": ["%s"]}`, ipamapi.PluginEndpointType)
+	})
+
+	go http.Serve(listener, mux)
+
+	return func() {
+		listener.Close()
+		if err := os.RemoveAll(sock); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getTestAllocator(t *testing.T, plugin string) ipamapi.Ipam {
+	p, err := plugins.Get(plugin, ipamapi.PluginEndpointType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newAllocator(plugin, p.Client)
+}
+
+func TestRemotePool(t *testing.T) {
+	var plugin = "test-ipam-driver-pool"
+
+	mux := http.NewServeMux()
+	defer setupPlugin(t, plugin, mux)()
+
+	handle(t, mux, "RequestPool", func(msg map[string]interface{}) interface{} {
+		if msg["AddressSpace"] != "local" || msg["Pool"] != "" || msg["V6"] != false {
+			t.Fatalf("Unexpected request: %v", msg)
+		}
+		return map[string]interface{}{
+			"PoolID": "pool-1",
+			"Pool":   "172.28.0.0/16",
+			"Data":   map[string]string{"com.example.gateway": "172.28.0.254"},
+		}
+	})
+
+	handle(t, mux, "ReleasePool", func(msg map[string]interface{}) interface{} {
+		if msg["PoolID"] != "pool-1" {
+			t.Fatalf("Unexpected pool id: %v", msg["PoolID"])
+		}
+		return map[string]interface{}{}
+	})
+
+	a := getTestAllocator(t, plugin)
+
+	id, nw, data, err := a.RequestPool("local", "", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "pool-1" || nw.String() != "172.28.0.0/16" {
+		t.Fatalf("Unexpected pool %s: %s", id, nw)
+	}
+	if data["com.example.gateway"] != "172.28.0.254" {
+		t.Fatalf("Unexpected pool data: %v", data)
+	}
+
+	if err := a.ReleasePool(id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteAddress(t *testing.T) {
+	var plugin = "test-ipam-driver-address"
+
+	mux := http.NewServeMux()
+	defer setupPlugin(t, plugin, mux)()
+
+	handle(t, mux, "RequestAddress", func(msg map[string]interface{}) interface{} {
+		if msg["Address"] == "172.28.0.1" {
+			return map[string]interface{}{"Err": "address already in use"}
+		}
+		return map[string]interface{}{"Address": "172.28.0.2/16"}
+	})
+
+	handle(t, mux, "ReleaseAddress", func(msg map[string]interface{}) interface{} {
+		if msg["PoolID"] != "pool-1" || msg["Address"] != "172.28.0.2" {
+			t.Fatalf("Unexpected request: %v", msg)
+		}
+		return map[string]interface{}{}
+	})
+
+	a := getTestAllocator(t, plugin)
+
+	ip, _, err := a.RequestAddress("pool-1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "172.28.0.2/16" {
+		t.Fatalf("Unexpected address: %s", ip)
+	}
+
+	if _, _, err := a.RequestAddress("pool-1", net.ParseIP("172.28.0.1"), nil); err == nil {
+		t.Fatal("Expected the plugin error to be returned")
+	}
+
+	if err := a.ReleaseAddress("pool-1", ip.IP); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,367 @@
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	iptablesRestorePath   string
+	ip6tablesRestorePath  string
+	restoreSupportsXlock  = false
+	restoreSupportsXlock6 = false
+	restoreCheckOnce      sync.Once
+	restoreCheckOnce6     sync.Once
+)
+
+// Batch is a set of rules programmed in a single transaction with
+// iptables-restore, instead of one iptables call per rule.
+type Batch struct {
+	rules []batchRule
+}
+
+type batchRule struct {
+	ipv    IPV
+	action Action
+	table  Table
+	chain  string
+	// pos is the position of the rule in the chain, 1 being the top, at
+	// which an inserted rule is programmed and a deleted rule is inserted
+	// back on rollback. A deleted rule of unknown position is appended back.
+	pos int
+	// listed is the position of a deleted rule in the chain listing taken
+	// when it was added to the batch
+	listed int
+	args   []string
+}
+
+// NewBatch returns an empty batch of rules.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// batchTable is a table of an IP version, which rules are committed in a
+// single iptables-restore or ip6tables-restore call
+type batchTable struct {
+	ipv   IPV
+	table Table
+}
+
+// Add records the rule to append to, insert at the top of, or delete from
+// the chain of the table.
+func (b *Batch) Add(action Action, table Table, chain string, args ...string) {
+	b.AddIPV(Iptables, action, table, chain, args...)
+}
+
+// AddIPV records the rule to append to, insert at the top of, or delete
+// from the chain of the table of the IP version. The position of a deleted
+// rule is looked up, for the rule to be inserted back at its place on
+// rollback.
+func (b *Batch) AddIPV(ipv IPV, action Action, table Table, chain string, args ...string) {
+	if ipv != IP6Tables {
+		ipv = Iptables
+	}
+	if string(table) == "" {
+		table = Filter
+	}
+	r := batchRule{ipv: ipv, action: action, table: table, chain: chain, args: args}
+	if action == Delete {
+		r.listed = ipv.position(table, chain, args...)
+		r.pos = b.deletePosition(r)
+	}
+	b.rules = append(b.rules, r)
+}
+
+// deletePosition returns the position the deleted rule is at when the rules
+// recorded before it are programmed, 0 if it is unknown.
+func (b *Batch) deletePosition(r batchRule) int {
+	if r.listed == 0 {
+		return 0
+	}
+
+	pos := r.listed
+	for _, e := range b.rules {
+		if e.ipv != r.ipv || e.table != r.table || e.chain != r.chain {
+			continue
+		}
+		switch e.action {
+		case Insert:
+			if e.pos <= pos {
+				pos++
+			}
+		case Delete:
+			if e.listed != 0 && e.listed < r.listed {
+				pos--
+			}
+		}
+	}
+	return pos
+}
+
+// Len returns the number of rules of the batch.
+func (b *Batch) Len() int {
+	return len(b.rules)
+}
+
+// Commit programs the rules of the batch. The rules of each table are
+// committed atomically and the tables already committed are rolled back
+// when a following one fails, so that either all the rules are programmed
+// or none.
+func (b *Batch) Commit() error {
+	if len(b.rules) == 0 {
+		return nil
+	}
+
+	tables := b.tables()
+	if firewalldRunning {
+		return b.commitRaw()
+	}
+	for _, t := range tables {
+		if initRestoreCheck(t.ipv) != nil {
+			return b.commitRaw()
+		}
+	}
+
+	for i, t := range tables {
+		if err := restore(t.ipv, b.restoreInput(t)); err != nil {
+			inverse := b.inverse()
+			for j := i - 1; j >= 0; j-- {
+				if e := restore(tables[j].ipv, inverse.restoreInput(tables[j])); e != nil {
+					logrus.Warnf("Failed to roll back the %s %s table rules: %v", tables[j].ipv, tables[j].table, e)
+				}
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback undoes the rules of a committed batch. The deleted rules are
+// inserted back at their position in the chain, or appended back when it
+// was not found.
+func (b *Batch) Rollback() error {
+	return b.inverse().Commit()
+}
+
+// commitRaw programs the rules one by one, deleting the programmed ones
+// when a rule fails.
+func (b *Batch) commitRaw() error {
+	for i, r := range b.rules {
+		if err := r.raw(); err != nil {
+			undo := &Batch{rules: b.rules[:i]}
+			for _, u := range undo.inverse().rules {
+				if e := u.raw(); e != nil {
+					logrus.Warnf("Failed to roll back iptables rule %v: %v", u.args, e)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r batchRule) raw() error {
+	args := append(append([]string{"-t", string(r.table)}, r.command()...), r.args...)
+	if output, err := r.ipv.Raw(args...); err != nil {
+		return err
+	} else if len(output) != 0 {
+		return ChainError{Chain: r.chain, Output: output}
+	}
+	return nil
+}
+
+// command returns the action of the rule on its chain, with the position
+// of an inserted rule
+func (r batchRule) command() []string {
+	cmd := []string{string(r.action), r.chain}
+	if r.action == Insert && r.pos > 0 {
+		cmd = append(cmd, strconv.Itoa(r.pos))
+	}
+	return cmd
+}
+
+// inverse returns the batch undoing this one. The rules are undone in the
+// reverse order, so that the deleted rules are inserted back at the
+// position they were deleted from.
+func (b *Batch) inverse() *Batch {
+	inv := &Batch{rules: make([]batchRule, 0, len(b.rules))}
+	for i := len(b.rules) - 1; i >= 0; i-- {
+		r := b.rules[i]
+		r.listed = 0
+		switch {
+		case r.action != Delete:
+			if r.action == Insert && r.pos == 0 {
+				r.pos = 1
+			}
+			r.action = Delete
+		case r.pos > 0:
+			r.action = Insert
+		default:
+			r.action = Append
+		}
+		inv.rules = append(inv.rules, r)
+	}
+	return inv
+}
+
+// tables returns the tables of the batch rules, in order of appearance
+func (b *Batch) tables() []batchTable {
+	var tables []batchTable
+	seen := map[batchTable]bool{}
+	for _, r := range b.rules {
+		t := batchTable{ipv: r.ipv, table: r.table}
+		if !seen[t] {
+			seen[t] = true
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// restoreInput returns the iptables-restore input programming the batch
+// rules of the table.
+func (b *Batch) restoreInput(t batchTable) string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "*%s\n", t.table)
+	for _, r := range b.rules {
+		if r.ipv != t.ipv || r.table != t.table {
+			continue
+		}
+		line := r.command()
+		for _, a := range r.args {
+			line = append(line, restoreQuote(a))
+		}
+		fmt.Fprintln(&buf, strings.Join(line, " "))
+	}
+	fmt.Fprintln(&buf, "COMMIT")
+
+	return buf.String()
+}
+
+// restoreQuote returns the argument as iptables-restore parses it. The rule
+// lines are split on blanks but within double quotes, where a backslash
+// escapes the next character.
+func restoreQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"\\") {
+		return arg
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '"' || arg[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(arg[i])
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+// position returns the position of the rule in the chain of the table, 1
+// being the top, or 0 if it is not found.
+func (ipv IPV) position(table Table, chain string, rule ...string) int {
+	path := iptablesPath
+	if ipv == IP6Tables {
+		path = ip6tablesPath
+	}
+	if path == "" {
+		return 0
+	}
+
+	listing, err := exec.Command(path, "-t", string(table), "-S", chain).Output()
+	if err != nil {
+		return 0
+	}
+
+	return rulePosition(string(listing), chain, rule)
+}
+
+// rulePosition returns the position of the rule in the iptables -S listing
+// of the chain, 0 if it is not listed.
+func rulePosition(listing, chain string, rule []string) int {
+	prefix := "-A " + chain + " "
+	ruleString := strings.Join(rule, " ")
+
+	pos := 0
+	for _, line := range strings.Split(listing, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		pos++
+		if line[len(prefix):] == ruleString {
+			return pos
+		}
+	}
+
+	return 0
+}
+
+// initRestoreCheck looks the restore command of the IP version up, once.
+func initRestoreCheck(ipv IPV) error {
+	if ipv == IP6Tables {
+		restoreCheckOnce6.Do(func() {
+			ip6tablesRestorePath, restoreSupportsXlock6 = lookupRestore("ip6tables-restore")
+		})
+		if ip6tablesRestorePath == "" {
+			return ErrIp6tablesNotFound
+		}
+		return nil
+	}
+
+	restoreCheckOnce.Do(func() {
+		iptablesRestorePath, restoreSupportsXlock = lookupRestore("iptables-restore")
+	})
+	if iptablesRestorePath == "" {
+		return ErrIptablesNotFound
+	}
+	return nil
+}
+
+// lookupRestore returns the path of the named restore command, empty if it
+// is not installed, and whether it supports the --wait option.
+func lookupRestore(name string) (string, bool) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", false
+	}
+	cmd := exec.Command(path, "--wait", "--noflush")
+	cmd.Stdin = strings.NewReader("")
+	return path, cmd.Run() == nil
+}
+
+// restore runs iptables-restore, or ip6tables-restore, leaving the rules
+// not part of the input in place.
+func restore(ipv IPV, input string) error {
+	path, xlock := iptablesRestorePath, restoreSupportsXlock
+	if ipv == IP6Tables {
+		path, xlock = ip6tablesRestorePath, restoreSupportsXlock6
+	}
+
+	args := []string{"--noflush"}
+	if xlock {
+		args = append([]string{"--wait"}, args...)
+	} else {
+		bestEffortLock.Lock()
+		defer bestEffortLock.Unlock()
+	}
+
+	logrus.Debugf("%s, %v: %s", path, args, input)
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s-restore failed: %s (%s)", ipv.command(), output, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package iptables
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestBatchRestoreInput(t *testing.T) {
+	b := NewBatch()
+	b.Add(Insert, Nat, "POSTROUTING", "-s", "172.17.0.0/16", "!", "-o", "docker0", "-j", "MASQUERADE")
+	b.Add(Append, "", "FORWARD", "-i", "docker0", "-o", "docker0", "-j", "ACCEPT")
+	b.Add(Delete, Nat, "DOCKER", "-m", "comment", "--comment", "a comment", "-j", "RETURN")
+
+	if b.Len() != 3 {
+		t.Fatalf("Unexpected batch length %d", b.Len())
+	}
+
+	tables := b.tables()
+	if len(tables) != 2 || tables[0].table != Nat || tables[1].table != Filter {
+		t.Fatalf("Unexpected batch tables %v", tables)
+	}
+
+	expected := "*nat\n" +
+		"-I POSTROUTING -s 172.17.0.0/16 ! -o docker0 -j MASQUERADE\n" +
+		"-D DOCKER -m comment --comment \"a comment\" -j RETURN\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Nat}); input != expected {
+		t.Fatalf("Unexpected nat input:\n%s\nExpected:\n%s", input, expected)
+	}
+
+	expected = "*filter\n-A FORWARD -i docker0 -o docker0 -j ACCEPT\nCOMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected filter input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
+
+func TestBatchInverse(t *testing.T) {
+	b := NewBatch()
+	b.Add(Insert, Filter, "FORWARD", "-j", "ACCEPT")
+	b.Add(Append, Filter, "FORWARD", "-j", "DROP")
+	b.Add(Delete, Filter, "FORWARD", "-j", "RETURN")
+
+	inv := b.inverse()
+	expected := "*filter\n-A FORWARD -j RETURN\n-D FORWARD -j DROP\n-D FORWARD -j ACCEPT\nCOMMIT\n"
+	if input := inv.restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected inverse input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
+
+func TestBatchInverseDeletePosition(t *testing.T) {
+	// The FORWARD chain lists X1, A, X3 and B, and the batch inserts a rule
+	// at its top before deleting A and B
+	b := NewBatch()
+	b.Add(Insert, Filter, "FORWARD", "-j", "ACCEPT")
+	for _, r := range []batchRule{
+		{ipv: Iptables, action: Delete, table: Filter, chain: "FORWARD", listed: 2, args: []string{"-j", "A"}},
+		{ipv: Iptables, action: Delete, table: Filter, chain: "FORWARD", listed: 4, args: []string{"-j", "B"}},
+	} {
+		r.pos = b.deletePosition(r)
+		b.rules = append(b.rules, r)
+	}
+
+	if b.rules[1].pos != 3 || b.rules[2].pos != 4 {
+		t.Fatalf("Unexpected positions %d and %d of the deleted rules", b.rules[1].pos, b.rules[2].pos)
+	}
+
+	inv := b.inverse()
+	expected := "*filter\n-I FORWARD 4 -j B\n-I FORWARD 3 -j A\n-D FORWARD -j ACCEPT\nCOMMIT\n"
+	if input := inv.restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected inverse input:\n%s\nExpected:\n%s", input, expected)
+	}
+
+	// Rolling the rollback back inserts the rule at the top again
+	expected = "*filter\n-I FORWARD 1 -j ACCEPT\n-D FORWARD -j A\n-D FORWARD -j B\nCOMMIT\n"
+	if input := inv.inverse().restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected inverse input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
+
+func TestRulePosition(t *testing.T) {
+	listing := "-P FORWARD ACCEPT\n" +
+		"-A FORWARD -j DOCKER-ISOLATION\n" +
+		"-A FORWARD -o docker0 -j DOCKER\n" +
+		"-A FORWARD -i docker0 -o docker0 -j ACCEPT\n"
+
+	if pos := rulePosition(listing, "FORWARD", []string{"-i", "docker0", "-o", "docker0", "-j", "ACCEPT"}); pos != 3 {
+		t.Fatalf("Unexpected rule position %d", pos)
+	}
+
+	if pos := rulePosition(listing, "FORWARD", []string{"-o", "docker0", "-j", "ACCEPT"}); pos != 0 {
+		t.Fatalf("Unexpected position %d of a rule absent from the chain", pos)
+	}
+}
+
+func TestRestoreQuote(t *testing.T) {
+	for arg, expected := range map[string]string{
+		"MASQUERADE":    "MASQUERADE",
+		"":              `""`,
+		"a comment":     `"a comment"`,
+		"tab\there":     "\"tab\there\"",
+		`say "hi"`:      `"say \"hi\""`,
+		`back\slash`:    `"back\\slash"`,
+		`end\`:          `"end\\"`,
+		`"quoted" \ ok`: `"\"quoted\" \\ ok"`,
+	} {
+		if quoted := restoreQuote(arg); quoted != expected {
+			t.Fatalf("Unexpected quoting of %q: %s, expected %s", arg, quoted, expected)
+		}
+	}
+}
+
+func TestForwardRules(t *testing.T) {
+	c := &Chain{Name: "DOCKER", Bridge: "docker0"}
+	b := NewBatch()
+	c.ForwardRules(b, Append, net.IPv4zero, 8080, "tcp", "172.17.0.2", 80)
+
+	expected := "*nat\n" +
+		"-A DOCKER -p tcp -d 0/0 --dport 8080 -j DNAT --to-destination 172.17.0.2:80\n" +
+		"-A POSTROUTING -p tcp -s 172.17.0.2 -d 172.17.0.2 --dport 80 -j MASQUERADE\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Nat}); input != expected {
+		t.Fatalf("Unexpected nat input:\n%s\nExpected:\n%s", input, expected)
+	}
+
+	expected = "*filter\n-A DOCKER ! -i docker0 -o docker0 -p tcp -d 172.17.0.2 --dport 80 -j ACCEPT\nCOMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected filter input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
+
+func TestEmptyBatchCommit(t *testing.T) {
+	if err := NewBatch().Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitRestoreCheckConcurrent(t *testing.T) {
+	for _, ipv := range []IPV{Iptables, IP6Tables} {
+		expected := initRestoreCheck(ipv)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- initRestoreCheck(ipv)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != expected {
+				t.Fatalf("Unexpected %s restore check result %v, expected %v", ipv, err, expected)
+			}
+		}
+	}
+}
+
+func TestForwardRulesIPv6(t *testing.T) {
+	c := &Chain{Name: "DOCKER", Bridge: "docker0"}
+	b := NewBatch()
+	c.ForwardRules(b, Append, net.ParseIP("2001:db8::1"), 8080, "tcp", "2001:db8:1::2", 80)
+
+	tables := b.tables()
+	if len(tables) != 2 || tables[0] != (batchTable{IP6Tables, Nat}) || tables[1] != (batchTable{IP6Tables, Filter}) {
+		t.Fatalf("Unexpected batch tables %v", tables)
+	}
+
+	expected := "*nat\n" +
+		"-A DOCKER -p tcp -d 2001:db8::1 --dport 8080 -j DNAT --to-destination [2001:db8:1::2]:80\n" +
+		"-A POSTROUTING -p tcp -s 2001:db8:1::2 -d 2001:db8:1::2 --dport 80 -j MASQUERADE\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(tables[0]); input != expected {
+		t.Fatalf("Unexpected nat input:\n%s\nExpected:\n%s", input, expected)
+	}
+
+	if input := b.restoreInput(batchTable{Iptables, Nat}); input != "*nat\nCOMMIT\n" {
+		t.Fatalf("Unexpected IPv6 rules in the iptables input:\n%s", input)
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	for ip, ipv := range map[string]IPV{
+		"172.17.0.2":      Iptables,
+		"::ffff:10.0.0.1": Iptables,
+		"2001:db8::1":     IP6Tables,
+		"::":              IP6Tables,
+	} {
+		if v := IPVersion(net.ParseIP(ip)); v != ipv {
+			t.Fatalf("Unexpected IP version %s for %s", v, ip)
+		}
+	}
+	if v := IPVersion(nil); v != Iptables {
+		t.Fatalf("Unexpected IP version %s for a nil address", v)
+	}
+}
+
+func TestForwardRangeRules(t *testing.T) {
+	c := &Chain{Name: "DOCKER", Bridge: "docker0"}
+	b := NewBatch()
+	c.ForwardRangeRules(b, Append, net.IPv4zero, 10000, 1000, "udp", "172.17.0.2", 10000)
+	c.ForwardRangeRules(b, Append, net.ParseIP("192.168.0.1"), 20000, 100, "tcp", "172.17.0.2", 8000)
+
+	expected := "*nat\n" +
+		"-A DOCKER -p udp -d 0/0 --dport 10000:10999 -j DNAT --to-destination 172.17.0.2\n" +
+		"-A POSTROUTING -p udp -s 172.17.0.2 -d 172.17.0.2 --dport 10000:10999 -j MASQUERADE\n" +
+		"-A DOCKER -p tcp -d 192.168.0.1 --dport 20000:20099 -j DNAT --to-destination 172.17.0.2:8000-8099/20000\n" +
+		"-A POSTROUTING -p tcp -s 172.17.0.2 -d 172.17.0.2 --dport 8000:8099 -j MASQUERADE\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Nat}); input != expected {
+		t.Fatalf("Unexpected nat input:\n%s\nExpected:\n%s", input, expected)
+	}
+
+	expected = "*filter\n" +
+		"-A DOCKER ! -i docker0 -o docker0 -p udp -d 172.17.0.2 --dport 10000:10999 -j ACCEPT\n" +
+		"-A DOCKER ! -i docker0 -o docker0 -p tcp -d 172.17.0.2 --dport 8000:8099 -j ACCEPT\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Filter}); input != expected {
+		t.Fatalf("Unexpected filter input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
+
+func TestForwardRulesSCTP(t *testing.T) {
+	c := &Chain{Name: "DOCKER", Bridge: "docker0"}
+	b := NewBatch()
+	c.ForwardRules(b, Append, net.IPv4zero, 3868, "sctp", "172.17.0.2", 3868)
+
+	expected := "*nat\n" +
+		"-A DOCKER -p sctp -d 0/0 --dport 3868 -j DNAT --to-destination 172.17.0.2:3868\n" +
+		"-A POSTROUTING -p sctp -s 172.17.0.2 -d 172.17.0.2 --dport 3868 -j MASQUERADE\n" +
+		"COMMIT\n"
+	if input := b.restoreInput(batchTable{Iptables, Nat}); input != expected {
+		t.Fatalf("Unexpected nat input:\n%s\nExpected:\n%s", input, expected)
+	}
+}
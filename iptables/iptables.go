@@ -34,19 +34,25 @@ const (
 )
 
 var (
-	iptablesPath  string
-	supportsXlock = false
+	iptablesPath   string
+	ip6tablesPath  string
+	supportsXlock  = false
+	supportsXlock6 = false
 	// used to lock iptables commands if xtables lock is not supported
 	bestEffortLock sync.Mutex
 	// ErrIptablesNotFound is returned when the rule is not found.
 	ErrIptablesNotFound = errors.New("Iptables not found")
+	// ErrIp6tablesNotFound is returned when the ip6tables binary is not found.
+	ErrIp6tablesNotFound = errors.New("Ip6tables not found")
 )
 
-// Chain defines the iptables chain.
+// Chain defines the iptables chain. The chain of an empty IPV is an
+// iptables one.
 type Chain struct {
 	Name   string
 	Bridge string
 	Table  Table
+	IPV    IPV
 }
 
 // ChainError is returned to represent errors during ip table operation.
@@ -59,7 +65,44 @@ func (e ChainError) Error() string {
 	return fmt.Sprintf("Error iptables %s: %s", e.Chain, string(e.Output))
 }
 
-func initCheck() error {
+// IPVersion returns the IP version of the rules matching the passed address,
+// IP6Tables for an IPv6 address and Iptables otherwise.
+func IPVersion(ip net.IP) IPV {
+	if ip != nil && ip.To4() == nil {
+		return IP6Tables
+	}
+	return Iptables
+}
+
+// command returns the name of the system command programming the rules of
+// the IP version.
+func (ipv IPV) command() string {
+	if ipv == IP6Tables {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// loopback returns the loopback network of the IP version.
+func (ipv IPV) loopback() string {
+	if ipv == IP6Tables {
+		return "::1/128"
+	}
+	return "127.0.0.0/8"
+}
+
+func initCheck(ipv IPV) error {
+	if ipv == IP6Tables {
+		if ip6tablesPath == "" {
+			path, err := exec.LookPath("ip6tables")
+			if err != nil {
+				return ErrIp6tablesNotFound
+			}
+			ip6tablesPath = path
+			supportsXlock6 = exec.Command(ip6tablesPath, "--wait", "-L", "-n").Run() == nil
+		}
+		return nil
+	}
 
 	if iptablesPath == "" {
 		path, err := exec.LookPath("iptables")
@@ -74,10 +117,16 @@ func initCheck() error {
 
 // NewChain adds a new chain to ip table.
 func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error) {
+	return Iptables.NewChain(name, bridge, table, hairpinMode)
+}
+
+// NewChain adds a new chain to the ip table of the IP version.
+func (ipv IPV) NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error) {
 	c := &Chain{
 		Name:   name,
 		Bridge: bridge,
 		Table:  table,
+		IPV:    ipv,
 	}
 
 	if string(c.Table) == "" {
@@ -85,8 +134,8 @@ func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error
 	}
 
 	// Add chain if it doesn't exist
-	if _, err := Raw("-t", string(c.Table), "-n", "-L", c.Name); err != nil {
-		if output, err := Raw("-t", string(c.Table), "-N", c.Name); err != nil {
+	if _, err := ipv.Raw("-t", string(c.Table), "-n", "-L", c.Name); err != nil {
+		if output, err := ipv.Raw("-t", string(c.Table), "-N", c.Name); err != nil {
 			return nil, err
 		} else if len(output) != 0 {
 			return nil, fmt.Errorf("Could not create %s/%s chain: %s", c.Table, c.Name, output)
@@ -98,7 +147,7 @@ func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error
 		preroute := []string{
 			"-m", "addrtype",
 			"--dst-type", "LOCAL"}
-		if !Exists(Nat, "PREROUTING", preroute...) {
+		if !ipv.Exists(Nat, "PREROUTING", preroute...) {
 			if err := c.Prerouting(Append, preroute...); err != nil {
 				return nil, fmt.Errorf("Failed to inject docker in PREROUTING chain: %s", err)
 			}
@@ -107,9 +156,9 @@ func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error
 			"-m", "addrtype",
 			"--dst-type", "LOCAL"}
 		if !hairpinMode {
-			output = append(output, "!", "--dst", "127.0.0.0/8")
+			output = append(output, "!", "--dst", ipv.loopback())
 		}
-		if !Exists(Nat, "OUTPUT", output...) {
+		if !ipv.Exists(Nat, "OUTPUT", output...) {
 			if err := c.Output(Append, output...); err != nil {
 				return nil, fmt.Errorf("Failed to inject docker in OUTPUT chain: %s", err)
 			}
@@ -118,9 +167,9 @@ func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error
 		link := []string{
 			"-o", c.Bridge,
 			"-j", c.Name}
-		if !Exists(Filter, "FORWARD", link...) {
+		if !ipv.Exists(Filter, "FORWARD", link...) {
 			insert := append([]string{string(Insert), "FORWARD"}, link...)
-			if output, err := Raw(insert...); err != nil {
+			if output, err := ipv.Raw(insert...); err != nil {
 				return nil, err
 			} else if len(output) != 0 {
 				return nil, fmt.Errorf("Could not create linking rule to %s/%s: %s", c.Table, c.Name, output)
@@ -132,9 +181,16 @@ func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error
 
 // RemoveExistingChain removes existing chain from the table.
 func RemoveExistingChain(name string, table Table) error {
+	return Iptables.RemoveExistingChain(name, table)
+}
+
+// RemoveExistingChain removes existing chain from the table of the IP
+// version.
+func (ipv IPV) RemoveExistingChain(name string, table Table) error {
 	c := &Chain{
 		Name:  name,
 		Table: table,
+		IPV:   ipv,
 	}
 	if string(c.Table) == "" {
 		c.Table = Filter
@@ -143,7 +199,30 @@ func RemoveExistingChain(name string, table Table) error {
 }
 
 // Forward adds forwarding rule to 'filter' table and corresponding nat rule to 'nat' table.
+// The rules forwarding to an IPv6 destination address are ip6tables ones.
 func (c *Chain) Forward(action Action, ip net.IP, port int, proto, destAddr string, destPort int) error {
+	b := NewBatch()
+	c.ForwardRules(b, action, ip, port, proto, destAddr, destPort)
+	return b.Commit()
+}
+
+// ForwardRules records the rules of Forward in the batch.
+func (c *Chain) ForwardRules(b *Batch, action Action, ip net.IP, port int, proto, destAddr string, destPort int) {
+	c.ForwardRangeRules(b, action, ip, port, 1, proto, destAddr, destPort)
+}
+
+// ForwardRange adds the forwarding rules of the count contiguous ports
+// starting at port to the ones starting at destPort. A single rule of each
+// table covers the whole range.
+func (c *Chain) ForwardRange(action Action, ip net.IP, port, count int, proto, destAddr string, destPort int) error {
+	b := NewBatch()
+	c.ForwardRangeRules(b, action, ip, port, count, proto, destAddr, destPort)
+	return b.Commit()
+}
+
+// ForwardRangeRules records the rules of ForwardRange in the batch.
+func (c *Chain) ForwardRangeRules(b *Batch, action Action, ip net.IP, port, count int, proto, destAddr string, destPort int) {
+	ipv := IPVersion(net.ParseIP(destAddr))
 	daddr := ip.String()
 	if ip.IsUnspecified() {
 		// iptables interprets "0.0.0.0" as "0.0.0.0/32", whereas we
@@ -151,67 +230,66 @@ func (c *Chain) Forward(action Action, ip net.IP, port int, proto, destAddr stri
 		// value" by both iptables and ip6tables.
 		daddr = "0/0"
 	}
-	if output, err := Raw("-t", string(Nat), string(action), c.Name,
+
+	dport, destDport := strconv.Itoa(port), strconv.Itoa(destPort)
+	target := net.JoinHostPort(destAddr, destDport)
+	if count > 1 {
+		dport = fmt.Sprintf("%d:%d", port, port+count-1)
+		destDport = fmt.Sprintf("%d:%d", destPort, destPort+count-1)
+		if port == destPort {
+			// DNAT keeps the destination port when none is passed
+			target = destAddr
+		} else {
+			// The ports of the range are shifted by the offset of the
+			// destination range, rather than spread over its ports
+			target = fmt.Sprintf("%s-%d/%d", net.JoinHostPort(destAddr, strconv.Itoa(destPort)), destPort+count-1, port)
+		}
+	}
+
+	b.AddIPV(ipv, action, Nat, c.Name,
 		"-p", proto,
 		"-d", daddr,
-		"--dport", strconv.Itoa(port),
+		"--dport", dport,
 		"-j", "DNAT",
-		"--to-destination", net.JoinHostPort(destAddr, strconv.Itoa(destPort))); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
-	}
+		"--to-destination", target)
 
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
+	b.AddIPV(ipv, action, Filter, c.Name,
 		"!", "-i", c.Bridge,
 		"-o", c.Bridge,
 		"-p", proto,
 		"-d", destAddr,
-		"--dport", strconv.Itoa(destPort),
-		"-j", "ACCEPT"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
-	}
+		"--dport", destDport,
+		"-j", "ACCEPT")
 
-	if output, err := Raw("-t", string(Nat), string(action), "POSTROUTING",
+	b.AddIPV(ipv, action, Nat, "POSTROUTING",
 		"-p", proto,
 		"-s", destAddr,
 		"-d", destAddr,
-		"--dport", strconv.Itoa(destPort),
-		"-j", "MASQUERADE"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
-	}
-
-	return nil
+		"--dport", destDport,
+		"-j", "MASQUERADE")
 }
 
 // Link adds reciprocal ACCEPT rule for two supplied IP addresses.
 // Traffic is allowed from ip1 to ip2 and vice-versa
 func (c *Chain) Link(action Action, ip1, ip2 net.IP, port int, proto string) error {
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
+	ipv := IPVersion(ip1)
+	b := NewBatch()
+	b.AddIPV(ipv, action, Filter, c.Name,
 		"-i", c.Bridge, "-o", c.Bridge,
 		"-p", proto,
 		"-s", ip1.String(),
 		"-d", ip2.String(),
 		"--dport", strconv.Itoa(port),
-		"-j", "ACCEPT"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return fmt.Errorf("Error iptables forward: %s", output)
-	}
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
+		"-j", "ACCEPT")
+	b.AddIPV(ipv, action, Filter, c.Name,
 		"-i", c.Bridge, "-o", c.Bridge,
 		"-p", proto,
 		"-s", ip2.String(),
 		"-d", ip1.String(),
 		"--sport", strconv.Itoa(port),
-		"-j", "ACCEPT"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return fmt.Errorf("Error iptables forward: %s", output)
+		"-j", "ACCEPT")
+	if err := b.Commit(); err != nil {
+		return fmt.Errorf("Error iptables forward: %s", err)
 	}
 	return nil
 }
@@ -222,7 +300,7 @@ func (c *Chain) Prerouting(action Action, args ...string) error {
 	if len(args) > 0 {
 		a = append(a, args...)
 	}
-	if output, err := Raw(append(a, "-j", c.Name)...); err != nil {
+	if output, err := c.IPV.Raw(append(a, "-j", c.Name)...); err != nil {
 		return err
 	} else if len(output) != 0 {
 		return ChainError{Chain: "PREROUTING", Output: output}
@@ -236,7 +314,7 @@ func (c *Chain) Output(action Action, args ...string) error {
 	if len(args) > 0 {
 		a = append(a, args...)
 	}
-	if output, err := Raw(append(a, "-j", c.Name)...); err != nil {
+	if output, err := c.IPV.Raw(append(a, "-j", c.Name)...); err != nil {
 		return err
 	} else if len(output) != 0 {
 		return ChainError{Chain: "OUTPUT", Output: output}
@@ -249,19 +327,24 @@ func (c *Chain) Remove() error {
 	// Ignore errors - This could mean the chains were never set up
 	if c.Table == Nat {
 		c.Prerouting(Delete, "-m", "addrtype", "--dst-type", "LOCAL")
-		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "!", "--dst", "127.0.0.0/8")
+		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "!", "--dst", c.IPV.loopback())
 		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL") // Created in versions <= 0.1.6
 
 		c.Prerouting(Delete)
 		c.Output(Delete)
 	}
-	Raw("-t", string(c.Table), "-F", c.Name)
-	Raw("-t", string(c.Table), "-X", c.Name)
+	c.IPV.Raw("-t", string(c.Table), "-F", c.Name)
+	c.IPV.Raw("-t", string(c.Table), "-X", c.Name)
 	return nil
 }
 
 // Exists checks if a rule exists
 func Exists(table Table, chain string, rule ...string) bool {
+	return Iptables.Exists(table, chain, rule...)
+}
+
+// Exists checks if a rule exists in the table of the IP version.
+func (ipv IPV) Exists(table Table, chain string, rule ...string) bool {
 	if string(table) == "" {
 		table = Filter
 	}
@@ -271,7 +354,7 @@ func Exists(table Table, chain string, rule ...string) bool {
 
 	// try -C
 	// if exit status is 0 then return true, the rule exists
-	if _, err := Raw(append([]string{
+	if _, err := ipv.Raw(append([]string{
 		"-t", string(table), "-C", chain}, rule...)...); err == nil {
 		return true
 	}
@@ -279,36 +362,54 @@ func Exists(table Table, chain string, rule ...string) bool {
 	// parse "iptables -S" for the rule (this checks rules in a specific chain
 	// in a specific table)
 	ruleString := strings.Join(rule, " ")
-	existingRules, _ := exec.Command(iptablesPath, "-t", string(table), "-S", chain).Output()
+	path := iptablesPath
+	if ipv == IP6Tables {
+		path = ip6tablesPath
+	}
+	existingRules, _ := exec.Command(path, "-t", string(table), "-S", chain).Output()
 
 	return strings.Contains(string(existingRules), ruleString)
 }
 
 // Raw calls 'iptables' system command, passing supplied arguments.
 func Raw(args ...string) ([]byte, error) {
+	return Iptables.Raw(args...)
+}
+
+// Raw calls the system command of the IP version, 'iptables' or
+// 'ip6tables', passing supplied arguments.
+func (ipv IPV) Raw(args ...string) ([]byte, error) {
+	if ipv != IP6Tables {
+		ipv = Iptables
+	}
+
 	if firewalldRunning {
-		output, err := Passthrough(Iptables, args...)
+		output, err := Passthrough(ipv, args...)
 		if err == nil || !strings.Contains(err.Error(), "was not provided by any .service files") {
 			return output, err
 		}
 
 	}
 
-	if err := initCheck(); err != nil {
+	if err := initCheck(ipv); err != nil {
 		return nil, err
 	}
-	if supportsXlock {
+	path, xlock := iptablesPath, supportsXlock
+	if ipv == IP6Tables {
+		path, xlock = ip6tablesPath, supportsXlock6
+	}
+	if xlock {
 		args = append([]string{"--wait"}, args...)
 	} else {
 		bestEffortLock.Lock()
 		defer bestEffortLock.Unlock()
 	}
 
-	logrus.Debugf("%s, %v", iptablesPath, args)
+	logrus.Debugf("%s, %v", path, args)
 
-	output, err := exec.Command(iptablesPath, args...).CombinedOutput()
+	output, err := exec.Command(path, args...).CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("iptables failed: iptables %v: %s (%s)", strings.Join(args, " "), output, err)
+		return nil, fmt.Errorf("iptables failed: %s %v: %s (%s)", ipv.command(), strings.Join(args, " "), output, err)
 	}
 
 	// ignore iptables' message about xtables lock
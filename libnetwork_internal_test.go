@@ -1,9 +1,20 @@
 package libnetwork
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/resolvconf"
+	"github.com/docker/libnetwork/resolver"
+	"github.com/docker/libnetwork/types"
 )
 
 func TestDriverRegistration(t *testing.T) {
@@ -12,15 +23,331 @@ func TestDriverRegistration(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = c.(*controller).RegisterDriver(bridgeNetType, nil)
+	err = c.(*controller).RegisterDriver(bridgeNetType, nil, driverapi.Capability{})
 	if err == nil {
 		t.Fatalf("Expecting the RegisterDriver to fail for %s", bridgeNetType)
 	}
 	if _, ok := err.(driverapi.ErrActiveRegistration); !ok {
 		t.Fatalf("Failed for unexpected reason: %v", err)
 	}
-	err = c.(*controller).RegisterDriver("test-dummy", nil)
+	err = c.(*controller).RegisterDriver("test-dummy", nil, driverapi.Capability{})
 	if err != nil {
 		t.Fatalf("Test failed with an error %v", err)
 	}
 }
+
+func TestEndpointAddStaticRoute(t *testing.T) {
+	ep := &endpoint{
+		iFaces:   []*endpointInterface{&endpointInterface{id: 1}},
+		joinInfo: &endpointJoinInfo{},
+	}
+
+	_, dest, _ := net.ParseCIDR("10.20.0.0/16")
+
+	if err := ep.AddStaticRoute(nil, types.NEXTHOP, net.ParseIP("192.168.1.1"), 0); err == nil {
+		t.Fatalf("Expected failure adding a static route without destination")
+	}
+
+	if err := ep.AddStaticRoute(dest, types.NEXTHOP, nil, 0); err == nil {
+		t.Fatalf("Expected failure adding a next hop route without next hop")
+	}
+
+	if err := ep.AddStaticRoute(dest, types.CONNECTED, nil, 2); err == nil {
+		t.Fatalf("Expected failure adding an on-link route through an unknown interface")
+	}
+
+	err := ep.AddStaticRoute(dest, 5, nil, 1)
+	if err == nil {
+		t.Fatalf("Expected failure adding a static route of an invalid type")
+	}
+	if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+
+	if err := ep.AddStaticRoute(dest, types.NEXTHOP, net.ParseIP("192.168.1.1"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.AddStaticRoute(dest, types.CONNECTED, nil, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ep.joinInfo.staticRoutes) != 2 {
+		t.Fatalf("Expected 2 static routes, got %d", len(ep.joinInfo.staticRoutes))
+	}
+}
+
+// newResolvableEndpoint returns an endpoint of the network, joined to a
+// sandbox when joined is set
+func newResolvableEndpoint(n *network, name, addr, addrv6 string, joined bool, aliases ...string) *endpoint {
+	ep := &endpoint{name: name, id: types.UUID(name), network: n, aliases: aliases}
+
+	i := &endpointInterface{}
+	i.addr.IP = net.ParseIP(addr)
+	if addrv6 != "" {
+		i.addrv6.IP = net.ParseIP(addrv6)
+	}
+	ep.iFaces = []*endpointInterface{i}
+
+	if joined {
+		ep.sandboxID = "sandbox-" + name
+	}
+
+	n.endpoints[ep.id] = ep
+	return ep
+}
+
+func TestSandboxResolve(t *testing.T) {
+	n1 := &network{name: "net1", endpoints: endpointTable{}}
+	n2 := &network{name: "net2", endpoints: endpointTable{}}
+	n3 := &network{name: "net3", endpoints: endpointTable{}}
+
+	self := newResolvableEndpoint(n1, "self", "172.18.0.2", "", true)
+	newResolvableEndpoint(n1, "web", "172.18.0.3", "2001:db8::3", true, "www")
+	newResolvableEndpoint(n1, "stopped", "172.18.0.4", "", false)
+	other := newResolvableEndpoint(n2, "db", "172.19.0.2", "", true)
+	newResolvableEndpoint(n3, "hidden", "172.20.0.2", "", true)
+
+	sb := &containerSandbox{endpoints: []*endpoint{self, other}}
+
+	for name, expected := range map[string][]net.IP{
+		"web":     {net.ParseIP("172.18.0.3"), net.ParseIP("2001:db8::3")},
+		"WWW":     {net.ParseIP("172.18.0.3"), net.ParseIP("2001:db8::3")},
+		"db":      {net.ParseIP("172.19.0.2")},
+		"self":    {net.ParseIP("172.18.0.2")},
+		"stopped": nil,
+		"hidden":  nil,
+	} {
+		ips := sb.ResolveName(name)
+		if len(ips) != len(expected) {
+			t.Fatalf("Expected %v for %s, got %v", expected, name, ips)
+		}
+		for i := range ips {
+			if !ips[i].Equal(expected[i]) {
+				t.Fatalf("Expected %v for %s, got %v", expected, name, ips)
+			}
+		}
+	}
+
+	for addr, expected := range map[string]string{
+		"172.18.0.3":  "web",
+		"2001:db8::3": "web",
+		"172.19.0.2":  "db",
+		"172.18.0.4":  "",
+		"172.20.0.2":  "",
+	} {
+		if name := sb.ResolveIP(net.ParseIP(addr)); name != expected {
+			t.Fatalf("Expected %q for %s, got %q", expected, addr, name)
+		}
+	}
+}
+
+func TestSandboxEmbeddedDNS(t *testing.T) {
+	if !netutils.IsRunningInContainer() {
+		defer netutils.SetupTestNetNS(t)()
+	}
+
+	dir, err := ioutil.TempDir("", "libnetwork-dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolvConfPath := filepath.Join(dir, "resolv.conf")
+	sbox, err := c.NewSandbox("dns-container",
+		SandboxOptionUseEmbeddedDNS(),
+		SandboxOptionHostsPath(filepath.Join(dir, "hosts")),
+		SandboxOptionResolvConfPath(resolvConfPath),
+		SandboxOptionDNS("192.0.2.53"),
+		SandboxOptionDNSSearch("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sbox.Delete()
+
+	content, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "nameserver "+resolver.DefaultAddress+"\n") || strings.Contains(string(content), "192.0.2.53") {
+		t.Fatalf("Expected the resolv.conf to only point to the embedded resolver, got:\n%s", content)
+	}
+
+	sb := sbox.(*containerSandbox)
+	n := &network{name: "net1", endpoints: endpointTable{}}
+	sb.endpoints = []*endpoint{newResolvableEndpoint(n, "web", "172.18.0.3", "", true)}
+
+	// A query for the A record of web
+	query := []byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 3, 'w', 'e', 'b', 0, 0, 1, 0, 1}
+
+	var (
+		reply = make([]byte, 512)
+		size  int
+		qErr  error
+	)
+	err = sb.osSbox.InvokeFunc(func() {
+		conn, err := net.Dial("udp", net.JoinHostPort(resolver.DefaultAddress, "53"))
+		if err != nil {
+			qErr = err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, qErr = conn.Write(query); qErr == nil {
+			size, qErr = conn.Read(reply)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qErr != nil {
+		t.Fatalf("Query to the embedded resolver failed: %v", qErr)
+	}
+
+	reply = reply[:size]
+	if len(reply) < 4 || reply[3]&0xf != 0 || !bytes.HasSuffix(reply, net.ParseIP("172.18.0.3").To4()) {
+		t.Fatalf("Unexpected reply from the embedded resolver %v", reply)
+	}
+}
+
+func TestUpdateResolvConfs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libnetwork-resolvconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		c    = &controller{containerSandboxes: containerSandboxTable{}}
+		n    = &network{name: "net1", endpoints: endpointTable{}}
+		old  = []byte("nameserver 1.2.3.4\nnameserver 2001:db8::53\n")
+		host = []byte("nameserver 127.0.0.1\nnameserver 5.6.7.8\n")
+	)
+
+	newSandbox := func(name string, joined bool, options ...SandboxOption) *containerSandbox {
+		sb := &containerSandbox{id: name, controller: c}
+		sb.config.resolvConfPath = filepath.Join(dir, name)
+		sb.processOptions(options...)
+		if joined {
+			sb.endpoints = []*endpoint{newResolvableEndpoint(n, name, "172.18.0.2", "", true)}
+		}
+		if err := sb.updateDNS(old, false); err != nil {
+			t.Fatal(err)
+		}
+		c.containerSandboxes[name] = sb
+		return sb
+	}
+
+	newSandbox("updated", true)
+	newSandbox("unjoined", false)
+	newSandbox("custom", true, SandboxOptionDNS("9.9.9.9"))
+	modified := newSandbox("modified", true)
+	if err := ioutil.WriteFile(modified.config.resolvConfPath, []byte("nameserver 8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.updateResolvConfs(host)
+
+	for name, expected := range map[string]string{
+		"updated":  "nameserver 5.6.7.8\n",
+		"unjoined": "nameserver 1.2.3.4\n",
+		"custom":   "nameserver 1.2.3.4\n",
+		"modified": "nameserver 8.8.8.8\n",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Fatalf("Expected the resolv.conf of sandbox %s to be %q, got %q", name, expected, content)
+		}
+	}
+}
+
+func TestStopResolvConfWatcher(t *testing.T) {
+	if _, err := os.Stat(resolvconf.Path); err != nil {
+		t.Skipf("No host resolv.conf: %v", err)
+	}
+
+	nc, err := New(OptionWatchResolvConf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := nc.(*controller)
+	w := c.resolvConfWatcher
+	if w == nil {
+		t.Fatal("Expected the controller to watch the host resolv.conf")
+	}
+
+	c.Stop()
+	if c.resolvConfWatcher != nil {
+		t.Fatal("Expected the watcher to be released on Stop")
+	}
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Fatal("Expected the events of the stopped watcher to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the watcher to be closed")
+	}
+
+	// Stopping twice is harmless
+	c.Stop()
+}
+
+func TestParentHostsRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libnetwork-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &controller{containerSandboxes: containerSandboxTable{}}
+	n := &network{name: "net1", endpoints: endpointTable{}, ctrlr: c}
+
+	parent := &containerSandbox{id: "sandbox-parent", controller: c}
+	parent.config.hostsPath = filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(parent.config.hostsPath, []byte("127.0.0.1\tlocalhost\n172.18.0.9\tdb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.containerSandboxes[parent.id] = parent
+	newResolvableEndpoint(n, "parent", "172.18.0.2", "", true)
+
+	child := &containerSandbox{id: "sandbox-child", controller: c}
+	child.processOptions(
+		SandboxOptionParentUpdate("parent", "db", "172.18.0.3"),
+		SandboxOptionParentUpdate("parent", "cache", "172.18.0.3"),
+		SandboxOptionParentUpdate("missing", "web", "172.18.0.3"),
+	)
+	ep := newResolvableEndpoint(n, "child", "172.18.0.3", "", true)
+
+	checkHosts := func(expected string) {
+		content, err := ioutil.ReadFile(parent.config.hostsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Fatalf("Expected the parent hosts file\n%s\ngot\n%s", expected, content)
+		}
+	}
+
+	// The stale entry is rewritten and the missing one is added, once
+	for i := 0; i < 2; i++ {
+		if err := child.updateParentHosts(ep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkHosts("127.0.0.1\tlocalhost\n172.18.0.3\tdb\n172.18.0.3\tcache\n")
+
+	if err := child.removeParentHosts(ep); err != nil {
+		t.Fatal(err)
+	}
+	checkHosts("127.0.0.1\tlocalhost\n")
+}
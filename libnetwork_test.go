@@ -19,10 +19,13 @@ import (
 	"github.com/docker/docker/pkg/reexec"
 	"github.com/docker/libnetwork"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay"
+	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
 )
 
@@ -39,25 +42,30 @@ func TestMain(m *testing.M) {
 }
 
 func createTestNetwork(networkType, networkName string, option options.Generic, netOption options.Generic) (libnetwork.Network, error) {
+	_, network, err := createTestController(networkType, networkName, option, netOption)
+	return network, err
+}
+
+func createTestController(networkType, networkName string, option options.Generic, netOption options.Generic) (libnetwork.NetworkController, libnetwork.Network, error) {
 	controller, err := libnetwork.New()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	genericOption := make(map[string]interface{})
 	genericOption[netlabel.GenericData] = option
 
 	err = controller.ConfigureNetworkDriver(networkType, genericOption)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	network, err := controller.NewNetwork(networkType, networkName,
 		libnetwork.NetworkOptionGeneric(netOption))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return network, nil
+	return controller, network, nil
 }
 
 func getEmptyGenericOption() map[string]interface{} {
@@ -75,7 +83,7 @@ func getPortMapping() []types.PortBinding {
 }
 
 func TestNull(t *testing.T) {
-	network, err := createTestNetwork("null", "testnetwork", options.Generic{},
+	controller, network, err := createTestController("null", "testnetwork", options.Generic{},
 		options.Generic{})
 	if err != nil {
 		t.Fatal(err)
@@ -86,19 +94,284 @@ func TestNull(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep.Join("null_container",
+	sb, err := controller.NewSandbox("null_container",
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep.Join(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep.Leave(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := network.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeprecatedJoinOptions(t *testing.T) {
+	controller, network, err := createTestController("null", "testnetwork", options.Generic{},
+		options.Generic{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Delete()
+
+	ep, err := network.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete()
+
+	hostsPath := "/tmp/libnetwork_test/deprecated_hosts"
+	defer os.Remove(hostsPath)
+
+	sb, err := controller.NewSandbox("deprecated_container",
+		libnetwork.SandboxOptionHostsPath(hostsPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
+
+	// The JoinOption setters still configure the sandbox
+	if err := ep.Join(sb,
 		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
+		libnetwork.JoinOptionExtraHost("web", "192.168.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Leave(sb)
+
+	content, err := ioutil.ReadFile(hostsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "192.168.0.1\tweb\n"; !bytes.Contains(content, []byte(expected)) {
+		t.Fatalf("Expected to find %q in the hosts file, got %q", expected, content)
+	}
+}
+
+func TestControllerRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libnetwork-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	controller, err := libnetwork.New(libnetwork.OptionLocalDataStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network, err := controller.NewNetwork("null", "testnetwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := network.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := controller.NewSandbox("restore_container", libnetwork.SandboxOptionHostname("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new controller on the same store must pick up the state left behind
+	restored, err := libnetwork.New(libnetwork.OptionLocalDataStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rn, err := restored.NetworkByName("testnetwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rn.ID() != network.ID() || rn.Type() != "null" {
+		t.Fatalf("Restored network %s (%s) of type %s does not match %s (%s)", rn.Name(), rn.ID(), rn.Type(), network.Name(), network.ID())
+	}
+
+	rep, err := rn.EndpointByName("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.ID() != ep.ID() {
+		t.Fatalf("Restored endpoint id %s does not match %s", rep.ID(), ep.ID())
+	}
+
+	if rep.Info().SandboxKey() != sb.Key() {
+		t.Fatalf("Restored endpoint sandbox key %q does not match %q", rep.Info().SandboxKey(), sb.Key())
+	}
+
+	rsb, err := restored.SandboxByID(sb.ID())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ep.Leave("null_container")
+	if rsb.ContainerID() != "restore_container" || rsb.Key() != sb.Key() {
+		t.Fatalf("Restored sandbox for %s (%s) does not match %s (%s)", rsb.ContainerID(), rsb.Key(), sb.ContainerID(), sb.Key())
+	}
+
+	if eps := rsb.Endpoints(); len(eps) != 1 || eps[0].ID() != ep.ID() {
+		t.Fatalf("Expected the restored sandbox to be joined to endpoint %s, got %v", ep.ID(), eps)
+	}
+
+	if err := rsb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Info().SandboxKey() != "" {
+		t.Fatalf("Expected the endpoint to be left on sandbox delete, found sandbox key %q", rep.Info().SandboxKey())
+	}
+
+	if err := rep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rn.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is left to restore once the objects are deleted
+	restored, err = libnetwork.New(libnetwork.OptionLocalDataStore(dir))
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if len(restored.Networks()) != 0 {
+		t.Fatalf("Expected no networks to be restored, found %d", len(restored.Networks()))
+	}
+
+	if len(restored.Sandboxes()) != 0 {
+		t.Fatalf("Expected no sandboxes to be restored, found %d", len(restored.Sandboxes()))
+	}
+}
+
+func TestLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libnetwork-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	controller, err := libnetwork.New(libnetwork.OptionLocalDataStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nLabels := map[string]string{"tier": "front"}
+	network, err := controller.NewNetwork("null", "testnetwork",
+		libnetwork.NetworkOptionLabels(nLabels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer network.Delete()
+
+	ep, err := network.CreateEndpoint("testep",
+		libnetwork.CreateOptionLabels(map[string]string{"role": "db"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete()
+
+	// The labels must not be affected by changes to the maps they were set
+	// with or returned in
+	nLabels["tier"] = "back"
+	network.Labels()["tier"] = "back"
+	if v := network.Labels()["tier"]; v != "front" {
+		t.Fatalf("Unexpected network label value %q", v)
+	}
+
+	if v := ep.Labels()["role"]; v != "db" {
+		t.Fatalf("Unexpected endpoint label value %q", v)
+	}
+
+	restored, err := libnetwork.New(libnetwork.OptionLocalDataStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rn, err := restored.NetworkByName("testnetwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := rn.Labels()["tier"]; v != "front" {
+		t.Fatalf("Unexpected restored network label value %q", v)
+	}
+
+	rep, err := rn.EndpointByName("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := rep.Labels()["role"]; v != "db" {
+		t.Fatalf("Unexpected restored endpoint label value %q", v)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	controller, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, cancelAll := controller.Subscribe(libnetwork.EventFilter{})
+	defer cancelAll()
+
+	joins, cancelJoins := controller.Subscribe(libnetwork.EventFilter{
+		Types: []libnetwork.EventType{libnetwork.EventEndpointJoin, libnetwork.EventEndpointLeave},
+	})
+
+	network, err := controller.NewNetwork("null", "testnetwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := network.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := controller.NewSandbox("events_container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
 	if err := ep.Delete(); err != nil {
 		t.Fatal(err)
 	}
@@ -106,10 +379,43 @@ func TestNull(t *testing.T) {
 	if err := network.Delete(); err != nil {
 		t.Fatal(err)
 	}
+
+	expected := []libnetwork.EventType{
+		libnetwork.EventNetworkCreate,
+		libnetwork.EventEndpointCreate,
+		libnetwork.EventEndpointJoin,
+		libnetwork.EventEndpointLeave,
+		libnetwork.EventEndpointDelete,
+		libnetwork.EventNetworkDelete,
+	}
+	for _, et := range expected {
+		e := <-all
+		if e.Type != et {
+			t.Fatalf("Expected event %s. Got %s", et, e.Type)
+		}
+		if e.NetworkID != network.ID() || e.NetworkName != "testnetwork" || e.NetworkType != "null" {
+			t.Fatalf("Unexpected network in event: %+v", e)
+		}
+		if et != libnetwork.EventNetworkCreate && et != libnetwork.EventNetworkDelete && e.EndpointID != ep.ID() {
+			t.Fatalf("Unexpected endpoint in event: %+v", e)
+		}
+	}
+
+	for _, et := range []libnetwork.EventType{libnetwork.EventEndpointJoin, libnetwork.EventEndpointLeave} {
+		e := <-joins
+		if e.Type != et || e.ContainerID != "events_container" {
+			t.Fatalf("Unexpected event on the filtered subscription: %+v", e)
+		}
+	}
+
+	cancelJoins()
+	if _, ok := <-joins; ok {
+		t.Fatal("Expected the channel to be closed on cancel")
+	}
 }
 
 func TestHost(t *testing.T) {
-	network, err := createTestNetwork("host", "testnetwork", options.Generic{}, options.Generic{})
+	controller, network, err := createTestController("host", "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,11 +425,16 @@ func TestHost(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep1.Join("host_container1",
-		libnetwork.JoinOptionHostname("test1"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"),
-		libnetwork.JoinOptionUseDefaultSandbox())
+	sb1, err := controller.NewSandbox("host_container1",
+		libnetwork.SandboxOptionHostname("test1"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"),
+		libnetwork.SandboxOptionUseDefaultSandbox())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep1.Join(sb1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -133,25 +444,38 @@ func TestHost(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep2.Join("host_container2",
-		libnetwork.JoinOptionHostname("test2"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"),
-		libnetwork.JoinOptionUseDefaultSandbox())
+	sb2, err := controller.NewSandbox("host_container2",
+		libnetwork.SandboxOptionHostname("test2"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"),
+		libnetwork.SandboxOptionUseDefaultSandbox())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ep1.Leave("host_container1")
+	err = ep2.Join(sb2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ep2.Leave("host_container2")
+	err = ep1.Leave(sb1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep2.Leave(sb2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if err := sb2.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
 	if err := ep1.Delete(); err != nil {
 		t.Fatal(err)
 	}
@@ -166,20 +490,29 @@ func TestHost(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep3.Join("host_container3",
-		libnetwork.JoinOptionHostname("test3"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"),
-		libnetwork.JoinOptionUseDefaultSandbox())
+	sb3, err := controller.NewSandbox("host_container3",
+		libnetwork.SandboxOptionHostname("test3"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"),
+		libnetwork.SandboxOptionUseDefaultSandbox())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ep3.Leave("host_container3")
+	err = ep3.Join(sb3)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	err = ep3.Leave(sb3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb3.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
 	if err := ep3.Delete(); err != nil {
 		t.Fatal(err)
 	}
@@ -278,6 +611,213 @@ func TestUnknownDriver(t *testing.T) {
 	}
 }
 
+func TestPeers(t *testing.T) {
+	if !netutils.IsRunningInContainer() {
+		defer netutils.SetupTestNetNS(t)()
+	}
+
+	vtep := net.ParseIP("192.168.1.1")
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	controller, network, err := createTestController("overlay", "testnetwork",
+		options.Generic{"BindAddress": vtep},
+		options.Generic{netlabel.GenericData: &overlay.NetworkConfiguration{VNI: 42, Subnet: subnet}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := network.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep, err := network.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	peers, err := controller.Peers(network.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || !peers[0].Local || string(peers[0].EndpointID) != ep.ID() || !peers[0].Vtep.Equal(vtep) {
+		t.Fatalf("Unexpected peers %v. Expected the local endpoint", peers)
+	}
+
+	mac, _ := net.ParseMAC("02:42:0a:01:00:64")
+	remote := &driverapi.Peer{EndpointID: "remote", IP: net.ParseIP("10.1.0.100"), Mac: mac, Vtep: net.ParseIP("192.168.1.2")}
+	if err := controller.PeerAdd(network.ID(), remote); err != nil {
+		t.Fatalf("Failed to add a remote peer: %v", err)
+	}
+
+	peers, err = controller.Peers(network.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, p := range peers {
+		if !p.Local && p.IP.Equal(remote.IP) && p.Vtep.Equal(remote.Vtep) {
+			found = true
+		}
+	}
+	if len(peers) != 2 || !found {
+		t.Fatalf("Unexpected peers %v. Expected the remote peer to be listed", peers)
+	}
+
+	if err := controller.PeerDelete(network.ID(), remote.IP); err != nil {
+		t.Fatalf("Failed to delete the remote peer: %v", err)
+	}
+	if peers, _ := controller.Peers(network.ID()); len(peers) != 1 {
+		t.Fatalf("Expected the local peer only, got %v", peers)
+	}
+
+	if _, err := controller.Peers("unknown"); err == nil {
+		t.Fatal("Expected to fail listing the peers of an unknown network")
+	} else if _, ok := err.(libnetwork.ErrNoSuchNetwork); !ok {
+		t.Fatalf("Did not fail with expected error. Actual error: %v", err)
+	}
+
+	bridge, err := controller.NewNetwork(bridgeNetType, "testbridge",
+		libnetwork.NetworkOptionGeneric(options.Generic{"BridgeName": "testbridge", "AllowNonDefaultBridge": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Delete()
+
+	if err := controller.PeerAdd(bridge.ID(), remote); err == nil {
+		t.Fatal("Expected to fail adding a peer to a bridge network")
+	} else if _, ok := err.(types.NotImplementedError); !ok {
+		t.Fatalf("Did not fail with expected error. Actual error: %v", err)
+	}
+}
+
+func TestRestoreDropsOverlayEndpoint(t *testing.T) {
+	if !netutils.IsRunningInContainer() {
+		defer netutils.SetupTestNetNS(t)()
+	}
+
+	dir, err := ioutil.TempDir("", "libnetwork-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newController := func() libnetwork.NetworkController {
+		c, err := libnetwork.New(libnetwork.OptionLocalDataStore(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ConfigureNetworkDriver("overlay", map[string]interface{}{
+			netlabel.GenericData: options.Generic{"BindAddress": net.ParseIP("192.168.1.1")},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	controller := newController()
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	network, err := controller.NewNetwork("overlay", "testnetwork",
+		libnetwork.NetworkOptionGeneric(options.Generic{netlabel.GenericData: &overlay.NetworkConfiguration{VNI: 42, Subnet: subnet}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := network.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := controller.NewSandbox("overlay_container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	// The overlay driver cannot restore the endpoint, which is dropped along
+	// with its interface in the sandbox
+	restored := newController()
+	rn, err := restored.NetworkByName("testnetwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rn.EndpointByName("testep"); err == nil {
+		t.Fatal("Expected the overlay endpoint to be dropped on restore")
+	}
+
+	rsb, err := restored.SandboxByID(sb.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eps := rsb.Endpoints(); len(eps) != 0 {
+		t.Fatalf("Expected the restored sandbox to have no endpoint, got %v", eps)
+	}
+	if links := sandboxLinks(t, rsb.Key()); len(links) != 1 || links[0] != "lo" {
+		t.Fatalf("Expected only the loopback interface left in the sandbox, got %v", links)
+	}
+
+	if peers, err := restored.Peers(rn.ID()); err != nil || len(peers) != 0 {
+		t.Fatalf("Unexpected peers %v (%v) of the dropped endpoint", peers, err)
+	}
+
+	// The endpoint is gone from the store too
+	if _, err := newController().NetworkByName("testnetwork"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rn.EndpointByName("testep"); err == nil {
+		t.Fatal("Expected the dropped endpoint not to be restored again")
+	}
+
+	if err := rsb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rn.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sandboxLinks returns the names of the links in the namespace at key
+func sandboxLinks(t *testing.T, key string) []string {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(key, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := netns.Set(netns.NsHandle(f.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns)
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, l := range links {
+		names = append(names, l.Attrs().Name)
+	}
+	return names
+}
+
 func TestNilRemoteDriver(t *testing.T) {
 	controller, err := libnetwork.New()
 	if err != nil {
@@ -290,8 +830,35 @@ func TestNilRemoteDriver(t *testing.T) {
 		t.Fatal("Expected to fail. But instead succeeded")
 	}
 
-	if _, ok := err.(types.NotFoundError); !ok {
-		t.Fatalf("Did not fail with expected error. Actual error: %v", err)
+	if _, ok := err.(types.NotFoundError); !ok {
+		t.Fatalf("Did not fail with expected error. Actual error: %v", err)
+	}
+}
+
+func TestNetworkIpam(t *testing.T) {
+	controller, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = controller.NewNetwork("null", "unknown_ipam",
+		libnetwork.NetworkOptionIpam("framerelay-ipam"))
+	if err == nil {
+		t.Fatal("Expected to fail. But instead succeeded")
+	}
+
+	if _, ok := err.(libnetwork.IpamTypeError); !ok {
+		t.Fatalf("Did not fail with expected error. Actual error: %v", err)
+	}
+
+	n, err := controller.NewNetwork("null", "default_ipam",
+		libnetwork.NetworkOptionIpam(ipamapi.DefaultIPAM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Delete(); err != nil {
+		t.Fatal(err)
 	}
 }
 
@@ -735,7 +1302,7 @@ func TestEndpointJoin(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -762,16 +1329,27 @@ func TestEndpointJoin(t *testing.T) {
 		t.Fatalf("Expected an empty sandbox key for an empty endpoint. Instead found a non-empty sandbox key: %s", info.SandboxKey())
 	}
 
-	_, err = ep.Join(containerID,
-		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := sb.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	err = ep.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	defer func() {
-		err = ep.Leave(containerID)
+		err = ep.Leave(sb)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -783,8 +1361,165 @@ func TestEndpointJoin(t *testing.T) {
 		t.Fatalf("Expected a valid gateway for a joined endpoint. Instead found an invalid gateway: %v", info.Gateway())
 	}
 
-	if info.SandboxKey() == "" {
-		t.Fatalf("Expected an non-empty sandbox key for a joined endpoint. Instead found a empty sandbox key")
+	if info.SandboxKey() != sb.Key() {
+		t.Fatalf("Expected sandbox key %s for a joined endpoint. Instead found %q", sb.Key(), info.SandboxKey())
+	}
+
+	// A second endpoint on another network joins the same sandbox
+	n2, err := controller.NewNetwork(bridgeNetType, "testnetwork2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep2, err := n2.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep2.Join(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		err = ep2.Leave(sb)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if ep2.Info().SandboxKey() != sb.Key() {
+		t.Fatalf("Expected sandbox key %s for the second endpoint. Instead found %q", sb.Key(), ep2.Info().SandboxKey())
+	}
+
+	eps := sb.Endpoints()
+	if len(eps) != 2 || eps[0].ID() != ep.ID() || eps[1].ID() != ep2.ID() {
+		t.Fatalf("Expected the sandbox to be joined to %s and %s in order, got %v", ep.ID(), ep2.ID(), eps)
+	}
+}
+
+func TestEndpointJoinGatewayPriority(t *testing.T) {
+	if !netutils.IsRunningInContainer() {
+		defer netutils.SetupTestNetNS(t)()
+	}
+
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n2, err := controller.NewNetwork(bridgeNetType, "testnetwork2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep1, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep2, err := n2.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := controller.NewSandbox(containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := sb.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := ep1.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ep1.Info().ProvidesGateway() {
+		t.Fatalf("Expected the first endpoint joined to provide the gateway")
+	}
+	checkDefaultGateway(t, sb.Key(), ep1.Info().Gateway())
+
+	// The second endpoint has a higher priority and takes the gateway over
+	if err := ep2.Join(sb, libnetwork.JoinOptionPriority(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if ep1.Info().ProvidesGateway() || !ep2.Info().ProvidesGateway() {
+		t.Fatalf("Expected the endpoint with the highest priority to provide the gateway")
+	}
+	checkDefaultGateway(t, sb.Key(), ep2.Info().Gateway())
+
+	// The gateway goes back to the first endpoint once the second one leaves
+	if err := ep2.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ep1.Info().ProvidesGateway() || ep2.Info().ProvidesGateway() {
+		t.Fatalf("Expected the gateway to be handed back to the remaining endpoint")
+	}
+	checkDefaultGateway(t, sb.Key(), ep1.Info().Gateway())
+
+	// With equal priorities the first endpoint joined keeps the gateway
+	if err := ep2.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ep1.Info().ProvidesGateway() || ep2.Info().ProvidesGateway() {
+		t.Fatalf("Expected the first endpoint joined to keep the gateway")
+	}
+	checkDefaultGateway(t, sb.Key(), ep1.Info().Gateway())
+
+	if err := ep1.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ep2.Info().ProvidesGateway() {
+		t.Fatalf("Expected the gateway to be handed over to the remaining endpoint")
+	}
+	checkDefaultGateway(t, sb.Key(), ep2.Info().Gateway())
+}
+
+// checkDefaultGateway verifies the only default route in the namespace at key
+// goes through gw.
+func checkDefaultGateway(t *testing.T, key string, gw net.IP) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(key, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := netns.Set(netns.NsHandle(f.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns)
+
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gws []net.IP
+	for _, r := range routes {
+		if r.Dst == nil {
+			gws = append(gws, r.Gw)
+		}
+	}
+
+	if len(gws) != 1 || !gws[0].Equal(gw) {
+		t.Fatalf("Expected a single default route through %v. Instead found %v", gw, gws)
 	}
 }
 
@@ -793,22 +1528,31 @@ func TestEndpointJoinInvalidContainerId(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	_, err = controller.NewSandbox("")
+	if err == nil {
+		t.Fatal("Expected to fail sandbox creation with empty container id string")
+	}
+
+	if _, ok := err.(libnetwork.InvalidContainerIDError); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
+	}
+
 	ep, err := n.CreateEndpoint("ep1")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ep.Join("")
+	err = ep.Join(nil)
 	if err == nil {
-		t.Fatal("Expected to fail join with empty container id string")
+		t.Fatal("Expected to fail join with a nil sandbox")
 	}
 
-	if _, ok := err.(libnetwork.InvalidContainerIDError); !ok {
+	if _, ok := err.(libnetwork.InvalidSandboxError); !ok {
 		t.Fatalf("Failed for unexpected reason: %v", err)
 	}
 }
@@ -818,7 +1562,7 @@ func TestEndpointDeleteWithActiveContainer(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -828,15 +1572,20 @@ func TestEndpointDeleteWithActiveContainer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep.Join(containerID,
-		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ep.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep.Leave(containerID)
+		err = sb.Delete()
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -862,7 +1611,7 @@ func TestEndpointMultipleJoins(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -872,22 +1621,33 @@ func TestEndpointMultipleJoins(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep.Join(containerID,
-		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
+	sb1, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb1.Delete()
 
+	err = ep.Join(sb1)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep.Leave(containerID)
+		err = ep.Leave(sb1)
 		if err != nil {
 			t.Fatal(err)
 		}
 	}()
 
-	_, err = ep.Join("container2")
+	sb2, err := controller.NewSandbox("container2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb2.Delete()
+
+	err = ep.Join(sb2)
 	if err == nil {
 		t.Fatal("Expected to fail multiple joins for the same endpoint")
 	}
@@ -902,7 +1662,7 @@ func TestEndpointInvalidLeave(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController(bridgeNetType, "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -912,47 +1672,56 @@ func TestEndpointInvalidLeave(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = ep.Leave(containerID)
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionHostname("test"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
+
+	err = ep.Leave(sb)
 	if err == nil {
 		t.Fatal("Expected to fail leave from an endpoint which has no active join")
 	}
 
-	if _, ok := err.(libnetwork.InvalidContainerIDError); !ok {
-		if _, ok := err.(libnetwork.ErrNoContainer); !ok {
-			t.Fatalf("Failed for unexpected reason: %v", err)
-		}
+	if _, ok := err.(libnetwork.ErrNoContainer); !ok {
+		t.Fatalf("Failed for unexpected reason: %v", err)
 	}
 
-	_, err = ep.Join(containerID,
-		libnetwork.JoinOptionHostname("test"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
-
+	err = ep.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep.Leave(containerID)
+		err = ep.Leave(sb)
 		if err != nil {
 			t.Fatal(err)
 		}
 	}()
 
-	err = ep.Leave("")
+	err = ep.Leave(nil)
 	if err == nil {
-		t.Fatal("Expected to fail leave with empty container id")
+		t.Fatal("Expected to fail leave with a nil sandbox")
 	}
 
-	if _, ok := err.(libnetwork.InvalidContainerIDError); !ok {
+	if _, ok := err.(libnetwork.InvalidSandboxError); !ok {
 		t.Fatalf("Failed for unexpected reason: %v", err)
 	}
 
-	err = ep.Leave("container2")
+	sb2, err := controller.NewSandbox("container2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb2.Delete()
+
+	err = ep.Leave(sb2)
 	if err == nil {
-		t.Fatal("Expected to fail leave with wrong container id")
+		t.Fatal("Expected to fail leave with a sandbox which has not joined")
 	}
 
-	if _, ok := err.(libnetwork.InvalidContainerIDError); !ok {
+	if _, ok := err.(libnetwork.InvalidSandboxError); !ok {
 		t.Fatalf("Failed for unexpected reason: %v", err)
 	}
 
@@ -963,7 +1732,7 @@ func TestEndpointUpdateParent(t *testing.T) {
 		defer netutils.SetupTestNetNS(t)()
 	}
 
-	n, err := createTestNetwork("bridge", "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController("bridge", "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -973,16 +1742,21 @@ func TestEndpointUpdateParent(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep1.Join(containerID,
-		libnetwork.JoinOptionHostname("test1"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionExtraHost("web", "192.168.0.1"))
+	sb1, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionHostname("test1"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionExtraHost("web", "192.168.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb1.Delete()
 
+	err = ep1.Join(sb1)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep1.Leave(containerID)
+		err = ep1.Leave(sb1)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -993,18 +1767,23 @@ func TestEndpointUpdateParent(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep2.Join("container2",
-		libnetwork.JoinOptionHostname("test2"),
-		libnetwork.JoinOptionDomainname("docker.io"),
-		libnetwork.JoinOptionHostsPath("/var/lib/docker/test_network/container2/hosts"),
-		libnetwork.JoinOptionParentUpdate(ep1.ID(), "web", "192.168.0.2"))
+	sb2, err := controller.NewSandbox("container2",
+		libnetwork.SandboxOptionHostname("test2"),
+		libnetwork.SandboxOptionDomainname("docker.io"),
+		libnetwork.SandboxOptionHostsPath("/var/lib/docker/test_network/container2/hosts"),
+		libnetwork.SandboxOptionParentUpdate(ep1.ID(), "web", "192.168.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb2.Delete()
 
+	err = ep2.Join(sb2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	defer func() {
-		err = ep2.Leave("container2")
+		err = ep2.Leave(sb2)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -1043,7 +1822,7 @@ func TestEnableIPv6(t *testing.T) {
 		},
 	}
 
-	n, err := createTestNetwork("bridge", "testnetwork", options.Generic{}, netOption)
+	controller, n, err := createTestController("bridge", "testnetwork", options.Generic{}, netOption)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1060,14 +1839,19 @@ func TestEnableIPv6(t *testing.T) {
 	resolvConfPath := "/tmp/libnetwork_test/resolv.conf"
 	defer os.Remove(resolvConfPath)
 
-	_, err = ep1.Join(containerID,
-		libnetwork.JoinOptionResolvConfPath(resolvConfPath))
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionResolvConfPath(resolvConfPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
 
+	err = ep1.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep1.Leave(containerID)
+		err = ep1.Leave(sb)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -1110,7 +1894,7 @@ func TestResolvConf(t *testing.T) {
 		}
 	}()
 
-	n, err := createTestNetwork("bridge", "testnetwork", options.Generic{}, options.Generic{})
+	controller, n, err := createTestController("bridge", "testnetwork", options.Generic{}, options.Generic{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1127,13 +1911,19 @@ func TestResolvConf(t *testing.T) {
 	resolvConfPath := "/tmp/libnetwork_test/resolv.conf"
 	defer os.Remove(resolvConfPath)
 
-	_, err = ep1.Join(containerID,
-		libnetwork.JoinOptionResolvConfPath(resolvConfPath))
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionResolvConfPath(resolvConfPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
+
+	err = ep1.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer func() {
-		err = ep1.Leave(containerID)
+		err = ep1.Leave(sb)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -1158,7 +1948,7 @@ func TestResolvConf(t *testing.T) {
 		t.Fatalf("Expected %s, Got %s", string(expectedResolvConf1), string(content))
 	}
 
-	err = ep1.Leave(containerID)
+	err = ep1.Leave(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1167,8 +1957,7 @@ func TestResolvConf(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ep1.Join(containerID,
-		libnetwork.JoinOptionResolvConfPath(resolvConfPath))
+	err = ep1.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1186,13 +1975,12 @@ func TestResolvConf(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = ep1.Leave(containerID)
+	err = ep1.Leave(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ep1.Join(containerID,
-		libnetwork.JoinOptionResolvConfPath(resolvConfPath))
+	err = ep1.Join(sb)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1207,6 +1995,88 @@ func TestResolvConf(t *testing.T) {
 	}
 }
 
+func TestResolvConfDNSOptions(t *testing.T) {
+	if !netutils.IsRunningInContainer() {
+		defer netutils.SetupTestNetNS(t)()
+	}
+
+	tmpResolvConf := []byte("nameserver 12.34.56.78\noptions ndots:1 timeout:2\n")
+	expectedResolvConf := []byte("nameserver 12.34.56.78\noptions ndots:5 timeout:2 edns0\n")
+
+	//take a copy of resolv.conf for restoring after test completes
+	resolvConfSystem, err := ioutil.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//cleanup
+	defer func() {
+		if err := ioutil.WriteFile("/etc/resolv.conf", resolvConfSystem, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := ioutil.WriteFile("/etc/resolv.conf", tmpResolvConf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	controller, n, err := createTestController("null", "testnetwork", options.Generic{}, options.Generic{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Delete()
+
+	ep1, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep1.Delete()
+
+	ep2, err := n.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep2.Delete()
+
+	resolvConfPath := "/tmp/libnetwork_test/resolv.conf"
+	defer os.Remove(resolvConfPath)
+
+	sb, err := controller.NewSandbox(containerID,
+		libnetwork.SandboxOptionResolvConfPath(resolvConfPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
+
+	err = ep2.Join(sb, libnetwork.JoinOptionDNSOptions("ndots:16"))
+	if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Expected a BadRequestError joining with an invalid DNS option, got %v", err)
+	}
+
+	if err := ep1.Join(sb, libnetwork.JoinOptionDNSOptions("ndots:5", "edns0")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, expectedResolvConf) {
+		t.Fatalf("Expected %s, Got %s", string(expectedResolvConf), string(content))
+	}
+
+	if err := ep1.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, tmpResolvConf) {
+		t.Fatalf("Expected %s, Got %s", string(tmpResolvConf), string(content))
+	}
+}
+
 func TestInvalidRemoteDriver(t *testing.T) {
 	if !netutils.IsRunningInContainer() {
 		t.Skip("Skipping test when not running inside a Container")
@@ -1277,6 +2147,14 @@ func TestValidRemoteDriver(t *testing.T) {
 		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1+json")
 		fmt.Fprintf(w, `{"Implements": ["%s"]}`, driverapi.NetworkPluginEndpointType)
 	})
+	mux.HandleFunc(fmt.Sprintf("/%s.GetCapabilities", driverapi.NetworkPluginEndpointType), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1+json")
+		fmt.Fprintf(w, `{"Scope": "local", "ProtocolVersion": 1}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/%s.CreateNetwork", driverapi.NetworkPluginEndpointType), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1+json")
+		fmt.Fprintf(w, "null")
+	})
 
 	if err := os.MkdirAll("/usr/share/docker/plugins", 0755); err != nil {
 		t.Fatal(err)
@@ -1299,15 +2177,23 @@ func TestValidRemoteDriver(t *testing.T) {
 	_, err = controller.NewNetwork("valid-network-driver", "dummy",
 		libnetwork.NetworkOptionGeneric(getEmptyGenericOption()))
 	if err != nil {
-		if _, ok := err.(*driverapi.ErrNotImplemented); !ok {
-			t.Fatal(err)
-		}
+		t.Fatal(err)
+	}
+
+	c, err := controller.DriverCapability("valid-network-driver")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Scope != driverapi.LocalScope {
+		t.Fatalf("Unexpected driver scope: %s", c.Scope)
 	}
 }
 
 var (
 	once   sync.Once
 	ctrlr  libnetwork.NetworkController
+	sbx    libnetwork.Sandbox
 	start  = make(chan struct{})
 	done   = make(chan chan struct{}, numThreads-1)
 	origns = netns.None()
@@ -1359,6 +2245,11 @@ func createGlobalInstance(t *testing.T) {
 	if err != nil {
 		t.Fatal("createendpoint")
 	}
+
+	sbx, err = ctrlr.NewSandbox("racing_container")
+	if err != nil {
+		t.Fatal("newsandbox")
+	}
 }
 
 func debugf(format string, a ...interface{}) (int, error) {
@@ -1371,7 +2262,7 @@ func debugf(format string, a ...interface{}) (int, error) {
 
 func parallelJoin(t *testing.T, ep libnetwork.Endpoint, thrNumber int) {
 	debugf("J%d.", thrNumber)
-	_, err := ep.Join("racing_container")
+	err := ep.Join(sbx)
 	runtime.LockOSThread()
 	if err != nil {
 		if _, ok := err.(libnetwork.ErrNoContainer); !ok {
@@ -1386,7 +2277,7 @@ func parallelJoin(t *testing.T, ep libnetwork.Endpoint, thrNumber int) {
 
 func parallelLeave(t *testing.T, ep libnetwork.Endpoint, thrNumber int) {
 	debugf("L%d.", thrNumber)
-	err := ep.Leave("racing_container")
+	err := ep.Leave(sbx)
 	runtime.LockOSThread()
 	if err != nil {
 		if _, ok := err.(libnetwork.ErrNoContainer); !ok {
@@ -1474,6 +2365,11 @@ func runParallelTests(t *testing.T, thrNumber int) {
 		}
 
 		testns.Close()
+		err = sbx.Delete()
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		err = ep.Delete()
 		if err != nil {
 			t.Fatal(err)
@@ -1,5 +1,7 @@
 package netlabel
 
+import "strings"
+
 const (
 	// GenericData constant that helps to identify an option as a Generic constant
 	GenericData = "io.docker.network.generic"
@@ -15,4 +17,32 @@ const (
 
 	//EnableIPv6 constant represents enabling IPV6 at network level
 	EnableIPv6 = "io.docker.network.enable_ipv6"
+
+	// IpamDriver constant represents the name of the IPAM driver of a network
+	IpamDriver = "io.docker.network.ipam.driver"
+
+	// Labels constant represents the user labels of a network or an endpoint
+	Labels = "io.docker.network.labels"
 )
+
+// Split returns the key and the value of a label in the key=value form.
+// The value of a label with no '=' is empty.
+func Split(label string) (key string, value string) {
+	kv := strings.SplitN(label, "=", 2)
+	if len(kv) == 1 {
+		return kv[0], ""
+	}
+	return kv[0], kv[1]
+}
+
+// Match returns whether the labels satisfy the filter, which is either in the
+// key=value form, matching the label with that value, or a bare key, matching
+// the label with any value.
+func Match(labels map[string]string, filter string) bool {
+	key, value := Split(filter)
+	v, ok := labels[key]
+	if !ok {
+		return false
+	}
+	return !strings.Contains(filter, "=") || v == value
+}
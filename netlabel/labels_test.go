@@ -0,0 +1,37 @@
+package netlabel
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	for label, expected := range map[string][2]string{
+		"key=value":  {"key", "value"},
+		"key=a=b":    {"key", "a=b"},
+		"key=":       {"key", ""},
+		"key":        {"key", ""},
+		"com.ex.k=v": {"com.ex.k", "v"},
+	} {
+		k, v := Split(label)
+		if k != expected[0] || v != expected[1] {
+			t.Fatalf("Split(%q) returned %q, %q", label, k, v)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	labels := map[string]string{"tier": "front", "public": ""}
+
+	for filter, expected := range map[string]bool{
+		"tier=front": true,
+		"tier=back":  false,
+		"tier":       true,
+		"public":     true,
+		"public=":    true,
+		"public=yes": false,
+		"missing":    false,
+		"tier=":      false,
+	} {
+		if Match(labels, filter) != expected {
+			t.Fatalf("Match(%q) should have returned %v", filter, expected)
+		}
+	}
+}
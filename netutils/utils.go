@@ -3,12 +3,14 @@
 package netutils
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 )
@@ -20,6 +22,8 @@ var (
 	ErrNetworkOverlaps = errors.New("requested network overlaps with existing network")
 	// ErrNoDefaultRoute preformatted error
 	ErrNoDefaultRoute = errors.New("no default route")
+	// ErrIfaceName preformatted error
+	ErrIfaceName = errors.New("failed to find name for new interface")
 
 	networkGetRoutesFct = netlink.RouteList
 )
@@ -147,3 +151,43 @@ func GenerateRandomName(prefix string, size int) (string, error) {
 	}
 	return prefix + hex.EncodeToString(id)[:size], nil
 }
+
+// GenerateIfaceName returns a name for a new interface, made of the prefix
+// followed by size random hex characters, which is not in use in the current
+// namespace. (example: veth0f60e2c)
+func GenerateIfaceName(prefix string, size int) (string, error) {
+	for i := 0; i < 3; i++ {
+		name, err := GenerateRandomName(prefix, size)
+		if err != nil {
+			continue
+		}
+		if _, err := net.InterfaceByName(name); err != nil {
+			if strings.Contains(err.Error(), "no such") {
+				return name, nil
+			}
+			return "", err
+		}
+	}
+	return "", ErrIfaceName
+}
+
+// LinkByMacAddress returns the link in the current namespace with the passed
+// hardware address and of the passed type, any type when empty, if any.
+func LinkByMacAddress(mac net.HardwareAddr, linkType string) netlink.Link {
+	if len(mac) == 0 {
+		return nil
+	}
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil
+	}
+
+	for _, link := range links {
+		if (linkType == "" || link.Type() == linkType) && bytes.Equal(link.Attrs().HardwareAddr, mac) {
+			return link
+		}
+	}
+
+	return nil
+}
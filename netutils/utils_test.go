@@ -209,3 +209,17 @@ func TestUtilGenerateRandomMAC(t *testing.T) {
 		t.Fatalf("mac1 %s should not equal mac2 %s", mac1, mac2)
 	}
 }
+
+// Test interface name generation skips the names in use
+func TestGenerateIfaceName(t *testing.T) {
+	name, err := GenerateIfaceName("veth", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(name) != 11 {
+		t.Fatalf("Expected 11 characters, instead received %d characters", len(name))
+	}
+	if _, err := net.InterfaceByName(name); err == nil {
+		t.Fatalf("Expected %s not to be in use", name)
+	}
+}
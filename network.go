@@ -3,6 +3,7 @@ package libnetwork
 import (
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/stringid"
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/netlabel"
@@ -22,9 +23,11 @@ type Network interface {
 	// The type of network, which corresponds to its managing driver.
 	Type() string
 
+	// Labels returns the labels the network was created with.
+	Labels() map[string]string
+
 	// Create a new endpoint to this network symbolically identified by the
 	// specified unique name. The options parameter carry driver specific options.
-	// Labels support will be added in the near future.
 	CreateEndpoint(name string, options ...EndpointOption) (Endpoint, error)
 
 	// Delete the network.
@@ -54,6 +57,8 @@ type network struct {
 	id          types.UUID
 	driver      driverapi.Driver
 	enableIPv6  bool
+	ipamType    string
+	labels      map[string]string
 	endpoints   endpointTable
 	generic     options.Generic
 	sync.Mutex
@@ -75,6 +80,13 @@ func (n *network) Type() string {
 	return n.driver.Type()
 }
 
+func (n *network) Labels() map[string]string {
+	n.Lock()
+	defer n.Unlock()
+
+	return copyLabels(n.labels)
+}
+
 // NetworkOption is a option setter function type used to pass varios options to
 // NewNetwork method. The various setter functions of type NetworkOption are
 // provided by libnetwork, they look like NetworkOptionXXXX(...)
@@ -91,6 +103,22 @@ func NetworkOptionGeneric(generic map[string]interface{}) NetworkOption {
 	}
 }
 
+// NetworkOptionIpam function returns an option setter for the IPAM driver
+// managing the address pools and addresses of the network
+func NetworkOptionIpam(ipamDriver string) NetworkOption {
+	return func(n *network) {
+		n.ipamType = ipamDriver
+	}
+}
+
+// NetworkOptionLabels function returns an option setter for the labels of
+// the network, which are also passed to the driver
+func NetworkOptionLabels(labels map[string]string) NetworkOption {
+	return func(n *network) {
+		n.labels = copyLabels(labels)
+	}
+}
+
 func (n *network) processOptions(options ...NetworkOption) {
 	for _, opt := range options {
 		if opt != nil {
@@ -128,7 +156,17 @@ func (n *network) Delete() error {
 	}()
 
 	err = n.driver.DeleteNetwork(n.id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if e := n.ctrlr.deleteFromStore(n); e != nil {
+		log.Warnf("Failed to delete network %s from the store: %v", n.name, e)
+	}
+
+	n.ctrlr.publishNetworkEvent(EventNetworkDelete, n)
+
+	return nil
 }
 
 func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoint, error) {
@@ -146,9 +184,19 @@ func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoi
 		return nil, err
 	}
 
+	if err := n.ctrlr.updateToStore(ep); err != nil {
+		if e := d.DeleteEndpoint(n.id, ep.id); e != nil {
+			log.Warnf("Failed to delete endpoint %s on store failure: %v", name, e)
+		}
+		return nil, err
+	}
+
 	n.Lock()
 	n.endpoints[ep.id] = ep
 	n.Unlock()
+
+	n.ctrlr.publishEndpointEvent(EventEndpointCreate, ep, "")
+
 	return ep, nil
 }
 
@@ -205,3 +253,16 @@ func (n *network) EndpointByID(id string) (Endpoint, error) {
 	}
 	return nil, ErrNoSuchEndpoint(id)
 }
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+
+	return c
+}
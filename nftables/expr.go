@@ -0,0 +1,286 @@
+package nftables
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Expression attributes, as defined by the kernel
+const (
+	nftaListElem = 1
+	nftaExprName = 1
+	nftaExprData = 2
+
+	nftaDataValue   = 1
+	nftaDataVerdict = 2
+
+	nftaVerdictCode  = 1
+	nftaVerdictChain = 2
+
+	nftaMetaDreg = 1
+	nftaMetaKey  = 2
+
+	nftaCmpSreg = 1
+	nftaCmpOp   = 2
+	nftaCmpData = 3
+
+	nftaPayloadDreg   = 1
+	nftaPayloadBase   = 2
+	nftaPayloadOffset = 3
+	nftaPayloadLen    = 4
+
+	nftaBitwiseSreg = 1
+	nftaBitwiseDreg = 2
+	nftaBitwiseLen  = 3
+	nftaBitwiseMask = 4
+	nftaBitwiseXor  = 5
+
+	nftaImmediateDreg = 1
+	nftaImmediateData = 2
+
+	nftaCtDreg = 1
+	nftaCtKey  = 2
+
+	nftaFibDreg   = 1
+	nftaFibResult = 2
+	nftaFibFlags  = 3
+
+	nftaNatType        = 1
+	nftaNatFamily      = 2
+	nftaNatRegAddrMin  = 3
+	nftaNatRegProtoMin = 5
+
+	nftRegVerdict = 0
+	nftReg1       = 1
+	nftReg2       = 2
+
+	nftMetaIIFName = 6
+	nftMetaOIFName = 7
+	nftMetaL4Proto = 16
+
+	nftPayloadNetworkHeader   = 1
+	nftPayloadTransportHeader = 2
+
+	nftCtState = 0
+
+	nftFibResultAddrType = 3
+	nftFibFlagSaddr      = 1
+	nftFibFlagDaddr      = 2
+	rtnLocal             = 2
+
+	nftNatDNAT = 1
+
+	verdictDrop   = 0
+	verdictAccept = 1
+	verdictJump   = -3
+
+	ifNameSize = 16
+)
+
+// CmpOp is the comparison operator of a match
+type CmpOp uint32
+
+const (
+	// Eq matches the packets equal to the value
+	Eq CmpOp = 0
+	// Neq matches the packets not equal to the value
+	Neq CmpOp = 1
+)
+
+// CtState is a bit of the conntrack state of a packet
+type CtState uint32
+
+const (
+	// Established matches the packets of established connections
+	Established CtState = 1 << 1
+	// Related matches the packets related to established connections
+	Related CtState = 1 << 2
+)
+
+// Expr is a sequence of kernel expressions matching or acting on a packet
+type Expr []*attr
+
+func expr(name string, attrs ...*attr) *attr {
+	elem := nestedAttr(nftaListElem, newAttr(nftaExprName, nl.ZeroTerminated(name)))
+	if len(attrs) > 0 {
+		elem.children = append(elem.children, nestedAttr(nftaExprData, attrs...))
+	}
+	return elem
+}
+
+func u32Attr(attrType int, v uint32) *attr {
+	return newAttr(attrType, be32(v))
+}
+
+func dataAttr(attrType int, value []byte) *attr {
+	return nestedAttr(attrType, newAttr(nftaDataValue, value))
+}
+
+func hostU32(v uint32) []byte {
+	b := make([]byte, 4)
+	nl.NativeEndian().PutUint32(b, v)
+	return b
+}
+
+func meta(key uint32) *attr {
+	return expr("meta", u32Attr(nftaMetaKey, key), u32Attr(nftaMetaDreg, nftReg1))
+}
+
+func cmp(op CmpOp, value []byte) *attr {
+	return expr("cmp", u32Attr(nftaCmpSreg, nftReg1), u32Attr(nftaCmpOp, uint32(op)), dataAttr(nftaCmpData, value))
+}
+
+func payload(base, offset, length uint32) *attr {
+	return expr("payload",
+		u32Attr(nftaPayloadDreg, nftReg1),
+		u32Attr(nftaPayloadBase, base),
+		u32Attr(nftaPayloadOffset, offset),
+		u32Attr(nftaPayloadLen, length))
+}
+
+func bitwise(mask []byte) *attr {
+	return expr("bitwise",
+		u32Attr(nftaBitwiseSreg, nftReg1),
+		u32Attr(nftaBitwiseDreg, nftReg1),
+		u32Attr(nftaBitwiseLen, uint32(len(mask))),
+		dataAttr(nftaBitwiseMask, mask),
+		dataAttr(nftaBitwiseXor, make([]byte, len(mask))))
+}
+
+func ifName(name string) []byte {
+	b := make([]byte, ifNameSize)
+	copy(b, name)
+	return b
+}
+
+// IIFName matches the name of the interface the packet came in from
+func IIFName(op CmpOp, name string) Expr {
+	return Expr{meta(nftMetaIIFName), cmp(op, ifName(name))}
+}
+
+// OIFName matches the name of the interface the packet goes out to
+func OIFName(op CmpOp, name string) Expr {
+	return Expr{meta(nftMetaOIFName), cmp(op, ifName(name))}
+}
+
+func address(op CmpOp, offset uint32, network *net.IPNet) Expr {
+	e := Expr{payload(nftPayloadNetworkHeader, offset, net.IPv4len)}
+	if ones, _ := network.Mask.Size(); ones != 32 {
+		e = append(e, bitwise(network.Mask))
+	}
+	return append(e, cmp(op, network.IP.Mask(network.Mask).To4()))
+}
+
+// Saddr matches the source address of the packet against a network
+func Saddr(op CmpOp, network *net.IPNet) Expr {
+	return address(op, 12, network)
+}
+
+// Daddr matches the destination address of the packet against a network
+func Daddr(op CmpOp, network *net.IPNet) Expr {
+	return address(op, 16, network)
+}
+
+// Proto matches the transport protocol, tcp, udp or sctp, of the packet. It must
+// precede the port matches.
+func Proto(proto string) Expr {
+	var p byte
+	switch proto {
+	case "tcp":
+		p = 6
+	case "udp":
+		p = 17
+	case "sctp":
+		p = 132
+	}
+	return Expr{meta(nftMetaL4Proto), cmp(Eq, []byte{p})}
+}
+
+func port(offset uint32, p int) Expr {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(p))
+	return Expr{payload(nftPayloadTransportHeader, offset, 2), cmp(Eq, b)}
+}
+
+// Sport matches the source port of the packet
+func Sport(p int) Expr {
+	return port(0, p)
+}
+
+// Dport matches the destination port of the packet
+func Dport(p int) Expr {
+	return port(2, p)
+}
+
+// Ct matches the packets in any of the passed conntrack states
+func Ct(state CtState) Expr {
+	return Expr{
+		expr("ct", u32Attr(nftaCtKey, nftCtState), u32Attr(nftaCtDreg, nftReg1)),
+		bitwise(hostU32(uint32(state))),
+		cmp(Neq, hostU32(0)),
+	}
+}
+
+func addrTypeLocal(flag uint32) Expr {
+	return Expr{
+		expr("fib", u32Attr(nftaFibDreg, nftReg1), u32Attr(nftaFibResult, nftFibResultAddrType), u32Attr(nftaFibFlags, flag)),
+		cmp(Eq, hostU32(rtnLocal)),
+	}
+}
+
+// SrcLocal matches the packets whose source address is local to the host
+func SrcLocal() Expr {
+	return addrTypeLocal(nftFibFlagSaddr)
+}
+
+// DstLocal matches the packets whose destination address is local to the host
+func DstLocal() Expr {
+	return addrTypeLocal(nftFibFlagDaddr)
+}
+
+func verdict(code int32, chain string) Expr {
+	v := nestedAttr(nftaDataVerdict, newAttr(nftaVerdictCode, be32(uint32(code))))
+	if chain != "" {
+		v.children = append(v.children, newAttr(nftaVerdictChain, nl.ZeroTerminated(chain)))
+	}
+	data := nestedAttr(nftaImmediateData, v)
+	return Expr{expr("immediate", u32Attr(nftaImmediateDreg, nftRegVerdict), data)}
+}
+
+// Accept accepts the packet
+func Accept() Expr {
+	return verdict(verdictAccept, "")
+}
+
+// Drop drops the packet
+func Drop() Expr {
+	return verdict(verdictDrop, "")
+}
+
+// Jump continues the evaluation of the packet in the passed chain
+func Jump(chain string) Expr {
+	return verdict(verdictJump, chain)
+}
+
+// Masquerade translates the source address of the packet to the address of
+// the interface it goes out to
+func Masquerade() Expr {
+	return Expr{expr("masq")}
+}
+
+// DNAT translates the destination of the packet to the passed address and port
+func DNAT(ip net.IP, p int) Expr {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(p))
+	return Expr{
+		expr("immediate", u32Attr(nftaImmediateDreg, nftReg1), dataAttr(nftaImmediateData, ip.To4())),
+		expr("immediate", u32Attr(nftaImmediateDreg, nftReg2), dataAttr(nftaImmediateData, b)),
+		expr("nat",
+			u32Attr(nftaNatType, nftNatDNAT),
+			u32Attr(nftaNatFamily, family),
+			u32Attr(nftaNatRegAddrMin, nftReg1),
+			u32Attr(nftaNatRegProtoMin, nftReg2)),
+	}
+}
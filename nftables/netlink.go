@@ -0,0 +1,251 @@
+package nftables
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Netlink constants of the nf_tables subsystem, as defined by the kernel
+const (
+	nfnlSubsysNftables = 10
+	nfnlMsgBatchBegin  = 0x10
+	nfnlMsgBatchEnd    = 0x11
+
+	nftMsgNewTable = 0
+	nftMsgDelTable = 2
+	nftMsgNewChain = 3
+	nftMsgDelChain = 5
+	nftMsgNewRule  = 6
+	nftMsgGetRule  = 7
+	nftMsgDelRule  = 8
+
+	nlaFNested  = 0x8000
+	nlaTypeMask = 0x3fff
+)
+
+var seq = uint32(time.Now().Unix())
+
+// attr is a netlink attribute, holding either data or nested attributes
+type attr struct {
+	attrType uint16
+	data     []byte
+	children []*attr
+}
+
+func newAttr(attrType int, data []byte) *attr {
+	return &attr{attrType: uint16(attrType), data: data}
+}
+
+// nestedAttr returns an attribute flagged as holding the passed attributes
+func nestedAttr(attrType int, children ...*attr) *attr {
+	return &attr{attrType: uint16(attrType | nlaFNested), children: children}
+}
+
+func (a *attr) serialize() []byte {
+	payload := a.data
+	for _, c := range a.children {
+		payload = append(payload, c.serialize()...)
+	}
+
+	b := make([]byte, nlaAlign(syscall.SizeofRtAttr+len(payload)))
+	nl.NativeEndian().PutUint16(b[0:2], uint16(syscall.SizeofRtAttr+len(payload)))
+	nl.NativeEndian().PutUint16(b[2:4], a.attrType)
+	copy(b[syscall.SizeofRtAttr:], payload)
+
+	return b
+}
+
+func nlaAlign(l int) int {
+	return (l + syscall.NLA_ALIGNTO - 1) & ^(syscall.NLA_ALIGNTO - 1)
+}
+
+// message is a netlink message of the nf_tables subsystem
+type message struct {
+	msgType uint16
+	flags   uint16
+	attrs   []*attr
+}
+
+func newMessage(msgType uint16, flags uint16, attrs ...*attr) *message {
+	return &message{msgType: msgType, flags: flags, attrs: attrs}
+}
+
+// serialize encodes the message with the nfgenmsg header of the passed
+// family and resource id.
+func (m *message) serialize(seq uint32, family uint8, resID uint16) []byte {
+	var payload []byte
+	for _, a := range m.attrs {
+		payload = append(payload, a.serialize()...)
+	}
+
+	b := make([]byte, syscall.NLMSG_HDRLEN+4, syscall.NLMSG_HDRLEN+4+len(payload))
+	native := nl.NativeEndian()
+	native.PutUint32(b[0:4], uint32(len(b)+len(payload)))
+	native.PutUint16(b[4:6], m.msgType)
+	native.PutUint16(b[6:8], m.flags)
+	native.PutUint32(b[8:12], seq)
+	b[16] = family
+	b[17] = 0 // NFNETLINK_V0
+	binary.BigEndian.PutUint16(b[18:20], resID)
+
+	return append(b, payload...)
+}
+
+func msgType(t int) uint16 {
+	return uint16(nfnlSubsysNftables<<8 | t)
+}
+
+// conn is a netlink socket of the netfilter family
+type conn struct {
+	fd int
+}
+
+func newConn() (*conn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &conn{fd: fd}, nil
+}
+
+func (c *conn) close() {
+	syscall.Close(c.fd)
+}
+
+func (c *conn) send(b []byte) error {
+	return syscall.Sendto(c.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+func (c *conn) receive() ([]syscall.NetlinkMessage, error) {
+	rb := make([]byte, syscall.Getpagesize()*16)
+	n, _, err := syscall.Recvfrom(c.fd, rb, 0)
+	if err != nil {
+		return nil, err
+	}
+	return syscall.ParseNetlinkMessage(rb[:n])
+}
+
+// errno returns the error carried by a NLMSG_ERROR message, nil for an ack
+func errno(m syscall.NetlinkMessage) error {
+	if len(m.Data) < 4 {
+		return fmt.Errorf("truncated netlink error message")
+	}
+	if e := int32(nl.NativeEndian().Uint32(m.Data[0:4])); e != 0 {
+		return syscall.Errno(-e)
+	}
+	return nil
+}
+
+// transact applies the passed messages atomically, as a single batch, and
+// returns the first error reported by the kernel.
+func transact(msgs ...*message) error {
+	c, err := newConn()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	begin := newMessage(nfnlMsgBatchBegin, syscall.NLM_F_REQUEST)
+	end := newMessage(nfnlMsgBatchEnd, syscall.NLM_F_REQUEST)
+
+	b := begin.serialize(atomic.AddUint32(&seq, 1), syscall.AF_UNSPEC, nfnlSubsysNftables)
+	for _, m := range msgs {
+		m.flags |= syscall.NLM_F_REQUEST | syscall.NLM_F_ACK
+		b = append(b, m.serialize(atomic.AddUint32(&seq, 1), family, 0)...)
+	}
+	b = append(b, end.serialize(atomic.AddUint32(&seq, 1), syscall.AF_UNSPEC, nfnlSubsysNftables)...)
+
+	if err := c.send(b); err != nil {
+		return err
+	}
+
+	// Every message of the batch is acknowledged, successfully or not
+	var firstErr error
+	for acks := 0; acks < len(msgs); {
+		replies, err := c.receive()
+		if err != nil {
+			return err
+		}
+		for _, r := range replies {
+			if r.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			acks++
+			if err := errno(r); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// dump sends the passed request as a dump and returns the attributes of the
+// returned objects.
+func dump(m *message) ([][]syscall.NetlinkRouteAttr, error) {
+	c, err := newConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	m.flags |= syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP
+	if err := c.send(m.serialize(atomic.AddUint32(&seq, 1), family, 0)); err != nil {
+		return nil, err
+	}
+
+	var objects [][]syscall.NetlinkRouteAttr
+	for {
+		replies, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range replies {
+			switch r.Header.Type {
+			case syscall.NLMSG_DONE:
+				return objects, nil
+			case syscall.NLMSG_ERROR:
+				if err := errno(r); err != nil {
+					return nil, err
+				}
+				return objects, nil
+			}
+
+			// Skip the nfgenmsg header
+			if len(r.Data) < 4 {
+				continue
+			}
+			attrs, err := nl.ParseRouteAttr(r.Data[4:])
+			if err != nil {
+				return nil, err
+			}
+			for i := range attrs {
+				attrs[i].Attr.Type &= nlaTypeMask
+			}
+			objects = append(objects, attrs)
+		}
+	}
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
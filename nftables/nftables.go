@@ -0,0 +1,429 @@
+// Package nftables programs the NAT and filter rules of the bridge networks
+// through the nf_tables netlink interface of the kernel. It mirrors the
+// chains of the iptables package without depending on any binary.
+package nftables
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/iptables"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Table refers to the Nat or Filter table.
+type Table string
+
+const (
+	// Nat table is used for nat translation rules.
+	Nat Table = "libnetwork-nat"
+	// Filter table is used for filter rules.
+	Filter Table = "libnetwork-filter"
+)
+
+// The tables only hold IPv4 rules, as the iptables ones
+const family = syscall.AF_INET
+
+// Table, chain and rule attributes, as defined by the kernel
+const (
+	nftaTableName = 1
+
+	nftaChainTable  = 1
+	nftaChainName   = 3
+	nftaChainHook   = 4
+	nftaChainPolicy = 5
+	nftaChainType   = 7
+
+	nftaHookHooknum  = 1
+	nftaHookPriority = 2
+
+	nftaRuleTable       = 1
+	nftaRuleChain       = 2
+	nftaRuleHandle      = 3
+	nftaRuleExpressions = 4
+	nftaRuleUserdata    = 7
+
+	// The comment type of the rule user data, as set by the nft tool
+	udataRuleComment = 0
+	maxKeyLen        = 127
+)
+
+// Netfilter hooks
+const (
+	hookPrerouting  = 0
+	hookForward     = 2
+	hookOutput      = 3
+	hookPostrouting = 4
+)
+
+type baseChain struct {
+	name      string
+	chainType string
+	hook      uint32
+	priority  int32
+}
+
+// baseChains are the chains of each table attached to the netfilter hooks,
+// named after their iptables counterparts.
+var baseChains = map[Table][]baseChain{
+	Nat: {
+		{"PREROUTING", "nat", hookPrerouting, -100},
+		{"OUTPUT", "nat", hookOutput, -100},
+		{"POSTROUTING", "nat", hookPostrouting, 100},
+	},
+	Filter: {
+		{"FORWARD", "filter", hookForward, 0},
+	},
+}
+
+// lock serializes the check and the programming of the rules
+var lock sync.Mutex
+
+// Chain defines the nftables chain.
+type Chain struct {
+	Name   string
+	Bridge string
+	Table  Table
+}
+
+// Rule is a rule of a chain. Key identifies the rule in the chain and is
+// stored as the rule comment.
+type Rule struct {
+	Key   string
+	Exprs []Expr
+}
+
+// NewRule returns the rule with the passed key and expressions
+func NewRule(key string, exprs ...Expr) *Rule {
+	return &Rule{Key: key, Exprs: exprs}
+}
+
+// ChainError is returned to represent errors during nftables operation.
+type ChainError struct {
+	Chain string
+	Err   error
+}
+
+func (e ChainError) Error() string {
+	return fmt.Sprintf("Error nftables %s: %v", e.Chain, e.Err)
+}
+
+func (t Table) check() error {
+	if _, ok := baseChains[t]; !ok {
+		return fmt.Errorf("unknown nftables table %q", string(t))
+	}
+	return nil
+}
+
+// setupTable creates the table and its base chains if they do not exist
+func setupTable(table Table) error {
+	if err := table.check(); err != nil {
+		return err
+	}
+
+	msgs := []*message{newMessage(msgType(nftMsgNewTable), syscall.NLM_F_CREATE,
+		newAttr(nftaTableName, nl.ZeroTerminated(string(table))))}
+
+	for _, c := range baseChains[table] {
+		msgs = append(msgs, newMessage(msgType(nftMsgNewChain), syscall.NLM_F_CREATE,
+			newAttr(nftaChainTable, nl.ZeroTerminated(string(table))),
+			newAttr(nftaChainName, nl.ZeroTerminated(c.name)),
+			nestedAttr(nftaChainHook,
+				newAttr(nftaHookHooknum, be32(c.hook)),
+				newAttr(nftaHookPriority, be32(uint32(c.priority)))),
+			newAttr(nftaChainPolicy, be32(verdictAccept)),
+			newAttr(nftaChainType, nl.ZeroTerminated(c.chainType))))
+	}
+
+	return transact(msgs...)
+}
+
+// DeleteTable removes the table with all its chains and rules.
+func DeleteTable(table Table) error {
+	err := transact(newMessage(msgType(nftMsgDelTable), 0,
+		newAttr(nftaTableName, nl.ZeroTerminated(string(table)))))
+	if err == syscall.ENOENT {
+		return nil
+	}
+	return err
+}
+
+// NewChain adds a new chain to the nftables table.
+func NewChain(name, bridge string, table Table, hairpinMode bool) (*Chain, error) {
+	c := &Chain{
+		Name:   name,
+		Bridge: bridge,
+		Table:  table,
+	}
+
+	if string(c.Table) == "" {
+		c.Table = Filter
+	}
+
+	if err := setupTable(c.Table); err != nil {
+		return nil, fmt.Errorf("Could not create %s table: %v", c.Table, err)
+	}
+
+	// Add chain if it doesn't exist
+	if err := transact(newMessage(msgType(nftMsgNewChain), syscall.NLM_F_CREATE,
+		newAttr(nftaChainTable, nl.ZeroTerminated(string(c.Table))),
+		newAttr(nftaChainName, nl.ZeroTerminated(c.Name)))); err != nil {
+		return nil, fmt.Errorf("Could not create %s/%s chain: %v", c.Table, c.Name, err)
+	}
+
+	switch c.Table {
+	case Nat:
+		if err := c.Prerouting(iptables.Append); err != nil {
+			return nil, fmt.Errorf("Failed to inject docker in PREROUTING chain: %s", err)
+		}
+		if err := c.Output(iptables.Append, hairpinMode); err != nil {
+			return nil, fmt.Errorf("Failed to inject docker in OUTPUT chain: %s", err)
+		}
+	case Filter:
+		link := NewRule(fmt.Sprintf("-o %s -j %s", c.Bridge, c.Name), OIFName(Eq, c.Bridge), Jump(c.Name))
+		if err := Program(iptables.Insert, Filter, "FORWARD", link); err != nil {
+			return nil, fmt.Errorf("Could not create linking rule to %s/%s: %v", c.Table, c.Name, err)
+		}
+	}
+	return c, nil
+}
+
+// RemoveExistingChain removes existing chain from the table.
+func RemoveExistingChain(name string, table Table) error {
+	c := &Chain{
+		Name:  name,
+		Table: table,
+	}
+	if string(c.Table) == "" {
+		c.Table = Filter
+	}
+	return c.Remove()
+}
+
+// Forward adds forwarding rule to 'filter' table and corresponding nat rule to 'nat' table.
+func (c *Chain) Forward(action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int) error {
+	dest := net.ParseIP(destAddr)
+	if dest == nil || dest.To4() == nil {
+		return fmt.Errorf("invalid destination address %q", destAddr)
+	}
+	destNet := &net.IPNet{IP: dest, Mask: net.CIDRMask(32, 32)}
+	target := net.JoinHostPort(destAddr, strconv.Itoa(destPort))
+
+	dnat := NewRule(fmt.Sprintf("-p %s -d %s --dport %d -j DNAT --to-destination %s", proto, ip, port, target))
+	if !ip.IsUnspecified() {
+		dnat.Exprs = append(dnat.Exprs, Daddr(Eq, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}))
+	}
+	dnat.Exprs = append(dnat.Exprs, Proto(proto), Dport(port), DNAT(dest, destPort))
+	if err := Program(action, Nat, c.Name, dnat); err != nil {
+		return ChainError{Chain: "FORWARD", Err: err}
+	}
+
+	accept := NewRule(fmt.Sprintf("! -i %s -o %s -p %s -d %s --dport %d -j ACCEPT", c.Bridge, c.Bridge, proto, destAddr, destPort),
+		IIFName(Neq, c.Bridge), OIFName(Eq, c.Bridge), Daddr(Eq, destNet), Proto(proto), Dport(destPort), Accept())
+	if err := Program(action, Filter, c.Name, accept); err != nil {
+		return ChainError{Chain: "FORWARD", Err: err}
+	}
+
+	masq := NewRule(fmt.Sprintf("-p %s -s %s -d %s --dport %d -j MASQUERADE", proto, destAddr, destAddr, destPort),
+		Saddr(Eq, destNet), Daddr(Eq, destNet), Proto(proto), Dport(destPort), Masquerade())
+	if err := Program(action, Nat, "POSTROUTING", masq); err != nil {
+		return ChainError{Chain: "FORWARD", Err: err}
+	}
+
+	return nil
+}
+
+// Link adds reciprocal ACCEPT rule for two supplied IP addresses.
+// Traffic is allowed from ip1 to ip2 and vice-versa
+func (c *Chain) Link(action iptables.Action, ip1, ip2 net.IP, port int, proto string) error {
+	net1 := &net.IPNet{IP: ip1, Mask: net.CIDRMask(32, 32)}
+	net2 := &net.IPNet{IP: ip2, Mask: net.CIDRMask(32, 32)}
+
+	for _, r := range []*Rule{
+		NewRule(fmt.Sprintf("-i %s -o %s -p %s -s %s -d %s --dport %d -j ACCEPT", c.Bridge, c.Bridge, proto, ip1, ip2, port),
+			IIFName(Eq, c.Bridge), OIFName(Eq, c.Bridge), Saddr(Eq, net1), Daddr(Eq, net2), Proto(proto), Dport(port), Accept()),
+		NewRule(fmt.Sprintf("-i %s -o %s -p %s -s %s -d %s --sport %d -j ACCEPT", c.Bridge, c.Bridge, proto, ip2, ip1, port),
+			IIFName(Eq, c.Bridge), OIFName(Eq, c.Bridge), Saddr(Eq, net2), Daddr(Eq, net1), Proto(proto), Sport(port), Accept()),
+	} {
+		if err := Program(action, Filter, c.Name, r); err != nil {
+			return fmt.Errorf("Error nftables forward: %v", err)
+		}
+	}
+	return nil
+}
+
+// Prerouting adds linking rule to nat/PREROUTING chain.
+func (c *Chain) Prerouting(action iptables.Action) error {
+	rule := NewRule(fmt.Sprintf("-m addrtype --dst-type LOCAL -j %s", c.Name), DstLocal(), Jump(c.Name))
+	if err := Program(action, Nat, "PREROUTING", rule); err != nil {
+		return ChainError{Chain: "PREROUTING", Err: err}
+	}
+	return nil
+}
+
+// Output adds linking rule to nat/OUTPUT chain. Unless in hairpin mode, the
+// traffic to the loopback addresses is not translated.
+func (c *Chain) Output(action iptables.Action, hairpinMode bool) error {
+	rule := NewRule(fmt.Sprintf("-m addrtype --dst-type LOCAL -j %s", c.Name), DstLocal(), Jump(c.Name))
+	if !hairpinMode {
+		_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+		rule = NewRule(fmt.Sprintf("-m addrtype --dst-type LOCAL ! --dst 127.0.0.0/8 -j %s", c.Name),
+			DstLocal(), Daddr(Neq, loopback), Jump(c.Name))
+	}
+	if err := Program(action, Nat, "OUTPUT", rule); err != nil {
+		return ChainError{Chain: "OUTPUT", Err: err}
+	}
+	return nil
+}
+
+// Remove removes the chain.
+func (c *Chain) Remove() error {
+	// Ignore errors - This could mean the chains were never set up
+	switch c.Table {
+	case Nat:
+		c.Prerouting(iptables.Delete)
+		c.Output(iptables.Delete, false)
+		c.Output(iptables.Delete, true)
+	case Filter:
+		if c.Bridge != "" {
+			Program(iptables.Delete, Filter, "FORWARD", NewRule(fmt.Sprintf("-o %s -j %s", c.Bridge, c.Name)))
+		}
+	}
+
+	transact(newMessage(msgType(nftMsgDelRule), 0,
+		newAttr(nftaRuleTable, nl.ZeroTerminated(string(c.Table))),
+		newAttr(nftaRuleChain, nl.ZeroTerminated(c.Name))))
+	transact(newMessage(msgType(nftMsgDelChain), 0,
+		newAttr(nftaChainTable, nl.ZeroTerminated(string(c.Table))),
+		newAttr(nftaChainName, nl.ZeroTerminated(c.Name))))
+	return nil
+}
+
+// Program appends, inserts or deletes the rule of the chain. The rule is
+// added only if no rule with the same key exists, the table and its base
+// chains being created if needed. Only the key of the rule is needed for a
+// deletion.
+func Program(action iptables.Action, table Table, chain string, rule *Rule) error {
+	if err := table.check(); err != nil {
+		return err
+	}
+
+	if len(rule.Key) > maxKeyLen {
+		return fmt.Errorf("nftables rule key too long: %s", rule.Key)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	handles, err := ruleHandles(table, chain, rule.Key)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("nftables %s %s/%s: %s", action, table, chain, rule.Key)
+
+	switch action {
+	case iptables.Append, iptables.Insert:
+		if len(handles) > 0 {
+			return nil
+		}
+		if err := setupTable(table); err != nil {
+			return err
+		}
+		return addRule(table, chain, rule, action == iptables.Append)
+	case iptables.Delete:
+		if len(handles) == 0 {
+			return nil
+		}
+		msgs := make([]*message, 0, len(handles))
+		for _, h := range handles {
+			msgs = append(msgs, newMessage(msgType(nftMsgDelRule), 0,
+				newAttr(nftaRuleTable, nl.ZeroTerminated(string(table))),
+				newAttr(nftaRuleChain, nl.ZeroTerminated(chain)),
+				newAttr(nftaRuleHandle, be64(h))))
+		}
+		return transact(msgs...)
+	}
+
+	return fmt.Errorf("invalid nftables action %q", string(action))
+}
+
+// Exists checks if a rule with the passed key exists
+func Exists(table Table, chain string, key string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	handles, err := ruleHandles(table, chain, key)
+	return err == nil && len(handles) > 0
+}
+
+func addRule(table Table, chain string, rule *Rule, appendRule bool) error {
+	exprs := nestedAttr(nftaRuleExpressions)
+	for _, e := range rule.Exprs {
+		exprs.children = append(exprs.children, e...)
+	}
+
+	var flags uint16 = syscall.NLM_F_CREATE
+	if appendRule {
+		flags |= syscall.NLM_F_APPEND
+	}
+
+	return transact(newMessage(msgType(nftMsgNewRule), flags,
+		newAttr(nftaRuleTable, nl.ZeroTerminated(string(table))),
+		newAttr(nftaRuleChain, nl.ZeroTerminated(chain)),
+		exprs,
+		newAttr(nftaRuleUserdata, comment(rule.Key))))
+}
+
+// comment encodes the key as the user data comment of a rule
+func comment(key string) []byte {
+	return append([]byte{udataRuleComment, byte(len(key) + 1)}, nl.ZeroTerminated(key)...)
+}
+
+// ruleHandles returns the handles of the rules of the chain with the passed key
+func ruleHandles(table Table, chain, key string) ([]uint64, error) {
+	rules, err := dump(newMessage(msgType(nftMsgGetRule), 0,
+		newAttr(nftaRuleTable, nl.ZeroTerminated(string(table))),
+		newAttr(nftaRuleChain, nl.ZeroTerminated(chain))))
+	if err != nil {
+		if err == syscall.ENOENT {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var (
+		handles []uint64
+		want    = comment(key)
+	)
+	for _, attrs := range rules {
+		var (
+			handle  uint64
+			inChain bool
+			match   bool
+		)
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case nftaRuleChain:
+				inChain = string(bytes.TrimRight(a.Value, "\x00")) == chain
+			case nftaRuleHandle:
+				if len(a.Value) == 8 {
+					handle = binary.BigEndian.Uint64(a.Value)
+				}
+			case nftaRuleUserdata:
+				match = bytes.Equal(a.Value, want)
+			}
+		}
+		if inChain && match {
+			handles = append(handles, handle)
+		}
+	}
+
+	return handles, nil
+}
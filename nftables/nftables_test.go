@@ -0,0 +1,247 @@
+package nftables
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/vishvananda/netlink"
+)
+
+const chainName = "DOCKEREST"
+
+func TestNewChain(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	natChain, err := NewChain(chainName, "lo", Nat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Exists(Nat, "PREROUTING", "-m addrtype --dst-type LOCAL -j "+chainName) {
+		t.Fatalf("PREROUTING linking rule does not exist")
+	}
+
+	if !Exists(Nat, "OUTPUT", "-m addrtype --dst-type LOCAL ! --dst 127.0.0.0/8 -j "+chainName) {
+		t.Fatalf("OUTPUT linking rule does not exist")
+	}
+
+	filterChain, err := NewChain(chainName, "lo", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Exists(Filter, "FORWARD", "-o lo -j "+chainName) {
+		t.Fatalf("FORWARD linking rule does not exist")
+	}
+
+	// Creating the chains again does not duplicate the linking rules
+	if _, err := NewChain(chainName, "lo", Filter, false); err != nil {
+		t.Fatal(err)
+	}
+
+	handles, err := ruleHandles(Filter, "FORWARD", "-o lo -j "+chainName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handles) != 1 {
+		t.Fatalf("Expected one FORWARD linking rule, found %d", len(handles))
+	}
+
+	if err := natChain.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := filterChain.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if Exists(Nat, "PREROUTING", "-m addrtype --dst-type LOCAL -j "+chainName) {
+		t.Fatalf("PREROUTING linking rule still exists")
+	}
+
+	if Exists(Filter, "FORWARD", "-o lo -j "+chainName) {
+		t.Fatalf("FORWARD linking rule still exists")
+	}
+}
+
+func TestForward(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	if _, err := NewChain(chainName, "lo", Nat, false); err != nil {
+		t.Fatal(err)
+	}
+
+	filterChain, err := NewChain(chainName, "lo", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("192.168.1.1")
+	dnatKey := "-p tcp -d 192.168.1.1 --dport 1234 -j DNAT --to-destination 172.17.0.1:4321"
+	filterKey := "! -i lo -o lo -p tcp -d 172.17.0.1 --dport 4321 -j ACCEPT"
+	masqKey := "-p tcp -s 172.17.0.1 -d 172.17.0.1 --dport 4321 -j MASQUERADE"
+
+	if err := filterChain.Forward(iptables.Insert, ip, 1234, "tcp", "172.17.0.1", 4321); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Exists(Nat, chainName, dnatKey) {
+		t.Fatalf("DNAT rule does not exist")
+	}
+
+	if !Exists(Filter, chainName, filterKey) {
+		t.Fatalf("filter rule does not exist")
+	}
+
+	if !Exists(Nat, "POSTROUTING", masqKey) {
+		t.Fatalf("MASQUERADE rule does not exist")
+	}
+
+	if err := filterChain.Forward(iptables.Delete, ip, 1234, "tcp", "172.17.0.1", 4321); err != nil {
+		t.Fatal(err)
+	}
+
+	if Exists(Nat, chainName, dnatKey) || Exists(Filter, chainName, filterKey) || Exists(Nat, "POSTROUTING", masqKey) {
+		t.Fatalf("Forwarding rules still exist after the deletion")
+	}
+}
+
+func TestLink(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	filterChain, err := NewChain(chainName, "lo", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip1 := net.ParseIP("192.168.1.1")
+	ip2 := net.ParseIP("192.168.1.2")
+
+	if err := filterChain.Link(iptables.Append, ip1, ip2, 1234, "tcp"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"-i lo -o lo -p tcp -s 192.168.1.1 -d 192.168.1.2 --dport 1234 -j ACCEPT",
+		"-i lo -o lo -p tcp -s 192.168.1.2 -d 192.168.1.1 --sport 1234 -j ACCEPT",
+	} {
+		if !Exists(Filter, chainName, key) {
+			t.Fatalf("rule %q does not exist", key)
+		}
+	}
+}
+
+// TestDNAT checks the translation of the locally generated traffic to a
+// forwarded port.
+func TestDNAT(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(lo); err != nil {
+		t.Fatal(err)
+	}
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "nftest0"}, PeerName: "nftest1"}
+	if err := netlink.LinkAdd(veth); err != nil {
+		t.Fatal(err)
+	}
+	link, err := netlink.LinkByName("nftest0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := netlink.ParseAddr("10.99.0.1/24")
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "10.99.0.1:4321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(c, "hello")
+			c.Close()
+		}
+	}()
+
+	if _, err := NewChain(chainName, "nftest0", Nat, false); err != nil {
+		t.Fatal(err)
+	}
+	filterChain, err := NewChain(chainName, "nftest0", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := net.DialTimeout("tcp", "10.99.0.1:1234", time.Second); err == nil {
+		t.Fatalf("Unexpected connection to the port before its forwarding")
+	}
+
+	if err := filterChain.Forward(iptables.Append, net.IPv4zero, 1234, "tcp", "10.99.0.1", 4321); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.DialTimeout("tcp", "10.99.0.1:1234", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect to the forwarded port: %v", err)
+	}
+	defer c.Close()
+
+	buf := make([]byte, 5)
+	if _, err := c.Read(buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Unexpected reply %q from the forwarded port: %v", buf, err)
+	}
+}
+
+func TestDeleteTable(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	if _, err := NewChain(chainName, "lo", Filter, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteTable(Filter); err != nil {
+		t.Fatal(err)
+	}
+
+	if Exists(Filter, "FORWARD", "-o lo -j "+chainName) {
+		t.Fatalf("FORWARD linking rule still exists after the table deletion")
+	}
+
+	// Deleting a missing table is not an error
+	if err := DeleteTable(Filter); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProgramMissingChain(t *testing.T) {
+	defer netutils.SetupTestNetNS(t)()
+
+	if _, err := NewChain(chainName, "lo", Filter, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Program(iptables.Append, Filter, "MISSING", NewRule("-j ACCEPT", Accept())); err == nil {
+		t.Fatalf("Expected failure adding a rule to a missing chain")
+	}
+
+	if err := Program(iptables.Append, Table("raw"), "FORWARD", NewRule("-j ACCEPT", Accept())); err == nil {
+		t.Fatalf("Expected failure adding a rule to an unknown table")
+	}
+}
@@ -3,6 +3,7 @@
 package options
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 )
@@ -29,6 +30,18 @@ func (e CannotSetFieldError) Error() string {
 	return fmt.Sprintf("cannot set field %q of type %q", e.Field, e.Type)
 }
 
+// TypeMismatchError is the error returned when the generic parameters hold a
+// value which cannot be converted to the type of the destination field.
+type TypeMismatchError struct {
+	Field        string
+	ExpectedType string
+	ActualType   string
+}
+
+func (e TypeMismatchError) Error() string {
+	return fmt.Sprintf("type mismatch, field %s require type %v, actual type %v", e.Field, e.ExpectedType, e.ActualType)
+}
+
 // Generic is an basic type to store arbitrary settings.
 type Generic map[string]interface{}
 
@@ -62,7 +75,13 @@ func GenerateFromModel(options Generic, model interface{}) (interface{}, error)
 		if !field.CanSet() {
 			return nil, CannotSetFieldError{name, resType.String()}
 		}
-		field.Set(reflect.ValueOf(value))
+		// A nil value leaves the field to its zero value.
+		if value == nil {
+			continue
+		}
+		if err := setField(field, name, value); err != nil {
+			return nil, err
+		}
 	}
 
 	// If the model is not of pointer type, return content of the result.
@@ -71,3 +90,26 @@ func GenerateFromModel(options Generic, model interface{}) (interface{}, error)
 	}
 	return res.Elem().Interface(), nil
 }
+
+// setField assigns value to field. Values which are not assignable to the
+// field type, such as the generic maps and numbers produced when options are
+// decoded from JSON, are converted through a JSON round trip.
+func setField(field reflect.Value, name string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return nil
+	}
+
+	mismatch := TypeMismatchError{Field: name, ExpectedType: field.Type().String(), ActualType: v.Type().String()}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return mismatch
+	}
+	conv := reflect.New(field.Type())
+	if err := json.Unmarshal(b, conv.Interface()); err != nil {
+		return mismatch
+	}
+	field.Set(conv.Elem())
+	return nil
+}
@@ -1,6 +1,8 @@
 package options
 
 import (
+	"encoding/json"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
@@ -95,3 +97,54 @@ func TestFieldCannotBeSet(t *testing.T) {
 		t.Fatalf("expected %q in error message, got %s", expected, err.Error())
 	}
 }
+
+func TestGenerateFromJSON(t *testing.T) {
+	type Model struct {
+		Int     int
+		Name    string
+		Address *net.IPNet
+		Gateway net.IP
+		Unset   *net.IPNet
+	}
+
+	_, ipNet, _ := net.ParseCIDR("172.17.0.0/16")
+	orig := Model{Int: 42, Name: "foo", Address: ipNet, Gateway: net.ParseIP("172.17.0.1")}
+
+	b, err := json.Marshal(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gen Generic
+	if err := json.Unmarshal(b, &gen); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GenerateFromModel(gen, &Model{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cast := result.(*Model)
+	if cast.Int != orig.Int || cast.Name != orig.Name {
+		t.Fatalf("wrong values: expected %v, got %v", orig, cast)
+	}
+	if cast.Address == nil || cast.Address.String() != ipNet.String() {
+		t.Fatalf("wrong value for field Address: expected %v, got %v", ipNet, cast.Address)
+	}
+	if !cast.Gateway.Equal(orig.Gateway) {
+		t.Fatalf("wrong value for field Gateway: expected %v, got %v", orig.Gateway, cast.Gateway)
+	}
+	if cast.Unset != nil {
+		t.Fatalf("expected nil field Unset, got %v", cast.Unset)
+	}
+}
+
+func TestTypeMismatchError(t *testing.T) {
+	type Model struct{ Int int }
+	_, err := GenerateFromModel(Generic{"Int": "bar"}, Model{})
+
+	if _, ok := err.(TypeMismatchError); !ok {
+		t.Fatalf("expected TypeMismatchError, got %#v", err)
+	}
+}
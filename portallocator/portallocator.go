@@ -25,10 +25,12 @@ var (
 	ErrAllPortsAllocated = errors.New("all ports are allocated")
 	// ErrUnknownProtocol is returned when an unknown protocol was specified
 	ErrUnknownProtocol = errors.New("unknown protocol")
-	defaultIP          = net.ParseIP("0.0.0.0")
-	once               sync.Once
-	instance           *PortAllocator
-	createInstance     = func() { instance = newInstance() }
+	// ErrInvalidPortRange is returned when a range of ports does not fit in the ports space
+	ErrInvalidPortRange = errors.New("invalid port range")
+	defaultIP           = net.ParseIP("0.0.0.0")
+	once                sync.Once
+	instance            *PortAllocator
+	createInstance      = func() { instance = newInstance() }
 )
 
 // ErrPortAlreadyAllocated is the returned error information when a requested port is already being used
@@ -125,13 +127,26 @@ func getDynamicPortRange() (start int, end int, err error) {
 // If port is 0 it returns first free port. Otherwise it checks port availability
 // in pool and return that port or error if port is already busy.
 func (p *PortAllocator) RequestPort(ip net.IP, proto string, port int) (int, error) {
+	return p.RequestPortsInRange(ip, proto, port, 1)
+}
+
+// RequestPortsInRange requests the contiguous range of count ports starting
+// at port from global ports pool for specified ip and proto, and returns its
+// first port. If port is 0 it returns the first free range of the pool.
+// Otherwise it checks the availability of all the ports of the range, and
+// reserves none of them if one is already busy.
+func (p *PortAllocator) RequestPortsInRange(ip net.IP, proto string, port, count int) (int, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if proto != "tcp" && proto != "udp" {
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
 		return 0, ErrUnknownProtocol
 	}
 
+	if count < 1 || port < 0 || port+count-1 > 65535 {
+		return 0, ErrInvalidPortRange
+	}
+
 	if ip == nil {
 		ip = defaultIP
 	}
@@ -139,19 +154,28 @@ func (p *PortAllocator) RequestPort(ip net.IP, proto string, port int) (int, err
 	protomap, ok := p.ipMap[ipstr]
 	if !ok {
 		protomap = protoMap{
-			"tcp": p.newPortMap(),
-			"udp": p.newPortMap(),
+			"tcp":  p.newPortMap(),
+			"udp":  p.newPortMap(),
+			"sctp": p.newPortMap(),
 		}
 
 		p.ipMap[ipstr] = protomap
 	}
 	mapping := protomap[proto]
 	if port > 0 {
-		if _, ok := mapping.p[port]; !ok {
-			mapping.p[port] = struct{}{}
-			return port, nil
+		for i := port; i < port+count; i++ {
+			if _, ok := mapping.p[i]; ok {
+				return 0, newErrPortAlreadyAllocated(ipstr, i)
+			}
+		}
+		for i := port; i < port+count; i++ {
+			mapping.p[i] = struct{}{}
 		}
-		return 0, newErrPortAlreadyAllocated(ipstr, port)
+		return port, nil
+	}
+
+	if count > 1 {
+		return mapping.findRange(count)
 	}
 
 	port, err := mapping.findPort()
@@ -163,6 +187,12 @@ func (p *PortAllocator) RequestPort(ip net.IP, proto string, port int) (int, err
 
 // ReleasePort releases port from global ports pool for specified ip and proto.
 func (p *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
+	return p.ReleasePortsInRange(ip, proto, port, 1)
+}
+
+// ReleasePortsInRange releases the range of count ports starting at port
+// from global ports pool for specified ip and proto.
+func (p *PortAllocator) ReleasePortsInRange(ip net.IP, proto string, port, count int) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -173,7 +203,9 @@ func (p *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
 	if !ok {
 		return nil
 	}
-	delete(protomap[proto].p, port)
+	for i := port; i < port+count; i++ {
+		delete(protomap[proto].p, i)
+	}
 	return nil
 }
 
@@ -210,3 +242,36 @@ func (pm *portMap) findPort() (int, error) {
 	}
 	return 0, ErrAllPortsAllocated
 }
+
+// findRange reserves the first free range of count ports following the
+// last allocated port
+func (pm *portMap) findRange(count int) (int, error) {
+	last := pm.end - count + 1
+	if last < pm.begin {
+		return 0, ErrAllPortsAllocated
+	}
+
+	port := pm.last
+	for i := 0; i <= last-pm.begin; i++ {
+		port++
+		if port > last {
+			port = pm.begin
+		}
+
+		free := true
+		for j := port; j < port+count; j++ {
+			if _, ok := pm.p[j]; ok {
+				free = false
+				break
+			}
+		}
+		if free {
+			for j := port; j < port+count; j++ {
+				pm.p[j] = struct{}{}
+			}
+			pm.last = port + count - 1
+			return port, nil
+		}
+	}
+	return 0, ErrAllPortsAllocated
+}
@@ -104,6 +104,34 @@ func TestUnknowProtocol(t *testing.T) {
 	}
 }
 
+func TestRequestSCTPPort(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	port, err := p.RequestPort(defaultIP, "sctp", 3868)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 3868 {
+		t.Fatalf("Expected port 3868 got %d", port)
+	}
+
+	// The SCTP ports are allocated independently of the TCP ones
+	if _, err := p.RequestPort(defaultIP, "tcp", 3868); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(defaultIP, "sctp", 3868); err == nil {
+		t.Fatalf("Expected SCTP port 3868 to be already allocated")
+	}
+
+	if err := p.ReleasePort(defaultIP, "sctp", 3868); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(defaultIP, "sctp", 3868); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAllocateAllPorts(t *testing.T) {
 	p := Get()
 	defer resetPortAllocator()
@@ -252,3 +280,84 @@ func TestNoDuplicateBPR(t *testing.T) {
 		t.Fatalf("Acquire(0) allocated the same port twice: %d", port)
 	}
 }
+
+func TestRequestPortsInRange(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	port, err := p.RequestPortsInRange(defaultIP, "tcp", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != p.Begin {
+		t.Fatalf("Expected port %d got %d", p.Begin, port)
+	}
+
+	// The following range starts after the allocated one
+	port, err = p.RequestPortsInRange(defaultIP, "tcp", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != p.Begin+10 {
+		t.Fatalf("Expected port %d got %d", p.Begin+10, port)
+	}
+
+	// A range overlapping an allocated port is not reserved at all
+	if _, err := p.RequestPort(defaultIP, "tcp", 5005); err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.RequestPortsInRange(defaultIP, "tcp", 5000, 10)
+	if e, ok := err.(ErrPortAlreadyAllocated); !ok || e.Port() != 5005 {
+		t.Fatalf("Expected port 5005 already allocated error, got: %v", err)
+	}
+	if port, err := p.RequestPort(defaultIP, "tcp", 5000); err != nil || port != 5000 {
+		t.Fatalf("Expected port 5000 to be available, got %d: %v", port, err)
+	}
+
+	port, err = p.RequestPortsInRange(defaultIP, "tcp", 6000, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 6000 {
+		t.Fatalf("Expected port 6000 got %d", port)
+	}
+
+	if err := p.ReleasePortsInRange(defaultIP, "tcp", 6000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPortsInRange(defaultIP, "tcp", 6500, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range [][2]int{{65000, 1000}, {6000, 0}} {
+		if _, err := p.RequestPortsInRange(defaultIP, "tcp", r[0], r[1]); err != ErrInvalidPortRange {
+			t.Fatalf("Expected error %s for range %v got %v", ErrInvalidPortRange, r, err)
+		}
+	}
+}
+
+func TestRequestPortsInRangeExhausted(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	size := p.End - p.Begin + 1
+	if _, err := p.RequestPortsInRange(defaultIP, "udp", 0, size+1); err != ErrAllPortsAllocated {
+		t.Fatalf("Expected error %s got %v", ErrAllPortsAllocated, err)
+	}
+
+	// Leave a single free port in the middle of the dynamic range
+	middle := p.Begin + size/2
+	if _, err := p.RequestPortsInRange(defaultIP, "udp", p.Begin, middle-p.Begin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPortsInRange(defaultIP, "udp", middle+1, p.End-middle); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.RequestPortsInRange(defaultIP, "udp", 0, 2); err != ErrAllPortsAllocated {
+		t.Fatalf("Expected error %s got %v", ErrAllPortsAllocated, err)
+	}
+	if port, err := p.RequestPort(defaultIP, "udp", 0); err != nil || port != middle {
+		t.Fatalf("Expected port %d got %d: %v", middle, port, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
 )
 
 type mapping struct {
@@ -16,9 +17,12 @@ type mapping struct {
 	userlandProxy userlandProxy
 	host          net.Addr
 	container     net.Addr
+	// count is the number of contiguous ports mapped from the host and
+	// container addresses ports
+	count int
 }
 
-var newProxy = newProxyCommand
+var newProxy = newUserlandProxy
 
 var (
 	// ErrUnknownBackendAddressType refers to an unknown container or unsupported address type
@@ -27,11 +31,48 @@ var (
 	ErrPortMappedForIP = errors.New("port is already mapped to ip")
 	// ErrPortNotMapped refers to an unmapped port
 	ErrPortNotMapped = errors.New("port is not mapped")
+	// ErrIPVersionMismatch refers to a host address of another IP version than the container one
+	ErrIPVersionMismatch = errors.New("host and container addresses are not of the same IP version")
+	// ErrNotProxiedInProcess refers to a port which is not proxied by an in-process userland proxy
+	ErrNotProxiedInProcess = errors.New("port is not proxied in process")
 )
 
+// Forwarder programs the rules forwarding a host port to a container port,
+// as the iptables and nftables chains do
+type Forwarder interface {
+	Forward(action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int) error
+}
+
+// BatchForwarder is a Forwarder which records the forwarding rules in a
+// batch, for the rules of several mappings to be programmed at once. The
+// rules forward the count contiguous ports starting at port.
+type BatchForwarder interface {
+	Forwarder
+	ForwardRangeRules(b *iptables.Batch, action iptables.Action, ip net.IP, port, count int, proto, destAddr string, destPort int)
+}
+
+// Binding is a container transport address to map to a host address. A
+// zero HostPort maps the container address to any available host port.
+// A Count greater than one maps the range of contiguous ports starting at
+// the container port to a range of the same size starting at the host port.
+// The ports of a range are not proxied.
+type Binding struct {
+	Container net.Addr
+	HostIP    net.IP
+	HostPort  int
+	Count     int
+}
+
+// maxAllocatePortAttempts is the number of host ports tried for a binding
+// to any available host port
+const maxAllocatePortAttempts = 10
+
 // PortMapper manages the network address translation
 type PortMapper struct {
-	chain *iptables.Chain
+	chain Forwarder
+
+	// proxyMode is how the userland proxies of the mappings run
+	proxyMode ProxyMode
 
 	// udp:ip:port
 	currentMappings map[string]*mapping
@@ -55,67 +96,64 @@ func NewWithPortAllocator(allocator *portallocator.PortAllocator) *PortMapper {
 
 // SetIptablesChain sets the specified chain into portmapper
 func (pm *PortMapper) SetIptablesChain(c *iptables.Chain) {
+	if c == nil {
+		pm.chain = nil
+		return
+	}
 	pm.chain = c
 }
 
-// Map maps the specified container transport address to the host's network address and transport port
-func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, useProxy bool) (host net.Addr, err error) {
+// SetForwarder sets the specified forwarding chain into portmapper
+func (pm *PortMapper) SetForwarder(f Forwarder) {
+	pm.chain = f
+}
+
+// SetProxyMode sets how the userland proxies of the next mappings run
+func (pm *PortMapper) SetProxyMode(mode ProxyMode) {
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 
-	var (
-		m                 *mapping
-		proto             string
-		allocatedHostPort int
-	)
+	pm.proxyMode = mode
+}
 
-	switch container.(type) {
-	case *net.TCPAddr:
-		proto = "tcp"
-		if allocatedHostPort, err = pm.Allocator.RequestPort(hostIP, proto, hostPort); err != nil {
-			return nil, err
-		}
+// ProxyStats returns the connection counters of the in-process userland
+// proxy of the specified host transport address
+func (pm *PortMapper) ProxyStats(host net.Addr) (ProxyStats, error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
 
-		m = &mapping{
-			proto:     proto,
-			host:      &net.TCPAddr{IP: hostIP, Port: allocatedHostPort},
-			container: container,
-		}
+	m, exists := pm.currentMappings[getKey(host)]
+	if !exists {
+		return ProxyStats{}, ErrPortNotMapped
+	}
 
-		if useProxy {
-			m.userlandProxy = newProxy(proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port)
-		}
-	case *net.UDPAddr:
-		proto = "udp"
-		if allocatedHostPort, err = pm.Allocator.RequestPort(hostIP, proto, hostPort); err != nil {
-			return nil, err
-		}
+	p, ok := m.userlandProxy.(*inProcessProxy)
+	if !ok {
+		return ProxyStats{}, ErrNotProxiedInProcess
+	}
 
-		m = &mapping{
-			proto:     proto,
-			host:      &net.UDPAddr{IP: hostIP, Port: allocatedHostPort},
-			container: container,
-		}
+	return p.Stats(), nil
+}
 
-		if useProxy {
-			m.userlandProxy = newProxy(proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port)
-		}
-	default:
-		return nil, ErrUnknownBackendAddressType
+// Map maps the specified container transport address to the host's network address and transport port.
+// An IPv6 container address is published through ip6tables, on an IPv6 or an unspecified host address.
+func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, useProxy bool) (host net.Addr, err error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	m, err := pm.allocate(container, hostIP, hostPort, 1, useProxy)
+	if err != nil {
+		return nil, err
 	}
 
 	// release the allocated port on any further error during return.
 	defer func() {
 		if err != nil {
-			pm.Allocator.ReleasePort(hostIP, proto, allocatedHostPort)
+			pm.Allocator.ReleasePort(hostIP, m.proto, getPort(m.host))
 		}
 	}()
 
-	key := getKey(m.host)
-	if _, exists := pm.currentMappings[key]; exists {
-		return nil, ErrPortMappedForIP
-	}
-
+	allocatedHostPort := getPort(m.host)
 	containerIP, containerPort := getIPAndPort(m.container)
 	if err := pm.forward(iptables.Append, m.proto, hostIP, allocatedHostPort, containerIP.String(), containerPort); err != nil {
 		return nil, err
@@ -143,10 +181,157 @@ func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, usePr
 		}
 	}
 
-	pm.currentMappings[key] = m
+	pm.currentMappings[getKey(m.host)] = m
 	return m.host, nil
 }
 
+// MapAll maps the container transport addresses of the bindings as Map
+// does, but programs the forwarding rules of all of them in a single
+// transaction when the chain supports it. Either all the bindings are
+// mapped, or none. The host addresses are returned in the bindings order.
+func (pm *PortMapper) MapAll(bindings []Binding, useProxy bool) ([]net.Addr, error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	mappings := make([]*mapping, 0, len(bindings))
+	release := func() {
+		for _, m := range mappings {
+			if m.userlandProxy != nil {
+				m.userlandProxy.Stop()
+			}
+			pm.release(m)
+		}
+	}
+
+	for _, b := range bindings {
+		m, err := pm.allocateAndProxy(b, useProxy)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+
+	if err := pm.forwardAll(iptables.Append, mappings); err != nil {
+		release()
+		return nil, err
+	}
+
+	hosts := make([]net.Addr, 0, len(mappings))
+	for _, m := range mappings {
+		pm.currentMappings[getKey(m.host)] = m
+		hosts = append(hosts, m.host)
+	}
+
+	return hosts, nil
+}
+
+// allocateAndProxy allocates the host port of the binding and starts its
+// userland proxy. Other host ports are tried when the proxy of a binding to
+// any available port fails to start.
+func (pm *PortMapper) allocateAndProxy(b Binding, useProxy bool) (m *mapping, err error) {
+	for i := 0; i < maxAllocatePortAttempts; i++ {
+		if m, err = pm.allocate(b.Container, b.HostIP, b.HostPort, b.Count, useProxy); err == nil {
+			if m.userlandProxy == nil {
+				return m, nil
+			}
+			if err = m.userlandProxy.Start(); err == nil {
+				return m, nil
+			}
+			pm.release(m)
+		}
+		// There is no point in immediately retrying to map an explicitly chosen port.
+		if b.HostPort != 0 {
+			logrus.Warnf("Failed to allocate and map port %d: %s", b.HostPort, err)
+			break
+		}
+		logrus.Warnf("Failed to allocate and map port: %s, retry: %d", err, i+1)
+	}
+	return nil, err
+}
+
+// allocate allocates the host ports of a new mapping of the count ports of
+// the container address. Only the mappings of a single port are proxied.
+func (pm *PortMapper) allocate(container net.Addr, hostIP net.IP, hostPort, count int, useProxy bool) (*mapping, error) {
+	var (
+		m                 *mapping
+		proto             string
+		allocatedHostPort int
+		err               error
+	)
+
+	// The traffic to a specific host address cannot be forwarded to a
+	// container address of the other IP version
+	if containerIP := getIP(container); containerIP != nil && hostIP != nil && !hostIP.IsUnspecified() &&
+		iptables.IPVersion(hostIP) != iptables.IPVersion(containerIP) {
+		return nil, ErrIPVersionMismatch
+	}
+
+	if count < 1 {
+		count = 1
+	}
+	if count > 1 {
+		useProxy = false
+	}
+
+	switch container.(type) {
+	case *net.TCPAddr:
+		proto = "tcp"
+		if allocatedHostPort, err = pm.Allocator.RequestPortsInRange(hostIP, proto, hostPort, count); err != nil {
+			return nil, err
+		}
+
+		m = &mapping{
+			proto:     proto,
+			host:      &net.TCPAddr{IP: hostIP, Port: allocatedHostPort},
+			container: container,
+			count:     count,
+		}
+
+		if useProxy {
+			m.userlandProxy = newProxy(pm.proxyMode, proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port)
+		}
+	case *net.UDPAddr:
+		proto = "udp"
+		if allocatedHostPort, err = pm.Allocator.RequestPortsInRange(hostIP, proto, hostPort, count); err != nil {
+			return nil, err
+		}
+
+		m = &mapping{
+			proto:     proto,
+			host:      &net.UDPAddr{IP: hostIP, Port: allocatedHostPort},
+			container: container,
+			count:     count,
+		}
+
+		if useProxy {
+			m.userlandProxy = newProxy(pm.proxyMode, proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port)
+		}
+	case *types.SCTPAddr:
+		// The userland proxy does not support SCTP
+		proto = "sctp"
+		if allocatedHostPort, err = pm.Allocator.RequestPortsInRange(hostIP, proto, hostPort, count); err != nil {
+			return nil, err
+		}
+
+		m = &mapping{
+			proto:     proto,
+			host:      &types.SCTPAddr{IP: hostIP, Port: allocatedHostPort},
+			container: container,
+			count:     count,
+		}
+	default:
+		return nil, ErrUnknownBackendAddressType
+	}
+
+	if _, exists := pm.currentMappings[getKey(m.host)]; exists {
+		pm.release(m)
+		return nil, ErrPortMappedForIP
+	}
+
+	return m, nil
+}
+
 // Unmap removes stored mapping for the specified host transport address
 func (pm *PortMapper) Unmap(host net.Addr) error {
 	pm.lock.Lock()
@@ -164,19 +349,58 @@ func (pm *PortMapper) Unmap(host net.Addr) error {
 
 	delete(pm.currentMappings, key)
 
-	containerIP, containerPort := getIPAndPort(data.container)
-	hostIP, hostPort := getIPAndPort(data.host)
-	if err := pm.forward(iptables.Delete, data.proto, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
+	if err := pm.forwardAll(iptables.Delete, []*mapping{data}); err != nil {
 		logrus.Errorf("Error on iptables delete: %s", err)
 	}
 
-	switch a := host.(type) {
-	case *net.TCPAddr:
-		return pm.Allocator.ReleasePort(a.IP, "tcp", a.Port)
-	case *net.UDPAddr:
-		return pm.Allocator.ReleasePort(a.IP, "udp", a.Port)
+	return pm.release(data)
+}
+
+// UnmapAll removes the stored mappings for the specified host transport
+// addresses, deleting their forwarding rules in a single transaction when
+// the chain supports it. It returns the first error met.
+func (pm *PortMapper) UnmapAll(hosts []net.Addr) error {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	var (
+		mappings []*mapping
+		firstErr error
+	)
+	for _, host := range hosts {
+		key := getKey(host)
+		data, exists := pm.currentMappings[key]
+		if !exists {
+			if firstErr == nil {
+				firstErr = ErrPortNotMapped
+			}
+			continue
+		}
+
+		if data.userlandProxy != nil {
+			data.userlandProxy.Stop()
+		}
+
+		delete(pm.currentMappings, key)
+		mappings = append(mappings, data)
+	}
+
+	if err := pm.forwardAll(iptables.Delete, mappings); err != nil {
+		logrus.Errorf("Error on iptables delete: %s", err)
+	}
+
+	for _, m := range mappings {
+		if err := pm.release(m); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
+
+	return firstErr
+}
+
+// release releases the host ports of the mapping
+func (pm *PortMapper) release(m *mapping) error {
+	return pm.Allocator.ReleasePortsInRange(getIP(m.host), m.proto, getPort(m.host), m.count)
 }
 
 func getKey(a net.Addr) string {
@@ -185,6 +409,8 @@ func getKey(a net.Addr) string {
 		return fmt.Sprintf("%s:%d/%s", t.IP.String(), t.Port, "tcp")
 	case *net.UDPAddr:
 		return fmt.Sprintf("%s:%d/%s", t.IP.String(), t.Port, "udp")
+	case *types.SCTPAddr:
+		return fmt.Sprintf("%s:%d/%s", t.IP.String(), t.Port, "sctp")
 	}
 	return ""
 }
@@ -195,10 +421,89 @@ func getIPAndPort(a net.Addr) (net.IP, int) {
 		return t.IP, t.Port
 	case *net.UDPAddr:
 		return t.IP, t.Port
+	case *types.SCTPAddr:
+		return t.IP, t.Port
 	}
 	return nil, 0
 }
 
+func getIP(a net.Addr) net.IP {
+	ip, _ := getIPAndPort(a)
+	return ip
+}
+
+func getPort(a net.Addr) int {
+	_, port := getIPAndPort(a)
+	return port
+}
+
+// forwardAll programs the forwarding rules of the mappings in a single batch
+// when the chain supports it, one port after the other otherwise. Either
+// all the rules are programmed or none, but for deletions which are carried
+// out for as many ports as possible.
+func (pm *PortMapper) forwardAll(action iptables.Action, mappings []*mapping) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	if bf, ok := pm.chain.(BatchForwarder); ok {
+		b := iptables.NewBatch()
+		for _, m := range mappings {
+			containerIP, containerPort := getIPAndPort(m.container)
+			bf.ForwardRangeRules(b, action, getIP(m.host), getPort(m.host), m.count, m.proto, containerIP.String(), containerPort)
+		}
+		err := b.Commit()
+		if err == nil || action != iptables.Delete {
+			return err
+		}
+		// A single missing rule fails the whole batch
+	}
+
+	var firstErr error
+	for i, m := range mappings {
+		if err := pm.forwardPorts(action, m); err != nil {
+			if action == iptables.Delete {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			for _, done := range mappings[:i] {
+				pm.forwardPorts(iptables.Delete, done)
+			}
+			return err
+		}
+	}
+
+	return firstErr
+}
+
+// forwardPorts programs the forwarding rules of the mapping ports one by
+// one, deleting the programmed ones when an addition fails
+func (pm *PortMapper) forwardPorts(action iptables.Action, m *mapping) error {
+	var (
+		firstErr                   error
+		hostIP, hostPort           = getIPAndPort(m.host)
+		containerIP, containerPort = getIPAndPort(m.container)
+	)
+	for i := 0; i < m.count; i++ {
+		if err := pm.forward(action, m.proto, hostIP, hostPort+i, containerIP.String(), containerPort+i); err != nil {
+			if action == iptables.Delete {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			for j := 0; j < i; j++ {
+				pm.forward(iptables.Delete, m.proto, hostIP, hostPort+j, containerIP.String(), containerPort+j)
+			}
+			return err
+		}
+	}
+
+	return firstErr
+}
+
 func (pm *PortMapper) forward(action iptables.Action, proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
 	if pm.chain == nil {
 		return nil
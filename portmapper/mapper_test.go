@@ -1,11 +1,14 @@
 package portmapper
 
 import (
+	"fmt"
 	"net"
+	"strconv"
 	"testing"
 
 	"github.com/docker/libnetwork/iptables"
 	_ "github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
 )
 
 func init() {
@@ -194,3 +197,295 @@ func TestMapAllPortsSingleInterface(t *testing.T) {
 		hosts = []net.Addr{}
 	}
 }
+
+// testForwarder records the forwarded ports, failing for the ports in fail
+type testForwarder struct {
+	forwarded map[int]bool
+	fail      map[int]bool
+	batches   int
+}
+
+func newTestForwarder() *testForwarder {
+	return &testForwarder{forwarded: map[int]bool{}, fail: map[int]bool{}}
+}
+
+func (f *testForwarder) Forward(action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int) error {
+	if f.fail[port] {
+		return fmt.Errorf("failed to forward port %d", port)
+	}
+	if action == iptables.Delete {
+		delete(f.forwarded, port)
+	} else {
+		f.forwarded[port] = true
+	}
+	return nil
+}
+
+// testBatchForwarder records the forwarded ports of a batch at once
+type testBatchForwarder struct {
+	*testForwarder
+}
+
+func (f testBatchForwarder) ForwardRangeRules(b *iptables.Batch, action iptables.Action, ip net.IP, port, count int, proto, destAddr string, destPort int) {
+	f.batches++
+	for i := 0; i < count; i++ {
+		f.Forward(action, ip, port+i, proto, destAddr, destPort+i)
+	}
+}
+
+func TestMapAll(t *testing.T) {
+	pm := New()
+	f := newTestForwarder()
+	pm.SetForwarder(testBatchForwarder{f})
+
+	hostIP := net.ParseIP("192.168.0.1")
+	bindings := []Binding{
+		{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 80}, HostIP: hostIP, HostPort: 8080},
+		{Container: &net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: 53}, HostIP: hostIP, HostPort: 5353},
+		{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 443}, HostIP: hostIP},
+	}
+
+	hosts, err := pm.MapAll(bindings, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hosts) != 3 || hosts[0].String() != "192.168.0.1:8080" || hosts[1].String() != "192.168.0.1:5353" {
+		t.Fatalf("Unexpected host addresses %v", hosts)
+	}
+
+	if f.batches != 3 || len(f.forwarded) != 3 {
+		t.Fatalf("Expected the three mappings to be forwarded in a batch, got %d rules for %v", f.batches, f.forwarded)
+	}
+
+	// The mapped ports are in use
+	if _, err := pm.Map(bindings[0].Container, hostIP, 8080, true); err == nil {
+		t.Fatalf("Port is in use - mapping should have failed")
+	}
+
+	if err := pm.UnmapAll(hosts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.forwarded) != 0 {
+		t.Fatalf("Forwarding rules left after the unmapping: %v", f.forwarded)
+	}
+
+	if err := pm.UnmapAll(hosts); err != ErrPortNotMapped {
+		t.Fatalf("Expected a port not mapped error, got: %v", err)
+	}
+}
+
+func TestMapAllRollback(t *testing.T) {
+	pm := New()
+	f := newTestForwarder()
+	f.fail[8081] = true
+	pm.SetForwarder(f)
+
+	hostIP := net.ParseIP("192.168.0.1")
+	bindings := []Binding{
+		{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 80}, HostIP: hostIP, HostPort: 8080},
+		{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 81}, HostIP: hostIP, HostPort: 8081},
+	}
+
+	if _, err := pm.MapAll(bindings, true); err == nil {
+		t.Fatalf("Expected failure forwarding the port 8081")
+	}
+
+	if len(f.forwarded) != 0 {
+		t.Fatalf("Forwarding rules left after the failure: %v", f.forwarded)
+	}
+
+	// Neither port is left allocated
+	delete(f.fail, 8081)
+	hosts, err := pm.MapAll(bindings, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pm.UnmapAll(hosts); err != nil {
+		t.Fatal(err)
+	}
+
+	// A port mapped twice in the same batch fails the whole batch
+	bindings[1].HostPort = 8080
+	if _, err := pm.MapAll(bindings, true); err == nil {
+		t.Fatalf("Expected failure mapping the same port twice")
+	}
+
+	if _, err := pm.Map(bindings[0].Container, hostIP, 8080, true); err != nil {
+		t.Fatalf("Port 8080 left allocated after the failure: %v", err)
+	}
+}
+
+// destForwarder records the forwarding rules destination of the host ports
+type destForwarder map[int]string
+
+func (f destForwarder) Forward(action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int) error {
+	f[port] = net.JoinHostPort(destAddr, strconv.Itoa(destPort))
+	return nil
+}
+
+func TestMapIPv6Ports(t *testing.T) {
+	pm := New()
+	f := destForwarder{}
+	pm.SetForwarder(f)
+
+	srcAddr := &net.TCPAddr{Port: 1080, IP: net.ParseIP("2001:db8::2")}
+	host, err := pm.Map(srcAddr, net.ParseIP("2001:db8:1::1"), 8080, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.String() != "[2001:db8:1::1]:8080" {
+		t.Fatalf("Unexpected host address %s", host)
+	}
+	if f[8080] != "[2001:db8::2]:1080" {
+		t.Fatalf("Unexpected forwarding destination %q", f[8080])
+	}
+
+	// An IPv6 container address can be published on all the host addresses
+	if _, err := pm.Map(srcAddr, net.IPv4zero, 8081, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pm.Map(srcAddr, net.ParseIP("192.168.0.1"), 8082, true); err != ErrIPVersionMismatch {
+		t.Fatalf("Expected an IP version mismatch error, got: %v", err)
+	}
+
+	srcAddr4 := &net.UDPAddr{Port: 53, IP: net.ParseIP("172.16.0.1")}
+	if _, err := pm.Map(srcAddr4, net.ParseIP("2001:db8:1::1"), 5353, true); err != ErrIPVersionMismatch {
+		t.Fatalf("Expected an IP version mismatch error, got: %v", err)
+	}
+
+	// The failed mappings left their host port available
+	if _, err := pm.Map(srcAddr4, net.ParseIP("192.168.0.1"), 8082, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapAllRange(t *testing.T) {
+	pm := New()
+	f := newTestForwarder()
+	pm.SetForwarder(testBatchForwarder{f})
+
+	hostIP := net.ParseIP("192.168.0.1")
+	bindings := []Binding{
+		{Container: &net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: 10000}, HostIP: hostIP, HostPort: 20000, Count: 100},
+		{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 80}, HostIP: hostIP, Count: 10},
+	}
+
+	hosts, err := pm.MapAll(bindings, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single rule covers each range
+	if f.batches != 2 || len(f.forwarded) != 110 {
+		t.Fatalf("Expected the two ranges to be forwarded with one rule each, got %d rules for %d ports", f.batches, len(f.forwarded))
+	}
+
+	if hosts[0].String() != "192.168.0.1:20000" {
+		t.Fatalf("Unexpected host address %s", hosts[0])
+	}
+
+	// All the ports of the ranges are allocated
+	for _, port := range []int{20000, 20050, 20099} {
+		if _, err := pm.Map(&net.UDPAddr{IP: net.ParseIP("172.16.0.2"), Port: 53}, hostIP, port, false); err == nil {
+			t.Fatalf("Port %d of the range is available", port)
+		}
+	}
+	if _, err := pm.Map(&net.TCPAddr{IP: net.ParseIP("172.16.0.2"), Port: 80}, hostIP, getPort(hosts[1])+9, false); err == nil {
+		t.Fatalf("Port %d of the range is available", getPort(hosts[1])+9)
+	}
+
+	if err := pm.UnmapAll(hosts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.forwarded) != 0 {
+		t.Fatalf("Forwarding rules left after the unmapping: %v", f.forwarded)
+	}
+
+	if _, err := pm.Map(&net.UDPAddr{IP: net.ParseIP("172.16.0.2"), Port: 53}, hostIP, 20099, false); err != nil {
+		t.Fatalf("Port of the range left allocated after the unmapping: %v", err)
+	}
+}
+
+func TestMapRangePerPort(t *testing.T) {
+	pm := New()
+	f := newTestForwarder()
+	f.fail[30005] = true
+	pm.SetForwarder(f)
+
+	hostIP := net.ParseIP("192.168.0.1")
+	bindings := []Binding{{Container: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 30000}, HostIP: hostIP, HostPort: 30000, Count: 10}}
+
+	// The ports of a range are forwarded one by one by a plain forwarder,
+	// and none of them is left forwarded on failure
+	if _, err := pm.MapAll(bindings, false); err == nil {
+		t.Fatalf("Expected failure forwarding the port 30005")
+	}
+	if len(f.forwarded) != 0 {
+		t.Fatalf("Forwarding rules left after the failure: %v", f.forwarded)
+	}
+
+	delete(f.fail, 30005)
+	hosts, err := pm.MapAll(bindings, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.forwarded) != 10 {
+		t.Fatalf("Expected the 10 ports of the range to be forwarded, got %v", f.forwarded)
+	}
+
+	if err := pm.Unmap(hosts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.forwarded) != 0 {
+		t.Fatalf("Forwarding rules left after the unmapping: %v", f.forwarded)
+	}
+}
+
+func TestMapSCTPPorts(t *testing.T) {
+	pm := New()
+	f := destForwarder{}
+	pm.SetForwarder(f)
+
+	srcAddr := &types.SCTPAddr{IP: net.ParseIP("172.16.0.1"), Port: 3868}
+	hostIP := net.ParseIP("192.168.0.1")
+
+	// SCTP ports are forwarded without a userland proxy
+	host, err := pm.Map(srcAddr, hostIP, 3868, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.String() != "192.168.0.1:3868" || host.Network() != "sctp" {
+		t.Fatalf("Unexpected host address %s", host)
+	}
+	if f[3868] != "172.16.0.1:3868" {
+		t.Fatalf("Unexpected forwarding destination %q", f[3868])
+	}
+	if m := pm.currentMappings[getKey(host)]; m.userlandProxy != nil {
+		t.Fatalf("SCTP port mapped through a userland proxy")
+	}
+
+	if _, err := pm.Map(srcAddr, hostIP, 3868, true); err == nil {
+		t.Fatalf("Port is in use - mapping should have failed")
+	}
+
+	// The TCP port of the same number is available
+	if _, err := pm.Map(&net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 3868}, hostIP, 3868, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.Map(srcAddr, hostIP, 3868, true); err != nil {
+		t.Fatal(err)
+	}
+}
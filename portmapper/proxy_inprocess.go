@@ -0,0 +1,324 @@
+package portmapper
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ProxyMode selects how the userland proxies of the port mappings run
+type ProxyMode string
+
+const (
+	// InProcessProxy forwards the traffic of the proxied ports from
+	// goroutines of the process. It is the default mode.
+	InProcessProxy ProxyMode = "in-process"
+	// ExecProxy runs a docker-proxy process for every proxied port
+	ExecProxy ProxyMode = "exec"
+)
+
+const udpBufSize = 65507
+
+var (
+	// proxyDrainTimeout is how long a stopped in-process proxy lets its
+	// TCP connections complete before closing them
+	proxyDrainTimeout = 30 * time.Second
+	// udpFlowTimeout is how long an UDP flow is kept without any reply
+	udpFlowTimeout = 90 * time.Second
+)
+
+// ProxyStats are the connection counters of an in-process userland proxy.
+// The UDP flows, one per client address, are counted as connections.
+type ProxyStats struct {
+	// Active is the number of connections being forwarded
+	Active int64
+	// Total is the number of connections forwarded since the proxy started
+	Total int64
+}
+
+// inProcessProxy forwards the TCP connections, or UDP datagrams, received
+// on a host address to a container address
+type inProcessProxy struct {
+	frontend net.Addr
+	backend  net.Addr
+
+	tcpListener *net.TCPListener
+	udpConn     *net.UDPConn
+
+	active int64
+	total  int64
+
+	// conns are the connections to close when the drain times out, flows
+	// the backend connections of the UDP clients
+	conns map[net.Conn]struct{}
+	flows map[string]*net.UDPConn
+	wg    sync.WaitGroup
+	done  chan struct{}
+	sync.Mutex
+}
+
+func newInProcessProxy(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int) userlandProxy {
+	p := &inProcessProxy{
+		conns: make(map[net.Conn]struct{}),
+		flows: make(map[string]*net.UDPConn),
+		done:  make(chan struct{}),
+	}
+
+	switch proto {
+	case "tcp":
+		p.frontend = &net.TCPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.TCPAddr{IP: containerIP, Port: containerPort}
+	case "udp":
+		p.frontend = &net.UDPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.UDPAddr{IP: containerIP, Port: containerPort}
+	}
+
+	return p
+}
+
+// newUserlandProxy returns the userland proxy of the mode
+func newUserlandProxy(mode ProxyMode, proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int) userlandProxy {
+	if mode == ExecProxy {
+		return newProxyCommand(proto, hostIP, hostPort, containerIP, containerPort)
+	}
+	return newInProcessProxy(proto, hostIP, hostPort, containerIP, containerPort)
+}
+
+func (p *inProcessProxy) Start() error {
+	switch frontend := p.frontend.(type) {
+	case *net.TCPAddr:
+		l, err := net.ListenTCP("tcp", frontend)
+		if err != nil {
+			return err
+		}
+		p.tcpListener, p.frontend = l, l.Addr()
+		p.wg.Add(1)
+		go p.serveTCP()
+	case *net.UDPAddr:
+		c, err := net.ListenUDP("udp", frontend)
+		if err != nil {
+			return err
+		}
+		p.udpConn, p.frontend = c, c.LocalAddr()
+		p.wg.Add(1)
+		go p.serveUDP()
+	default:
+		return fmt.Errorf("unsupported userland proxy address %v", p.frontend)
+	}
+
+	logrus.Debugf("Started proxy on %s/%v for %v", p.frontend.Network(), p.frontend, p.backend)
+
+	return nil
+}
+
+// Stop closes the host address of the proxy right away, for the port to be
+// mapped again, and drains its connections in the background.
+func (p *inProcessProxy) Stop() error {
+	var err error
+	switch {
+	case p.tcpListener != nil:
+		err = p.tcpListener.Close()
+	case p.udpConn != nil:
+		err = p.udpConn.Close()
+	}
+
+	go p.drain()
+
+	return err
+}
+
+// Stats returns the connection counters of the proxy
+func (p *inProcessProxy) Stats() ProxyStats {
+	return ProxyStats{
+		Active: atomic.LoadInt64(&p.active),
+		Total:  atomic.LoadInt64(&p.total),
+	}
+}
+
+// drain lets the forwarded TCP connections complete, closing the ones still
+// open after proxyDrainTimeout
+func (p *inProcessProxy) drain() {
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(proxyDrainTimeout):
+		p.Lock()
+		logrus.Debugf("Closing %d connections of the proxy on %s/%v", len(p.conns), p.frontend.Network(), p.frontend)
+		for c := range p.conns {
+			c.Close()
+		}
+		p.Unlock()
+		<-drained
+	}
+
+	close(p.done)
+}
+
+func (p *inProcessProxy) serveTCP() {
+	defer p.wg.Done()
+
+	for {
+		client, err := p.tcpListener.AcceptTCP()
+		if err != nil {
+			// The listener is closed when the proxy stops
+			logrus.Debugf("Stopping proxy on tcp/%v for tcp/%v (%s)", p.frontend, p.backend, err)
+			return
+		}
+		p.wg.Add(1)
+		go p.forwardTCP(client)
+	}
+}
+
+func (p *inProcessProxy) forwardTCP(client *net.TCPConn) {
+	defer p.wg.Done()
+
+	backend, err := net.DialTCP("tcp", nil, p.backend.(*net.TCPAddr))
+	if err != nil {
+		logrus.Warnf("Can't forward traffic to backend tcp/%v: %s", p.backend, err)
+		client.Close()
+		return
+	}
+
+	p.track(true, client, backend)
+	atomic.AddInt64(&p.total, 1)
+	atomic.AddInt64(&p.active, 1)
+
+	var wg sync.WaitGroup
+	broker := func(to, from *net.TCPConn) {
+		defer wg.Done()
+		io.Copy(to, from)
+		// Forward the end of the stream to the other side
+		from.CloseRead()
+		to.CloseWrite()
+	}
+
+	wg.Add(2)
+	go broker(client, backend)
+	go broker(backend, client)
+	wg.Wait()
+
+	client.Close()
+	backend.Close()
+	p.track(false, client, backend)
+	atomic.AddInt64(&p.active, -1)
+}
+
+// track records, or forgets, the connections to close when the drain times
+// out
+func (p *inProcessProxy) track(add bool, conns ...net.Conn) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, c := range conns {
+		if add {
+			p.conns[c] = struct{}{}
+		} else {
+			delete(p.conns, c)
+		}
+	}
+}
+
+func (p *inProcessProxy) serveUDP() {
+	defer p.wg.Done()
+
+	buf := make([]byte, udpBufSize)
+	for {
+		n, client, err := p.udpConn.ReadFromUDP(buf)
+		if err != nil {
+			// The listener is closed when the proxy stops
+			logrus.Debugf("Stopping proxy on udp/%v for udp/%v (%s)", p.frontend, p.backend, err)
+			break
+		}
+
+		key := client.String()
+		p.Lock()
+		flow, ok := p.flows[key]
+		if !ok {
+			if flow, err = net.DialUDP("udp", nil, p.backend.(*net.UDPAddr)); err != nil {
+				p.Unlock()
+				logrus.Warnf("Can't forward traffic to backend udp/%v: %s", p.backend, err)
+				continue
+			}
+			p.flows[key] = flow
+			atomic.AddInt64(&p.total, 1)
+			atomic.AddInt64(&p.active, 1)
+			p.wg.Add(1)
+			go p.replyUDP(flow, client, key)
+		}
+		p.Unlock()
+
+		for i := 0; i != n; {
+			written, err := flow.Write(buf[i:n])
+			if err != nil {
+				logrus.Debugf("Can't proxy a datagram to udp/%v: %s", p.backend, err)
+				break
+			}
+			i += written
+		}
+	}
+
+	// The replies cannot be sent back once the host address is closed
+	p.Lock()
+	for _, flow := range p.flows {
+		flow.Close()
+	}
+	p.Unlock()
+}
+
+// replyUDP sends the replies of the flow back to the client, until the flow
+// stays idle for udpFlowTimeout
+func (p *inProcessProxy) replyUDP(flow *net.UDPConn, client *net.UDPAddr, key string) {
+	defer func() {
+		p.Lock()
+		delete(p.flows, key)
+		p.Unlock()
+		flow.Close()
+		atomic.AddInt64(&p.active, -1)
+		p.wg.Done()
+	}()
+
+	buf := make([]byte, udpBufSize)
+	for {
+		flow.SetReadDeadline(time.Now().Add(udpFlowTimeout))
+		n, err := flow.Read(buf)
+		if err != nil {
+			// The last datagram was refused by the backend: the
+			// following ones may not be
+			if isConnRefused(err) {
+				continue
+			}
+			return
+		}
+
+		for i := 0; i != n; {
+			written, err := p.udpConn.WriteToUDP(buf[i:n], client)
+			if err != nil {
+				return
+			}
+			i += written
+		}
+	}
+}
+
+func isConnRefused(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+		return sysErr.Err == syscall.ECONNREFUSED
+	}
+	return opErr.Err == syscall.ECONNREFUSED
+}
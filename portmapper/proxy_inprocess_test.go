@@ -0,0 +1,215 @@
+package portmapper
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var loopback = net.ParseIP("127.0.0.1")
+
+// echoTCP serves the connections to the returned address by echoing the
+// lines they send
+func echoTCP(t *testing.T) *net.TCPAddr {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: loopback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr)
+}
+
+func startProxy(t *testing.T, proto string, backend net.IP, port int) *inProcessProxy {
+	p := newInProcessProxy(proto, loopback, 0, backend, port).(*inProcessProxy)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func echoLine(t *testing.T, c net.Conn, r *bufio.Reader, line string) {
+	if _, err := c.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != line+"\n" {
+		t.Fatalf("Expected %q echoed, got %q", line, reply)
+	}
+}
+
+func waitStats(t *testing.T, p *inProcessProxy, expected ProxyStats) {
+	for i := 0; i < 100; i++ {
+		if p.Stats() == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected stats %+v, got %+v", expected, p.Stats())
+}
+
+func TestInProcessProxyTCP(t *testing.T) {
+	backend := echoTCP(t)
+	p := startProxy(t, "tcp", backend.IP, backend.Port)
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", p.frontend.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		echoLine(t, c, bufio.NewReader(c), "hello")
+		waitStats(t, p, ProxyStats{Active: 1, Total: int64(i + 1)})
+		c.Close()
+		waitStats(t, p, ProxyStats{Active: 0, Total: int64(i + 1)})
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.done
+}
+
+func TestInProcessProxyDrain(t *testing.T) {
+	backend := echoTCP(t)
+	p := startProxy(t, "tcp", backend.IP, backend.Port)
+
+	c, err := net.Dial("tcp", p.frontend.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+	echoLine(t, c, r, "before")
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The host port is released right away, the open connection is drained
+	if _, err := net.Dial("tcp", p.frontend.String()); err == nil {
+		t.Fatal("Expected the stopped proxy to refuse new connections")
+	}
+	echoLine(t, c, r, "after")
+
+	select {
+	case <-p.done:
+		t.Fatal("Expected the proxy to wait for its connections")
+	default:
+	}
+
+	c.Close()
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the proxy to be drained once its connections are closed")
+	}
+	waitStats(t, p, ProxyStats{Active: 0, Total: 1})
+}
+
+func TestInProcessProxyDrainTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { proxyDrainTimeout = timeout }(proxyDrainTimeout)
+	proxyDrainTimeout = 100 * time.Millisecond
+
+	backend := echoTCP(t)
+	p := startProxy(t, "tcp", backend.IP, backend.Port)
+
+	c, err := net.Dial("tcp", p.frontend.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	echoLine(t, c, bufio.NewReader(c), "hello")
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the open connection to be closed after the drain timeout")
+	}
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestInProcessProxyUDP(t *testing.T) {
+	backend, err := net.ListenUDP("udp", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		buf := make([]byte, udpBufSize)
+		for {
+			n, from, err := backend.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteToUDP(buf[:n], from)
+		}
+	}()
+
+	addr := backend.LocalAddr().(*net.UDPAddr)
+	p := startProxy(t, "udp", addr.IP, addr.Port)
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("udp", p.frontend.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		echoLine(t, c, bufio.NewReader(c), "hello")
+		echoLine(t, c, bufio.NewReader(c), "again")
+	}
+	waitStats(t, p, ProxyStats{Active: 2, Total: 2})
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the UDP flows to be closed with the proxy")
+	}
+	waitStats(t, p, ProxyStats{Active: 0, Total: 2})
+}
+
+func TestProxyStats(t *testing.T) {
+	pm := New()
+	pm.SetForwarder(newTestForwarder())
+	hostIP := net.ParseIP("192.168.1.10")
+	host := &net.TCPAddr{IP: hostIP, Port: 9080}
+
+	if _, err := pm.ProxyStats(host); err != ErrPortNotMapped {
+		t.Fatalf("Expected ErrPortNotMapped, got %v", err)
+	}
+
+	if _, err := pm.Map(&net.TCPAddr{IP: net.ParseIP("172.17.0.2"), Port: 80}, hostIP, 9080, true); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Unmap(host)
+
+	// The tests replace the userland proxies with mocks
+	if _, err := pm.ProxyStats(host); err != ErrNotProxiedInProcess {
+		t.Fatalf("Expected ErrNotProxiedInProcess, got %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package resolvconf
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -30,8 +32,21 @@ var (
 	nsIPv6Regexp      = regexp.MustCompile(`(?m)^nameserver\s+` + ipv6Address + `\s*\n*`)
 	nsRegexp          = regexp.MustCompile(`^\s*nameserver\s*((` + ipv4Address + `)|(` + ipv6Address + `))\s*$`)
 	searchRegexp      = regexp.MustCompile(`^\s*search\s*(([^\s]+\s*)*)$`)
+	optionsRegexp     = regexp.MustCompile(`^\s*options\s*(([^\s]+\s*)*)$`)
+	optionsLineRegexp = regexp.MustCompile(`(?m)^[ \t]*options([ \t].*)?\n?`)
 )
 
+// maxOptionValues are the largest values of the resolver options taking one,
+// see resolv.conf(5)
+var maxOptionValues = map[string]int{
+	"ndots":    15,
+	"timeout":  30,
+	"attempts": 5,
+}
+
+// Path is the path of the host resolv.conf
+const Path = "/etc/resolv.conf"
+
 var lastModified struct {
 	sync.Mutex
 	sha256   string
@@ -40,7 +55,7 @@ var lastModified struct {
 
 // Get returns the contents of /etc/resolv.conf
 func Get() ([]byte, error) {
-	resolv, err := ioutil.ReadFile("/etc/resolv.conf")
+	resolv, err := ioutil.ReadFile(Path)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +69,7 @@ func GetIfChanged() ([]byte, string, error) {
 	lastModified.Lock()
 	defer lastModified.Unlock()
 
-	resolv, err := ioutil.ReadFile("/etc/resolv.conf")
+	resolv, err := ioutil.ReadFile(Path)
 	if err != nil {
 		return nil, "", err
 	}
@@ -80,15 +95,17 @@ func GetLastModified() ([]byte, string) {
 	return lastModified.contents, lastModified.sha256
 }
 
-// FilterResolvDNS cleans up the config in resolvConf.  It has two main jobs:
+// FilterResolvDNS cleans up the config in resolvConf.  It has three main jobs:
 // 1. It looks for localhost (127.*|::1) entries in the provided
 //    resolv.conf, removing local nameserver entries, and, if the resulting
 //    cleaned config has no defined nameservers left, adds default DNS entries
 // 2. Given the caller provides the enable/disable state of IPv6, the filter
 //    code will remove all IPv6 nameservers if it is not enabled for containers
+// 3. It merges dnsOptions into the options of resolvConf, which are kept
+//    otherwise, see MergeOptions
 //
 // It returns a boolean to notify the caller if changes were made at all
-func FilterResolvDNS(resolvConf []byte, ipv6Enabled bool) ([]byte, bool) {
+func FilterResolvDNS(resolvConf []byte, ipv6Enabled bool, dnsOptions []string) ([]byte, bool) {
 	changed := false
 	cleanedResolvConf := localhostNSRegexp.ReplaceAll(resolvConf, []byte{})
 	// if IPv6 is not enabled, also clean out any IPv6 address nameserver
@@ -106,6 +123,15 @@ func FilterResolvDNS(resolvConf []byte, ipv6Enabled bool) ([]byte, bool) {
 		}
 		cleanedResolvConf = append(cleanedResolvConf, []byte("\n"+strings.Join(dns, "\n"))...)
 	}
+	// replace the options lines with a single line of the merged options
+	if len(dnsOptions) > 0 {
+		options := MergeOptions(GetOptions(cleanedResolvConf), dnsOptions)
+		cleanedResolvConf = optionsLineRegexp.ReplaceAll(cleanedResolvConf, []byte{})
+		if len(cleanedResolvConf) > 0 && cleanedResolvConf[len(cleanedResolvConf)-1] != '\n' {
+			cleanedResolvConf = append(cleanedResolvConf, '\n')
+		}
+		cleanedResolvConf = append(cleanedResolvConf, []byte("options "+strings.Join(options, " ")+"\n")...)
+	}
 	if !bytes.Equal(resolvConf, cleanedResolvConf) {
 		changed = true
 	}
@@ -165,10 +191,62 @@ func GetSearchDomains(resolvConf []byte) []string {
 	return domains
 }
 
+// GetOptions returns the options (if any) listed in /etc/resolv.conf, the ones
+// of all the "options" lines in order.
+func GetOptions(resolvConf []byte) []string {
+	options := []string{}
+	for _, line := range getLines(resolvConf, []byte("#")) {
+		match := optionsRegexp.FindSubmatch(line)
+		if match == nil {
+			continue
+		}
+		options = append(options, strings.Fields(string(match[1]))...)
+	}
+	return options
+}
+
+// MergeOptions returns the resolver options with dnsOptions overriding the
+// options of the same name, the part before any ':', and appended otherwise.
+func MergeOptions(options, dnsOptions []string) []string {
+	merged := make([]string, 0, len(options)+len(dnsOptions))
+	index := make(map[string]int)
+	for _, o := range append(append([]string{}, options...), dnsOptions...) {
+		name := strings.SplitN(o, ":", 2)[0]
+		if i, ok := index[name]; ok {
+			merged[i] = o
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, o)
+	}
+	return merged
+}
+
+// ValidateOption checks that option is a resolver option containers may set:
+// ndots:n, timeout:n, attempts:n, rotate or edns0.
+func ValidateOption(option string) error {
+	parts := strings.SplitN(option, ":", 2)
+	switch parts[0] {
+	case "rotate", "edns0":
+		if len(parts) == 1 {
+			return nil
+		}
+	case "ndots", "timeout", "attempts":
+		if len(parts) == 2 {
+			v, err := strconv.Atoi(parts[1])
+			if err == nil && v >= 0 && v <= maxOptionValues[parts[0]] {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid resolver option %q: %s takes a value from 0 to %d", option, parts[0], maxOptionValues[parts[0]])
+	}
+	return fmt.Errorf("invalid resolver option %q", option)
+}
+
 // Build writes a configuration file to path containing a "nameserver" entry
-// for every element in dns, and a "search" entry for every element in
-// dnsSearch.
-func Build(path string, dns, dnsSearch []string) error {
+// for every element in dns, a "search" entry for every element in dnsSearch
+// and an "options" entry for every element in dnsOptions.
+func Build(path string, dns, dnsSearch, dnsOptions []string) error {
 	content := bytes.NewBuffer(nil)
 	for _, dns := range dns {
 		if _, err := content.WriteString("nameserver " + dns + "\n"); err != nil {
@@ -182,6 +260,11 @@ func Build(path string, dns, dnsSearch []string) error {
 			}
 		}
 	}
+	if len(dnsOptions) > 0 {
+		if _, err := content.WriteString("options " + strings.Join(dnsOptions, " ") + "\n"); err != nil {
+			return err
+		}
+	}
 
 	return ioutil.WriteFile(path, content.Bytes(), 0644)
 }
@@ -98,6 +98,44 @@ nameserver 4.30.20.100`: {"foo.example.com", "example.com"},
 	}
 }
 
+func TestGetOptions(t *testing.T) {
+	for resolv, result := range map[string][]string{
+		`options ndots:2`:                  {"ndots:2"},
+		` 	 options 	 ndots:2 rotate # ignored`: {"ndots:2", "rotate"},
+		``:                              {},
+		`# options ndots:2`:             {},
+		`nameserver 1.2.3.4
+options ndots:2
+search example.com
+options timeout:1 edns0`: {"ndots:2", "timeout:1", "edns0"},
+	} {
+		test := GetOptions([]byte(resolv))
+		if !strSlicesEqual(test, result) {
+			t.Fatalf("Wrong options string {%s} should be %v. Input: %s", test, result, resolv)
+		}
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	merged := MergeOptions([]string{"ndots:1", "rotate", "timeout:2"}, []string{"edns0", "ndots:5", "rotate"})
+	if expected := []string{"ndots:5", "rotate", "timeout:2", "edns0"}; !strSlicesEqual(merged, expected) {
+		t.Fatalf("Expected merged options %v, got %v", expected, merged)
+	}
+}
+
+func TestValidateOption(t *testing.T) {
+	for _, valid := range []string{"ndots:0", "ndots:15", "timeout:30", "attempts:5", "rotate", "edns0"} {
+		if err := ValidateOption(valid); err != nil {
+			t.Fatalf("Expected %s to be valid: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"ndots", "ndots:16", "ndots:-1", "timeout:x", "attempts:6", "rotate:1", "debug", ""} {
+		if err := ValidateOption(invalid); err == nil {
+			t.Fatalf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
 func strSlicesEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -119,7 +157,7 @@ func TestBuild(t *testing.T) {
 	}
 	defer os.Remove(file.Name())
 
-	err = Build(file.Name(), []string{"ns1", "ns2", "ns3"}, []string{"search1"})
+	err = Build(file.Name(), []string{"ns1", "ns2", "ns3"}, []string{"search1"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -141,7 +179,7 @@ func TestBuildWithZeroLengthDomainSearch(t *testing.T) {
 	}
 	defer os.Remove(file.Name())
 
-	err = Build(file.Name(), []string{"ns1", "ns2", "ns3"}, []string{"."})
+	err = Build(file.Name(), []string{"ns1", "ns2", "ns3"}, []string{"."}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -159,45 +197,82 @@ func TestBuildWithZeroLengthDomainSearch(t *testing.T) {
 	}
 }
 
+func TestBuildWithOptions(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	err = Build(file.Name(), []string{"ns1"}, []string{"search1"}, []string{"ndots:5", "rotate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "nameserver ns1\nsearch search1\noptions ndots:5 rotate\n"; string(content) != expected {
+		t.Fatalf("Expected '%s' got '%s'", expected, content)
+	}
+}
+
+func TestFilterResolvDNSOptions(t *testing.T) {
+	// the host options are kept as is without dns options
+	ns1 := "nameserver 10.16.60.14\noptions ndots:1 timeout:2\n"
+	if result, changed := FilterResolvDNS([]byte(ns1), false, nil); changed || string(result) != ns1 {
+		t.Fatalf("Expected the options to be kept: expected \n<%s> got \n<%s>", ns1, result)
+	}
+
+	// the dns options are merged into a single options line
+	ns1 = "options ndots:1\nnameserver 10.16.60.14\noptions timeout:2\nsearch example.com"
+	ns0 := "nameserver 10.16.60.14\nsearch example.com\noptions ndots:5 timeout:2 edns0\n"
+	if result, changed := FilterResolvDNS([]byte(ns1), false, []string{"ndots:5", "edns0"}); !changed || string(result) != ns0 {
+		t.Fatalf("Failed merging options: expected \n<%s> got \n<%s>", ns0, result)
+	}
+}
+
 func TestFilterResolvDns(t *testing.T) {
 	ns0 := "nameserver 10.16.60.14\nnameserver 10.16.60.21\n"
 
-	if result, _ := FilterResolvDNS([]byte(ns0), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns0), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed No Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
 	}
 
 	ns1 := "nameserver 10.16.60.14\nnameserver 10.16.60.21\nnameserver 127.0.0.1\n"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
 	}
 
 	ns1 = "nameserver 10.16.60.14\nnameserver 127.0.0.1\nnameserver 10.16.60.21\n"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
 	}
 
 	ns1 = "nameserver 127.0.1.1\nnameserver 10.16.60.14\nnameserver 10.16.60.21\n"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
 	}
 
 	ns1 = "nameserver ::1\nnameserver 10.16.60.14\nnameserver 127.0.2.1\nnameserver 10.16.60.21\n"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
 	}
 
 	ns1 = "nameserver 10.16.60.14\nnameserver ::1\nnameserver 10.16.60.21\nnameserver ::1"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
@@ -205,7 +280,7 @@ func TestFilterResolvDns(t *testing.T) {
 
 	// with IPv6 disabled (false param), the IPv6 nameserver should be removed
 	ns1 = "nameserver 10.16.60.14\nnameserver 2002:dead:beef::1\nnameserver 10.16.60.21\nnameserver ::1"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost+IPv6 off: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
@@ -214,7 +289,7 @@ func TestFilterResolvDns(t *testing.T) {
 	// with IPv6 enabled, the IPv6 nameserver should be preserved
 	ns0 = "nameserver 10.16.60.14\nnameserver 2002:dead:beef::1\nnameserver 10.16.60.21\n"
 	ns1 = "nameserver 10.16.60.14\nnameserver 2002:dead:beef::1\nnameserver 10.16.60.21\nnameserver ::1"
-	if result, _ := FilterResolvDNS([]byte(ns1), true); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), true, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed Localhost+IPv6 on: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
@@ -223,7 +298,7 @@ func TestFilterResolvDns(t *testing.T) {
 	// with IPv6 enabled, and no non-localhost servers, Google defaults (both IPv4+IPv6) should be added
 	ns0 = "\nnameserver 8.8.8.8\nnameserver 8.8.4.4\nnameserver 2001:4860:4860::8888\nnameserver 2001:4860:4860::8844"
 	ns1 = "nameserver 127.0.0.1\nnameserver ::1\nnameserver 127.0.2.1"
-	if result, _ := FilterResolvDNS([]byte(ns1), true); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), true, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed no Localhost+IPv6 enabled: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
@@ -232,7 +307,7 @@ func TestFilterResolvDns(t *testing.T) {
 	// with IPv6 disabled, and no non-localhost servers, Google defaults (only IPv4) should be added
 	ns0 = "\nnameserver 8.8.8.8\nnameserver 8.8.4.4"
 	ns1 = "nameserver 127.0.0.1\nnameserver ::1\nnameserver 127.0.2.1"
-	if result, _ := FilterResolvDNS([]byte(ns1), false); result != nil {
+	if result, _ := FilterResolvDNS([]byte(ns1), false, nil); result != nil {
 		if ns0 != string(result) {
 			t.Fatalf("Failed no Localhost+IPv6 enabled: expected \n<%s> got \n<%s>", ns0, string(result))
 		}
@@ -0,0 +1,101 @@
+package resolvconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The events reporting that a file of a watched directory was written,
+// replaced or removed
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM
+
+// Watcher reports the changes of a resolv.conf file. The directory of the
+// file is watched rather than the file, for its replacements to be reported,
+// along with the directory of its target when the file is a symbolic link.
+type Watcher struct {
+	file   *os.File
+	names  map[int32]map[string]bool
+	events chan struct{}
+}
+
+// NewWatcher returns a watcher of the resolv.conf file at path
+func NewWatcher(path string) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		names:  make(map[int32]map[string]bool),
+		events: make(chan struct{}, 1),
+	}
+
+	paths := []string{path}
+	if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+		paths = append(paths, target)
+	}
+
+	for _, p := range paths {
+		wd, err := syscall.InotifyAddWatch(fd, filepath.Dir(p), watchMask)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+		if w.names[int32(wd)] == nil {
+			w.names[int32(wd)] = make(map[string]bool)
+		}
+		w.names[int32(wd)][filepath.Base(p)] = true
+	}
+
+	// The non blocking descriptor is polled, for Close to interrupt Read
+	w.file = os.NewFile(uintptr(fd), "inotify")
+
+	go w.watch()
+
+	return w, nil
+}
+
+// Events returns the channel receiving a value after the file changed. The
+// changes happening before the value is received are coalesced. The channel
+// is closed when the watcher is.
+func (w *Watcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) watch() {
+	defer close(w.events)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		changed := false
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:start+int(ev.Len)]), "\x00")
+			if w.names[ev.Wd][name] {
+				changed = true
+			}
+			off = start + int(ev.Len)
+		}
+
+		if changed {
+			select {
+			case w.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package resolvconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func expectEvent(t *testing.T, w *Watcher, expected bool, what string) {
+	timeout := 5 * time.Second
+	if !expected {
+		timeout = 200 * time.Millisecond
+	}
+
+	select {
+	case _, ok := <-w.Events():
+		if !ok {
+			t.Fatalf("Watcher closed while waiting for %s", what)
+		}
+		if !expected {
+			t.Fatalf("Unexpected event for %s", what)
+		}
+	case <-time.After(timeout):
+		if expected {
+			t.Fatalf("No event for %s", what)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolvconf-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The watched file is a link to a file of another directory
+	target := filepath.Join(dir, "run", "resolv.conf")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(target, []byte("nameserver 1.2.3.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "resolv.conf")
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(target, []byte("nameserver 5.6.7.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, true, "a write of the link target")
+
+	tmp := filepath.Join(dir, "resolv.conf.tmp")
+	if err := ioutil.WriteFile(tmp, []byte("nameserver 9.9.9.9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, false, "a write of another file")
+
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, true, "a replacement of the file")
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Fatal("Expected the events channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the events channel to be closed with the watcher")
+	}
+}
@@ -0,0 +1,26 @@
+// +build !linux
+
+package resolvconf
+
+import "errors"
+
+// ErrNotImplemented is returned when watching resolv.conf is not supported
+var ErrNotImplemented = errors.New("not implemented")
+
+// Watcher reports the changes of a resolv.conf file
+type Watcher struct{}
+
+// NewWatcher returns a watcher of the resolv.conf file at path
+func NewWatcher(path string) (*Watcher, error) {
+	return nil, ErrNotImplemented
+}
+
+// Events returns the channel receiving a value after the file changed
+func (w *Watcher) Events() <-chan struct{} {
+	return nil
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() error {
+	return nil
+}
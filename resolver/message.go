@@ -0,0 +1,264 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DNS resource record types and class, RFC 1035 and RFC 3596
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeAAAA = 28
+
+	classINET = 1
+)
+
+// DNS response codes
+const (
+	rcodeSuccess       = 0
+	rcodeFormatError   = 1
+	rcodeServerFailure = 2
+)
+
+// DNS header flags
+const (
+	flagResponse           = 1 << 15
+	flagAuthoritative      = 1 << 10
+	flagRecursionDesired   = 1 << 8
+	flagRecursionAvailable = 1 << 7
+
+	opcodeMask  = 0xf << 11
+	opcodeQuery = 0
+)
+
+const (
+	headerLen     = 12
+	maxLabelLen   = 63
+	maxNameLen    = 255
+	maxPointerHop = 16
+)
+
+var (
+	errShortMessage = errors.New("dns message too short")
+	errInvalidName  = errors.New("invalid dns name")
+)
+
+// question is the question section of a query
+type question struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+// query is a parsed DNS query. Only its header is set when its question
+// section cannot be parsed.
+type query struct {
+	id       uint16
+	flags    uint16
+	qdcount  uint16
+	question question
+}
+
+// answer is a resource record of the answer section of a reply
+type answer struct {
+	rtype uint16
+	ttl   uint32
+	data  []byte
+}
+
+// parseQuery parses the header and the first question of the message. The
+// returned query is nil when the message has no complete header.
+func parseQuery(msg []byte) (*query, error) {
+	if len(msg) < headerLen {
+		return nil, errShortMessage
+	}
+
+	q := &query{
+		id:      binary.BigEndian.Uint16(msg[0:]),
+		flags:   binary.BigEndian.Uint16(msg[2:]),
+		qdcount: binary.BigEndian.Uint16(msg[4:]),
+	}
+	if q.qdcount == 0 {
+		return q, nil
+	}
+
+	name, off, err := readName(msg, headerLen)
+	if err != nil {
+		return q, err
+	}
+	if len(msg) < off+4 {
+		return q, errShortMessage
+	}
+
+	q.question = question{
+		name:   name,
+		qtype:  binary.BigEndian.Uint16(msg[off:]),
+		qclass: binary.BigEndian.Uint16(msg[off+2:]),
+	}
+
+	return q, nil
+}
+
+// isStandard tells whether the query is a single question standard query of
+// the internet class, the only ones the resolver answers itself
+func (q *query) isStandard() bool {
+	return q.flags&flagResponse == 0 && q.flags&opcodeMask == opcodeQuery &&
+		q.qdcount == 1 && q.question.qclass == classINET
+}
+
+// reply builds the reply to the query with the response code and answers.
+// The answers are records of the queried name.
+func (q *query) reply(rcode int, answers []answer) ([]byte, error) {
+	flags := uint16(flagResponse|flagRecursionAvailable) | q.flags&(opcodeMask|flagRecursionDesired) | uint16(rcode)
+	if rcode == rcodeSuccess && len(answers) != 0 {
+		flags |= flagAuthoritative
+	}
+
+	msg := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(msg[0:], q.id)
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	if q.question.name == "" {
+		return msg, nil
+	}
+
+	name, err := packName(q.question.name)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+
+	msg = append(msg, name...)
+	msg = appendUint16(msg, q.question.qtype, q.question.qclass)
+
+	for _, a := range answers {
+		msg = append(msg, name...)
+		msg = appendUint16(msg, a.rtype, classINET)
+		msg = append(msg, byte(a.ttl>>24), byte(a.ttl>>16), byte(a.ttl>>8), byte(a.ttl))
+		msg = appendUint16(msg, uint16(len(a.data)))
+		msg = append(msg, a.data...)
+	}
+
+	return msg, nil
+}
+
+func appendUint16(b []byte, values ...uint16) []byte {
+	for _, v := range values {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// readName reads the domain name at off in the message, following the
+// compression pointers, and returns it with a trailing dot along with the
+// offset following it.
+func readName(msg []byte, off int) (string, int, error) {
+	var (
+		labels []string
+		end    = -1
+		hops   int
+		length int
+	)
+
+	for {
+		if off >= len(msg) {
+			return "", 0, errShortMessage
+		}
+
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				return strings.Join(labels, ".") + ".", end, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errShortMessage
+			}
+			length += c + 1
+			if length > maxNameLen {
+				return "", 0, errInvalidName
+			}
+			labels = append(labels, string(msg[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errShortMessage
+			}
+			if hops++; hops > maxPointerHop {
+				return "", 0, errInvalidName
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			return "", 0, errInvalidName
+		}
+	}
+}
+
+// packName returns the wire form of the domain name, with or without a
+// trailing dot
+func packName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name)+2 > maxNameLen {
+		return nil, errInvalidName
+	}
+
+	b := make([]byte, 0, len(name)+2)
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > maxLabelLen {
+				return nil, errInvalidName
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+
+	return append(b, 0), nil
+}
+
+// ptrToIP returns the address of an in-addr.arpa or ip6.arpa name, nil when
+// the name is not a reverse lookup name
+func ptrToIP(name string) net.IP {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		parts := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(parts) != net.IPv4len {
+			return nil
+		}
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+		return net.ParseIP(strings.Join(parts, ".")).To4()
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		parts := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(parts) != 2*net.IPv6len {
+			return nil
+		}
+		nibbles := make([]byte, 0, len(parts))
+		for i := len(parts) - 1; i >= 0; i-- {
+			if len(parts[i]) != 1 {
+				return nil
+			}
+			nibbles = append(nibbles, parts[i][0])
+		}
+		ip, err := hex.DecodeString(string(nibbles))
+		if err != nil {
+			return nil
+		}
+		return net.IP(ip)
+	}
+
+	return nil
+}
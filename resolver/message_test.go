@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// newQuery returns the message of a recursive query for the name
+func newQuery(t *testing.T, id uint16, name string, qtype uint16) []byte {
+	qname, err := packName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, headerLen)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], flagRecursionDesired)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	msg = append(msg, qname...)
+	return appendUint16(msg, qtype, classINET)
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := parseQuery(newQuery(t, 0x1234, "web.example.com", typeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.id != 0x1234 || !q.isStandard() {
+		t.Fatalf("Unexpected query %+v", q)
+	}
+	if q.question != (question{name: "web.example.com.", qtype: typeA, qclass: classINET}) {
+		t.Fatalf("Unexpected question %+v", q.question)
+	}
+
+	// A question name made of a label and a pointer to a previous name
+	msg := newQuery(t, 1, "example.com", typeA)
+	msg[5] = 2
+	msg = append(msg, 3, 'w', 'e', 'b', 0xc0, headerLen)
+	msg = appendUint16(msg, typeAAAA, classINET)
+	name, off, err := readName(msg, len(msg)-10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "web.example.com." || off != len(msg)-4 {
+		t.Fatalf("Unexpected compressed name %q ending at %d", name, off)
+	}
+
+	if q, err := parseQuery(msg[:headerLen-1]); q != nil || err == nil {
+		t.Fatal("Expected failure parsing a truncated header")
+	}
+	if q, err := parseQuery(msg[:headerLen+5]); q == nil || err == nil {
+		t.Fatal("Expected the header of a truncated question to be parsed")
+	}
+
+	// A pointer to itself
+	loop := append(newQuery(t, 1, "", typeA)[:headerLen], 0xc0, headerLen, 0, 1, 0, 1)
+	if _, err := parseQuery(loop); err != errInvalidName {
+		t.Fatalf("Expected errInvalidName for a pointer loop, got %v", err)
+	}
+}
+
+func TestReply(t *testing.T) {
+	q, err := parseQuery(newQuery(t, 7, "web", typeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := q.reply(rcodeSuccess, []answer{{rtype: typeA, ttl: 600, data: net.ParseIP("172.17.0.2").To4()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0, 7, 0x85, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		3, 'w', 'e', 'b', 0, 0, 1, 0, 1,
+		3, 'w', 'e', 'b', 0, 0, 1, 0, 1, 0, 0, 2, 0x58, 0, 4, 172, 17, 0, 2,
+	}
+	if !bytes.Equal(resp, expected) {
+		t.Fatalf("Expected reply\n%v\ngot\n%v", expected, resp)
+	}
+
+	if _, err := packName("a..b"); err != errInvalidName {
+		t.Fatalf("Expected errInvalidName for an empty label, got %v", err)
+	}
+}
+
+func TestPtrToIP(t *testing.T) {
+	for name, expected := range map[string]net.IP{
+		"2.0.17.172.in-addr.arpa.": net.ParseIP("172.17.0.2"),
+		"2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.IP6.ARPA.": net.ParseIP("2001:db8::2"),
+		"0.17.172.in-addr.arpa.":    nil,
+		"web.example.com.":          nil,
+		"x.0.17.172.in-addr.arpa.":  nil,
+		"20.0.0.0.0.0.0.ip6.arpa.":  nil,
+		"256.0.17.172.in-addr.arpa": nil,
+	} {
+		if ip := ptrToIP(name); !ip.Equal(expected) {
+			t.Fatalf("Expected %v for %s, got %v", expected, name, ip)
+		}
+	}
+}
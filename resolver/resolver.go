@@ -0,0 +1,352 @@
+// Package resolver implements the DNS server embedded in the sandboxes,
+// which resolves the names of the endpoints on the networks a sandbox is
+// attached to and forwards the other queries to the upstream servers.
+package resolver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultAddress is the address the resolvers listen on in the sandboxes
+const DefaultAddress = "127.0.0.11"
+
+const (
+	dnsPort = 53
+
+	// answerTTL is the time to live of the records the resolver answers
+	answerTTL = 600
+	// maxConcurrent is the number of queries handled at the same time
+	maxConcurrent = 100
+	// maxMsgSize is the size of the largest DNS message
+	maxMsgSize = 65535
+)
+
+var (
+	// forwardTimeout is how long the resolver waits for an upstream server
+	forwardTimeout = 4 * time.Second
+	// tcpIdleTimeout is how long a TCP client connection is kept idle
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// Backend resolves the names and the addresses of the endpoints the
+// resolver answers for
+type Backend interface {
+	// ResolveName returns the addresses of the endpoint of the name, none
+	// when the name is unknown. The name has no trailing dot.
+	ResolveName(name string) []net.IP
+
+	// ResolveIP returns the name of the endpoint of the address, an empty
+	// name when the address is unknown.
+	ResolveIP(ip net.IP) string
+}
+
+// Resolver is a DNS server answering the A, AAAA and PTR queries for the
+// names of its backend and forwarding the other queries to the upstream
+// servers. It serves both UDP and TCP on port 53 of DefaultAddress.
+type Resolver struct {
+	backend    Backend
+	listenAddr string
+	upstreams  []string
+	conn       *net.UDPConn
+	listener   *net.TCPListener
+	queries    chan struct{}
+	sync.Mutex
+}
+
+// New returns a resolver answering for the backend
+func New(backend Backend) *Resolver {
+	return &Resolver{
+		backend:    backend,
+		listenAddr: net.JoinHostPort(DefaultAddress, fmt.Sprintf("%d", dnsPort)),
+		queries:    make(chan struct{}, maxConcurrent),
+	}
+}
+
+// SetUpstreams sets the servers the queries the resolver does not answer are
+// forwarded to, tried in order. The servers are IP addresses, queried on port
+// 53, or host:port addresses.
+func (r *Resolver) SetUpstreams(servers []string) {
+	upstreams := make([]string, 0, len(servers))
+	for _, s := range servers {
+		if net.ParseIP(s) != nil {
+			s = net.JoinHostPort(s, fmt.Sprintf("%d", dnsPort))
+		}
+		upstreams = append(upstreams, s)
+	}
+
+	r.Lock()
+	r.upstreams = upstreams
+	r.Unlock()
+}
+
+// Start opens the sockets of the resolver and serves the queries in the
+// background. The sockets are opened in the network namespace of the calling
+// thread.
+func (r *Resolver) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", r.listenAddr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp/%s: %v", r.listenAddr, err)
+	}
+
+	// Listen on the same port, the one picked for the UDP socket if none
+	// was requested
+	tcpAddr := &net.TCPAddr{IP: addr.IP, Port: conn.LocalAddr().(*net.UDPAddr).Port}
+	listener, err := net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to listen on tcp/%s: %v", tcpAddr, err)
+	}
+
+	r.Lock()
+	r.conn, r.listener = conn, listener
+	r.Unlock()
+
+	go r.serveUDP(conn)
+	go r.serveTCP(listener)
+
+	return nil
+}
+
+// Stop closes the sockets of the resolver
+func (r *Resolver) Stop() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	if r.listener != nil {
+		r.listener.Close()
+		r.listener = nil
+	}
+}
+
+func (r *Resolver) serveUDP(conn *net.UDPConn) {
+	for {
+		buf := make([]byte, maxMsgSize)
+		n, client, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The socket is closed when the resolver stops
+			logrus.Debugf("Stopping DNS resolver on udp/%s: %v", conn.LocalAddr(), err)
+			return
+		}
+
+		select {
+		case r.queries <- struct{}{}:
+		default:
+			logrus.Debugf("Dropping DNS query from %s: too many queries in progress", client)
+			continue
+		}
+
+		go func() {
+			defer func() { <-r.queries }()
+
+			if resp := r.handle(buf[:n], "udp"); resp != nil {
+				if _, err := conn.WriteToUDP(resp, client); err != nil {
+					logrus.Debugf("Failed to send DNS reply to %s: %v", client, err)
+				}
+			}
+		}()
+	}
+}
+
+func (r *Resolver) serveTCP(listener *net.TCPListener) {
+	for {
+		conn, err := listener.AcceptTCP()
+		if err != nil {
+			// The listener is closed when the resolver stops
+			logrus.Debugf("Stopping DNS resolver on tcp/%s: %v", listener.Addr(), err)
+			return
+		}
+
+		go r.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn answers the length prefixed queries of the connection until
+// it is closed or stays idle for tcpIdleTimeout
+func (r *Resolver) serveTCPConn(conn *net.TCPConn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+		msg, err := readTCPMsg(conn)
+		if err != nil {
+			return
+		}
+
+		r.queries <- struct{}{}
+		resp := r.handle(msg, "tcp")
+		<-r.queries
+
+		if resp == nil {
+			return
+		}
+		if err := writeTCPMsg(conn, resp); err != nil {
+			logrus.Debugf("Failed to send DNS reply to %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handle returns the reply to the query message, received over proto, nil
+// when the message cannot be replied to
+func (r *Resolver) handle(msg []byte, proto string) []byte {
+	q, err := parseQuery(msg)
+	if q == nil {
+		return nil
+	}
+	if err != nil {
+		return r.reply(q, rcodeFormatError, nil)
+	}
+
+	if resp := r.answer(q); resp != nil {
+		return resp
+	}
+
+	return r.forward(q, msg, proto)
+}
+
+// answer returns the reply to the query for a name of the backend, nil for
+// the other names
+func (r *Resolver) answer(q *query) []byte {
+	if !q.isStandard() {
+		return nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.question.name, "."))
+
+	if q.question.qtype == typePTR {
+		ip := ptrToIP(name)
+		if ip == nil {
+			return nil
+		}
+		target := r.backend.ResolveIP(ip)
+		if target == "" {
+			return nil
+		}
+		data, err := packName(target)
+		if err != nil {
+			logrus.Debugf("Invalid name %q of address %s: %v", target, ip, err)
+			return nil
+		}
+		return r.reply(q, rcodeSuccess, []answer{{rtype: typePTR, ttl: answerTTL, data: data}})
+	}
+
+	ips := r.backend.ResolveName(name)
+	if len(ips) == 0 {
+		return nil
+	}
+
+	// The name is known: the records of other types are missing
+	var answers []answer
+	for _, ip := range ips {
+		switch ip4 := ip.To4(); {
+		case q.question.qtype == typeA && ip4 != nil:
+			answers = append(answers, answer{rtype: typeA, ttl: answerTTL, data: ip4})
+		case q.question.qtype == typeAAAA && ip4 == nil && ip.To16() != nil:
+			answers = append(answers, answer{rtype: typeAAAA, ttl: answerTTL, data: ip.To16()})
+		}
+	}
+
+	return r.reply(q, rcodeSuccess, answers)
+}
+
+// forward relays the query message to the upstream servers, over the same
+// protocol it was received, and returns the first reply
+func (r *Resolver) forward(q *query, msg []byte, proto string) []byte {
+	r.Lock()
+	upstreams := r.upstreams
+	r.Unlock()
+
+	for _, server := range upstreams {
+		resp, err := exchange(proto, server, msg)
+		if err != nil {
+			logrus.Debugf("Failed to forward DNS query for %s to %s/%s: %v", q.question.name, proto, server, err)
+			continue
+		}
+		return resp
+	}
+
+	return r.reply(q, rcodeServerFailure, nil)
+}
+
+func (r *Resolver) reply(q *query, rcode int, answers []answer) []byte {
+	resp, err := q.reply(rcode, answers)
+	if err != nil {
+		logrus.Debugf("Failed to build DNS reply for %s: %v", q.question.name, err)
+		return nil
+	}
+	return resp
+}
+
+// exchange sends the query message to the server and returns its reply
+func exchange(proto, server string, msg []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(proto, server, forwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	if proto == "tcp" {
+		if err := writeTCPMsg(conn, msg); err != nil {
+			return nil, err
+		}
+		return readTCPMsg(conn)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip the late replies to previous queries
+		if n >= 2 && buf[0] == msg[0] && buf[1] == msg[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+func readTCPMsg(conn net.Conn) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func writeTCPMsg(conn net.Conn, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+
+	_, err := conn.Write(buf)
+	return err
+}
@@ -0,0 +1,206 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBackend map[string][]net.IP
+
+func (b testBackend) ResolveName(name string) []net.IP {
+	return b[name]
+}
+
+func (b testBackend) ResolveIP(ip net.IP) string {
+	for name, ips := range b {
+		for _, i := range ips {
+			if i.Equal(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// reply is the parsed reply to a test query
+type reply struct {
+	id      uint16
+	rcode   int
+	answers [][]byte
+}
+
+func parseReply(t *testing.T, msg []byte) reply {
+	q, err := parseQuery(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+
+	r := reply{id: q.id, rcode: int(q.flags & 0xf)}
+	off := len(msg)
+	if ancount := int(binary.BigEndian.Uint16(msg[6:])); ancount != 0 {
+		_, off, _ = readName(msg, headerLen)
+		off += 4
+		for i := 0; i < ancount; i++ {
+			if _, off, err = readName(msg, off); err != nil {
+				t.Fatal(err)
+			}
+			length := int(binary.BigEndian.Uint16(msg[off+8:]))
+			r.answers = append(r.answers, msg[off+10:off+10+length])
+			off += 10 + length
+		}
+	}
+	return r
+}
+
+func startResolver(t *testing.T, backend Backend, upstreams ...string) *Resolver {
+	r := New(backend)
+	r.listenAddr = "127.0.0.1:0"
+	r.SetUpstreams(upstreams)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func exchangeTest(t *testing.T, proto string, r *Resolver, msg []byte) reply {
+	addr := r.conn.LocalAddr().String()
+	conn, err := net.Dial(proto, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var resp []byte
+	if proto == "tcp" {
+		if err = writeTCPMsg(conn, msg); err == nil {
+			resp, err = readTCPMsg(conn)
+		}
+	} else if _, err = conn.Write(msg); err == nil {
+		resp = make([]byte, maxMsgSize)
+		var n int
+		n, err = conn.Read(resp)
+		resp = resp[:n]
+	}
+	if err != nil {
+		t.Fatalf("Query to %s/%s failed: %v", proto, addr, err)
+	}
+	return parseReply(t, resp)
+}
+
+// startUpstream starts an upstream server answering all the A queries with
+// the address, over UDP and TCP
+func startUpstream(t *testing.T, ip net.IP) (string, func()) {
+	upstream := startResolver(t, upstreamBackend{ip})
+	return upstream.conn.LocalAddr().String(), upstream.Stop
+}
+
+type upstreamBackend struct {
+	ip net.IP
+}
+
+func (b upstreamBackend) ResolveName(name string) []net.IP {
+	return []net.IP{b.ip}
+}
+
+func (b upstreamBackend) ResolveIP(ip net.IP) string {
+	return ""
+}
+
+func TestResolverAnswer(t *testing.T) {
+	backend := testBackend{
+		"web": {net.ParseIP("172.17.0.2"), net.ParseIP("2001:db8::2")},
+		"db":  {net.ParseIP("172.17.0.3")},
+	}
+	r := startResolver(t, backend)
+	defer r.Stop()
+
+	for _, proto := range []string{"udp", "tcp"} {
+		resp := exchangeTest(t, proto, r, newQuery(t, 1, "WEB.", typeA))
+		if resp.id != 1 || resp.rcode != rcodeSuccess || len(resp.answers) != 1 || !net.IP(resp.answers[0]).Equal(net.ParseIP("172.17.0.2")) {
+			t.Fatalf("Unexpected %s reply to the A query %+v", proto, resp)
+		}
+	}
+
+	resp := exchangeTest(t, "udp", r, newQuery(t, 2, "web", typeAAAA))
+	if resp.rcode != rcodeSuccess || len(resp.answers) != 1 || !net.IP(resp.answers[0]).Equal(net.ParseIP("2001:db8::2")) {
+		t.Fatalf("Unexpected reply to the AAAA query %+v", resp)
+	}
+
+	// The name is known but has no IPv6 address
+	resp = exchangeTest(t, "udp", r, newQuery(t, 3, "db", typeAAAA))
+	if resp.rcode != rcodeSuccess || len(resp.answers) != 0 {
+		t.Fatalf("Expected an empty reply to the AAAA query, got %+v", resp)
+	}
+
+	resp = exchangeTest(t, "udp", r, newQuery(t, 4, "3.0.17.172.in-addr.arpa", typePTR))
+	if resp.rcode != rcodeSuccess || len(resp.answers) != 1 {
+		t.Fatalf("Unexpected reply to the PTR query %+v", resp)
+	}
+	if name, _, err := readName(resp.answers[0], 0); err != nil || name != "db." {
+		t.Fatalf("Expected db. for the PTR query, got %q (%v)", name, err)
+	}
+
+	// The unknown names cannot be resolved without upstream servers
+	resp = exchangeTest(t, "udp", r, newQuery(t, 5, "www.example.com", typeA))
+	if resp.rcode != rcodeServerFailure {
+		t.Fatalf("Expected a server failure for an unknown name, got %+v", resp)
+	}
+}
+
+func TestResolverForward(t *testing.T) {
+	upstreamIP := net.ParseIP("192.0.2.1")
+	upstream, stop := startUpstream(t, upstreamIP)
+	defer stop()
+
+	defer func(timeout time.Duration) { forwardTimeout = timeout }(forwardTimeout)
+	forwardTimeout = 200 * time.Millisecond
+
+	// The first upstream server is not reachable
+	dead, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+
+	r := startResolver(t, testBackend{"web": {net.ParseIP("172.17.0.2")}}, dead.LocalAddr().String(), upstream)
+	defer r.Stop()
+
+	for _, proto := range []string{"udp", "tcp"} {
+		resp := exchangeTest(t, proto, r, newQuery(t, 42, "www.example.com", typeA))
+		if resp.id != 42 || resp.rcode != rcodeSuccess || len(resp.answers) != 1 || !net.IP(resp.answers[0]).Equal(upstreamIP) {
+			t.Fatalf("Unexpected %s reply to the forwarded query %+v", proto, resp)
+		}
+	}
+
+	// The backend names are not forwarded
+	resp := exchangeTest(t, "udp", r, newQuery(t, 43, "web", typeA))
+	if len(resp.answers) != 1 || !net.IP(resp.answers[0]).Equal(net.ParseIP("172.17.0.2")) {
+		t.Fatalf("Unexpected reply to the query for a backend name %+v", resp)
+	}
+}
+
+func TestResolverStop(t *testing.T) {
+	r := startResolver(t, testBackend{})
+	addr := r.conn.LocalAddr().String()
+	r.Stop()
+
+	if _, err := net.Dial("tcp", addr); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("Expected the stopped resolver to refuse connections, got %v", err)
+	}
+}
+
+func TestSetUpstreams(t *testing.T) {
+	r := New(testBackend{})
+	r.SetUpstreams([]string{"8.8.8.8", "2001:4860:4860::8888", "127.0.0.1:5353"})
+
+	expected := []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53", "127.0.0.1:5353"}
+	for i, u := range r.upstreams {
+		if u != expected[i] {
+			t.Fatalf("Expected upstreams %v, got %v", expected, r.upstreams)
+		}
+	}
+}
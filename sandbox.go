@@ -0,0 +1,1053 @@
+package libnetwork
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/libnetwork/etchosts"
+	"github.com/docker/libnetwork/resolvconf"
+	"github.com/docker/libnetwork/resolver"
+	"github.com/docker/libnetwork/sandbox"
+	"github.com/docker/libnetwork/types"
+)
+
+// Sandbox provides the control over the network container entity. It is a
+// one to one mapping with the container and owns the network namespace, the
+// /etc/hosts and the /etc/resolv.conf files shared by all the endpoints which
+// join it.
+type Sandbox interface {
+	// ID returns the ID of the sandbox
+	ID() string
+
+	// ContainerID returns the ID of the container the sandbox was created for
+	ContainerID() string
+
+	// Key returns the sandbox key, the path of its network namespace
+	Key() string
+
+	// Endpoints returns the endpoints joined to the sandbox, in join order
+	Endpoints() []Endpoint
+
+	// Delete leaves all the endpoints joined to the sandbox and destroys it
+	Delete() error
+}
+
+// SandboxOption is a option setter function type used to pass various options to
+// NewSandbox method. The various setter functions of type SandboxOption are
+// provided by libnetwork, they look like SandboxOptionXXXX(...)
+type SandboxOption func(sb *containerSandbox)
+
+// These are the container configs used to customize container /etc/hosts file.
+type hostsPathConfig struct {
+	hostName      string
+	domainName    string
+	hostsPath     string
+	extraHosts    []extraHost
+	parentUpdates []parentUpdate
+}
+
+// These are the container configs used to customize container /etc/resolv.conf file.
+type resolvConfPathConfig struct {
+	resolvConfPath string
+	dnsList        []string
+	dnsSearchList  []string
+	useEmbeddedDNS bool
+}
+
+type containerConfig struct {
+	hostsPathConfig
+	resolvConfPathConfig
+	generic           map[string]interface{}
+	useDefaultSandBox bool
+}
+
+type extraHost struct {
+	name string
+	IP   string
+}
+
+type parentUpdate struct {
+	eid  string
+	name string
+	ip   string
+}
+
+type containerSandbox struct {
+	id          string
+	containerID string
+	key         string
+	config      containerConfig
+	osSbox      sandbox.Sandbox
+	controller  *controller
+	endpoints   []*endpoint
+	gwEndpoint  *endpoint
+	resolver    *resolver.Resolver
+	sync.Mutex
+}
+
+type containerSandboxTable map[string]*containerSandbox
+
+const defaultPrefix = "/var/lib/docker/network/files"
+
+func (sb *containerSandbox) ID() string {
+	return sb.id
+}
+
+func (sb *containerSandbox) ContainerID() string {
+	return sb.containerID
+}
+
+func (sb *containerSandbox) Key() string {
+	return sb.key
+}
+
+func (sb *containerSandbox) Endpoints() []Endpoint {
+	sb.Lock()
+	defer sb.Unlock()
+
+	list := make([]Endpoint, 0, len(sb.endpoints))
+	for _, ep := range sb.endpoints {
+		list = append(list, ep)
+	}
+
+	return list
+}
+
+func (sb *containerSandbox) Delete() error {
+	c := sb.controller
+
+	sb.Lock()
+	if sb.osSbox == nil {
+		sb.Unlock()
+		return ErrNoSuchSandbox(sb.id)
+	}
+	eps := make([]*endpoint, len(sb.endpoints))
+	copy(eps, sb.endpoints)
+	sb.Unlock()
+
+	for _, ep := range eps {
+		if err := ep.Leave(sb); err != nil {
+			log.Warnf("Failed to leave endpoint %s while deleting sandbox %s: %v", ep.Name(), sb.id, err)
+		}
+	}
+
+	c.Lock()
+	delete(c.containerSandboxes, sb.id)
+	c.Unlock()
+
+	sb.Lock()
+	sb.osSbox = nil
+	r := sb.resolver
+	sb.resolver = nil
+	sb.Unlock()
+
+	if r != nil {
+		r.Stop()
+	}
+
+	c.sandboxRm(sb.key)
+
+	if err := c.deleteFromStore(sb.kv()); err != nil {
+		log.Warnf("Failed to delete sandbox %s from the store: %v", sb.id, err)
+	}
+
+	return nil
+}
+
+func (sb *containerSandbox) processOptions(options ...SandboxOption) {
+	for _, opt := range options {
+		if opt != nil {
+			opt(sb)
+		}
+	}
+}
+
+func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (Sandbox, error) {
+	if containerID == "" {
+		return nil, InvalidContainerIDError(containerID)
+	}
+
+	var found Sandbox
+	c.WalkSandboxes(func(current Sandbox) bool {
+		if current.ContainerID() == containerID {
+			found = current
+			return true
+		}
+		return false
+	})
+	if found != nil {
+		return nil, SandboxExistsError(containerID)
+	}
+
+	sb := &containerSandbox{
+		id:          stringid.GenerateRandomID(),
+		containerID: containerID,
+		config: containerConfig{
+			hostsPathConfig: hostsPathConfig{
+				extraHosts:    []extraHost{},
+				parentUpdates: []parentUpdate{},
+			},
+		},
+		controller: c,
+	}
+	sb.processOptions(options...)
+	sb.newResolver()
+
+	if sb.config.hostsPath == "" {
+		sb.config.hostsPath = defaultPrefix + "/" + containerID + "/hosts"
+	}
+
+	if sb.config.resolvConfPath == "" {
+		sb.config.resolvConfPath = defaultPrefix + "/" + containerID + "/resolv.conf"
+	}
+
+	sb.key = sandbox.GenerateKey(containerID)
+	if sb.config.useDefaultSandBox {
+		sb.key = sandbox.GenerateKey("default")
+	}
+
+	if err := sb.buildHostsFile(); err != nil {
+		return nil, err
+	}
+
+	if err := sb.setupDNS(); err != nil {
+		return nil, err
+	}
+
+	osSbox, err := c.sandboxAdd(sb.key, !sb.config.useDefaultSandBox)
+	if err != nil {
+		return nil, err
+	}
+	sb.osSbox = osSbox
+
+	if sb.resolver != nil {
+		if err := sb.startResolver(); err != nil {
+			c.sandboxRm(sb.key)
+			return nil, fmt.Errorf("failed to start the DNS resolver of sandbox %s: %v", sb.id, err)
+		}
+	}
+
+	c.Lock()
+	c.containerSandboxes[sb.id] = sb
+	c.Unlock()
+
+	if err := c.updateToStore(sb.kv()); err != nil {
+		log.Warnf("Failed to update sandbox %s in the store: %v", sb.id, err)
+	}
+
+	return sb, nil
+}
+
+func (c *controller) Sandboxes() []Sandbox {
+	c.Lock()
+	defer c.Unlock()
+
+	list := make([]Sandbox, 0, len(c.containerSandboxes))
+	for _, sb := range c.containerSandboxes {
+		list = append(list, sb)
+	}
+
+	return list
+}
+
+func (c *controller) WalkSandboxes(walker SandboxWalker) {
+	for _, sb := range c.Sandboxes() {
+		if walker(sb) {
+			return
+		}
+	}
+}
+
+func (c *controller) SandboxByID(id string) (Sandbox, error) {
+	if id == "" {
+		return nil, ErrInvalidID(id)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if sb, ok := c.containerSandboxes[id]; ok {
+		return sb, nil
+	}
+
+	return nil, ErrNoSuchSandbox(id)
+}
+
+// populateNetworkResources moves the interfaces of the joining endpoint into
+// the sandbox, programs its static routes and reprograms the default gateway
+// if the endpoint takes it over.
+func (sb *containerSandbox) populateNetworkResources(ep *endpoint) (err error) {
+	ep.Lock()
+	joinInfo := ep.joinInfo
+	ifaces := ep.iFaces
+	ep.Unlock()
+
+	sb.Lock()
+	defer sb.Unlock()
+
+	if sb.osSbox == nil {
+		return ErrNoSuchSandbox(sb.id)
+	}
+
+	var (
+		added  []*sandbox.Interface
+		routes []*types.StaticRoute
+	)
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, r := range routes {
+			if e := sb.osSbox.RemoveStaticRoute(r); e != nil {
+				log.Debugf("Remove static route failed: %v", e)
+			}
+		}
+		for _, a := range added {
+			if e := sb.osSbox.RemoveInterface(a); e != nil {
+				log.Debugf("Remove interface failed: %v", e)
+			}
+		}
+	}()
+
+	for _, i := range ifaces {
+		iface := &sandbox.Interface{
+			SrcName: i.srcName,
+			DstName: sb.interfaceName(i.dstName),
+			Address: &i.addr,
+		}
+		if i.addrv6.IP.To16() != nil {
+			iface.AddressIPv6 = &i.addrv6
+		}
+		for _, r := range joinInfo.staticRoutes {
+			if r.RouteType == types.CONNECTED && r.InterfaceID == i.id {
+				iface.Routes = append(iface.Routes, r.Destination)
+			}
+		}
+		if err = sb.osSbox.AddInterface(iface); err != nil {
+			return err
+		}
+		added = append(added, iface)
+
+		// The name in use inside the sandbox may differ from the one
+		// requested by the driver if another endpoint already took it
+		ep.Lock()
+		i.dstName = iface.DstName
+		ep.Unlock()
+	}
+
+	for _, r := range joinInfo.staticRoutes {
+		if r.RouteType != types.NEXTHOP {
+			continue
+		}
+		if err = sb.osSbox.AddStaticRoute(r); err != nil {
+			return err
+		}
+		routes = append(routes, r)
+	}
+
+	sb.endpoints = append(sb.endpoints, ep)
+
+	if err = sb.updateGateway(); err != nil {
+		sb.endpoints = sb.endpoints[:len(sb.endpoints)-1]
+		// Give the gateway back to the endpoint which provided it
+		if e := sb.updateGateway(); e != nil {
+			log.Warnf("Failed to restore the gateway of sandbox %s: %v", sb.id, e)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// clearNetworkResources removes the static routes of the leaving endpoint,
+// moves its interfaces out of the sandbox and, if the endpoint provided the
+// default gateway, hands it over to the next endpoint in line.
+func (sb *containerSandbox) clearNetworkResources(ep *endpoint) {
+	ep.Lock()
+	joinInfo := ep.joinInfo
+	ifaces := ep.iFaces
+	ep.Unlock()
+
+	sb.Lock()
+	defer sb.Unlock()
+
+	for idx, e := range sb.endpoints {
+		if e == ep {
+			sb.endpoints = append(sb.endpoints[:idx], sb.endpoints[idx+1:]...)
+			break
+		}
+	}
+
+	// The default route must be moved while the interface it goes through
+	// is still in the sandbox
+	if err := sb.updateGateway(); err != nil {
+		log.Warnf("Failed to update the gateway of sandbox %s: %v", sb.id, err)
+	}
+
+	if joinInfo != nil {
+		for _, r := range joinInfo.staticRoutes {
+			if r.RouteType != types.NEXTHOP {
+				continue
+			}
+			if err := sb.osSbox.RemoveStaticRoute(r); err != nil {
+				log.Debugf("Remove static route failed: %v", err)
+			}
+		}
+	}
+
+	for _, i := range ifaces {
+		for _, iface := range sb.osSbox.Interfaces() {
+			if iface.SrcName != i.srcName || iface.DstName != i.dstName {
+				continue
+			}
+			if err := sb.osSbox.RemoveInterface(iface); err != nil {
+				log.Debugf("Remove interface failed: %v", err)
+			}
+			break
+		}
+	}
+
+	if sb.gwEndpoint == ep {
+		sb.gwEndpoint = nil
+	}
+}
+
+// gatewayEndpoint returns the endpoint which should provide the default
+// gateway of the sandbox: the one with the highest priority among the
+// endpoints having a gateway, the first joined in case of a tie.
+func (sb *containerSandbox) gatewayEndpoint() *endpoint {
+	var (
+		gwEp *endpoint
+		prio int
+	)
+
+	for _, ep := range sb.endpoints {
+		ep.Lock()
+		ji := ep.joinInfo
+		ep.Unlock()
+
+		if ji == nil || (len(ji.gw) == 0 && len(ji.gw6) == 0) {
+			continue
+		}
+
+		if gwEp == nil || ji.priority > prio {
+			gwEp = ep
+			prio = ji.priority
+		}
+	}
+
+	return gwEp
+}
+
+// updateGateway programs the default gateway of the endpoint elected by
+// gatewayEndpoint, replacing the one currently set if it differs.
+func (sb *containerSandbox) updateGateway() error {
+	gwEp := sb.gatewayEndpoint()
+	if gwEp == sb.gwEndpoint {
+		return nil
+	}
+
+	if sb.gwEndpoint != nil {
+		if err := sb.osSbox.UnsetGateway(); err != nil {
+			return err
+		}
+
+		if err := sb.osSbox.UnsetGatewayIPv6(); err != nil {
+			return err
+		}
+
+		sb.gwEndpoint = nil
+	}
+
+	if gwEp == nil {
+		return nil
+	}
+
+	gwEp.Lock()
+	joinInfo := gwEp.joinInfo
+	gwEp.Unlock()
+
+	if err := sb.osSbox.SetGateway(joinInfo.gw); err != nil {
+		return err
+	}
+
+	if err := sb.osSbox.SetGatewayIPv6(joinInfo.gw6); err != nil {
+		if e := sb.osSbox.UnsetGateway(); e != nil {
+			log.Debugf("Unset gateway failed: %v", e)
+		}
+		return err
+	}
+
+	sb.gwEndpoint = gwEp
+
+	return nil
+}
+
+// interfaceName returns the name the interface requested as name is given in
+// the sandbox. The name is kept unless it is already in use, in which case
+// the first free index is appended to its non numeric prefix.
+func (sb *containerSandbox) interfaceName(name string) string {
+	used := make(map[string]bool)
+	for _, iface := range sb.osSbox.Interfaces() {
+		used[iface.DstName] = true
+	}
+
+	if !used[name] {
+		return name
+	}
+
+	prefix := strings.TrimRight(name, "0123456789")
+	for i := 0; ; i++ {
+		if n := fmt.Sprintf("%s%d", prefix, i); !used[n] {
+			return n
+		}
+	}
+}
+
+// isPrimary tells whether the endpoint is the first one joined to the
+// sandbox, the one whose address the container hostname resolves to.
+func (sb *containerSandbox) isPrimary(ep *endpoint) bool {
+	sb.Lock()
+	defer sb.Unlock()
+
+	return len(sb.endpoints) == 0 || sb.endpoints[0] == ep
+}
+
+func (sb *containerSandbox) enableIPv6() bool {
+	sb.Lock()
+	eps := make([]*endpoint, len(sb.endpoints))
+	copy(eps, sb.endpoints)
+	sb.Unlock()
+
+	for _, ep := range eps {
+		ep.Lock()
+		n := ep.network
+		ep.Unlock()
+
+		n.Lock()
+		enabled := n.enableIPv6
+		n.Unlock()
+
+		if enabled {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sb *containerSandbox) buildHostsFile() error {
+	var extraContent []etchosts.Record
+
+	sb.Lock()
+	config := sb.config.hostsPathConfig
+	var primary *endpoint
+	if len(sb.endpoints) != 0 {
+		primary = sb.endpoints[0]
+	}
+	sb.Unlock()
+
+	dir, _ := filepath.Split(config.hostsPath)
+	err := createBasePath(dir)
+	if err != nil {
+		return err
+	}
+
+	IP := ""
+	if primary != nil {
+		primary.Lock()
+		joinInfo := primary.joinInfo
+		ifaces := primary.iFaces
+		primary.Unlock()
+
+		if joinInfo != nil && joinInfo.hostsPath != "" {
+			content, err := ioutil.ReadFile(joinInfo.hostsPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if err == nil {
+				return ioutil.WriteFile(config.hostsPath, content, 0644)
+			}
+		}
+
+		if len(ifaces) != 0 && ifaces[0] != nil {
+			IP = ifaces[0].addr.IP.String()
+		}
+	}
+
+	for _, extraHost := range config.extraHosts {
+		extraContent = append(extraContent,
+			etchosts.Record{Hosts: extraHost.name, IP: extraHost.IP})
+	}
+
+	return etchosts.Build(config.hostsPath, IP, config.hostName,
+		config.domainName, extraContent)
+}
+
+// updateParentHosts adds the records of the parent updates to the hosts
+// files of the containers joined to the parent endpoints which are on the
+// network of the passed endpoint. The existing entries of the updated names
+// are rewritten with their new address.
+func (sb *containerSandbox) updateParentHosts(ep *endpoint) error {
+	return sb.walkParentHosts(ep, func(hostsPath string, rec etchosts.Record) error {
+		if err := etchosts.Update(hostsPath, rec.IP, rec.Hosts); err != nil {
+			return err
+		}
+		return etchosts.Add(hostsPath, []etchosts.Record{rec})
+	})
+}
+
+// removeParentHosts removes the records updateParentHosts added for the
+// passed endpoint from the hosts files of the parent containers.
+func (sb *containerSandbox) removeParentHosts(ep *endpoint) error {
+	return sb.walkParentHosts(ep, func(hostsPath string, rec etchosts.Record) error {
+		return etchosts.Delete(hostsPath, []etchosts.Record{rec})
+	})
+}
+
+// walkParentHosts calls fn with the hosts file of the container joined to
+// each parent endpoint on the network of the passed endpoint, along with the
+// record of the parent update.
+func (sb *containerSandbox) walkParentHosts(ep *endpoint, fn func(hostsPath string, rec etchosts.Record) error) error {
+	sb.Lock()
+	parentUpdates := sb.config.parentUpdates
+	sb.Unlock()
+
+	ep.Lock()
+	network := ep.network
+	ep.Unlock()
+
+	for _, update := range parentUpdates {
+		network.Lock()
+		pep, ok := network.endpoints[types.UUID(update.eid)]
+		network.Unlock()
+		if !ok {
+			continue
+		}
+
+		psb := pep.getSandbox()
+		if psb == nil {
+			continue
+		}
+
+		psb.Lock()
+		hostsPath := psb.config.hostsPath
+		psb.Unlock()
+
+		if err := fn(hostsPath, etchosts.Record{Hosts: update.name, IP: update.ip}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sb *containerSandbox) updateDNS(resolvConf []byte, ipv6Enabled bool) error {
+	sb.Lock()
+	resolvConfPath := sb.config.resolvConfPath
+	sb.Unlock()
+
+	oldHash := []byte{}
+	hashFile := resolvConfPath + ".hash"
+
+	resolvBytes, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		oldHash, err = ioutil.ReadFile(hashFile)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+
+			oldHash = []byte{}
+		}
+	}
+
+	curHash, err := ioutils.HashData(bytes.NewReader(resolvBytes))
+	if err != nil {
+		return err
+	}
+
+	if string(oldHash) != "" && curHash != string(oldHash) {
+		// Seems the user has changed the container resolv.conf since the last time
+		// we checked so return without doing anything.
+		return nil
+	}
+
+	// replace any localhost/127.* and remove IPv6 nameservers if IPv6 disabled,
+	// and merge the DNS options of the joined endpoints.
+	resolvConf, _ = resolvconf.FilterResolvDNS(resolvConf, ipv6Enabled, sb.dnsOptions())
+
+	newHash, err := ioutils.HashData(bytes.NewReader(resolvConf))
+	if err != nil {
+		return err
+	}
+
+	// for atomic updates to these files, use temporary files with os.Rename:
+	dir := path.Dir(resolvConfPath)
+	tmpHashFile, err := ioutil.TempFile(dir, "hash")
+	if err != nil {
+		return err
+	}
+	tmpResolvFile, err := ioutil.TempFile(dir, "resolv")
+	if err != nil {
+		return err
+	}
+
+	// Change the perms to 0644 since ioutil.TempFile creates it by default as 0600
+	if err := os.Chmod(tmpResolvFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	// write the updates to the temp files
+	if err = ioutil.WriteFile(tmpHashFile.Name(), []byte(newHash), 0644); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(tmpResolvFile.Name(), resolvConf, 0644); err != nil {
+		return err
+	}
+
+	// rename the temp files for atomic replace
+	if err = os.Rename(tmpHashFile.Name(), hashFile); err != nil {
+		return err
+	}
+	return os.Rename(tmpResolvFile.Name(), resolvConfPath)
+}
+
+// setupDNS generates the resolv.conf of the sandbox. IPv6 nameservers are
+// kept only if one of the joined endpoints is on an IPv6 enabled network.
+func (sb *containerSandbox) setupDNS() error {
+	sb.Lock()
+	config := sb.config.resolvConfPathConfig
+	r := sb.resolver
+	sb.Unlock()
+
+	dir, _ := filepath.Split(config.resolvConfPath)
+	err := createBasePath(dir)
+	if err != nil {
+		return err
+	}
+
+	resolvConf, err := resolvconf.Get()
+	if err != nil {
+		return err
+	}
+
+	if r != nil {
+		return sb.setupEmbeddedDNS(r, resolvConf)
+	}
+
+	if len(config.dnsList) > 0 ||
+		len(config.dnsSearchList) > 0 {
+		var (
+			dnsList       = resolvconf.GetNameservers(resolvConf)
+			dnsSearchList = resolvconf.GetSearchDomains(resolvConf)
+		)
+
+		if len(config.dnsList) > 0 {
+			dnsList = config.dnsList
+		}
+
+		if len(config.dnsSearchList) > 0 {
+			dnsSearchList = config.dnsSearchList
+		}
+
+		dnsOptions := resolvconf.MergeOptions(resolvconf.GetOptions(resolvConf), sb.dnsOptions())
+
+		return resolvconf.Build(config.resolvConfPath, dnsList, dnsSearchList, dnsOptions)
+	}
+
+	return sb.updateDNS(resolvConf, sb.enableIPv6())
+}
+
+// dnsOptions returns the resolver options of the joined endpoints, those of
+// the endpoints joined last overriding the options of the same name.
+func (sb *containerSandbox) dnsOptions() []string {
+	sb.Lock()
+	endpoints := sb.endpoints
+	sb.Unlock()
+
+	var options []string
+	for _, ep := range endpoints {
+		ep.Lock()
+		if ep.joinInfo != nil {
+			options = resolvconf.MergeOptions(options, ep.joinInfo.dnsOptions)
+		}
+		ep.Unlock()
+	}
+
+	return options
+}
+
+// setupEmbeddedDNS points the resolv.conf of the sandbox to the embedded
+// resolver, which forwards the queries for the names it does not know to the
+// configured nameservers, or to the ones of the host.
+func (sb *containerSandbox) setupEmbeddedDNS(r *resolver.Resolver, resolvConf []byte) error {
+	sb.Lock()
+	config := sb.config.resolvConfPathConfig
+	sb.Unlock()
+
+	dnsList := config.dnsList
+	if len(dnsList) == 0 {
+		dnsList = resolvconf.GetNameservers(resolvConf)
+	}
+
+	dnsSearchList := config.dnsSearchList
+	if len(dnsSearchList) == 0 {
+		dnsSearchList = resolvconf.GetSearchDomains(resolvConf)
+	}
+
+	dnsOptions := resolvconf.MergeOptions(resolvconf.GetOptions(resolvConf), sb.dnsOptions())
+
+	r.SetUpstreams(dnsList)
+
+	return resolvconf.Build(config.resolvConfPath, []string{resolver.DefaultAddress}, dnsSearchList, dnsOptions)
+}
+
+// newResolver creates the embedded resolver of a sandbox configured with
+// one. The sandboxes sharing the host network namespace use the nameservers
+// of the host instead.
+func (sb *containerSandbox) newResolver() {
+	if sb.config.useEmbeddedDNS && !sb.config.useDefaultSandBox {
+		sb.resolver = resolver.New(sb)
+	}
+}
+
+// startResolver starts the embedded resolver of the sandbox, listening in
+// its network namespace.
+func (sb *containerSandbox) startResolver() error {
+	sb.Lock()
+	r := sb.resolver
+	osSbox := sb.osSbox
+	sb.Unlock()
+
+	var err error
+	if e := osSbox.InvokeFunc(func() { err = r.Start() }); e != nil {
+		return e
+	}
+
+	return err
+}
+
+// resolvableEndpoints returns the endpoints of the networks the sandbox is
+// attached to, network after network in join order.
+func (sb *containerSandbox) resolvableEndpoints() []*endpoint {
+	sb.Lock()
+	eps := make([]*endpoint, len(sb.endpoints))
+	copy(eps, sb.endpoints)
+	sb.Unlock()
+
+	var (
+		list []*endpoint
+		seen = make(map[*network]bool)
+	)
+	for _, ep := range eps {
+		ep.Lock()
+		n := ep.network
+		ep.Unlock()
+
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+
+		n.Lock()
+		for _, e := range n.endpoints {
+			list = append(list, e)
+		}
+		n.Unlock()
+	}
+
+	return list
+}
+
+// ResolveName returns the addresses of the endpoint named, or aliased, name
+// on the networks the sandbox is attached to. Only the endpoints joined to a
+// sandbox are resolved.
+func (sb *containerSandbox) ResolveName(name string) []net.IP {
+	for _, ep := range sb.resolvableEndpoints() {
+		var ips []net.IP
+
+		ep.Lock()
+		if ep.sandboxID != "" && ep.hasName(name) && len(ep.iFaces) != 0 {
+			i := ep.iFaces[0]
+			if i.addr.IP != nil {
+				ips = append(ips, types.GetIPCopy(i.addr.IP))
+			}
+			if i.addrv6.IP != nil {
+				ips = append(ips, types.GetIPCopy(i.addrv6.IP))
+			}
+		}
+		ep.Unlock()
+
+		if len(ips) != 0 {
+			return ips
+		}
+	}
+
+	return nil
+}
+
+// ResolveIP returns the name of the endpoint of the address on the networks
+// the sandbox is attached to.
+func (sb *containerSandbox) ResolveIP(ip net.IP) string {
+	for _, ep := range sb.resolvableEndpoints() {
+		var name string
+
+		ep.Lock()
+		if ep.sandboxID != "" {
+			for _, i := range ep.iFaces {
+				if i.addr.IP.Equal(ip) || i.addrv6.IP.Equal(ip) {
+					name = ep.name
+					break
+				}
+			}
+		}
+		ep.Unlock()
+
+		if name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// updateResolvConfs regenerates from the content of the host resolv.conf the
+// resolv.conf of the joined sandboxes which use the host DNS configuration.
+// The files modified since they were generated are left alone. The embedded
+// resolvers forward the queries to the new nameservers.
+func (c *controller) updateResolvConfs(resolvConf []byte) {
+	for _, s := range c.Sandboxes() {
+		sb := s.(*containerSandbox)
+
+		sb.Lock()
+		config := sb.config.resolvConfPathConfig
+		joined := len(sb.endpoints) != 0
+		r := sb.resolver
+		sb.Unlock()
+
+		if !joined || len(config.dnsList) > 0 {
+			continue
+		}
+
+		if r != nil {
+			r.SetUpstreams(resolvconf.GetNameservers(resolvConf))
+			continue
+		}
+
+		if len(config.dnsSearchList) > 0 {
+			continue
+		}
+
+		if err := sb.updateDNS(resolvConf, sb.enableIPv6()); err != nil {
+			log.Warnf("Failed to update the resolv.conf of sandbox %s: %v", sb.id, err)
+		}
+	}
+}
+
+// SandboxOptionHostname function returns an option setter for hostname option to
+// be passed to NewSandbox method.
+func SandboxOptionHostname(name string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.hostName = name
+	}
+}
+
+// SandboxOptionDomainname function returns an option setter for domainname option to
+// be passed to NewSandbox method.
+func SandboxOptionDomainname(name string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.domainName = name
+	}
+}
+
+// SandboxOptionHostsPath function returns an option setter for hostspath option to
+// be passed to NewSandbox method.
+func SandboxOptionHostsPath(path string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.hostsPath = path
+	}
+}
+
+// SandboxOptionExtraHost function returns an option setter for extra /etc/hosts options
+// which is a name and IP as strings.
+func SandboxOptionExtraHost(name string, IP string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.extraHosts = append(sb.config.extraHosts, extraHost{name: name, IP: IP})
+	}
+}
+
+// SandboxOptionParentUpdate function returns an option setter for parent container
+// which needs to update the IP address for the linked container.
+func SandboxOptionParentUpdate(eid string, name, ip string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.parentUpdates = append(sb.config.parentUpdates, parentUpdate{eid: eid, name: name, ip: ip})
+	}
+}
+
+// SandboxOptionResolvConfPath function returns an option setter for resolvconfpath option to
+// be passed to NewSandbox method.
+func SandboxOptionResolvConfPath(path string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.resolvConfPath = path
+	}
+}
+
+// SandboxOptionDNS function returns an option setter for dns entry option to
+// be passed to NewSandbox method.
+func SandboxOptionDNS(dns string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.dnsList = append(sb.config.dnsList, dns)
+	}
+}
+
+// SandboxOptionDNSSearch function returns an option setter for dns search entry option to
+// be passed to NewSandbox method.
+func SandboxOptionDNSSearch(search string) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.dnsSearchList = append(sb.config.dnsSearchList, search)
+	}
+}
+
+// SandboxOptionUseEmbeddedDNS function returns an option setter for using an
+// embedded DNS server to be passed to NewSandbox method. The server resolves
+// the names and aliases of the endpoints on the networks the sandbox is
+// attached to and forwards the other queries to the DNS servers of the
+// sandbox, or of the host. It is not available with the default sandbox.
+func SandboxOptionUseEmbeddedDNS() SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.useEmbeddedDNS = true
+	}
+}
+
+// SandboxOptionUseDefaultSandbox function returns an option setter for using default sandbox to
+// be passed to NewSandbox method.
+func SandboxOptionUseDefaultSandbox() SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.useDefaultSandBox = true
+	}
+}
+
+// SandboxOptionGeneric function returns an option setter for Generic configuration
+// that is not managed by libNetwork but can be used by the Drivers during the call to
+// endpoint join method. Container Labels are a good example.
+func SandboxOptionGeneric(generic map[string]interface{}) SandboxOption {
+	return func(sb *containerSandbox) {
+		sb.config.generic = generic
+	}
+}
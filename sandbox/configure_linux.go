@@ -30,6 +30,25 @@ func configureInterface(iface netlink.Link, settings *Interface) error {
 }
 
 func programGateway(path string, gw net.IP) error {
+	return updateRoute(path, nil, gw, false)
+}
+
+func removeGateway(path string, gw net.IP) error {
+	return updateRoute(path, nil, gw, true)
+}
+
+func programRoute(path string, dest *net.IPNet, nh net.IP) error {
+	return updateRoute(path, dest, nh, false)
+}
+
+func removeRoute(path string, dest *net.IPNet, nh net.IP) error {
+	return updateRoute(path, dest, nh, true)
+}
+
+// updateRoute adds or, if remove is set, deletes the route to dest through
+// the next hop nh in the network namespace at path. A nil dest stands for
+// the default route.
+func updateRoute(path string, dest *net.IPNet, nh net.IP, remove bool) error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -51,16 +70,39 @@ func programGateway(path string, gw net.IP) error {
 	}
 	defer netns.Set(origns)
 
-	gwRoutes, err := netlink.RouteGet(gw)
+	nhRoutes, err := netlink.RouteGet(nh)
 	if err != nil {
-		return fmt.Errorf("route for the gateway could not be found: %v", err)
+		return fmt.Errorf("route for the next hop %s could not be found: %v", nh, err)
 	}
 
-	return netlink.RouteAdd(&netlink.Route{
+	route := &netlink.Route{
 		Scope:     netlink.SCOPE_UNIVERSE,
-		LinkIndex: gwRoutes[0].LinkIndex,
-		Gw:        gw,
-	})
+		LinkIndex: nhRoutes[0].LinkIndex,
+		Gw:        nh,
+		Dst:       dest,
+	}
+
+	if remove {
+		return netlink.RouteDel(route)
+	}
+
+	return netlink.RouteAdd(route)
+}
+
+// setInterfaceRoutes programs the on-link routes of the interface, which must
+// be up.
+func setInterfaceRoutes(iface netlink.Link, settings *Interface) error {
+	for _, dest := range settings.Routes {
+		err := netlink.RouteAdd(&netlink.Route{
+			Scope:     netlink.SCOPE_LINK,
+			LinkIndex: iface.Attrs().Index,
+			Dst:       dest,
+		})
+		if err != nil {
+			return fmt.Errorf("error setting route to %s on interface %q: %v", dest, settings.DstName, err)
+		}
+	}
+	return nil
 }
 
 func setInterfaceIP(iface netlink.Link, settings *Interface) error {
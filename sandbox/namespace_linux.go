@@ -8,11 +8,18 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
 )
 
-const prefix = "/var/run/docker/netns"
+const (
+	prefix = "/var/run/docker/netns"
+
+	// Filesystem magic numbers of a bind mounted network namespace
+	nsfsMagic   = 0x6e736673
+	procfsMagic = 0x9fa0
+)
 
 var once sync.Once
 
@@ -53,6 +60,28 @@ func NewSandbox(key string, osCreate bool) (Sandbox, error) {
 	return &networkNamespace{path: key, sinfo: info}, nil
 }
 
+// RestoreSandbox provides a sandbox instance for a network namespace which
+// was created earlier, possibly by a previous instance of the process, and is
+// still mounted at the path identified by key. The passed info describes the
+// interfaces and gateways already programmed in the namespace.
+func RestoreSandbox(key string, info *Info) (Sandbox, error) {
+	var fs syscall.Statfs_t
+
+	if err := syscall.Statfs(key, &fs); err != nil {
+		return nil, fmt.Errorf("failed to restore network namespace %q: %v", key, err)
+	}
+
+	if fs.Type != nsfsMagic && fs.Type != procfsMagic {
+		return nil, fmt.Errorf("failed to restore network namespace %q: not a namespace mount", key)
+	}
+
+	if info == nil {
+		info = &Info{Interfaces: []*Interface{}}
+	}
+
+	return &networkNamespace{path: key, sinfo: info.GetCopy()}, nil
+}
+
 func createNetworkNamespace(path string, osCreate bool) (*Info, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -163,6 +192,13 @@ func (n *networkNamespace) RemoveInterface(i *Interface) error {
 		return err
 	}
 
+	for idx, si := range n.sinfo.Interfaces {
+		if si.Equal(i) {
+			n.sinfo.Interfaces = append(n.sinfo.Interfaces[:idx], n.sinfo.Interfaces[idx+1:]...)
+			break
+		}
+	}
+
 	return nil
 }
 
@@ -214,6 +250,11 @@ func (n *networkNamespace) AddInterface(i *Interface) error {
 		return err
 	}
 
+	// Routes can only be added to an interface which is up.
+	if err := setInterfaceRoutes(iface, i); err != nil {
+		return err
+	}
+
 	n.sinfo.Interfaces = append(n.sinfo.Interfaces, i)
 	return nil
 }
@@ -244,6 +285,91 @@ func (n *networkNamespace) SetGatewayIPv6(gw net.IP) error {
 	return err
 }
 
+func (n *networkNamespace) UnsetGateway() error {
+	if len(n.sinfo.Gateway) == 0 {
+		return nil
+	}
+
+	err := removeGateway(n.path, n.sinfo.Gateway)
+	if err == nil {
+		n.sinfo.Gateway = nil
+	}
+
+	return err
+}
+
+func (n *networkNamespace) UnsetGatewayIPv6() error {
+	if len(n.sinfo.GatewayIPv6) == 0 {
+		return nil
+	}
+
+	err := removeGateway(n.path, n.sinfo.GatewayIPv6)
+	if err == nil {
+		n.sinfo.GatewayIPv6 = nil
+	}
+
+	return err
+}
+
+func (n *networkNamespace) AddStaticRoute(r *types.StaticRoute) error {
+	if r.RouteType != types.NEXTHOP {
+		return fmt.Errorf("static route to %s is not a next hop route", r.Destination)
+	}
+
+	err := programRoute(n.path, r.Destination, r.NextHop)
+	if err == nil {
+		n.sinfo.StaticRoutes = append(n.sinfo.StaticRoutes, r)
+	}
+
+	return err
+}
+
+func (n *networkNamespace) RemoveStaticRoute(r *types.StaticRoute) error {
+	if r.RouteType != types.NEXTHOP {
+		return fmt.Errorf("static route to %s is not a next hop route", r.Destination)
+	}
+
+	err := removeRoute(n.path, r.Destination, r.NextHop)
+	if err != nil {
+		return err
+	}
+
+	for idx, sr := range n.sinfo.StaticRoutes {
+		if sr.Equal(r) {
+			n.sinfo.StaticRoutes = append(n.sinfo.StaticRoutes[:idx], n.sinfo.StaticRoutes[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (n *networkNamespace) InvokeFunc(f func()) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer origns.Close()
+
+	nsFD, err := os.OpenFile(n.path, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed get network namespace %q: %v", n.path, err)
+	}
+	defer nsFD.Close()
+
+	if err = netns.Set(netns.NsHandle(nsFD.Fd())); err != nil {
+		return err
+	}
+	defer netns.Set(origns)
+
+	f()
+
+	return nil
+}
+
 func (n *networkNamespace) Interfaces() []*Interface {
 	return n.sinfo.Interfaces
 }
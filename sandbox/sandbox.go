@@ -33,6 +33,23 @@ type Sandbox interface {
 	// Set default IPv6 gateway for the sandbox
 	SetGatewayIPv6(gw net.IP) error
 
+	// Unset the previously set default IPv4 gateway in the sandbox
+	UnsetGateway() error
+
+	// Unset the previously set default IPv6 gateway in the sandbox
+	UnsetGatewayIPv6() error
+
+	// Add a next hop static route to the sandbox. On-link routes are added
+	// along with the Interface they go through.
+	AddStaticRoute(*types.StaticRoute) error
+
+	// Remove a next hop static route previously added to the sandbox.
+	RemoveStaticRoute(*types.StaticRoute) error
+
+	// Run the passed function with the calling thread in the sandbox, for
+	// the sockets it opens to belong to the sandbox.
+	InvokeFunc(func()) error
+
 	// Destroy the sandbox
 	Destroy() error
 }
@@ -49,7 +66,10 @@ type Info struct {
 	// IPv6 gateway for the sandbox.
 	GatewayIPv6 net.IP
 
-	// TODO: Add routes and ip tables etc.
+	// Next hop static routes of the sandbox.
+	StaticRoutes []*types.StaticRoute
+
+	// TODO: Add ip tables etc.
 }
 
 // Interface represents the settings and identity of a network device. It is
@@ -70,6 +90,9 @@ type Interface struct {
 
 	// IPv6 address for the interface.
 	AddressIPv6 *net.IPNet
+
+	// Destinations reachable on-link through the interface.
+	Routes []*net.IPNet
 }
 
 // GetCopy returns a copy of this Interface structure
@@ -79,6 +102,7 @@ func (i *Interface) GetCopy() *Interface {
 		DstName:     i.DstName,
 		Address:     types.GetIPNetCopy(i.Address),
 		AddressIPv6: types.GetIPNetCopy(i.AddressIPv6),
+		Routes:      getIPNetListCopy(i.Routes),
 	}
 }
 
@@ -104,6 +128,16 @@ func (i *Interface) Equal(o *Interface) bool {
 		return false
 	}
 
+	if len(i.Routes) != len(o.Routes) {
+		return false
+	}
+
+	for idx := range i.Routes {
+		if !types.CompareIPNet(i.Routes[idx], o.Routes[idx]) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -116,7 +150,12 @@ func (s *Info) GetCopy() *Info {
 	gw := types.GetIPCopy(s.Gateway)
 	gw6 := types.GetIPCopy(s.GatewayIPv6)
 
-	return &Info{Interfaces: list, Gateway: gw, GatewayIPv6: gw6}
+	var routes []*types.StaticRoute
+	for _, r := range s.StaticRoutes {
+		routes = append(routes, r.GetCopy())
+	}
+
+	return &Info{Interfaces: list, Gateway: gw, GatewayIPv6: gw6, StaticRoutes: routes}
 }
 
 // Equal checks if this instance of SandboxInfo is equal to the passed one
@@ -150,6 +189,29 @@ func (s *Info) Equal(o *Info) bool {
 		}
 	}
 
+	if len(s.StaticRoutes) != len(o.StaticRoutes) {
+		return false
+	}
+
+	for i := 0; i < len(s.StaticRoutes); i++ {
+		if !s.StaticRoutes[i].Equal(o.StaticRoutes[i]) {
+			return false
+		}
+	}
+
 	return true
 
 }
+
+func getIPNetListCopy(list []*net.IPNet) []*net.IPNet {
+	if list == nil {
+		return nil
+	}
+
+	cp := make([]*net.IPNet, len(list))
+	for i, n := range list {
+		cp[i] = types.GetIPNetCopy(n)
+	}
+
+	return cp
+}
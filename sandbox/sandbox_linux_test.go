@@ -62,6 +62,12 @@ func newInfo(t *testing.T) (*Info, error) {
 	intf.AddressIPv6 = addrv6
 	intf.AddressIPv6.IP = ip6
 
+	_, route, err := net.ParseCIDR("192.168.2.0/24")
+	if err != nil {
+		return nil, err
+	}
+	intf.Routes = []*net.IPNet{route}
+
 	sinfo := &Info{Interfaces: []*Interface{intf}}
 	sinfo.Gateway = net.ParseIP("192.168.1.1")
 	// sinfo.GatewayIPv6 = net.ParseIP("2001:DB8::1")
@@ -102,4 +108,53 @@ func verifySandbox(t *testing.T, s Sandbox) {
 		t.Fatalf("Could not find the interface %s inside the sandbox: %v", sboxIfaceName,
 			err)
 	}
+
+	for _, i := range s.Interfaces() {
+		for _, r := range i.Routes {
+			if !hasRoute(t, r) {
+				t.Fatalf("Could not find the route to %s of interface %s inside the sandbox", r, i.DstName)
+			}
+		}
+	}
+}
+
+// verifyRoute checks whether the sandbox has a route to dest.
+func verifyRoute(t *testing.T, s Sandbox, dest *net.IPNet) bool {
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("Could not get the current netns: %v", err)
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(s.Key(), os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed top open network namespace path %q: %v", s.Key(), err)
+	}
+	defer f.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err = netns.Set(netns.NsHandle(f.Fd())); err != nil {
+		t.Fatalf("Setting to the namespace pointed to by the sandbox %s failed: %v", s.Key(), err)
+	}
+	defer netns.Set(origns)
+
+	return hasRoute(t, dest)
+}
+
+// hasRoute checks whether the current namespace has a route to dest.
+func hasRoute(t *testing.T, dest *net.IPNet) bool {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		t.Fatalf("Could not list the routes: %v", err)
+	}
+
+	for _, r := range routes {
+		if r.Dst != nil && r.Dst.String() == dest.String() {
+			return true
+		}
+	}
+
+	return false
 }
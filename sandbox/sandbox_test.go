@@ -2,7 +2,10 @@ package sandbox
 
 import (
 	"net"
+	"os"
 	"testing"
+
+	"github.com/docker/libnetwork/types"
 )
 
 func TestSandboxCreate(t *testing.T) {
@@ -43,6 +46,43 @@ func TestSandboxCreate(t *testing.T) {
 	}
 
 	verifySandbox(t, s)
+
+	_, dest, _ := net.ParseCIDR("10.20.0.0/16")
+	route := &types.StaticRoute{Destination: dest, RouteType: types.NEXTHOP, NextHop: info.Gateway}
+	err = s.AddStaticRoute(route)
+	if err != nil {
+		t.Fatalf("Failed to add static route to sandbox: %v", err)
+	}
+
+	if !verifyRoute(t, s, dest) {
+		t.Fatalf("Could not find the static route to %s inside the sandbox", dest)
+	}
+
+	err = s.RemoveStaticRoute(route)
+	if err != nil {
+		t.Fatalf("Failed to remove static route from sandbox: %v", err)
+	}
+
+	if verifyRoute(t, s, dest) {
+		t.Fatalf("Static route to %s still present inside the sandbox after removal", dest)
+	}
+
+	err = s.UnsetGateway()
+	if err != nil {
+		t.Fatalf("Failed to unset gateway in sandbox: %v", err)
+	}
+
+	err = s.UnsetGatewayIPv6()
+	if err != nil {
+		t.Fatalf("Failed to unset ipv6 gateway in sandbox: %v", err)
+	}
+
+	// The default route is gone, it must be possible to program it again
+	err = s.SetGateway(info.Gateway)
+	if err != nil {
+		t.Fatalf("Failed to set gateway to sandbox after unsetting it: %v", err)
+	}
+
 	s.Destroy()
 }
 
@@ -66,6 +106,70 @@ func TestSandboxCreateTwice(t *testing.T) {
 	s.Destroy()
 }
 
+func TestSandboxRestore(t *testing.T) {
+	key, err := newKey(t)
+	if err != nil {
+		t.Fatalf("Failed to obtain a key: %v", err)
+	}
+
+	s, err := NewSandbox(key, true)
+	if err != nil {
+		t.Fatalf("Failed to create a new sandbox: %v", err)
+	}
+	defer s.Destroy()
+
+	info := &Info{Interfaces: getInterfaceList(), Gateway: net.ParseIP("192.168.30.254")}
+	r, err := RestoreSandbox(key, info)
+	if err != nil {
+		t.Fatalf("Failed to restore the sandbox: %v", err)
+	}
+
+	if r.Key() != key {
+		t.Fatalf("r.Key() returned %s. Expected %s", r.Key(), key)
+	}
+
+	if len(r.Interfaces()) != len(info.Interfaces) {
+		t.Fatalf("Restored sandbox has %d interfaces. Expected %d", len(r.Interfaces()), len(info.Interfaces))
+	}
+
+	// A plain file is not a namespace and must not be restored
+	plain, err := newKey(t)
+	if err != nil {
+		t.Fatalf("Failed to obtain a key: %v", err)
+	}
+	defer os.Remove(plain)
+
+	if _, err := RestoreSandbox(plain, nil); err == nil {
+		t.Fatalf("Expected failure when restoring a sandbox from a plain file")
+	}
+}
+
+func TestSandboxInvokeFunc(t *testing.T) {
+	key, err := newKey(t)
+	if err != nil {
+		t.Fatalf("Failed to obtain a key: %v", err)
+	}
+
+	s, err := NewSandbox(key, true)
+	if err != nil {
+		t.Fatalf("Failed to create a new sandbox: %v", err)
+	}
+	defer s.Destroy()
+
+	var ifaces []net.Interface
+	if err := s.InvokeFunc(func() { ifaces, err = net.Interfaces() }); err != nil {
+		t.Fatalf("Failed to invoke a function in the sandbox: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new sandbox only holds its loopback interface
+	if len(ifaces) != 1 || ifaces[0].Name != "lo" {
+		t.Fatalf("Expected only the loopback interface in the sandbox, got %v", ifaces)
+	}
+}
+
 func TestInterfaceEqual(t *testing.T) {
 	list := getInterfaceList()
 
@@ -114,7 +218,9 @@ func TestInterfaceCopy(t *testing.T) {
 }
 
 func TestSandboxInfoCopy(t *testing.T) {
-	si := Info{Interfaces: getInterfaceList(), Gateway: net.ParseIP("192.168.1.254"), GatewayIPv6: net.ParseIP("2001:2345::abcd:8889")}
+	_, dest, _ := net.ParseCIDR("10.20.0.0/16")
+	routes := []*types.StaticRoute{&types.StaticRoute{Destination: dest, RouteType: types.NEXTHOP, NextHop: net.ParseIP("192.168.1.254")}}
+	si := Info{Interfaces: getInterfaceList(), Gateway: net.ParseIP("192.168.1.254"), GatewayIPv6: net.ParseIP("2001:2345::abcd:8889"), StaticRoutes: routes}
 	cp := si.GetCopy()
 
 	if !si.Equal(cp) {
@@ -131,6 +237,7 @@ func getInterfaceList() []*Interface {
 	_, netv4b, _ := net.ParseCIDR("172.18.255.2/23")
 	_, netv6a, _ := net.ParseCIDR("2001:2345::abcd:8888/80")
 	_, netv6b, _ := net.ParseCIDR("2001:2345::abcd:8889/80")
+	_, route, _ := net.ParseCIDR("172.20.0.0/16")
 
 	return []*Interface{
 		&Interface{
@@ -144,6 +251,7 @@ func getInterfaceList() []*Interface {
 			DstName:     "eth1",
 			Address:     netv4b,
 			AddressIPv6: netv6b,
+			Routes:      []*net.IPNet{route},
 		},
 	}
 }
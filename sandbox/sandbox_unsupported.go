@@ -13,3 +13,9 @@ var (
 func NewSandbox(key string) (Sandbox, error) {
 	return nil, ErrNotImplemented
 }
+
+// RestoreSandbox provides a sandbox instance for a previously created sandbox
+// identified by key
+func RestoreSandbox(key string, info *Info) (Sandbox, error) {
+	return nil, ErrNotImplemented
+}
@@ -0,0 +1,758 @@
+package libnetwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/sandbox"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// networkRecord is the persisted form of a network
+type networkRecord struct {
+	Name        string
+	ID          string
+	NetworkType string
+	EnableIPv6  bool
+	IpamType    string
+	Labels      map[string]string
+	Generic     map[string]interface{}
+}
+
+// endpointRecord is the persisted form of an endpoint
+type endpointRecord struct {
+	Name         string
+	ID           string
+	NetworkID    string
+	Interfaces   []interfaceRecord
+	JoinInfo     *joinInfoRecord
+	SandboxID    string
+	ExposedPorts []types.TransportPort
+	Aliases      []string
+	Labels       map[string]string
+	Generic      map[string]interface{}
+}
+
+type interfaceRecord struct {
+	ID          int
+	MacAddress  string
+	Address     string
+	AddressIPv6 string
+	SrcName     string
+	DstName     string
+}
+
+type joinInfoRecord struct {
+	Gateway        net.IP
+	GatewayIPv6    net.IP
+	HostsPath      string
+	ResolvConfPath string
+	Priority       int
+	DNSOptions     []string
+	StaticRoutes   []*types.StaticRoute
+}
+
+// sandboxRecord is the persisted form of a sandbox
+type sandboxRecord struct {
+	ID                string
+	ContainerID       string
+	Key               string
+	Endpoints         []string
+	HostName          string
+	DomainName        string
+	HostsPath         string
+	ExtraHosts        []extraHostRecord
+	ParentUpdates     []parentUpdateRecord
+	ResolvConfPath    string
+	DNSList           []string
+	DNSSearchList     []string
+	UseEmbeddedDNS    bool
+	Generic           map[string]interface{}
+	UseDefaultSandbox bool
+}
+
+type extraHostRecord struct {
+	Name string
+	IP   string
+}
+
+type parentUpdateRecord struct {
+	EID  string
+	Name string
+	IP   string
+}
+
+func (n *network) Key() []string {
+	return []string{datastore.NetworkKeyPrefix, string(n.id)}
+}
+
+func (n *network) Value() ([]byte, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	return json.Marshal(&networkRecord{
+		Name:        n.name,
+		ID:          string(n.id),
+		NetworkType: n.networkType,
+		EnableIPv6:  n.enableIPv6,
+		IpamType:    n.ipamType,
+		Labels:      n.labels,
+		Generic:     n.generic,
+	})
+}
+
+func (n *network) SetValue(value []byte) error {
+	var nr networkRecord
+
+	if err := json.Unmarshal(value, &nr); err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	n.name = nr.Name
+	n.id = types.UUID(nr.ID)
+	n.networkType = nr.NetworkType
+	n.enableIPv6 = nr.EnableIPv6
+	n.ipamType = nr.IpamType
+	n.labels = nr.Labels
+	n.generic = restoreGeneric(nr.Generic)
+
+	return nil
+}
+
+func (ep *endpoint) Key() []string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return []string{datastore.EndpointKeyPrefix, string(ep.network.id), string(ep.id)}
+}
+
+func (ep *endpoint) Value() ([]byte, error) {
+	ep.Lock()
+	defer ep.Unlock()
+
+	er := &endpointRecord{
+		Name:         ep.name,
+		ID:           string(ep.id),
+		NetworkID:    string(ep.network.id),
+		ExposedPorts: ep.exposedPorts,
+		Aliases:      ep.aliases,
+		Labels:       ep.labels,
+		Generic:      ep.generic,
+	}
+
+	for _, i := range ep.iFaces {
+		ir := interfaceRecord{
+			ID:      i.id,
+			SrcName: i.srcName,
+			DstName: i.dstName,
+		}
+		if len(i.mac) != 0 {
+			ir.MacAddress = i.mac.String()
+		}
+		if len(i.addr.IP) != 0 {
+			ir.Address = i.addr.String()
+		}
+		if len(i.addrv6.IP) != 0 {
+			ir.AddressIPv6 = i.addrv6.String()
+		}
+		er.Interfaces = append(er.Interfaces, ir)
+	}
+
+	if ep.joinInfo != nil {
+		er.JoinInfo = &joinInfoRecord{
+			Gateway:        ep.joinInfo.gw,
+			GatewayIPv6:    ep.joinInfo.gw6,
+			HostsPath:      ep.joinInfo.hostsPath,
+			ResolvConfPath: ep.joinInfo.resolvConfPath,
+			Priority:       ep.joinInfo.priority,
+			DNSOptions:     ep.joinInfo.dnsOptions,
+			StaticRoutes:   ep.joinInfo.staticRoutes,
+		}
+	}
+
+	er.SandboxID = ep.sandboxID
+
+	return json.Marshal(er)
+}
+
+func (ep *endpoint) SetValue(value []byte) error {
+	var er endpointRecord
+
+	if err := json.Unmarshal(value, &er); err != nil {
+		return err
+	}
+
+	iFaces := make([]*endpointInterface, 0, len(er.Interfaces))
+	for _, ir := range er.Interfaces {
+		i := &endpointInterface{id: ir.ID, srcName: ir.SrcName, dstName: ir.DstName}
+		if ir.MacAddress != "" {
+			mac, err := net.ParseMAC(ir.MacAddress)
+			if err != nil {
+				return err
+			}
+			i.mac = mac
+		}
+		if ir.Address != "" {
+			addr, err := types.ParseCIDR(ir.Address)
+			if err != nil {
+				return err
+			}
+			i.addr = *addr
+		}
+		if ir.AddressIPv6 != "" {
+			addr, err := types.ParseCIDR(ir.AddressIPv6)
+			if err != nil {
+				return err
+			}
+			i.addrv6 = *addr
+		}
+		iFaces = append(iFaces, i)
+	}
+
+	generic, err := restoreEndpointGeneric(er.Generic)
+	if err != nil {
+		return err
+	}
+
+	ep.Lock()
+	defer ep.Unlock()
+
+	ep.name = er.Name
+	ep.id = types.UUID(er.ID)
+	ep.iFaces = iFaces
+	ep.exposedPorts = er.ExposedPorts
+	ep.aliases = er.Aliases
+	ep.labels = er.Labels
+	ep.generic = generic
+
+	if jr := er.JoinInfo; jr != nil {
+		ep.joinInfo = &endpointJoinInfo{
+			gw:             jr.Gateway,
+			gw6:            jr.GatewayIPv6,
+			hostsPath:      jr.HostsPath,
+			resolvConfPath: jr.ResolvConfPath,
+			priority:       jr.Priority,
+			dnsOptions:     jr.DNSOptions,
+			staticRoutes:   jr.StaticRoutes,
+		}
+	}
+
+	ep.sandboxID = er.SandboxID
+
+	return nil
+}
+
+// sandboxKV is the datastore.KV view of a sandbox, whose Key method is taken
+// by the Sandbox interface.
+type sandboxKV containerSandbox
+
+func (sb *containerSandbox) kv() *sandboxKV {
+	return (*sandboxKV)(sb)
+}
+
+func (sb *sandboxKV) Key() []string {
+	return []string{datastore.SandboxKeyPrefix, sb.id}
+}
+
+func (sb *sandboxKV) Value() ([]byte, error) {
+	sb.Lock()
+	defer sb.Unlock()
+
+	sr := &sandboxRecord{
+		ID:                sb.id,
+		ContainerID:       sb.containerID,
+		Key:               sb.key,
+		HostName:          sb.config.hostName,
+		DomainName:        sb.config.domainName,
+		HostsPath:         sb.config.hostsPath,
+		ResolvConfPath:    sb.config.resolvConfPath,
+		DNSList:           sb.config.dnsList,
+		DNSSearchList:     sb.config.dnsSearchList,
+		UseEmbeddedDNS:    sb.config.useEmbeddedDNS,
+		Generic:           sb.config.generic,
+		UseDefaultSandbox: sb.config.useDefaultSandBox,
+	}
+	for _, ep := range sb.endpoints {
+		sr.Endpoints = append(sr.Endpoints, string(ep.id))
+	}
+	for _, eh := range sb.config.extraHosts {
+		sr.ExtraHosts = append(sr.ExtraHosts, extraHostRecord{Name: eh.name, IP: eh.IP})
+	}
+	for _, pu := range sb.config.parentUpdates {
+		sr.ParentUpdates = append(sr.ParentUpdates, parentUpdateRecord{EID: pu.eid, Name: pu.name, IP: pu.ip})
+	}
+
+	return json.Marshal(sr)
+}
+
+func (sb *sandboxKV) SetValue(value []byte) error {
+	var sr sandboxRecord
+
+	if err := json.Unmarshal(value, &sr); err != nil {
+		return err
+	}
+
+	(*containerSandbox)(sb).setRecord(&sr)
+
+	return nil
+}
+
+// setRecord restores the sandbox from its record. The joined endpoints are
+// not restored, the caller resolves them from the record.
+func (sb *containerSandbox) setRecord(sr *sandboxRecord) {
+	sb.Lock()
+	defer sb.Unlock()
+
+	sb.id = sr.ID
+	sb.containerID = sr.ContainerID
+	sb.key = sr.Key
+	sb.config = containerConfig{
+		hostsPathConfig: hostsPathConfig{
+			hostName:      sr.HostName,
+			domainName:    sr.DomainName,
+			hostsPath:     sr.HostsPath,
+			extraHosts:    []extraHost{},
+			parentUpdates: []parentUpdate{},
+		},
+		resolvConfPathConfig: resolvConfPathConfig{
+			resolvConfPath: sr.ResolvConfPath,
+			dnsList:        sr.DNSList,
+			dnsSearchList:  sr.DNSSearchList,
+			useEmbeddedDNS: sr.UseEmbeddedDNS,
+		},
+		generic:           restoreGeneric(sr.Generic),
+		useDefaultSandBox: sr.UseDefaultSandbox,
+	}
+	for _, eh := range sr.ExtraHosts {
+		sb.config.extraHosts = append(sb.config.extraHosts, extraHost{name: eh.Name, IP: eh.IP})
+	}
+	for _, pu := range sr.ParentUpdates {
+		sb.config.parentUpdates = append(sb.config.parentUpdates, parentUpdate{eid: pu.EID, name: pu.Name, ip: pu.IP})
+	}
+}
+
+// restoreGeneric converts the driver opaque data of a decoded generic map
+// back to options.Generic, which drivers decode through GenerateFromModel.
+func restoreGeneric(generic map[string]interface{}) map[string]interface{} {
+	if generic == nil {
+		return nil
+	}
+
+	if data, ok := generic[netlabel.GenericData].(map[string]interface{}); ok {
+		generic[netlabel.GenericData] = options.Generic(data)
+	}
+
+	if data, ok := generic[netlabel.Labels].(map[string]interface{}); ok {
+		labels := make(map[string]string, len(data))
+		for k, v := range data {
+			if s, ok := v.(string); ok {
+				labels[k] = s
+			}
+		}
+		generic[netlabel.Labels] = labels
+	}
+
+	return generic
+}
+
+// restoreEndpointGeneric restores the well known endpoint labels to the
+// types libnetwork set them with.
+func restoreEndpointGeneric(generic map[string]interface{}) (map[string]interface{}, error) {
+	generic = restoreGeneric(generic)
+	if generic == nil {
+		return make(map[string]interface{}), nil
+	}
+
+	labels := map[string]interface{}{
+		netlabel.PortMap:      &[]types.PortBinding{},
+		netlabel.ExposedPorts: &[]types.TransportPort{},
+		netlabel.MacAddress:   &net.HardwareAddr{},
+	}
+
+	for label, ptr := range labels {
+		v, ok := generic[label]
+		if !ok || v == nil {
+			continue
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, ptr); err != nil {
+			return nil, fmt.Errorf("failed to restore endpoint label %s: %v", label, err)
+		}
+
+		switch t := ptr.(type) {
+		case *[]types.PortBinding:
+			generic[label] = *t
+		case *[]types.TransportPort:
+			generic[label] = *t
+		case *net.HardwareAddr:
+			generic[label] = *t
+		}
+	}
+
+	return generic, nil
+}
+
+func (c *controller) updateToStore(kvObject datastore.KV) error {
+	c.Lock()
+	store := c.store
+	c.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	return store.PutObject(kvObject)
+}
+
+func (c *controller) deleteFromStore(kvObject datastore.KV) error {
+	c.Lock()
+	store := c.store
+	c.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	if err := store.DeleteObject(kvObject); err != nil && err != datastore.ErrKeyNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// restoreFromStore reloads the networks, endpoints and sandboxes persisted by
+// a previous instance of the controller and reconciles them with the drivers.
+// Objects which cannot be reconciled are logged and skipped.
+func (c *controller) restoreFromStore() error {
+	nValues, err := c.store.List(datastore.NetworkKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	var joined, dropped []*endpoint
+	for _, value := range nValues {
+		n := &network{ctrlr: c, endpoints: endpointTable{}}
+		if err := n.SetValue(value); err != nil {
+			log.Warnf("Failed to decode a persisted network: %v", err)
+			continue
+		}
+
+		eps, drops, err := c.restoreNetwork(n)
+		if err != nil {
+			log.Warnf("Failed to restore network %s (%s): %v", n.name, n.id, err)
+			continue
+		}
+		joined = append(joined, eps...)
+		dropped = append(dropped, drops...)
+	}
+
+	return c.restoreSandboxes(joined, dropped)
+}
+
+// restoreNetwork recreates the network and its endpoints in the driver and
+// returns the endpoints which had a sandbox joined, along with the ones the
+// driver cannot restore, which are deleted from the store.
+func (c *controller) restoreNetwork(n *network) ([]*endpoint, []*endpoint, error) {
+	c.Lock()
+	dd, ok := c.drivers[n.networkType]
+	c.Unlock()
+	if !ok {
+		var err error
+		if dd, err = c.loadDriver(n.networkType); err != nil {
+			return nil, nil, err
+		}
+	}
+	n.driver = dd.driver
+
+	if err := n.driver.CreateNetwork(n.id, n.generic); err != nil {
+		return nil, nil, err
+	}
+
+	c.Lock()
+	c.networks[n.id] = n
+	c.Unlock()
+
+	eValues, err := c.store.List(datastore.EndpointKeyPrefix, string(n.id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var joined, dropped []*endpoint
+	for _, value := range eValues {
+		ep := &endpoint{network: n}
+		if err := ep.SetValue(value); err != nil {
+			log.Warnf("Failed to decode a persisted endpoint on network %s: %v", n.name, err)
+			continue
+		}
+
+		// The persisted interfaces are passed to the driver, which must
+		// take them over instead of allocating new ones.
+		if err := n.driver.CreateEndpoint(n.id, ep.id, ep, ep.generic); err != nil {
+			if _, ok := err.(driverapi.ErrNotRestorable); ok {
+				log.Warnf("Dropping endpoint %s (%s) which the %s driver cannot restore", ep.name, ep.id, n.networkType)
+				if err := c.deleteFromStore(ep); err != nil {
+					log.Warnf("Failed to delete endpoint %s from the store: %v", ep.name, err)
+				}
+				dropped = append(dropped, ep)
+				continue
+			}
+			log.Warnf("Failed to restore endpoint %s (%s): %v", ep.name, ep.id, err)
+			continue
+		}
+
+		n.Lock()
+		n.endpoints[ep.id] = ep
+		n.Unlock()
+
+		if ep.sandboxID != "" {
+			joined = append(joined, ep)
+		}
+	}
+
+	return joined, dropped, nil
+}
+
+// restoreSandboxes reloads the persisted sandboxes and reattaches the joined
+// endpoints to them. The network namespaces are expected to have survived the
+// restart and are not reprogrammed; the drivers rebuild their join state.
+// Endpoints whose join cannot be restored are detached, and the interfaces
+// of the dropped endpoints are deleted from their sandboxes.
+func (c *controller) restoreSandboxes(joined, dropped []*endpoint) error {
+	sValues, err := c.store.List(datastore.SandboxKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[types.UUID]*endpoint, len(joined))
+	for _, ep := range joined {
+		pending[ep.id] = ep
+	}
+	drops := make(map[types.UUID]*endpoint, len(dropped))
+	for _, ep := range dropped {
+		drops[ep.id] = ep
+	}
+	// stale holds the interfaces of the dropped endpoints by sandbox id
+	stale := make(map[string][]*sandbox.Interface)
+
+	var sboxes []*containerSandbox
+	infos := make(map[string]*sandbox.Info)
+	for _, value := range sValues {
+		var sr sandboxRecord
+		if err := json.Unmarshal(value, &sr); err != nil {
+			log.Warnf("Failed to decode a persisted sandbox: %v", err)
+			continue
+		}
+
+		sb := &containerSandbox{controller: c}
+		sb.setRecord(&sr)
+
+		info, ok := infos[sb.key]
+		if !ok {
+			info = &sandbox.Info{Interfaces: []*sandbox.Interface{}}
+			infos[sb.key] = info
+		}
+
+		for _, id := range sr.Endpoints {
+			if ep, ok := drops[types.UUID(id)]; ok && ep.sandboxID == sb.id {
+				ep.Lock()
+				for _, i := range ep.iFaces {
+					stale[sb.id] = append(stale[sb.id], &sandbox.Interface{SrcName: i.srcName, DstName: i.dstName})
+				}
+				ep.Unlock()
+				continue
+			}
+
+			ep, ok := pending[types.UUID(id)]
+			if !ok || ep.sandboxID != sb.id {
+				log.Warnf("Endpoint %s joined to sandbox %s was not restored", id, sb.id)
+				continue
+			}
+			delete(pending, ep.id)
+
+			ep.Lock()
+			if ep.joinInfo == nil {
+				ep.joinInfo = &endpointJoinInfo{}
+			}
+			for _, i := range ep.iFaces {
+				iface := &sandbox.Interface{
+					SrcName: i.srcName,
+					DstName: i.dstName,
+					Address: types.GetIPNetCopy(&i.addr),
+				}
+				if i.addrv6.IP.To16() != nil {
+					iface.AddressIPv6 = types.GetIPNetCopy(&i.addrv6)
+				}
+				for _, r := range ep.joinInfo.staticRoutes {
+					if r.RouteType == types.CONNECTED && r.InterfaceID == i.id {
+						iface.Routes = append(iface.Routes, r.Destination)
+					}
+				}
+				info.Interfaces = append(info.Interfaces, iface)
+			}
+			for _, r := range ep.joinInfo.staticRoutes {
+				if r.RouteType == types.NEXTHOP {
+					info.StaticRoutes = append(info.StaticRoutes, r)
+				}
+			}
+			ep.Unlock()
+
+			sb.endpoints = append(sb.endpoints, ep)
+		}
+
+		if gwEp := sb.gatewayEndpoint(); gwEp != nil {
+			sb.gwEndpoint = gwEp
+			info.Gateway = gwEp.joinInfo.gw
+			info.GatewayIPv6 = gwEp.joinInfo.gw6
+		}
+
+		sboxes = append(sboxes, sb)
+	}
+
+	// The endpoints left have no persisted sandbox to rejoin
+	for _, ep := range pending {
+		log.Warnf("Sandbox of endpoint %s (%s) was not restored", ep.name, ep.id)
+		c.detachEndpoint(ep)
+	}
+
+	for key, info := range infos {
+		osSbox, err := sandbox.RestoreSandbox(key, info)
+		if err != nil {
+			log.Warnf("Failed to restore sandbox %s: %v", key, err)
+			continue
+		}
+
+		c.Lock()
+		c.sandboxes[key] = &sandboxData{sandbox: osSbox}
+		c.Unlock()
+	}
+
+	for _, sb := range sboxes {
+		c.Lock()
+		sData, ok := c.sandboxes[sb.key]
+		if ok {
+			sData.refCnt++
+		}
+		c.Unlock()
+
+		if !ok {
+			for _, ep := range sb.endpoints {
+				c.detachEndpoint(ep)
+			}
+			if err := c.deleteFromStore(sb.kv()); err != nil {
+				log.Warnf("Failed to delete sandbox %s from the store: %v", sb.id, err)
+			}
+			continue
+		}
+		sb.osSbox = sData.sandbox
+
+		for _, iface := range stale[sb.id] {
+			removeStaleInterface(sb.osSbox, iface)
+		}
+
+		var restored []*endpoint
+		for _, ep := range sb.endpoints {
+			if err := c.restoreJoin(sb, ep); err != nil {
+				log.Warnf("Failed to restore the join of endpoint %s (%s): %v", ep.name, ep.id, err)
+				c.detachEndpoint(ep)
+				if sb.gwEndpoint == ep {
+					sb.gwEndpoint = nil
+				}
+				continue
+			}
+			restored = append(restored, ep)
+		}
+
+		changed := len(restored) != len(sb.endpoints) || len(stale[sb.id]) != 0
+		sb.endpoints = restored
+
+		// The resolver of the previous process is gone with it
+		sb.newResolver()
+		if sb.resolver != nil {
+			if err := sb.setupDNS(); err != nil {
+				log.Warnf("Failed to set up the DNS of sandbox %s: %v", sb.id, err)
+			}
+			if err := sb.startResolver(); err != nil {
+				log.Warnf("Failed to start the DNS resolver of sandbox %s: %v", sb.id, err)
+				sb.resolver = nil
+			}
+		}
+
+		c.Lock()
+		c.containerSandboxes[sb.id] = sb
+		c.Unlock()
+
+		if changed {
+			if err := c.updateToStore(sb.kv()); err != nil {
+				log.Warnf("Failed to update sandbox %s in the store: %v", sb.id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeStaleInterface takes the interface of a dropped endpoint out of the
+// sandbox and deletes it. The interface may already be gone along with the
+// resources of the driver it was connected to.
+func removeStaleInterface(osSbox sandbox.Sandbox, iface *sandbox.Interface) {
+	if err := osSbox.RemoveInterface(iface); err != nil {
+		log.Debugf("Failed to remove interface %s of a dropped endpoint: %v", iface.DstName, err)
+		return
+	}
+
+	if link, err := netlink.LinkByName(iface.SrcName); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			log.Warnf("Failed to delete interface %s of a dropped endpoint: %v", iface.SrcName, err)
+		}
+	}
+}
+
+func (c *controller) restoreJoin(sb *containerSandbox, ep *endpoint) error {
+	ep.Lock()
+	n := ep.network
+	names := make([][2]string, len(ep.iFaces))
+	for i, iface := range ep.iFaces {
+		names[i] = [2]string{iface.srcName, iface.dstName}
+	}
+	ep.Unlock()
+
+	if err := n.driver.Join(n.id, ep.id, sb.key, ep, sb.config.generic); err != nil {
+		return err
+	}
+
+	// The names in use inside the sandbox are the ones assigned by the
+	// driver and the sandbox at the original join
+	ep.Lock()
+	for i, iface := range ep.iFaces {
+		iface.srcName, iface.dstName = names[i][0], names[i][1]
+	}
+	ep.Unlock()
+
+	return nil
+}
+
+// detachEndpoint marks the endpoint as not joined to any sandbox.
+func (c *controller) detachEndpoint(ep *endpoint) {
+	ep.Lock()
+	ep.sandboxID = ""
+	ep.joinInfo = nil
+	ep.Unlock()
+
+	if err := c.updateToStore(ep); err != nil {
+		log.Warnf("Failed to update endpoint %s in the store: %v", ep.name, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -22,13 +23,39 @@ func (t *TransportPort) GetCopy() TransportPort {
 	return TransportPort{Proto: t.Proto, Port: t.Port}
 }
 
-// PortBinding represent a port binding between the container an the host
+// PortBinding represent a port binding between the container an the host.
+// A binding with a PortEnd maps the range of container ports from Port to
+// PortEnd to the range of host ports of the same size from HostPort to
+// HostPortEnd.
 type PortBinding struct {
-	Proto    Protocol
-	IP       net.IP
-	Port     uint16
-	HostIP   net.IP
-	HostPort uint16
+	Proto       Protocol
+	IP          net.IP
+	Port        uint16
+	HostIP      net.IP
+	HostPort    uint16
+	PortEnd     uint16
+	HostPortEnd uint16
+}
+
+// PortCount returns the number of ports of the binding, more than one for
+// the binding of a range of ports
+func (p PortBinding) PortCount() int {
+	if p.PortEnd <= p.Port {
+		return 1
+	}
+	return int(p.PortEnd-p.Port) + 1
+}
+
+// Validate checks the port ranges of the binding. The host range, when
+// specified, must be of the size of the container range.
+func (p PortBinding) Validate() error {
+	if p.PortEnd != 0 && p.PortEnd < p.Port {
+		return ErrInvalidPortRange(fmt.Sprintf("container ports %d-%d", p.Port, p.PortEnd))
+	}
+	if p.HostPortEnd != 0 && (p.HostPort == 0 || int(p.HostPortEnd)-int(p.HostPort)+1 != p.PortCount()) {
+		return ErrInvalidPortRange(fmt.Sprintf("host ports %d-%d for %d container ports", p.HostPort, p.HostPortEnd, p.PortCount()))
+	}
+	return nil
 }
 
 // HostAddr returns the host side transport address
@@ -38,6 +65,8 @@ func (p PortBinding) HostAddr() (net.Addr, error) {
 		return &net.UDPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
 	case TCP:
 		return &net.TCPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
+	case SCTP:
+		return &SCTPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
 	default:
 		return nil, ErrInvalidProtocolBinding(p.Proto.String())
 	}
@@ -50,6 +79,8 @@ func (p PortBinding) ContainerAddr() (net.Addr, error) {
 		return &net.UDPAddr{IP: p.IP, Port: int(p.Port)}, nil
 	case TCP:
 		return &net.TCPAddr{IP: p.IP, Port: int(p.Port)}, nil
+	case SCTP:
+		return &SCTPAddr{IP: p.IP, Port: int(p.Port)}, nil
 	default:
 		return nil, ErrInvalidProtocolBinding(p.Proto.String())
 	}
@@ -58,11 +89,13 @@ func (p PortBinding) ContainerAddr() (net.Addr, error) {
 // GetCopy returns a copy of this PortBinding structure instance
 func (p *PortBinding) GetCopy() PortBinding {
 	return PortBinding{
-		Proto:    p.Proto,
-		IP:       GetIPCopy(p.IP),
-		Port:     p.Port,
-		HostIP:   GetIPCopy(p.HostIP),
-		HostPort: p.HostPort,
+		Proto:       p.Proto,
+		IP:          GetIPCopy(p.IP),
+		Port:        p.Port,
+		HostIP:      GetIPCopy(p.HostIP),
+		HostPort:    p.HostPort,
+		PortEnd:     p.PortEnd,
+		HostPortEnd: p.HostPortEnd,
 	}
 }
 
@@ -80,6 +113,10 @@ func (p *PortBinding) Equal(o *PortBinding) bool {
 		return false
 	}
 
+	if p.PortEnd != o.PortEnd || p.HostPortEnd != o.HostPortEnd {
+		return false
+	}
+
 	if p.IP != nil {
 		if !p.IP.Equal(o.IP) {
 			return false
@@ -110,6 +147,16 @@ func (ipb ErrInvalidProtocolBinding) Error() string {
 	return fmt.Sprintf("invalid transport protocol: %s", string(ipb))
 }
 
+// ErrInvalidPortRange is returned when the port ranges of the binding are not valid.
+type ErrInvalidPortRange string
+
+func (ipr ErrInvalidPortRange) Error() string {
+	return fmt.Sprintf("invalid port range: %s", string(ipr))
+}
+
+// BadRequest denotes the type of this error
+func (ipr ErrInvalidPortRange) BadRequest() {}
+
 const (
 	// ICMP is for the ICMP ip protocol
 	ICMP = 1
@@ -117,6 +164,8 @@ const (
 	TCP = 6
 	// UDP is for the UDP ip protocol
 	UDP = 17
+	// SCTP is for the SCTP ip protocol
+	SCTP = 132
 )
 
 // Protocol represents a IP protocol number
@@ -130,6 +179,8 @@ func (p Protocol) String() string {
 		return "tcp"
 	case UDP:
 		return "udp"
+	case SCTP:
+		return "sctp"
 	default:
 		return fmt.Sprintf("%d", p)
 	}
@@ -144,11 +195,32 @@ func ParseProtocol(s string) Protocol {
 		return UDP
 	case "tcp":
 		return TCP
+	case "sctp":
+		return SCTP
 	default:
 		return 0
 	}
 }
 
+// SCTPAddr represents the address of an SCTP end point, which the net
+// package has no type for
+type SCTPAddr struct {
+	IP   net.IP
+	Port int
+}
+
+// Network returns the address's network name, "sctp"
+func (a *SCTPAddr) Network() string {
+	return "sctp"
+}
+
+func (a *SCTPAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+}
+
 // GetMacCopy returns a copy of the passed MAC address
 func GetMacCopy(from net.HardwareAddr) net.HardwareAddr {
 	to := make(net.HardwareAddr, len(from))
@@ -184,6 +256,66 @@ func CompareIPNet(a, b *net.IPNet) bool {
 	return a.IP.Equal(b.IP) && bytes.Equal(a.Mask, b.Mask)
 }
 
+// ParseCIDR returns the IP Network for the passed address in CIDR notation.
+// Unlike net.ParseCIDR, the host part of the address is preserved.
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ipNet.IP = ip
+	return ipNet, nil
+}
+
+const (
+	// NEXTHOP indicates a StaticRoute with an IP next hop
+	NEXTHOP = iota
+	// CONNECTED indicates a StaticRoute reachable on-link through an interface
+	CONNECTED
+)
+
+// StaticRoute is a route a driver requests to be programmed in the sandbox
+// of the containers joining its endpoints.
+type StaticRoute struct {
+	Destination *net.IPNet
+
+	// RouteType is either NEXTHOP or CONNECTED
+	RouteType int
+
+	// NextHop is the address the NEXTHOP routes go through
+	NextHop net.IP
+
+	// InterfaceID is the id, within the endpoint, of the interface the
+	// CONNECTED routes go through
+	InterfaceID int
+}
+
+// GetCopy returns a copy of this StaticRoute structure
+func (r *StaticRoute) GetCopy() *StaticRoute {
+	return &StaticRoute{
+		Destination: GetIPNetCopy(r.Destination),
+		RouteType:   r.RouteType,
+		NextHop:     GetIPCopy(r.NextHop),
+		InterfaceID: r.InterfaceID,
+	}
+}
+
+// Equal checks if this instance of StaticRoute is equal to the passed one
+func (r *StaticRoute) Equal(o *StaticRoute) bool {
+	if r == o {
+		return true
+	}
+
+	if o == nil {
+		return false
+	}
+
+	return r.RouteType == o.RouteType &&
+		r.InterfaceID == o.InterfaceID &&
+		r.NextHop.Equal(o.NextHop) &&
+		CompareIPNet(r.Destination, o.Destination)
+}
+
 /******************************
  * Well-known Error Interfaces
  ******************************/
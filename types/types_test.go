@@ -1,6 +1,7 @@
 package types
 
 import (
+	"net"
 	"testing"
 
 	_ "github.com/docker/libnetwork/netutils"
@@ -97,3 +98,66 @@ func TestErrorConstructors(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPortBindingRange(t *testing.T) {
+	for _, c := range []struct {
+		binding PortBinding
+		count   int
+		valid   bool
+	}{
+		{PortBinding{Proto: TCP, Port: 80, HostPort: 8080}, 1, true},
+		{PortBinding{Proto: TCP, Port: 80, PortEnd: 80, HostPort: 8080, HostPortEnd: 8080}, 1, true},
+		{PortBinding{Proto: UDP, Port: 10000, PortEnd: 10999}, 1000, true},
+		{PortBinding{Proto: UDP, Port: 10000, PortEnd: 10999, HostPort: 20000, HostPortEnd: 20999}, 1000, true},
+		{PortBinding{Proto: UDP, Port: 10000, PortEnd: 10999, HostPort: 20000, HostPortEnd: 20099}, 1000, false},
+		{PortBinding{Proto: UDP, Port: 10000, PortEnd: 10999, HostPortEnd: 20099}, 1000, false},
+		{PortBinding{Proto: TCP, Port: 80, PortEnd: 79}, 1, false},
+	} {
+		if n := c.binding.PortCount(); n != c.count {
+			t.Fatalf("Unexpected port count %d for %v", n, c.binding)
+		}
+		err := c.binding.Validate()
+		if c.valid && err != nil {
+			t.Fatalf("Unexpected validation error for %v: %v", c.binding, err)
+		}
+		if !c.valid {
+			if _, ok := err.(BadRequestError); !ok {
+				t.Fatalf("Failed to detect the invalid range of %v: %v", c.binding, err)
+			}
+		}
+	}
+
+	b := PortBinding{Proto: UDP, IP: net.ParseIP("172.17.0.2"), Port: 10000, PortEnd: 10999, HostIP: net.IPv4zero, HostPort: 20000, HostPortEnd: 20999}
+	c := b.GetCopy()
+	if !b.Equal(&c) {
+		t.Fatalf("Copy of %v differs: %v", b, c)
+	}
+	c.HostPortEnd = 20998
+	if b.Equal(&c) {
+		t.Fatalf("Failed to detect the different host range of %v", c)
+	}
+}
+
+func TestSCTPPortBinding(t *testing.T) {
+	if p := ParseProtocol("SCTP"); p != SCTP || p.String() != "sctp" {
+		t.Fatalf("Unexpected SCTP protocol %v", p)
+	}
+
+	b := PortBinding{Proto: SCTP, IP: net.ParseIP("172.17.0.2"), Port: 3868, HostIP: net.ParseIP("2001:db8::1"), HostPort: 3868}
+
+	host, err := b.HostAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := host.(*SCTPAddr); !ok || host.Network() != "sctp" || a.String() != "[2001:db8::1]:3868" {
+		t.Fatalf("Unexpected host address %#v", host)
+	}
+
+	container, err := b.ContainerAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := container.(*SCTPAddr); !ok || container.String() != "172.17.0.2:3868" {
+		t.Fatalf("Unexpected container address %#v", container)
+	}
+}